@@ -8,9 +8,11 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/sfn"
 	"github.com/draftea-coding-challenge/lambdas/invoice-processor/internal/handler"
 	"github.com/draftea-coding-challenge/lambdas/invoice-processor/internal/repository"
 	"github.com/draftea-coding-challenge/lambdas/invoice-processor/internal/service"
+	"github.com/draftea-coding-challenge/shared/idempotency"
 	"github.com/draftea-coding-challenge/shared/observability"
 )
 
@@ -40,14 +42,33 @@ func main() {
 	// Initialize repository
 	paymentsTable := getEnv("PAYMENTS_TABLE", "Payments")
 	eventsTable := getEnv("PAYMENT_EVENTS_TABLE", "PaymentEvents")
+	ledgerTable := getEnv("LEDGER_TABLE", "Ledger")
+	schedulesTable := getEnv("PAYMENT_SCHEDULES_TABLE", "PaymentSchedules")
+	runsTable := getEnv("PAYMENT_SCHEDULE_RUNS_TABLE", "PaymentScheduleRuns")
+	invoicesTable := getEnv("INVOICES_TABLE", "Invoices")
+	invoiceCountersTable := getEnv("INVOICE_COUNTERS_TABLE", "InvoiceCounters")
 
-	repo := repository.NewPaymentRepository(dynamoClient, paymentsTable, eventsTable)
+	repo := repository.NewPaymentRepository(dynamoClient, paymentsTable, eventsTable, ledgerTable, schedulesTable, runsTable, invoicesTable, invoiceCountersTable)
+
+	// Step Functions client the scheduler starts payment sagas with
+	sfnConfig := &aws.Config{}
+	if endpoint := os.Getenv("STEPFUNCTIONS_ENDPOINT"); endpoint != "" {
+		sfnConfig.Endpoint = aws.String(endpoint)
+	}
+	stateMachineArn := getEnv("STATE_MACHINE_ARN", "arn:aws:states:us-east-1:000000000000:stateMachine:PaymentProcessingStateMachine")
+	saga := repository.NewSagaClient(sfn.New(sess, sfnConfig), stateMachineArn)
+
+	// Idempotency keys of payments and of the mutating endpoints
+	idempotencyStore := idempotency.NewStore(dynamoClient, getEnv("IDEMPOTENCY_TABLE", "Idempotency"))
 
 	// Initialize service
-	paymentService := service.NewPaymentService(repo, logger)
+	paymentService := service.NewPaymentService(repo, logger).
+		WithSagaClient(saga).
+		WithIdempotencyStore(idempotencyStore)
 
 	// Initialize handler
-	h := handler.NewInvoiceHandler(paymentService, logger)
+	h := handler.NewInvoiceHandler(paymentService, logger).
+		WithIdempotency(idempotency.NewMiddleware(idempotencyStore, logger))
 
 	// Start Lambda handler
 	lambda.Start(h.HandleRequest)
@@ -2,19 +2,26 @@ package handler
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/draftea-coding-challenge/lambdas/invoice-processor/internal/service"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/idempotency"
 	"github.com/draftea-coding-challenge/shared/observability"
 	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/draftea-coding-challenge/shared/utils"
 )
 
 type InvoiceHandler struct {
-	service *service.PaymentService
-	logger  *observability.Logger
+	service     *service.PaymentService
+	idempotency *idempotency.Middleware
+	logger      *observability.Logger
 }
 
 func NewInvoiceHandler(service *service.PaymentService, logger *observability.Logger) *InvoiceHandler {
@@ -24,6 +31,13 @@ func NewInvoiceHandler(service *service.PaymentService, logger *observability.Lo
 	}
 }
 
+// WithIdempotency makes POST /payment idempotent for requests carrying an
+// Idempotency-Key header
+func (h *InvoiceHandler) WithIdempotency(middleware *idempotency.Middleware) *InvoiceHandler {
+	h.idempotency = middleware
+	return h
+}
+
 // HandleRequest processes incoming requests
 func (h *InvoiceHandler) HandleRequest(ctx context.Context, request interface{}) (interface{}, error) {
 	// Check if this is an API Gateway request
@@ -37,7 +51,25 @@ func (h *InvoiceHandler) HandleRequest(ctx context.Context, request interface{})
 		case apiReq.HTTPMethod == "GET" && apiReq.Path == "/health":
 			return h.handleHealth()
 		case apiReq.HTTPMethod == "POST" && apiReq.Path == "/payment":
-			return h.handleCreatePayment(ctx, apiReq)
+			return h.idempotency.Wrap(h.handleCreatePayment)(ctx, apiReq)
+		case apiReq.HTTPMethod == "GET" && apiReq.Path == "/payment":
+			return h.handleListPayments(ctx, apiReq)
+		case apiReq.HTTPMethod == "POST" && apiReq.Path == "/payment-schedule":
+			return h.handleCreateSchedule(ctx, apiReq)
+		case strings.HasPrefix(apiReq.Path, "/payment-schedule/"):
+			return h.handleSchedule(ctx, apiReq)
+		case apiReq.HTTPMethod == "POST" && apiReq.Path == "/invoice":
+			return h.idempotency.Wrap(h.handleCreateInvoice)(ctx, apiReq)
+		case apiReq.HTTPMethod == "GET" && apiReq.Path == "/invoice":
+			return h.handleListInvoices(ctx, apiReq)
+		case strings.HasPrefix(apiReq.Path, "/invoice/"):
+			return h.handleInvoice(ctx, apiReq)
+		case apiReq.HTTPMethod == "POST" && strings.HasPrefix(apiReq.Path, "/payment/") && strings.HasSuffix(apiReq.Path, "/cancel"):
+			return h.handleCancelPayment(ctx, apiReq)
+		case apiReq.HTTPMethod == "GET" && strings.HasPrefix(apiReq.Path, "/payment/") && strings.HasSuffix(apiReq.Path, "/events"):
+			return h.handleGetPaymentTimeline(ctx, apiReq)
+		case apiReq.HTTPMethod == "GET" && strings.HasPrefix(apiReq.Path, "/payment/") && strings.HasSuffix(apiReq.Path, "/receipt"):
+			return h.handleGetReceipt(ctx, apiReq)
 		case apiReq.HTTPMethod == "GET" && strings.HasPrefix(apiReq.Path, "/payment/"):
 			return h.handleGetPayment(ctx, apiReq)
 		case apiReq.HTTPMethod == "PUT" && strings.HasPrefix(apiReq.Path, "/payment/"):
@@ -92,12 +124,24 @@ func (h *InvoiceHandler) HandleRequest(ctx context.Context, request interface{})
 		if body, ok := input["body"].(string); ok {
 			apiReq.Body = body
 		}
+		if headers, ok := input["headers"].(map[string]interface{}); ok {
+			apiReq.Headers = make(map[string]string, len(headers))
+			for k, v := range headers {
+				apiReq.Headers[k] = fmt.Sprintf("%v", v)
+			}
+		}
 		if pathParams, ok := input["pathParameters"].(map[string]interface{}); ok {
 			apiReq.PathParameters = make(map[string]string)
 			for k, v := range pathParams {
 				apiReq.PathParameters[k] = fmt.Sprintf("%v", v)
 			}
 		}
+		if queryParams, ok := input["queryStringParameters"].(map[string]interface{}); ok {
+			apiReq.QueryStringParameters = make(map[string]string, len(queryParams))
+			for k, v := range queryParams {
+				apiReq.QueryStringParameters[k] = fmt.Sprintf("%v", v)
+			}
+		}
 		return h.HandleRequest(ctx, apiReq)
 	}
 
@@ -126,10 +170,14 @@ func (h *InvoiceHandler) handleCreatePayment(ctx context.Context, request events
 	paymentResp, err := h.service.CreatePayment(ctx, service.CreatePaymentRequest{
 		UserID:   payment.UserID,
 		Amount:   payment.Amount,
-		Currency: payment.Currency,
 		Metadata: payment.Metadata,
 	})
 	if err != nil {
+		// A payment against an invoice that cannot take it is the caller's error
+		var appErr *apperrors.AppError
+		if errors.As(err, &appErr) && appErr.StatusCode < 500 {
+			return utils.AppErrorResponse(appErr)
+		}
 		return events.APIGatewayProxyResponse{
 			StatusCode: 500,
 			Body:       fmt.Sprintf(`{"error":"%s"}`, err.Error()),
@@ -167,6 +215,90 @@ func (h *InvoiceHandler) handleGetPayment(ctx context.Context, request events.AP
 	}, nil
 }
 
+// handleGetPaymentTimeline serves GET /payment/{id}/events
+func (h *InvoiceHandler) handleGetPaymentTimeline(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	paymentID := strings.TrimSuffix(strings.TrimPrefix(request.Path, "/payment/"), "/events")
+	if paymentID == "" || strings.Contains(paymentID, "/") {
+		return utils.ErrorResponse(400, "payment ID required")
+	}
+
+	timeline, err := h.service.GetPaymentTimeline(ctx, paymentID)
+	if err != nil {
+		return errorResponse(err, "failed to get payment events")
+	}
+
+	return utils.SuccessResponse(200, timeline)
+}
+
+// handleGetReceipt serves GET /payment/{id}/receipt?format=&locale=&version=,
+// returning the document itself. PDF bodies are base64 encoded for API Gateway.
+func (h *InvoiceHandler) handleGetReceipt(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	params := request.QueryStringParameters
+	req := service.ReceiptRequest{
+		PaymentID: strings.TrimSuffix(strings.TrimPrefix(request.Path, "/payment/"), "/receipt"),
+		Format:    params["format"],
+		Locale:    params["locale"],
+		Version:   params["version"],
+	}
+	if req.PaymentID == "" || strings.Contains(req.PaymentID, "/") {
+		return utils.ErrorResponse(400, "payment ID required")
+	}
+
+	document, err := h.service.GetReceipt(ctx, req)
+	if err != nil {
+		return errorResponse(err, "failed to render receipt")
+	}
+
+	response := events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       string(document.Body),
+		Headers: map[string]string{
+			"Content-Type":        document.ContentType,
+			"Content-Disposition": fmt.Sprintf("attachment; filename=%q", document.Filename),
+		},
+	}
+	if document.ContentType == "application/pdf" {
+		response.Body = base64.StdEncoding.EncodeToString(document.Body)
+		response.IsBase64Encoded = true
+	}
+	return response, nil
+}
+
+func (h *InvoiceHandler) handleListPayments(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	params := request.QueryStringParameters
+	req := service.ListPaymentsRequest{
+		UserID: params["userId"],
+		Status: params["status"],
+		From:   params["from"],
+		To:     params["to"],
+		Cursor: params["cursor"],
+	}
+	if req.UserID == "" {
+		return utils.ErrorResponse(400, "userId is required")
+	}
+	if minAmount := params["minAmount"]; minAmount != "" {
+		parsed, err := strconv.ParseInt(minAmount, 10, 64)
+		if err != nil {
+			return utils.ErrorResponse(400, "invalid minAmount")
+		}
+		req.MinAmount = parsed
+	}
+	if limit := params["limit"]; limit != "" {
+		parsed, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil {
+			return utils.ErrorResponse(400, "invalid limit")
+		}
+		req.Limit = parsed
+	}
+
+	history, err := h.service.ListPayments(ctx, req)
+	if err != nil {
+		return errorResponse(err, "failed to list payments")
+	}
+
+	return utils.SuccessResponse(200, history)
+}
+
 func (h *InvoiceHandler) handleUpdatePayment(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	paymentID := strings.TrimPrefix(request.Path, "/payment/")
 	if paymentID == "" {
@@ -186,12 +318,13 @@ func (h *InvoiceHandler) handleUpdatePayment(ctx context.Context, request events
 		}, nil
 	}
 
-	_, err := h.service.UpdatePaymentStatus(ctx, paymentID, types.PaymentStatus(updateReq.Status), "")
+	status, err := types.ParsePaymentStatus(updateReq.Status)
 	if err != nil {
-		return events.APIGatewayProxyResponse{
-			StatusCode: 500,
-			Body:       fmt.Sprintf(`{"error":"%s"}`, err.Error()),
-		}, nil
+		return utils.ErrorResponse(400, err.Error())
+	}
+
+	if _, err := h.service.UpdatePaymentStatus(ctx, paymentID, status, ""); err != nil {
+		return errorResponse(err, "failed to update payment status")
 	}
 
 	return events.APIGatewayProxyResponse{
@@ -200,6 +333,161 @@ func (h *InvoiceHandler) handleUpdatePayment(ctx context.Context, request events
 	}, nil
 }
 
+// handleCancelPayment serves POST /payment/{id}/cancel
+func (h *InvoiceHandler) handleCancelPayment(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	paymentID := strings.TrimSuffix(strings.TrimPrefix(request.Path, "/payment/"), "/cancel")
+	if paymentID == "" || strings.Contains(paymentID, "/") {
+		return utils.ErrorResponse(400, "payment ID required")
+	}
+
+	payment, err := h.service.CancelPayment(ctx, paymentID)
+	if err != nil {
+		return errorResponse(err, "failed to cancel payment")
+	}
+
+	return utils.SuccessResponse(200, payment)
+}
+
+func (h *InvoiceHandler) handleCreateSchedule(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req service.CreateScheduleRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return utils.ErrorResponse(400, "invalid request body")
+	}
+
+	schedule, err := h.service.CreateSchedule(ctx, req)
+	if err != nil {
+		return errorResponse(err, "failed to create payment schedule")
+	}
+
+	return utils.SuccessResponse(201, schedule)
+}
+
+// handleSchedule serves GET /payment-schedule/{id}, GET
+// /payment-schedule/{id}/runs and POST /payment-schedule/{id}/{pause,resume,cancel}
+func (h *InvoiceHandler) handleSchedule(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	scheduleID, operation, _ := strings.Cut(strings.TrimPrefix(request.Path, "/payment-schedule/"), "/")
+	if scheduleID == "" {
+		return utils.ErrorResponse(400, "schedule ID required")
+	}
+
+	var (
+		result interface{}
+		err    error
+	)
+	switch {
+	case request.HTTPMethod == "GET" && operation == "":
+		result, err = h.service.GetSchedule(ctx, scheduleID)
+	case request.HTTPMethod == "GET" && operation == "runs":
+		result, err = h.service.ListScheduleRuns(ctx, scheduleID)
+	case request.HTTPMethod == "POST" && operation == "pause":
+		result, err = h.service.PauseSchedule(ctx, scheduleID)
+	case request.HTTPMethod == "POST" && operation == "resume":
+		result, err = h.service.ResumeSchedule(ctx, scheduleID)
+	case request.HTTPMethod == "POST" && operation == "cancel":
+		result, err = h.service.CancelSchedule(ctx, scheduleID)
+	default:
+		return utils.ErrorResponse(404, "not found")
+	}
+	if err != nil {
+		return errorResponse(err, "failed to process payment schedule")
+	}
+
+	return utils.SuccessResponse(200, result)
+}
+
+func (h *InvoiceHandler) handleCreateInvoice(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req service.CreateInvoiceRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return utils.ErrorResponse(400, "invalid request body")
+	}
+
+	invoice, err := h.service.CreateInvoice(ctx, req)
+	if err != nil {
+		return errorResponse(err, "failed to create invoice")
+	}
+
+	return utils.SuccessResponse(201, invoice)
+}
+
+func (h *InvoiceHandler) handleListInvoices(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	params := request.QueryStringParameters
+	req := service.ListInvoicesRequest{
+		MerchantID: params["merchantId"],
+		Status:     params["status"],
+		Cursor:     params["cursor"],
+	}
+	if req.MerchantID == "" {
+		return utils.ErrorResponse(400, "merchantId is required")
+	}
+	if limit := params["limit"]; limit != "" {
+		parsed, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil {
+			return utils.ErrorResponse(400, "invalid limit")
+		}
+		req.Limit = parsed
+	}
+
+	invoices, err := h.service.ListInvoices(ctx, req)
+	if err != nil {
+		return errorResponse(err, "failed to list invoices")
+	}
+
+	return utils.SuccessResponse(200, invoices)
+}
+
+// handleInvoice serves GET, PUT and DELETE /invoice/{id} and POST
+// /invoice/{id}/{void,pay}. DELETE voids the invoice, as POST void does.
+func (h *InvoiceHandler) handleInvoice(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	invoiceID, operation, _ := strings.Cut(strings.TrimPrefix(request.Path, "/invoice/"), "/")
+	if invoiceID == "" {
+		return utils.ErrorResponse(400, "invoice ID required")
+	}
+
+	var (
+		result interface{}
+		err    error
+	)
+	switch {
+	case request.HTTPMethod == "GET" && operation == "":
+		result, err = h.service.GetInvoice(ctx, invoiceID)
+	case request.HTTPMethod == "PUT" && operation == "":
+		var req service.UpdateInvoiceRequest
+		if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+			return utils.ErrorResponse(400, "invalid request body")
+		}
+		result, err = h.service.UpdateInvoice(ctx, invoiceID, req)
+	case (request.HTTPMethod == "DELETE" && operation == "") || (request.HTTPMethod == "POST" && operation == "void"):
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if request.Body != "" {
+			if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+				return utils.ErrorResponse(400, "invalid request body")
+			}
+		}
+		result, err = h.service.VoidInvoice(ctx, invoiceID, req.Reason)
+	case request.HTTPMethod == "POST" && operation == "pay":
+		var req service.PayInvoiceRequest
+		if request.Body != "" {
+			if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+				return utils.ErrorResponse(400, "invalid request body")
+			}
+		}
+		started, payErr := h.service.PayInvoice(ctx, invoiceID, req)
+		if payErr != nil {
+			return errorResponse(payErr, "failed to pay invoice")
+		}
+		return utils.SuccessResponse(202, started)
+	default:
+		return utils.ErrorResponse(404, "not found")
+	}
+	if err != nil {
+		return errorResponse(err, "failed to process invoice")
+	}
+
+	return utils.SuccessResponse(200, result)
+}
+
 // handleStepFunctionInput handles requests from Step Functions
 func (h *InvoiceHandler) handleStepFunctionInput(ctx context.Context, action string, input map[string]interface{}) (interface{}, error) {
 	h.logger.Info("Processing Step Function request", map[string]interface{}{
@@ -212,9 +500,14 @@ func (h *InvoiceHandler) handleStepFunctionInput(ctx context.Context, action str
 		// Create payment record
 		paymentID, _ := input["paymentId"].(string)
 		userID, _ := input["userId"].(string)
-		amount, _ := input["amount"].(float64)
-		currency, _ := input["currency"].(string)
 		correlationID, _ := input["correlationId"].(string)
+		amount, err := utils.MoneyFromInput(input["amount"])
+		if err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
 		
 		// Convert metadata from map[string]interface{} to map[string]string
 		var metadata map[string]string
@@ -235,7 +528,6 @@ func (h *InvoiceHandler) handleStepFunctionInput(ctx context.Context, action str
 			PaymentID:     paymentID,
 			UserID:        userID,
 			Amount:        amount,
-			Currency:      currency,
 			CorrelationID: correlationID,
 			Metadata:      metadata,
 		}
@@ -259,7 +551,14 @@ func (h *InvoiceHandler) handleStepFunctionInput(ctx context.Context, action str
 		status, _ := input["status"].(string)
 		externalID, _ := input["externalId"].(string)
 
-		paymentStatus := types.PaymentStatus(status)
+		paymentStatus, err := types.ParsePaymentStatus(status)
+		if err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
 		payment, err := h.service.UpdatePaymentStatus(ctx, paymentID, paymentStatus, externalID)
 		if err != nil {
 			h.logger.Error("Failed to update payment", err, nil)
@@ -274,6 +573,68 @@ func (h *InvoiceHandler) handleStepFunctionInput(ctx context.Context, action str
 			Data:    payment,
 		}, nil
 
+	case "create_invoice":
+		var req service.CreateInvoiceRequest
+		data, err := json.Marshal(input)
+		if err == nil {
+			err = json.Unmarshal(data, &req)
+		}
+		if err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   fmt.Sprintf("invalid invoice input: %v", err),
+			}, nil
+		}
+
+		invoice, err := h.service.CreateInvoice(ctx, req)
+		if err != nil {
+			h.logger.Error("Failed to create invoice", err, nil)
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		return types.LambdaResponse{
+			Success: true,
+			Data:    invoice,
+		}, nil
+
+	case "check_cancelled":
+		paymentID, _ := input["paymentId"].(string)
+
+		cancelled, err := h.service.IsPaymentCancelled(ctx, paymentID)
+		if err != nil {
+			h.logger.Error("Failed to check payment cancellation", err, nil)
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		return types.LambdaResponse{
+			Success: true,
+			Data: map[string]interface{}{
+				"paymentId": paymentID,
+				"cancelled": cancelled,
+			},
+		}, nil
+
+	case "run_payment_schedules":
+		report, err := h.service.RunSchedules(ctx)
+		if err != nil {
+			h.logger.Error("Failed to run payment schedules", err, nil)
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		return types.LambdaResponse{
+			Success: true,
+			Data:    report,
+		}, nil
+
 	default:
 		return map[string]interface{}{
 			"statusCode": 400,
@@ -282,3 +643,12 @@ func (h *InvoiceHandler) handleStepFunctionInput(ctx context.Context, action str
 	}
 }
 
+// errorResponse maps typed application errors to their HTTP status, code and details.
+// Any other error is reported as a 500 with the given fallback message.
+func errorResponse(err error, fallback string) (events.APIGatewayProxyResponse, error) {
+	var appErr *apperrors.AppError
+	if errors.As(err, &appErr) && appErr.StatusCode < 500 {
+		return utils.AppErrorResponse(appErr)
+	}
+	return utils.ErrorResponse(500, fallback)
+}
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// ListPaymentEvents returns every event recorded for a payment, oldest first
+func (r *PaymentRepository) ListPaymentEvents(ctx context.Context, paymentID string) ([]types.PaymentEvent, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.eventsTable),
+		KeyConditionExpression: aws.String("PaymentID = :paymentId"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":paymentId": {
+				S: aws.String(paymentID),
+			},
+		},
+		ScanIndexForward: aws.Bool(true),
+	}
+
+	events := []types.PaymentEvent{}
+	for {
+		result, err := r.client.QueryWithContext(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query payment events: %w", err)
+		}
+
+		var page []types.PaymentEvent
+		if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal payment events: %w", err)
+		}
+		events = append(events, page...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return events, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// userCreatedAtIndex is the Payments GSI keyed by UserID and CreatedAt
+const userCreatedAtIndex = "UserCreatedAtIndex"
+
+// PaymentQuery filters a user's payments. Zero From/To leave that end of the
+// range open; an empty Status matches every status and a zero MinAmount
+// every amount.
+type PaymentQuery struct {
+	UserID            string
+	Status            types.PaymentStatus
+	From              time.Time
+	To                time.Time
+	MinAmount         int64
+	Limit             int64
+	ExclusiveStartKey map[string]*dynamodb.AttributeValue
+}
+
+// PaymentPage is one page of payments, newest first
+type PaymentPage struct {
+	Payments         []types.Payment
+	LastEvaluatedKey map[string]*dynamodb.AttributeValue
+}
+
+// ListPayments returns a user's payments from the UserCreatedAtIndex, newest
+// first. Status and MinAmount are applied as filters, so a page can hold
+// fewer than Limit items while LastEvaluatedKey is still set.
+func (r *PaymentRepository) ListPayments(ctx context.Context, query PaymentQuery) (*PaymentPage, error) {
+	keyCondition := "UserID = :userId"
+	names := map[string]*string{}
+	values := map[string]*dynamodb.AttributeValue{
+		":userId": {
+			S: aws.String(query.UserID),
+		},
+	}
+
+	switch {
+	case !query.From.IsZero() && !query.To.IsZero():
+		keyCondition += " AND CreatedAt BETWEEN :from AND :to"
+	case !query.From.IsZero():
+		keyCondition += " AND CreatedAt >= :from"
+	case !query.To.IsZero():
+		keyCondition += " AND CreatedAt <= :to"
+	}
+	if !query.From.IsZero() {
+		values[":from"] = &dynamodb.AttributeValue{S: aws.String(query.From.UTC().Format(time.RFC3339Nano))}
+	}
+	if !query.To.IsZero() {
+		values[":to"] = &dynamodb.AttributeValue{S: aws.String(query.To.UTC().Format(time.RFC3339Nano))}
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(r.paymentsTable),
+		IndexName:                 aws.String(userCreatedAtIndex),
+		KeyConditionExpression:    aws.String(keyCondition),
+		ExpressionAttributeValues: values,
+		ScanIndexForward:          aws.Bool(false),
+		ExclusiveStartKey:         query.ExclusiveStartKey,
+	}
+
+	var filters []string
+	if query.Status != "" {
+		filters = append(filters, "#status = :status")
+		names["#status"] = aws.String("Status")
+		values[":status"] = &dynamodb.AttributeValue{S: aws.String(string(query.Status))}
+	}
+	if query.MinAmount > 0 {
+		filters = append(filters, "Amount.Amount >= :minAmount")
+		values[":minAmount"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(query.MinAmount, 10))}
+	}
+	if len(filters) > 0 {
+		input.FilterExpression = aws.String(strings.Join(filters, " AND "))
+	}
+	if len(names) > 0 {
+		input.ExpressionAttributeNames = names
+	}
+	if query.Limit > 0 {
+		input.Limit = aws.Int64(query.Limit)
+	}
+
+	result, err := r.client.QueryWithContext(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query payments: %w", err)
+	}
+
+	page := &PaymentPage{
+		Payments:         []types.Payment{},
+		LastEvaluatedKey: result.LastEvaluatedKey,
+	}
+	if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &page.Payments); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payments: %w", err)
+	}
+
+	return page, nil
+}
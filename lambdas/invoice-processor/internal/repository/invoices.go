@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// merchantNumberIndex is the Invoices GSI keyed by MerchantID and Number,
+// used to list a merchant's invoices in numbering order
+const merchantNumberIndex = "MerchantNumberIndex"
+
+// ErrInvoiceChanged is returned when an invoice was updated by someone else
+// after it was read
+var ErrInvoiceChanged = errors.New("invoice was changed concurrently")
+
+// ErrInvoiceNumberTaken is returned when another invoice of the merchant took
+// the next number first
+var ErrInvoiceNumberTaken = errors.New("invoice number was taken concurrently")
+
+// CreateInvoice stores a new invoice under its merchant's next number. The
+// number is read from the merchant's counter in InvoiceCounters, and the
+// counter is advanced in the same transaction that stores the invoice,
+// conditioned on it not having moved, so numbers are never skipped or
+// reused. ErrInvoiceNumberTaken is returned if it moved; retrying reads the
+// new value.
+func (r *PaymentRepository) CreateInvoice(ctx context.Context, invoice *types.Invoice) error {
+	counter, err := r.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.invoiceCountersTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"MerchantID": {S: aws.String(invoice.MerchantID)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read invoice counter: %w", err)
+	}
+
+	var last int64
+	if number, ok := counter.Item["LastNumber"]; ok && number.N != nil {
+		if last, err = strconv.ParseInt(*number.N, 10, 64); err != nil {
+			return fmt.Errorf("invalid invoice counter: %w", err)
+		}
+	}
+	invoice.Number = last + 1
+
+	item, err := dynamodbattribute.MarshalMap(invoice)
+	if err != nil {
+		return fmt.Errorf("failed to marshal invoice: %w", err)
+	}
+
+	counterUpdate := &dynamodb.Update{
+		TableName: aws.String(r.invoiceCountersTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"MerchantID": {S: aws.String(invoice.MerchantID)},
+		},
+		UpdateExpression: aws.String("SET LastNumber = :next"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":next": {N: aws.String(strconv.FormatInt(invoice.Number, 10))},
+		},
+	}
+	if last == 0 {
+		counterUpdate.ConditionExpression = aws.String("attribute_not_exists(LastNumber)")
+	} else {
+		counterUpdate.ConditionExpression = aws.String("LastNumber = :last")
+		counterUpdate.ExpressionAttributeValues[":last"] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(last, 10))}
+	}
+
+	_, err = r.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{Update: counterUpdate},
+			{Put: &dynamodb.Put{
+				TableName:           aws.String(r.invoicesTable),
+				Item:                item,
+				ConditionExpression: aws.String("attribute_not_exists(ID)"),
+			}},
+		},
+	})
+	if err != nil {
+		var canceled *dynamodb.TransactionCanceledException
+		if errors.As(err, &canceled) && len(canceled.CancellationReasons) > 0 &&
+			aws.StringValue(canceled.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+			return ErrInvoiceNumberTaken
+		}
+		return fmt.Errorf("failed to create invoice: %w", err)
+	}
+
+	return nil
+}
+
+// GetInvoice retrieves an invoice by ID
+func (r *PaymentRepository) GetInvoice(ctx context.Context, invoiceID string) (*types.Invoice, error) {
+	result, err := r.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.invoicesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {S: aws.String(invoiceID)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invoice: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, apperrors.NewNotFoundError("invoice")
+	}
+
+	var invoice types.Invoice
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &invoice); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal invoice: %w", err)
+	}
+
+	return &invoice, nil
+}
+
+// UpdateInvoice replaces an invoice read at version with its new state,
+// bumping Version. ErrInvoiceChanged is returned if it was updated since.
+func (r *PaymentRepository) UpdateInvoice(ctx context.Context, invoice *types.Invoice, version int64) error {
+	invoice.Version = version + 1
+	invoice.UpdatedAt = time.Now().UTC()
+
+	item, err := dynamodbattribute.MarshalMap(invoice)
+	if err != nil {
+		return fmt.Errorf("failed to marshal invoice: %w", err)
+	}
+
+	_, err = r.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(r.invoicesTable),
+		Item:                item,
+		ConditionExpression: aws.String("Version = :version"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":version": {
+				N: aws.String(strconv.FormatInt(version, 10)),
+			},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrInvoiceChanged
+		}
+		return fmt.Errorf("failed to update invoice: %w", err)
+	}
+
+	return nil
+}
+
+// InvoiceQuery filters a merchant's invoices. An empty Status matches every
+// status.
+type InvoiceQuery struct {
+	MerchantID        string
+	Status            types.InvoiceStatus
+	Limit             int64
+	ExclusiveStartKey map[string]*dynamodb.AttributeValue
+}
+
+// InvoicePage is one page of invoices, newest number first
+type InvoicePage struct {
+	Invoices         []types.Invoice
+	LastEvaluatedKey map[string]*dynamodb.AttributeValue
+}
+
+// ListInvoices returns a merchant's invoices from the MerchantNumberIndex,
+// newest number first. Status is applied as a filter, so a page can hold
+// fewer than Limit items while LastEvaluatedKey is still set.
+func (r *PaymentRepository) ListInvoices(ctx context.Context, query InvoiceQuery) (*InvoicePage, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.invoicesTable),
+		IndexName:              aws.String(merchantNumberIndex),
+		KeyConditionExpression: aws.String("MerchantID = :merchantId"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":merchantId": {
+				S: aws.String(query.MerchantID),
+			},
+		},
+		ScanIndexForward:  aws.Bool(false),
+		ExclusiveStartKey: query.ExclusiveStartKey,
+	}
+
+	if query.Status != "" {
+		input.FilterExpression = aws.String("#status = :status")
+		input.ExpressionAttributeNames = map[string]*string{
+			"#status": aws.String("Status"),
+		}
+		input.ExpressionAttributeValues[":status"] = &dynamodb.AttributeValue{S: aws.String(string(query.Status))}
+	}
+	if query.Limit > 0 {
+		input.Limit = aws.Int64(query.Limit)
+	}
+
+	result, err := r.client.QueryWithContext(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invoices: %w", err)
+	}
+
+	page := &InvoicePage{
+		Invoices:         []types.Invoice{},
+		LastEvaluatedKey: result.LastEvaluatedKey,
+	}
+	if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &page.Invoices); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal invoices: %w", err)
+	}
+
+	return page, nil
+}
@@ -2,27 +2,41 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/google/uuid"
+	"github.com/draftea-coding-challenge/shared/ledger"
 	"github.com/draftea-coding-challenge/shared/types"
 )
 
 type PaymentRepository struct {
-	client        *dynamodb.DynamoDB
-	paymentsTable string
-	eventsTable   string
+	client               *dynamodb.DynamoDB
+	paymentsTable        string
+	eventsTable          string
+	schedulesTable       string
+	runsTable            string
+	invoicesTable        string
+	invoiceCountersTable string
+	ledger               *ledger.Store
 }
 
-func NewPaymentRepository(client *dynamodb.DynamoDB, paymentsTable, eventsTable string) *PaymentRepository {
+func NewPaymentRepository(client *dynamodb.DynamoDB, paymentsTable, eventsTable, ledgerTable, schedulesTable, runsTable, invoicesTable, invoiceCountersTable string) *PaymentRepository {
 	return &PaymentRepository{
-		client:        client,
-		paymentsTable: paymentsTable,
-		eventsTable:   eventsTable,
+		client:               client,
+		paymentsTable:        paymentsTable,
+		eventsTable:          eventsTable,
+		schedulesTable:       schedulesTable,
+		runsTable:            runsTable,
+		invoicesTable:        invoicesTable,
+		invoiceCountersTable: invoiceCountersTable,
+		ledger:               ledger.NewStore(client, ledgerTable),
 	}
 }
 
@@ -52,7 +66,7 @@ func (r *PaymentRepository) CreatePayment(ctx context.Context, payment *types.Pa
 	}
 	
 	// Log payment before marshaling
-	fmt.Printf("Payment before marshal: ID=%s, UserID=%s, Amount=%f\n", payment.ID, payment.UserID, payment.Amount)
+	fmt.Printf("Payment before marshal: ID=%s, UserID=%s, Amount=%s\n", payment.ID, payment.UserID, payment.Amount)
 	
 	item, err := dynamodbattribute.MarshalMap(payment)
 	if err != nil {
@@ -102,8 +116,20 @@ func (r *PaymentRepository) CreatePayment(ctx context.Context, payment *types.Pa
 	return nil
 }
 
-// UpdatePaymentStatus updates the status of a payment
+// ErrPaymentStatusConflict is returned when a payment is missing or its
+// current status cannot move to the requested one
+var ErrPaymentStatusConflict = errors.New("payment status does not allow this change")
+
+// UpdatePaymentStatus moves a payment to status. The update is conditional on
+// the payment's current status being one status can be reached from, so
+// concurrent and out-of-order updates cannot skip or undo a transition;
+// ErrPaymentStatusConflict is returned when it is not.
 func (r *PaymentRepository) UpdatePaymentStatus(ctx context.Context, paymentID string, status types.PaymentStatus, externalID string) error {
+	before := types.PaymentStatusesBefore(status)
+	if len(before) == 0 {
+		return ErrPaymentStatusConflict
+	}
+
 	updateExpr := "SET #status = :status, UpdatedAt = :updatedAt"
 	exprAttrNames := map[string]*string{
 		"#status": aws.String("Status"),
@@ -112,30 +138,47 @@ func (r *PaymentRepository) UpdatePaymentStatus(ctx context.Context, paymentID s
 		":status":    {S: aws.String(string(status))},
 		":updatedAt": {S: aws.String(time.Now().Format(time.RFC3339))},
 	}
-	
+
 	if externalID != "" {
 		updateExpr += ", ExternalID = :externalID"
 		exprAttrValues[":externalID"] = &dynamodb.AttributeValue{S: aws.String(externalID)}
 	}
-	
+
+	placeholders := make([]string, 0, len(before))
+	for i, from := range before {
+		placeholder := fmt.Sprintf(":from%d", i)
+		placeholders = append(placeholders, placeholder)
+		exprAttrValues[placeholder] = &dynamodb.AttributeValue{S: aws.String(string(from))}
+	}
+
 	input := &dynamodb.UpdateItemInput{
 		TableName: aws.String(r.paymentsTable),
 		Key: map[string]*dynamodb.AttributeValue{
 			"ID": {S: aws.String(paymentID)},
 		},
 		UpdateExpression:          aws.String(updateExpr),
+		ConditionExpression:       aws.String(fmt.Sprintf("attribute_exists(ID) AND #status IN (%s)", strings.Join(placeholders, ", "))),
 		ExpressionAttributeNames:  exprAttrNames,
 		ExpressionAttributeValues: exprAttrValues,
 	}
-	
+
 	_, err := r.client.UpdateItemWithContext(ctx, input)
 	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrPaymentStatusConflict
+		}
 		return fmt.Errorf("failed to update payment status: %w", err)
 	}
-	
+
 	return nil
 }
 
+// PostJournalEntry posts a journal entry. Posting the same entry again
+// returns ledger.ErrEntryExists.
+func (r *PaymentRepository) PostJournalEntry(ctx context.Context, entry *ledger.JournalEntry) error {
+	return r.ledger.Post(ctx, entry)
+}
+
 // GetPayment retrieves a payment by ID
 func (r *PaymentRepository) GetPayment(ctx context.Context, paymentID string) (*types.Payment, error) {
 	input := &dynamodb.GetItemInput{
@@ -162,34 +205,6 @@ func (r *PaymentRepository) GetPayment(ctx context.Context, paymentID string) (*
 	return &payment, nil
 }
 
-// CheckIdempotency checks if a payment with the given idempotency key already exists
-func (r *PaymentRepository) CheckIdempotency(ctx context.Context, idempotencyKey string) (*types.Payment, error) {
-	// Query payments by idempotency key (would need a GSI in production)
-	// For now, this is a simplified implementation
-	scanInput := &dynamodb.ScanInput{
-		TableName: aws.String(r.paymentsTable),
-		FilterExpression: aws.String("Metadata.idempotencyKey = :key"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":key": {S: aws.String(idempotencyKey)},
-		},
-	}
-	
-	result, err := r.client.ScanWithContext(ctx, scanInput)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check idempotency: %w", err)
-	}
-	
-	if len(result.Items) > 0 {
-		var payment types.Payment
-		if err := dynamodbattribute.UnmarshalMap(result.Items[0], &payment); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal payment: %w", err)
-		}
-		return &payment, nil
-	}
-	
-	return nil, nil
-}
-
 // recordEvent records a payment event
 func (r *PaymentRepository) recordEvent(ctx context.Context, event *types.PaymentEvent) error {
 	item, err := dynamodbattribute.MarshalMap(event)
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sfn"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// SagaInput is the input of the payment saga state machine
+type SagaInput struct {
+	UserID   string            `json:"userId"`
+	Amount   types.Money       `json:"amount"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// SagaExecution is the state of one execution of the payment saga. Status is
+// one of the Step Functions execution statuses, such as RUNNING or SUCCEEDED.
+type SagaExecution struct {
+	ExecutionArn string
+	Status       string
+	Error        string
+	Cause        string
+}
+
+// SagaClient starts and inspects executions of the payment saga
+type SagaClient struct {
+	client          *sfn.SFN
+	stateMachineArn string
+}
+
+// NewSagaClient creates a client for the payment saga state machine
+func NewSagaClient(client *sfn.SFN, stateMachineArn string) *SagaClient {
+	return &SagaClient{
+		client:          client,
+		stateMachineArn: stateMachineArn,
+	}
+}
+
+// Start starts an execution of the saga under name. Step Functions keeps
+// execution names unique, and starting a name again with the same input
+// returns the existing execution, so a repeated start is safe.
+func (c *SagaClient) Start(ctx context.Context, name string, input SagaInput) (string, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal saga input: %w", err)
+	}
+
+	result, err := c.client.StartExecutionWithContext(ctx, &sfn.StartExecutionInput{
+		StateMachineArn: aws.String(c.stateMachineArn),
+		Name:            aws.String(name),
+		Input:           aws.String(string(data)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to start payment saga %s: %w", name, err)
+	}
+
+	return aws.StringValue(result.ExecutionArn), nil
+}
+
+// Describe returns the state of a saga execution
+func (c *SagaClient) Describe(ctx context.Context, executionArn string) (*SagaExecution, error) {
+	result, err := c.client.DescribeExecutionWithContext(ctx, &sfn.DescribeExecutionInput{
+		ExecutionArn: aws.String(executionArn),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe payment saga %s: %w", executionArn, err)
+	}
+
+	return &SagaExecution{
+		ExecutionArn: executionArn,
+		Status:       aws.StringValue(result.Status),
+		Error:        aws.StringValue(result.Error),
+		Cause:        aws.StringValue(result.Cause),
+	}, nil
+}
@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// statusNextRunIndex is the PaymentSchedules GSI keyed by Status and
+// NextRunAt, used to find the active schedules that are due
+const statusNextRunIndex = "StatusNextRunIndex"
+
+// statusOccurrenceIndex is the PaymentScheduleRuns GSI keyed by Status and
+// OccurrenceAt, used to find the runs whose saga is still in progress
+const statusOccurrenceIndex = "StatusOccurrenceIndex"
+
+// ErrScheduleChanged is returned when a schedule or run was updated by
+// someone else after it was read
+var ErrScheduleChanged = errors.New("payment schedule was changed concurrently")
+
+// CreateSchedule stores a new payment schedule
+func (r *PaymentRepository) CreateSchedule(ctx context.Context, schedule *types.PaymentSchedule) error {
+	item, err := dynamodbattribute.MarshalMap(schedule)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payment schedule: %w", err)
+	}
+
+	_, err = r.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(r.schedulesTable),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(ID)"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create payment schedule: %w", err)
+	}
+
+	return nil
+}
+
+// GetSchedule retrieves a payment schedule by ID
+func (r *PaymentRepository) GetSchedule(ctx context.Context, scheduleID string) (*types.PaymentSchedule, error) {
+	result, err := r.client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.schedulesTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {S: aws.String(scheduleID)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment schedule: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, apperrors.NewNotFoundError("payment schedule")
+	}
+
+	var schedule types.PaymentSchedule
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &schedule); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payment schedule: %w", err)
+	}
+
+	return &schedule, nil
+}
+
+// UpdateSchedule replaces a schedule read at version with its new state,
+// bumping Version. ErrScheduleChanged is returned if it was updated since.
+func (r *PaymentRepository) UpdateSchedule(ctx context.Context, schedule *types.PaymentSchedule, version int64) error {
+	put, err := r.schedulePut(schedule, version)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:                 put.TableName,
+		Item:                      put.Item,
+		ConditionExpression:       put.ConditionExpression,
+		ExpressionAttributeValues: put.ExpressionAttributeValues,
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrScheduleChanged
+		}
+		return fmt.Errorf("failed to update payment schedule: %w", err)
+	}
+
+	return nil
+}
+
+// ListDueSchedules returns up to limit active schedules whose next
+// occurrence is at or before now, oldest first
+func (r *PaymentRepository) ListDueSchedules(ctx context.Context, now time.Time, limit int64) ([]types.PaymentSchedule, error) {
+	result, err := r.client.QueryWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(r.schedulesTable),
+		IndexName:              aws.String(statusNextRunIndex),
+		KeyConditionExpression: aws.String("#status = :active AND NextRunAt <= :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":active": {
+				S: aws.String(string(types.ScheduleStatusActive)),
+			},
+			":now": {
+				S: aws.String(now.UTC().Format(time.RFC3339Nano)),
+			},
+		},
+		Limit: aws.Int64(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due payment schedules: %w", err)
+	}
+
+	schedules := []types.PaymentSchedule{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &schedules); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal payment schedules: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// ListRunningRuns returns up to limit schedule runs whose saga has not been
+// seen to finish, oldest first
+func (r *PaymentRepository) ListRunningRuns(ctx context.Context, limit int64) ([]types.ScheduleRun, error) {
+	result, err := r.client.QueryWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(r.runsTable),
+		IndexName:              aws.String(statusOccurrenceIndex),
+		KeyConditionExpression: aws.String("#status = :running"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":running": {
+				S: aws.String(string(types.ScheduleRunStatusRunning)),
+			},
+		},
+		Limit: aws.Int64(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query running schedule runs: %w", err)
+	}
+
+	runs := []types.ScheduleRun{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &runs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schedule runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// ListRuns returns up to limit runs of a schedule, newest first
+func (r *PaymentRepository) ListRuns(ctx context.Context, scheduleID string, limit int64) ([]types.ScheduleRun, error) {
+	result, err := r.client.QueryWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(r.runsTable),
+		KeyConditionExpression: aws.String("ScheduleID = :scheduleId"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":scheduleId": {
+				S: aws.String(scheduleID),
+			},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int64(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query schedule runs: %w", err)
+	}
+
+	runs := []types.ScheduleRun{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &runs); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schedule runs: %w", err)
+	}
+
+	return runs, nil
+}
+
+// RecordRun stores a new run of a schedule together with the schedule's
+// state after it, read at version. Each occurrence is recorded once:
+// ErrScheduleChanged is returned if the run exists or the schedule changed.
+func (r *PaymentRepository) RecordRun(ctx context.Context, schedule *types.PaymentSchedule, version int64, run *types.ScheduleRun) error {
+	runPut, err := r.runPut(run)
+	if err != nil {
+		return err
+	}
+	runPut.ConditionExpression = aws.String("attribute_not_exists(ScheduleID)")
+
+	return r.writeScheduleRun(ctx, schedule, version, runPut)
+}
+
+// FinishRun records the outcome of a running run together with the
+// schedule's state after it, read at version. ErrScheduleChanged is returned
+// if the run was already finished or the schedule changed.
+func (r *PaymentRepository) FinishRun(ctx context.Context, schedule *types.PaymentSchedule, version int64, run *types.ScheduleRun) error {
+	runPut, err := r.runPut(run)
+	if err != nil {
+		return err
+	}
+	runPut.ConditionExpression = aws.String("#status = :running")
+	runPut.ExpressionAttributeNames = map[string]*string{
+		"#status": aws.String("Status"),
+	}
+	runPut.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+		":running": {
+			S: aws.String(string(types.ScheduleRunStatusRunning)),
+		},
+	}
+
+	return r.writeScheduleRun(ctx, schedule, version, runPut)
+}
+
+func (r *PaymentRepository) writeScheduleRun(ctx context.Context, schedule *types.PaymentSchedule, version int64, runPut *dynamodb.Put) error {
+	schedulePut, err := r.schedulePut(schedule, version)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{Put: schedulePut},
+			{Put: runPut},
+		},
+	})
+	if err != nil {
+		var canceled *dynamodb.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			for _, reason := range canceled.CancellationReasons {
+				if aws.StringValue(reason.Code) == "ConditionalCheckFailed" {
+					return ErrScheduleChanged
+				}
+			}
+		}
+		return fmt.Errorf("failed to record schedule run: %w", err)
+	}
+
+	return nil
+}
+
+// schedulePut writes a schedule read at version, with optimistic locking
+func (r *PaymentRepository) schedulePut(schedule *types.PaymentSchedule, version int64) (*dynamodb.Put, error) {
+	schedule.Version = version + 1
+	schedule.UpdatedAt = time.Now().UTC()
+
+	item, err := dynamodbattribute.MarshalMap(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payment schedule: %w", err)
+	}
+
+	return &dynamodb.Put{
+		TableName:           aws.String(r.schedulesTable),
+		Item:                item,
+		ConditionExpression: aws.String("Version = :version"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":version": {
+				N: aws.String(fmt.Sprintf("%d", version)),
+			},
+		},
+	}, nil
+}
+
+func (r *PaymentRepository) runPut(run *types.ScheduleRun) (*dynamodb.Put, error) {
+	item, err := dynamodbattribute.MarshalMap(run)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal schedule run: %w", err)
+	}
+
+	return &dynamodb.Put{
+		TableName: aws.String(r.runsTable),
+		Item:      item,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/draftea-coding-challenge/lambdas/invoice-processor/internal/repository"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/draftea-coding-challenge/shared/utils"
+)
+
+const (
+	defaultPaymentPageSize = 50
+	maxPaymentPageSize     = 100
+)
+
+// ListPaymentsRequest represents a payment history query. From and To are
+// RFC3339 timestamps on the payment's creation time, MinAmount is in minor
+// units, and Cursor is the NextCursor of a previous page.
+type ListPaymentsRequest struct {
+	UserID    string `json:"userId"`
+	Status    string `json:"status,omitempty"`
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+	MinAmount int64  `json:"minAmount,omitempty"`
+	Cursor    string `json:"cursor,omitempty"`
+	Limit     int64  `json:"limit,omitempty"`
+}
+
+// PaymentHistory is a page of a user's payments, newest first
+type PaymentHistory struct {
+	Payments   []types.Payment `json:"payments"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
+// ListPayments returns a page of the user's payments
+func (s *PaymentService) ListPayments(ctx context.Context, req ListPaymentsRequest) (*PaymentHistory, error) {
+	query, err := buildPaymentQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.repo.ListPayments(ctx, query)
+	if err != nil {
+		s.logger.Error("Failed to list payments", err, map[string]interface{}{
+			"userId": req.UserID,
+		})
+		return nil, err
+	}
+
+	nextCursor, err := utils.EncodeCursor(page.LastEvaluatedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PaymentHistory{
+		Payments:   page.Payments,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// buildPaymentQuery validates a history request and converts it to a repository query
+func buildPaymentQuery(req ListPaymentsRequest) (repository.PaymentQuery, error) {
+	query := repository.PaymentQuery{
+		UserID:    req.UserID,
+		MinAmount: req.MinAmount,
+		Limit:     req.Limit,
+	}
+
+	if req.UserID == "" {
+		return query, apperrors.NewValidationError("userId is required", nil)
+	}
+
+	var err error
+	if req.Status != "" {
+		if query.Status, err = types.ParsePaymentStatus(req.Status); err != nil {
+			return query, apperrors.NewValidationError(err.Error(), nil)
+		}
+	}
+
+	if req.From != "" {
+		if query.From, err = time.Parse(time.RFC3339, req.From); err != nil {
+			return query, apperrors.NewValidationError("invalid from timestamp, expected RFC3339", nil)
+		}
+	}
+	if req.To != "" {
+		if query.To, err = time.Parse(time.RFC3339, req.To); err != nil {
+			return query, apperrors.NewValidationError("invalid to timestamp, expected RFC3339", nil)
+		}
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && query.From.After(query.To) {
+		return query, apperrors.NewValidationError("from must not be after to", nil)
+	}
+
+	if req.MinAmount < 0 {
+		return query, apperrors.NewValidationError("minAmount must not be negative", nil)
+	}
+
+	switch {
+	case req.Limit < 0:
+		return query, apperrors.NewValidationError("limit must be greater than 0", nil)
+	case req.Limit == 0:
+		query.Limit = defaultPaymentPageSize
+	case req.Limit > maxPaymentPageSize:
+		query.Limit = maxPaymentPageSize
+	}
+
+	if query.ExclusiveStartKey, err = utils.DecodeCursor(req.Cursor); err != nil {
+		return query, apperrors.NewValidationError(err.Error(), nil)
+	}
+	// A cursor is only valid for the user whose history produced it
+	if userKey, ok := query.ExclusiveStartKey["UserID"]; req.Cursor != "" && (!ok || userKey.S == nil || *userKey.S != req.UserID) {
+		return query, apperrors.NewValidationError("invalid cursor", nil)
+	}
+
+	return query, nil
+}
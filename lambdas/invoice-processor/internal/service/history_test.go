@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/draftea-coding-challenge/shared/observability"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/draftea-coding-challenge/shared/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListPayments_ValidationError(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewPaymentService(nil, logger)
+
+	cases := map[string]ListPaymentsRequest{
+		"userId is required":             {},
+		"invalid payment status":         {UserID: "user123", Status: "settled"},
+		"invalid from timestamp":         {UserID: "user123", From: "yesterday"},
+		"from must not be after to":      {UserID: "user123", From: "2024-02-01T00:00:00Z", To: "2024-01-01T00:00:00Z"},
+		"minAmount must not be negative": {UserID: "user123", MinAmount: -1},
+		"limit must be greater than 0":   {UserID: "user123", Limit: -1},
+		"invalid cursor":                 {UserID: "user123", Cursor: "not-a-cursor"},
+	}
+
+	for expected, req := range cases {
+		_, err := service.ListPayments(context.Background(), req)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), expected)
+	}
+}
+
+func TestBuildPaymentQuery(t *testing.T) {
+	cursor, err := utils.EncodeCursor(map[string]*dynamodb.AttributeValue{
+		"ID":        {S: aws.String("pay-1")},
+		"UserID":    {S: aws.String("user123")},
+		"CreatedAt": {S: aws.String("2024-01-15T10:30:00Z")},
+	})
+	require.NoError(t, err)
+
+	query, err := buildPaymentQuery(ListPaymentsRequest{
+		UserID:    "user123",
+		Status:    "completed",
+		From:      "2024-01-01T00:00:00Z",
+		MinAmount: 5000,
+		Cursor:    cursor,
+		Limit:     500,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, types.PaymentStatusCompleted, query.Status)
+	assert.Equal(t, 2024, query.From.Year())
+	assert.True(t, query.To.IsZero())
+	assert.Equal(t, int64(5000), query.MinAmount)
+	assert.Equal(t, int64(maxPaymentPageSize), query.Limit)
+	assert.Equal(t, "pay-1", aws.StringValue(query.ExclusiveStartKey["ID"].S))
+
+	query, err = buildPaymentQuery(ListPaymentsRequest{UserID: "user123"})
+	require.NoError(t, err)
+	assert.Empty(t, query.Status)
+	assert.Equal(t, int64(defaultPaymentPageSize), query.Limit)
+	assert.Nil(t, query.ExclusiveStartKey)
+}
+
+func TestListPayments_RejectsCursorFromAnotherUser(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewPaymentService(nil, logger)
+
+	cursor, err := utils.EncodeCursor(map[string]*dynamodb.AttributeValue{
+		"ID":        {S: aws.String("pay-1")},
+		"UserID":    {S: aws.String("someone-else")},
+		"CreatedAt": {S: aws.String("2024-01-15T10:30:00Z")},
+	})
+	require.NoError(t, err)
+
+	_, err = service.ListPayments(context.Background(), ListPaymentsRequest{
+		UserID: "user123",
+		Cursor: cursor,
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid cursor")
+}
@@ -0,0 +1,509 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/draftea-coding-challenge/lambdas/invoice-processor/internal/repository"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/draftea-coding-challenge/shared/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	// invoiceMetadataKey is the payment metadata key naming the invoice a
+	// payment settles. The saga passes metadata through to the payment, so
+	// starting it with this key is how a payment is made against an invoice.
+	invoiceMetadataKey = "invoiceId"
+
+	// invoiceWriteAttempts is how many times an invoice write is retried
+	// when another write to the invoice, or to its merchant's numbering,
+	// got in first
+	invoiceWriteAttempts = 5
+
+	defaultInvoicePageSize = 50
+	maxInvoicePageSize     = 100
+)
+
+// CreateInvoiceRequest issues an invoice from merchant MerchantID to user
+// UserID. Every amount is in minor units of Currency.
+type CreateInvoiceRequest struct {
+	MerchantID string                  `json:"merchantId"`
+	UserID     string                  `json:"userId"`
+	Currency   string                  `json:"currency"`
+	LineItems  []types.InvoiceLineItem `json:"lineItems"`
+	Discounts  []types.InvoiceDiscount `json:"discounts,omitempty"`
+	Taxes      []types.InvoiceTax      `json:"taxes,omitempty"`
+	DueDate    time.Time               `json:"dueDate"`
+	Metadata   map[string]string       `json:"metadata,omitempty"`
+}
+
+// UpdateInvoiceRequest changes an unpaid invoice. Fields left out keep their
+// current value; the totals are calculated again.
+type UpdateInvoiceRequest struct {
+	LineItems []types.InvoiceLineItem `json:"lineItems,omitempty"`
+	Discounts []types.InvoiceDiscount `json:"discounts,omitempty"`
+	Taxes     []types.InvoiceTax      `json:"taxes,omitempty"`
+	DueDate   *time.Time              `json:"dueDate,omitempty"`
+	Metadata  map[string]string       `json:"metadata,omitempty"`
+}
+
+// ListInvoicesRequest represents a query for a merchant's invoices. Cursor is
+// the NextCursor of a previous page.
+type ListInvoicesRequest struct {
+	MerchantID string `json:"merchantId"`
+	Status     string `json:"status,omitempty"`
+	Cursor     string `json:"cursor,omitempty"`
+	Limit      int64  `json:"limit,omitempty"`
+}
+
+// InvoiceList is a page of a merchant's invoices, newest number first
+type InvoiceList struct {
+	Invoices   []types.Invoice `json:"invoices"`
+	NextCursor string          `json:"nextCursor,omitempty"`
+}
+
+// PayInvoiceRequest pays Amount of an invoice, or all that is still due when
+// Amount is zero
+type PayInvoiceRequest struct {
+	Amount types.Money `json:"amount"`
+}
+
+// InvoicePaymentStarted is a payment saga started to pay an invoice
+type InvoicePaymentStarted struct {
+	InvoiceID    string      `json:"invoiceId"`
+	Amount       types.Money `json:"amount"`
+	ExecutionArn string      `json:"executionArn"`
+}
+
+// CreateInvoice issues an invoice under its merchant's next number
+func (s *PaymentService) CreateInvoice(ctx context.Context, req CreateInvoiceRequest) (*types.Invoice, error) {
+	if err := validateCreateInvoiceRequest(req); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	invoice := &types.Invoice{
+		ID:         uuid.New().String(),
+		MerchantID: req.MerchantID,
+		UserID:     req.UserID,
+		Currency:   strings.ToUpper(req.Currency),
+		LineItems:  req.LineItems,
+		Discounts:  req.Discounts,
+		Taxes:      req.Taxes,
+		Status:     types.InvoiceStatusIssued,
+		DueDate:    req.DueDate.UTC(),
+		IssuedAt:   now,
+		Metadata:   req.Metadata,
+		Version:    1,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := invoice.Calculate(); err != nil {
+		return nil, apperrors.NewValidationError(err.Error(), nil)
+	}
+
+	var err error
+	for attempt := 0; attempt < invoiceWriteAttempts; attempt++ {
+		if err = s.repo.CreateInvoice(ctx, invoice); !errors.Is(err, repository.ErrInvoiceNumberTaken) {
+			break
+		}
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrInvoiceNumberTaken) {
+			return nil, apperrors.NewConcurrentUpdateError("invoice number")
+		}
+		s.logger.Error("Failed to create invoice", err, map[string]interface{}{
+			"merchantId": req.MerchantID,
+		})
+		return nil, fmt.Errorf("failed to create invoice: %w", err)
+	}
+
+	s.logger.Info("Invoice issued", map[string]interface{}{
+		"invoiceId":  invoice.ID,
+		"merchantId": invoice.MerchantID,
+		"number":     invoice.Number,
+		"total":      invoice.Total,
+	})
+
+	return invoice, nil
+}
+
+// GetInvoice retrieves an invoice by ID
+func (s *PaymentService) GetInvoice(ctx context.Context, invoiceID string) (*types.Invoice, error) {
+	if invoiceID == "" {
+		return nil, apperrors.NewValidationError("invoice ID is required", nil)
+	}
+
+	return s.repo.GetInvoice(ctx, invoiceID)
+}
+
+// UpdateInvoice changes the items, discounts, taxes, due date or metadata of
+// an issued invoice nothing has been paid against yet
+func (s *PaymentService) UpdateInvoice(ctx context.Context, invoiceID string, req UpdateInvoiceRequest) (*types.Invoice, error) {
+	return s.changeInvoice(ctx, invoiceID, func(invoice *types.Invoice, now time.Time) error {
+		if err := checkInvoiceUnpaid(invoice); err != nil {
+			return err
+		}
+
+		if req.LineItems != nil {
+			invoice.LineItems = req.LineItems
+		}
+		if req.Discounts != nil {
+			invoice.Discounts = req.Discounts
+		}
+		if req.Taxes != nil {
+			invoice.Taxes = req.Taxes
+		}
+		if req.DueDate != nil {
+			invoice.DueDate = req.DueDate.UTC()
+		}
+		if req.Metadata != nil {
+			invoice.Metadata = req.Metadata
+		}
+
+		if err := validateInvoiceLines(invoice.LineItems, invoice.Discounts, invoice.Taxes); err != nil {
+			return err
+		}
+		if err := invoice.Calculate(); err != nil {
+			return apperrors.NewValidationError(err.Error(), nil)
+		}
+		return nil
+	})
+}
+
+// VoidInvoice cancels an issued invoice nothing has been paid against. It
+// keeps its number and can no longer be paid.
+func (s *PaymentService) VoidInvoice(ctx context.Context, invoiceID, reason string) (*types.Invoice, error) {
+	return s.changeInvoice(ctx, invoiceID, func(invoice *types.Invoice, now time.Time) error {
+		if err := checkInvoiceUnpaid(invoice); err != nil {
+			return err
+		}
+
+		invoice.Status = types.InvoiceStatusVoid
+		invoice.VoidedAt = &now
+		invoice.VoidReason = reason
+		return nil
+	})
+}
+
+// ListInvoices returns a page of a merchant's invoices
+func (s *PaymentService) ListInvoices(ctx context.Context, req ListInvoicesRequest) (*InvoiceList, error) {
+	query, err := buildInvoiceQuery(req)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := s.repo.ListInvoices(ctx, query)
+	if err != nil {
+		s.logger.Error("Failed to list invoices", err, map[string]interface{}{
+			"merchantId": req.MerchantID,
+		})
+		return nil, err
+	}
+
+	nextCursor, err := utils.EncodeCursor(page.LastEvaluatedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &InvoiceList{
+		Invoices:   page.Invoices,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// PayInvoice starts the payment saga for part or all of what is still due on
+// an invoice and not reserved by payments in flight. The payment reserves its
+// amount when the saga creates it, and is applied when the saga completes.
+func (s *PaymentService) PayInvoice(ctx context.Context, invoiceID string, req PayInvoiceRequest) (*InvoicePaymentStarted, error) {
+	if s.saga == nil {
+		return nil, fmt.Errorf("payment saga is not configured")
+	}
+
+	invoice, err := s.GetInvoice(ctx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := req.Amount
+	if amount.IsZero() {
+		amount = invoice.AmountPayable()
+	}
+	if err := checkInvoicePayment(invoice, invoice.UserID, amount); err != nil {
+		return nil, err
+	}
+
+	executionArn, err := s.saga.Start(ctx, uuid.New().String(), repository.SagaInput{
+		UserID: invoice.UserID,
+		Amount: amount,
+		Metadata: map[string]string{
+			invoiceMetadataKey: invoice.ID,
+			"merchantId":       invoice.MerchantID,
+		},
+	})
+	if err != nil {
+		s.logger.Error("Failed to start invoice payment", err, map[string]interface{}{
+			"invoiceId": invoice.ID,
+		})
+		return nil, err
+	}
+
+	s.logger.Info("Invoice payment started", map[string]interface{}{
+		"invoiceId":    invoice.ID,
+		"amount":       amount,
+		"executionArn": executionArn,
+	})
+
+	return &InvoicePaymentStarted{
+		InvoiceID:    invoice.ID,
+		Amount:       amount,
+		ExecutionArn: executionArn,
+	}, nil
+}
+
+// linkInvoice attaches a new payment to the invoice named in its metadata,
+// if any, reserving the payment's amount on the invoice. The saga creates the
+// payment before it holds any funds, so a payment that could not take its
+// part of the invoice fails before money moves, and one that did is sure to
+// find the invoice open when it completes.
+func (s *PaymentService) linkInvoice(ctx context.Context, payment *types.Payment) error {
+	invoiceID := payment.Metadata[invoiceMetadataKey]
+	if invoiceID == "" {
+		return nil
+	}
+
+	_, err := s.changeInvoice(ctx, invoiceID, func(invoice *types.Invoice, now time.Time) error {
+		if invoice.HasReservation(payment.ID) {
+			return errInvoiceUnchanged
+		}
+		if err := checkInvoicePayment(invoice, payment.UserID, payment.Amount); err != nil {
+			return err
+		}
+		return invoice.Reserve(payment.ID, payment.Amount, now)
+	})
+	if err != nil && !errors.Is(err, errInvoiceUnchanged) {
+		return err
+	}
+
+	payment.InvoiceID = invoiceID
+	return nil
+}
+
+// releaseInvoice gives back the part of its invoice a payment that failed or
+// was cancelled had reserved. Releasing it twice is a no-op.
+func (s *PaymentService) releaseInvoice(ctx context.Context, payment *types.Payment) error {
+	if payment.InvoiceID == "" {
+		return nil
+	}
+
+	_, err := s.changeInvoice(ctx, payment.InvoiceID, func(invoice *types.Invoice, now time.Time) error {
+		if !invoice.Release(payment.ID) {
+			return errInvoiceUnchanged
+		}
+		return nil
+	})
+	if errors.Is(err, errInvoiceUnchanged) {
+		return nil
+	}
+	return err
+}
+
+// settleInvoice applies a completed payment to its invoice, marking the
+// invoice paid once its total is covered. Applying a payment twice is a
+// no-op, so a repeated COMPLETED update settles it once. The payment's
+// reservation keeps the invoice open until then; an invoice closed anyway is
+// reported as a conflict rather than dropping the payment.
+func (s *PaymentService) settleInvoice(ctx context.Context, payment *types.Payment) error {
+	if payment.InvoiceID == "" {
+		return nil
+	}
+
+	_, err := s.changeInvoice(ctx, payment.InvoiceID, func(invoice *types.Invoice, now time.Time) error {
+		if invoice.HasPayment(payment.ID) {
+			return errInvoiceUnchanged
+		}
+		if invoice.Status != types.InvoiceStatusIssued {
+			return apperrors.NewInvoiceStatusError(invoice.ID, string(invoice.Status))
+		}
+		return invoice.ApplyPayment(payment.ID, payment.Amount, now)
+	})
+	if errors.Is(err, errInvoiceUnchanged) {
+		return nil
+	}
+	if err != nil {
+		s.logger.Error("Failed to settle invoice", err, map[string]interface{}{
+			"invoiceId": payment.InvoiceID,
+			"paymentId": payment.ID,
+		})
+	}
+	return err
+}
+
+// errInvoiceUnchanged stops changeInvoice without writing the invoice
+var errInvoiceUnchanged = errors.New("invoice unchanged")
+
+// changeInvoice applies change to the current state of an invoice and saves
+// it with optimistic locking, starting over from a fresh read if another
+// write got in first
+func (s *PaymentService) changeInvoice(ctx context.Context, invoiceID string, change func(*types.Invoice, time.Time) error) (*types.Invoice, error) {
+	for attempt := 0; attempt < invoiceWriteAttempts; attempt++ {
+		invoice, err := s.GetInvoice(ctx, invoiceID)
+		if err != nil {
+			return nil, err
+		}
+
+		version := invoice.Version
+		if err := change(invoice, time.Now().UTC()); err != nil {
+			return nil, err
+		}
+
+		err = s.repo.UpdateInvoice(ctx, invoice, version)
+		if errors.Is(err, repository.ErrInvoiceChanged) {
+			continue
+		}
+		if err != nil {
+			s.logger.Error("Failed to update invoice", err, map[string]interface{}{
+				"invoiceId": invoiceID,
+			})
+			return nil, err
+		}
+
+		s.logger.Info("Invoice updated", map[string]interface{}{
+			"invoiceId":  invoice.ID,
+			"status":     invoice.Status,
+			"amountPaid": invoice.AmountPaid,
+		})
+		return invoice, nil
+	}
+
+	return nil, apperrors.NewConcurrentUpdateError("invoice")
+}
+
+// checkInvoiceUnpaid reports an invoice that can no longer be changed or
+// voided, because it is closed, has payments applied or has payments in flight
+func checkInvoiceUnpaid(invoice *types.Invoice) error {
+	if invoice.Status != types.InvoiceStatusIssued {
+		return apperrors.NewInvoiceStatusError(invoice.ID, string(invoice.Status))
+	}
+	if len(invoice.Payments) > 0 {
+		return apperrors.NewInvoiceStatusError(invoice.ID, "partially paid")
+	}
+	if len(invoice.Reservations) > 0 {
+		return apperrors.NewInvoiceStatusError(invoice.ID, "being paid")
+	}
+	return nil
+}
+
+// checkInvoicePayment reports whether userID can pay amount against invoice
+func checkInvoicePayment(invoice *types.Invoice, userID string, amount types.Money) error {
+	if invoice.Status != types.InvoiceStatusIssued {
+		return apperrors.NewInvoiceStatusError(invoice.ID, string(invoice.Status))
+	}
+	if userID != invoice.UserID {
+		return apperrors.NewValidationError("invoice is billed to another user", map[string]interface{}{
+			"invoiceId": invoice.ID,
+		})
+	}
+	if !amount.SameCurrency(invoice.Total) {
+		return apperrors.NewCurrencyMismatchError(invoice.Currency, amount.Currency)
+	}
+	if !amount.IsPositive() || amount.Amount > invoice.AmountPayable().Amount {
+		return apperrors.NewValidationError("amount must be greater than 0 and at most the amount due", map[string]interface{}{
+			"invoiceId":      invoice.ID,
+			"amountDue":      invoice.AmountDue(),
+			"amountReserved": invoice.AmountReserved,
+		})
+	}
+	return nil
+}
+
+// validateCreateInvoiceRequest validates the invoice creation request
+func validateCreateInvoiceRequest(req CreateInvoiceRequest) error {
+	if req.MerchantID == "" {
+		return apperrors.NewValidationError("merchantId is required", nil)
+	}
+	if req.UserID == "" {
+		return apperrors.NewValidationError("userId is required", nil)
+	}
+	if len(req.Currency) != 3 {
+		return apperrors.NewValidationError("invalid currency format", nil)
+	}
+	if req.DueDate.IsZero() {
+		return apperrors.NewValidationError("dueDate is required", nil)
+	}
+	return validateInvoiceLines(req.LineItems, req.Discounts, req.Taxes)
+}
+
+// validateInvoiceLines validates the billed lines of an invoice. Amounts are
+// checked against the currency by Invoice.Calculate.
+func validateInvoiceLines(items []types.InvoiceLineItem, discounts []types.InvoiceDiscount, taxes []types.InvoiceTax) error {
+	if len(items) == 0 {
+		return apperrors.NewValidationError("an invoice needs at least one line item", nil)
+	}
+	for i, item := range items {
+		if item.Description == "" || item.Quantity <= 0 || item.UnitPrice.IsNegative() {
+			return apperrors.NewValidationError("line items need a description, a positive quantity and a unit price of at least 0", map[string]interface{}{
+				"lineItem": i + 1,
+			})
+		}
+	}
+	for i, discount := range discounts {
+		if discount.RateBasisPoints < 0 || discount.RateBasisPoints > 10000 || (discount.RateBasisPoints == 0 && !discount.Amount.IsPositive()) {
+			return apperrors.NewValidationError("discounts need a positive amount or a rate between 1 and 10000 basis points", map[string]interface{}{
+				"discount": i + 1,
+			})
+		}
+	}
+	for i, tax := range taxes {
+		if tax.Name == "" || tax.RateBasisPoints <= 0 {
+			return apperrors.NewValidationError("taxes need a name and a positive rate in basis points", map[string]interface{}{
+				"tax": i + 1,
+			})
+		}
+	}
+	return nil
+}
+
+// buildInvoiceQuery validates an invoice list request and converts it to a repository query
+func buildInvoiceQuery(req ListInvoicesRequest) (repository.InvoiceQuery, error) {
+	query := repository.InvoiceQuery{
+		MerchantID: req.MerchantID,
+		Status:     types.InvoiceStatus(strings.ToUpper(req.Status)),
+		Limit:      req.Limit,
+	}
+
+	if req.MerchantID == "" {
+		return query, apperrors.NewValidationError("merchantId is required", nil)
+	}
+
+	switch query.Status {
+	case "", types.InvoiceStatusIssued, types.InvoiceStatusPaid, types.InvoiceStatusVoid:
+	default:
+		return query, apperrors.NewValidationError(fmt.Sprintf("invalid invoice status: %s", req.Status), nil)
+	}
+
+	switch {
+	case req.Limit < 0:
+		return query, apperrors.NewValidationError("limit must be greater than 0", nil)
+	case req.Limit == 0:
+		query.Limit = defaultInvoicePageSize
+	case req.Limit > maxInvoicePageSize:
+		query.Limit = maxInvoicePageSize
+	}
+
+	var err error
+	if query.ExclusiveStartKey, err = utils.DecodeCursor(req.Cursor); err != nil {
+		return query, apperrors.NewValidationError(err.Error(), nil)
+	}
+	// A cursor is only valid for the merchant whose invoices produced it
+	if merchantKey, ok := query.ExclusiveStartKey["MerchantID"]; req.Cursor != "" && (!ok || merchantKey.S == nil || *merchantKey.S != req.MerchantID) {
+		return query, apperrors.NewValidationError("invalid cursor", nil)
+	}
+
+	return query, nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/observability"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/draftea-coding-challenge/shared/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validCreateInvoiceRequest() CreateInvoiceRequest {
+	return CreateInvoiceRequest{
+		MerchantID: "merchant-1",
+		UserID:     "user123",
+		Currency:   "USD",
+		LineItems: []types.InvoiceLineItem{
+			{Description: "Season pass", Quantity: 1, UnitPrice: types.NewMoney(4999, "USD")},
+		},
+		Taxes:   []types.InvoiceTax{{Name: "VAT", RateBasisPoints: 2100}},
+		DueDate: time.Now().Add(30 * 24 * time.Hour),
+	}
+}
+
+func TestCreateInvoice_ValidationError(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewPaymentService(nil, logger)
+
+	cases := map[string]func(*CreateInvoiceRequest){
+		"merchantId is required":  func(r *CreateInvoiceRequest) { r.MerchantID = "" },
+		"userId is required":      func(r *CreateInvoiceRequest) { r.UserID = "" },
+		"invalid currency format": func(r *CreateInvoiceRequest) { r.Currency = "US" },
+		"dueDate is required":     func(r *CreateInvoiceRequest) { r.DueDate = time.Time{} },
+		"at least one line item":  func(r *CreateInvoiceRequest) { r.LineItems = nil },
+		"positive quantity":       func(r *CreateInvoiceRequest) { r.LineItems[0].Quantity = 0 },
+		"basis points": func(r *CreateInvoiceRequest) {
+			r.Discounts = []types.InvoiceDiscount{{Description: "Bad", RateBasisPoints: 20000}}
+		},
+		"taxes need a name": func(r *CreateInvoiceRequest) { r.Taxes[0].Name = "" },
+		"currency mismatch": func(r *CreateInvoiceRequest) { r.LineItems[0].UnitPrice = types.NewMoney(4999, "EUR") },
+		"exceed the subtotal": func(r *CreateInvoiceRequest) {
+			r.Discounts = []types.InvoiceDiscount{{Description: "Too much", Amount: types.NewMoney(5000, "USD")}}
+		},
+	}
+
+	for expected, mutate := range cases {
+		req := validCreateInvoiceRequest()
+		mutate(&req)
+
+		_, err := service.CreateInvoice(context.Background(), req)
+
+		var appErr *apperrors.AppError
+		require.ErrorAs(t, err, &appErr, expected)
+		assert.Equal(t, 400, appErr.StatusCode)
+		assert.Contains(t, err.Error(), expected)
+	}
+}
+
+func TestCheckInvoicePayment(t *testing.T) {
+	invoice := &types.Invoice{ID: "inv-1", UserID: "user123", Currency: "USD", Status: types.InvoiceStatusIssued}
+	invoice.LineItems = []types.InvoiceLineItem{{Description: "Season pass", Quantity: 1, UnitPrice: types.NewMoney(5000, "USD")}}
+	require.NoError(t, invoice.Calculate())
+	require.NoError(t, invoice.ApplyPayment("pay-1", types.NewMoney(2000, "USD"), time.Now()))
+
+	assert.NoError(t, checkInvoicePayment(invoice, "user123", types.NewMoney(3000, "USD")))
+	assert.Error(t, checkInvoicePayment(invoice, "user123", types.NewMoney(3001, "USD")))
+	assert.Error(t, checkInvoicePayment(invoice, "someone-else", types.NewMoney(1000, "USD")))
+	assert.Error(t, checkInvoicePayment(invoice, "user123", types.NewMoney(1000, "EUR")))
+
+	// A payment in flight takes its part before it completes
+	require.NoError(t, invoice.Reserve("pay-2", types.NewMoney(1000, "USD"), time.Now()))
+	assert.NoError(t, checkInvoicePayment(invoice, "user123", types.NewMoney(2000, "USD")))
+	assert.Error(t, checkInvoicePayment(invoice, "user123", types.NewMoney(2001, "USD")))
+
+	invoice.Status = types.InvoiceStatusVoid
+	err := checkInvoicePayment(invoice, "user123", types.NewMoney(1000, "USD"))
+	var appErr *apperrors.AppError
+	require.ErrorAs(t, err, &appErr)
+	assert.Equal(t, 409, appErr.StatusCode)
+}
+
+func TestCheckInvoiceUnpaid(t *testing.T) {
+	invoice := &types.Invoice{ID: "inv-1", UserID: "user123", Currency: "USD", Status: types.InvoiceStatusIssued}
+	invoice.LineItems = []types.InvoiceLineItem{{Description: "Season pass", Quantity: 1, UnitPrice: types.NewMoney(5000, "USD")}}
+	require.NoError(t, invoice.Calculate())
+	assert.NoError(t, checkInvoiceUnpaid(invoice))
+
+	// Voiding it now would strand the funds the payment is about to move
+	require.NoError(t, invoice.Reserve("pay-1", types.NewMoney(5000, "USD"), time.Now()))
+	err := checkInvoiceUnpaid(invoice)
+	var appErr *apperrors.AppError
+	require.ErrorAs(t, err, &appErr)
+	assert.Equal(t, 409, appErr.StatusCode)
+
+	invoice.Release("pay-1")
+	assert.NoError(t, checkInvoiceUnpaid(invoice))
+}
+
+func TestBuildInvoiceQuery(t *testing.T) {
+	cursor, err := utils.EncodeCursor(map[string]*dynamodb.AttributeValue{
+		"ID":         {S: aws.String("inv-1")},
+		"MerchantID": {S: aws.String("merchant-1")},
+		"Number":     {N: aws.String("7")},
+	})
+	require.NoError(t, err)
+
+	query, err := buildInvoiceQuery(ListInvoicesRequest{MerchantID: "merchant-1", Status: "paid", Cursor: cursor, Limit: 500})
+	require.NoError(t, err)
+	assert.Equal(t, types.InvoiceStatusPaid, query.Status)
+	assert.Equal(t, int64(maxInvoicePageSize), query.Limit)
+	assert.Equal(t, "inv-1", aws.StringValue(query.ExclusiveStartKey["ID"].S))
+
+	query, err = buildInvoiceQuery(ListInvoicesRequest{MerchantID: "merchant-1"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(defaultInvoicePageSize), query.Limit)
+
+	_, err = buildInvoiceQuery(ListInvoicesRequest{MerchantID: "merchant-2", Cursor: cursor})
+	assert.ErrorContains(t, err, "invalid cursor")
+
+	_, err = buildInvoiceQuery(ListInvoicesRequest{MerchantID: "merchant-1", Status: "overdue"})
+	assert.ErrorContains(t, err, "invalid invoice status")
+}
@@ -2,20 +2,31 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/draftea-coding-challenge/lambdas/invoice-processor/internal/repository"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/idempotency"
+	"github.com/draftea-coding-challenge/shared/ledger"
 	"github.com/draftea-coding-challenge/shared/observability"
 	"github.com/draftea-coding-challenge/shared/types"
 )
 
 // PaymentService handles business logic for payments
 type PaymentService struct {
-	repo   *repository.PaymentRepository
-	logger *observability.Logger
+	repo        *repository.PaymentRepository
+	saga        *repository.SagaClient
+	idempotency *idempotency.Store
+	logger      *observability.Logger
 }
 
+// paymentKeyPrefix scopes payment idempotency keys in the idempotency store,
+// apart from the keys of the HTTP middleware
+const paymentKeyPrefix = "payment#"
+
 // NewPaymentService creates a new payment service
 func NewPaymentService(repo *repository.PaymentRepository, logger *observability.Logger) *PaymentService {
 	return &PaymentService{
@@ -24,11 +35,16 @@ func NewPaymentService(repo *repository.PaymentRepository, logger *observability
 	}
 }
 
+// WithIdempotencyStore sets the store payment idempotency keys are claimed in
+func (s *PaymentService) WithIdempotencyStore(store *idempotency.Store) *PaymentService {
+	s.idempotency = store
+	return s
+}
+
 // CreatePaymentRequest represents a payment creation request
 type CreatePaymentRequest struct {
 	UserID         string            `json:"userId"`
-	Amount         float64           `json:"amount"`
-	Currency       string            `json:"currency"`
+	Amount         types.Money       `json:"amount"`
 	Metadata       map[string]string `json:"metadata,omitempty"`
 	IdempotencyKey string            `json:"idempotencyKey,omitempty"`
 	CorrelationID  string            `json:"correlationId,omitempty"`
@@ -41,25 +57,10 @@ func (s *PaymentService) CreatePayment(ctx context.Context, req CreatePaymentReq
 		return nil, err
 	}
 
-	// Check idempotency
-	if req.IdempotencyKey != "" {
-		existingPayment, err := s.repo.CheckIdempotency(ctx, req.IdempotencyKey)
-		if err != nil {
-			s.logger.Error("Failed to check idempotency", err, nil)
-		} else if existingPayment != nil {
-			s.logger.Info("Idempotent request, returning existing payment", map[string]interface{}{
-				"paymentId":      existingPayment.ID,
-				"idempotencyKey": req.IdempotencyKey,
-			})
-			return existingPayment, nil
-		}
-	}
-
 	// Create payment
 	payment := &types.Payment{
 		UserID:        req.UserID,
 		Amount:        req.Amount,
-		Currency:      req.Currency,
 		Status:        types.PaymentStatusPending,
 		CorrelationID: req.CorrelationID,
 		Metadata:      req.Metadata,
@@ -73,13 +74,17 @@ func (s *PaymentService) CreatePayment(ctx context.Context, req CreatePaymentReq
 		payment.Metadata["idempotencyKey"] = req.IdempotencyKey
 	}
 
-	if err := s.repo.CreatePayment(ctx, payment); err != nil {
+	payment, replayed, err := s.createPaymentOnce(ctx, req.IdempotencyKey, payment)
+	if err != nil {
 		s.logger.Error("Failed to create payment", err, map[string]interface{}{
 			"userId": req.UserID,
 			"amount": req.Amount,
 		})
 		return nil, fmt.Errorf("failed to create payment: %w", err)
 	}
+	if replayed {
+		return payment, nil
+	}
 
 	s.logger.Info("Payment created successfully", map[string]interface{}{
 		"paymentId": payment.ID,
@@ -108,13 +113,14 @@ func (s *PaymentService) GetPayment(ctx context.Context, paymentID string) (*typ
 	return payment, nil
 }
 
-// CreatePaymentFromStepFunction creates a payment from Step Function input
+// CreatePaymentFromStepFunction creates a payment from Step Function input.
+// Input carrying an idempotency key in its metadata, such as a scheduled
+// payment's occurrence, returns the payment already created for that key.
 func (s *PaymentService) CreatePaymentFromStepFunction(ctx context.Context, input types.StepFunctionInput) (*types.Payment, error) {
 	payment := &types.Payment{
 		ID:            input.PaymentID,
 		UserID:        input.UserID,
 		Amount:        input.Amount,
-		Currency:      input.Currency,
 		CorrelationID: input.CorrelationID,
 		Metadata:      input.Metadata,
 		Status:        types.PaymentStatusPending,
@@ -122,17 +128,113 @@ func (s *PaymentService) CreatePaymentFromStepFunction(ctx context.Context, inpu
 		UpdatedAt:     time.Now(),
 	}
 
-	if err := s.repo.CreatePayment(ctx, payment); err != nil {
+	payment, _, err := s.createPaymentOnce(ctx, input.Metadata["idempotencyKey"], payment)
+	if err != nil {
 		return nil, fmt.Errorf("failed to create payment: %w", err)
 	}
 
 	return payment, nil
 }
 
-// UpdatePaymentStatus updates the status of a payment
+// createPaymentOnce creates payment at most once per idempotency key. The key
+// is claimed in the idempotency store, and a key seen before returns the
+// payment created for it, with replayed set. Payments without a key are
+// always created.
+func (s *PaymentService) createPaymentOnce(ctx context.Context, key string, payment *types.Payment) (*types.Payment, bool, error) {
+	if key == "" || s.idempotency == nil {
+		return payment, false, s.storePayment(ctx, payment)
+	}
+
+	request, err := json.Marshal(map[string]interface{}{
+		"userId": payment.UserID,
+		"amount": payment.Amount,
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal idempotent request: %w", err)
+	}
+
+	paymentID, replayed, err := s.idempotency.Do(ctx, paymentKeyPrefix+key, idempotency.HashRequest(string(request)), func() (string, error) {
+		if err := s.storePayment(ctx, payment); err != nil {
+			return "", err
+		}
+		return payment.ID, nil
+	})
+	if err != nil {
+		if paymentID == "" {
+			return nil, false, err
+		}
+		// The payment was created; only recording it under the key failed
+		s.logger.Error("Failed to store payment idempotency key", err, map[string]interface{}{
+			"paymentId":      paymentID,
+			"idempotencyKey": key,
+		})
+	}
+
+	if !replayed {
+		return payment, false, nil
+	}
+
+	s.logger.Info("Idempotent request, returning existing payment", map[string]interface{}{
+		"paymentId":      paymentID,
+		"idempotencyKey": key,
+	})
+
+	existing, err := s.repo.GetPayment(ctx, paymentID)
+	if err != nil {
+		return nil, false, err
+	}
+	return existing, true, nil
+}
+
+// storePayment stores a new payment, linked to the invoice it pays if its
+// metadata names one. The invoice is reserved first, and released again if
+// the payment cannot be stored.
+func (s *PaymentService) storePayment(ctx context.Context, payment *types.Payment) error {
+	if err := s.linkInvoice(ctx, payment); err != nil {
+		return err
+	}
+
+	err := s.repo.CreatePayment(ctx, payment)
+	if err != nil {
+		if releaseErr := s.releaseInvoice(ctx, payment); releaseErr != nil {
+			s.logger.Error("Failed to release invoice of unsaved payment", releaseErr, map[string]interface{}{
+				"invoiceId": payment.InvoiceID,
+				"paymentId": payment.ID,
+			})
+		}
+	}
+	return err
+}
+
+// UpdatePaymentStatus moves a payment to status if its current status allows
+// it. Repeating the update that moved the payment to its current status, as a
+// retried saga step does, succeeds without changing it again; any other move
+// the transitions table does not allow is a conflict.
 func (s *PaymentService) UpdatePaymentStatus(ctx context.Context, paymentID string, status types.PaymentStatus, externalID string) (*types.Payment, error) {
+	if paymentID == "" {
+		return nil, apperrors.NewValidationError("payment ID is required", nil)
+	}
+	if !status.IsValid() {
+		return nil, apperrors.NewValidationError(fmt.Sprintf("invalid payment status %q", status), nil)
+	}
+
 	if err := s.repo.UpdatePaymentStatus(ctx, paymentID, status, externalID); err != nil {
-		return nil, fmt.Errorf("failed to update payment status: %w", err)
+		if !errors.Is(err, repository.ErrPaymentStatusConflict) {
+			return nil, fmt.Errorf("failed to update payment status: %w", err)
+		}
+
+		current, getErr := s.repo.GetPayment(ctx, paymentID)
+		if getErr != nil {
+			return nil, apperrors.NewNotFoundError("payment")
+		}
+		if current.Status != status {
+			s.logger.Warn("Rejected payment status transition", map[string]interface{}{
+				"paymentId": paymentID,
+				"status":    current.Status,
+				"requested": status,
+			})
+			return nil, apperrors.NewPaymentStatusConflictError(paymentID, string(current.Status), string(status))
+		}
 	}
 
 	// Get updated payment
@@ -141,20 +243,82 @@ func (s *PaymentService) UpdatePaymentStatus(ctx context.Context, paymentID stri
 		return nil, fmt.Errorf("failed to get updated payment: %w", err)
 	}
 
+	switch status {
+	case types.PaymentStatusCompleted:
+		if err := s.postGatewayConfirmation(ctx, payment); err != nil {
+			return nil, err
+		}
+		if err := s.settleInvoice(ctx, payment); err != nil {
+			return nil, err
+		}
+	case types.PaymentStatusFailed, types.PaymentStatusCancelled:
+		if err := s.releaseInvoice(ctx, payment); err != nil {
+			return nil, err
+		}
+	}
+
 	return payment, nil
 }
 
+// CancelPayment cancels a PENDING payment. The saga checks for cancellation
+// before holding funds and releases any hold it placed, so no money moves.
+// The update is conditional like any other status change, so it cannot race
+// the saga marking the payment PROCESSING: whichever lands first wins, and a
+// payment already past PENDING is a conflict.
+func (s *PaymentService) CancelPayment(ctx context.Context, paymentID string) (*types.Payment, error) {
+	payment, err := s.UpdatePaymentStatus(ctx, paymentID, types.PaymentStatusCancelled, "")
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Payment cancelled", map[string]interface{}{
+		"paymentId": payment.ID,
+		"userId":    payment.UserID,
+	})
+
+	return payment, nil
+}
+
+// IsPaymentCancelled reports whether a payment was cancelled, for the saga to
+// stop before funds move
+func (s *PaymentService) IsPaymentCancelled(ctx context.Context, paymentID string) (bool, error) {
+	payment, err := s.GetPayment(ctx, paymentID)
+	if err != nil {
+		return false, err
+	}
+	return payment.Status == types.PaymentStatusCancelled, nil
+}
+
+// postGatewayConfirmation moves a completed payment out of gateway clearing
+// into revenue. The entry is keyed by the payment, so a repeated COMPLETED
+// update posts it once.
+func (s *PaymentService) postGatewayConfirmation(ctx context.Context, payment *types.Payment) error {
+	entry, err := ledger.GatewayConfirmation(payment.ID+"#GATEWAY_CONFIRMED", payment.ID, payment.Amount, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to build gateway confirmation: %w", err)
+	}
+
+	if err := s.repo.PostJournalEntry(ctx, entry); err != nil && !errors.Is(err, ledger.ErrEntryExists) {
+		s.logger.Error("Failed to post gateway confirmation", err, map[string]interface{}{
+			"paymentId": payment.ID,
+		})
+		return fmt.Errorf("failed to post gateway confirmation: %w", err)
+	}
+
+	return nil
+}
+
 // validateCreatePaymentRequest validates the payment creation request
 func (s *PaymentService) validateCreatePaymentRequest(req CreatePaymentRequest) error {
 	if req.UserID == "" {
 		return fmt.Errorf("user ID is required")
 	}
 
-	if req.Amount <= 0 {
+	if !req.Amount.IsPositive() {
 		return fmt.Errorf("amount must be greater than 0")
 	}
 
-	if req.Currency == "" || len(req.Currency) != 3 {
+	if len(req.Amount.Currency) != 3 {
 		return fmt.Errorf("invalid currency format")
 	}
 
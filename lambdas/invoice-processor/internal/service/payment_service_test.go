@@ -2,18 +2,21 @@ package service
 
 import (
 	"context"
+	"errors"
 	"testing"
 
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
 	"github.com/draftea-coding-challenge/shared/observability"
+	"github.com/draftea-coding-challenge/shared/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCreatePayment_ValidationError(t *testing.T) {
 	// Test with invalid user ID
 	req := CreatePaymentRequest{
-		UserID:   "",
-		Amount:   100.00,
-		Currency: "USD",
+		UserID: "",
+		Amount: types.NewMoney(10000, "USD"),
 	}
 
 	logger := observability.NewLogger(context.Background(), "test")
@@ -28,9 +31,8 @@ func TestCreatePayment_ValidationError(t *testing.T) {
 func TestCreatePayment_InvalidAmount(t *testing.T) {
 	// Test with invalid amount
 	req := CreatePaymentRequest{
-		UserID:   "user123",
-		Amount:   -100.00,
-		Currency: "USD",
+		UserID: "user123",
+		Amount: types.NewMoney(-10000, "USD"),
 	}
 
 	logger := observability.NewLogger(context.Background(), "test")
@@ -45,9 +47,8 @@ func TestCreatePayment_InvalidAmount(t *testing.T) {
 func TestCreatePayment_MissingCurrency(t *testing.T) {
 	// Test with missing currency
 	req := CreatePaymentRequest{
-		UserID:   "user123",
-		Amount:   100.00,
-		Currency: "",
+		UserID: "user123",
+		Amount: types.NewMoney(10000, ""),
 	}
 
 	logger := observability.NewLogger(context.Background(), "test")
@@ -71,6 +72,24 @@ func TestGetPayment_InvalidID(t *testing.T) {
 }
 
 func TestUpdatePaymentStatus_InvalidPaymentID(t *testing.T) {
-	// Skip this test as it requires a valid repository
-	t.Skip("Requires repository implementation")
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewPaymentService(nil, logger)
+
+	result, err := service.UpdatePaymentStatus(context.Background(), "", types.PaymentStatusCompleted, "")
+
+	assert.Error(t, err)
+	assert.Nil(t, result)
+	assert.Contains(t, err.Error(), "payment ID is required")
+}
+
+func TestUpdatePaymentStatus_InvalidStatus(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewPaymentService(nil, logger)
+
+	result, err := service.UpdatePaymentStatus(context.Background(), "pay-1", types.PaymentStatus("completed"), "")
+
+	var appErr *apperrors.AppError
+	require.True(t, errors.As(err, &appErr))
+	assert.Equal(t, apperrors.ErrCodeValidation, appErr.Code)
+	assert.Nil(t, result)
 }
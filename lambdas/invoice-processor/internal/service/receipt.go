@@ -0,0 +1,266 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// Receipt formats
+const (
+	ReceiptFormatHTML = "html"
+	ReceiptFormatText = "text"
+	ReceiptFormatPDF  = "pdf"
+)
+
+const (
+	// latestReceiptTemplateVersion is the template version receipts are
+	// rendered with unless another is requested. A published version is
+	// never edited: changes go in a new version directory, so a receipt
+	// rendered again with its original version comes out the same.
+	latestReceiptTemplateVersion = "v1"
+
+	defaultReceiptLocale = "en"
+
+	// refundEventType is the PaymentEvents type the refund service records
+	// for each refund of a payment
+	refundEventType = "REFUNDED"
+)
+
+// receiptTemplates holds one directory per template version, each with one
+// directory per locale holding receipt.html.tmpl and receipt.txt.tmpl
+//
+//go:embed templates/receipts
+var receiptTemplates embed.FS
+
+// receiptLocale is how amounts and dates are written in a locale
+type receiptLocale struct {
+	decimalSeparator string
+	dateLayout       string
+}
+
+var receiptLocales = map[string]receiptLocale{
+	"en": {decimalSeparator: ".", dateLayout: "Jan 2, 2006 15:04 UTC"},
+	"es": {decimalSeparator: ",", dateLayout: "02/01/2006 15:04 UTC"},
+}
+
+// ReceiptRequest asks for the receipt of a payment in Format, written for
+// Locale (a language tag such as "es" or "es-AR") with template Version.
+// Empty fields take the defaults: HTML, English and the latest version.
+type ReceiptRequest struct {
+	PaymentID string `json:"paymentId"`
+	Format    string `json:"format,omitempty"`
+	Locale    string `json:"locale,omitempty"`
+	Version   string `json:"version,omitempty"`
+}
+
+// ReceiptRefund is one refund listed on a receipt
+type ReceiptRefund struct {
+	ID         string      `json:"id"`
+	Amount     types.Money `json:"amount"`
+	Reason     string      `json:"reason,omitempty"`
+	RefundedAt time.Time   `json:"refundedAt"`
+}
+
+// Receipt is what a receipt document shows: the payment, its refunds and what
+// is left of it after them
+type Receipt struct {
+	Payment         types.Payment   `json:"payment"`
+	Refunds         []ReceiptRefund `json:"refunds"`
+	RefundedTotal   types.Money     `json:"refundedTotal"`
+	NetAmount       types.Money     `json:"netAmount"`
+	Locale          string          `json:"locale"`
+	TemplateVersion string          `json:"templateVersion"`
+	GeneratedAt     time.Time       `json:"generatedAt"`
+}
+
+// ReceiptDocument is a rendered receipt
+type ReceiptDocument struct {
+	ContentType string
+	Filename    string
+	Body        []byte
+}
+
+// GetReceipt renders the receipt of a completed, or since refunded, payment
+// from the payment and its events
+func (s *PaymentService) GetReceipt(ctx context.Context, req ReceiptRequest) (*ReceiptDocument, error) {
+	if req.PaymentID == "" {
+		return nil, apperrors.NewValidationError("payment ID is required", nil)
+	}
+	format, locale, version, err := resolveReceiptOptions(req)
+	if err != nil {
+		return nil, err
+	}
+
+	payment, err := s.repo.GetPayment(ctx, req.PaymentID)
+	if err != nil {
+		return nil, apperrors.NewNotFoundError("payment")
+	}
+	switch payment.Status {
+	case types.PaymentStatusCompleted, types.PaymentStatusRefunded, types.PaymentStatusPartiallyRefunded:
+	default:
+		return nil, apperrors.NewReceiptNotReadyError(payment.ID, string(payment.Status))
+	}
+
+	events, err := s.repo.ListPaymentEvents(ctx, payment.ID)
+	if err != nil {
+		s.logger.Error("Failed to list payment events", err, map[string]interface{}{
+			"paymentId": payment.ID,
+		})
+		return nil, err
+	}
+
+	receipt, err := buildReceipt(payment, events)
+	if err != nil {
+		return nil, err
+	}
+	receipt.Locale = locale
+	receipt.TemplateVersion = version
+	receipt.GeneratedAt = time.Now().UTC()
+
+	document, err := renderReceipt(receipt, format)
+	if err != nil {
+		s.logger.Error("Failed to render receipt", err, map[string]interface{}{
+			"paymentId": payment.ID,
+			"format":    format,
+			"locale":    locale,
+			"version":   version,
+		})
+		return nil, fmt.Errorf("failed to render receipt: %w", err)
+	}
+
+	return document, nil
+}
+
+// resolveReceiptOptions applies the defaults to a receipt request and checks
+// a template exists for its version and locale. A regional locale such as
+// "es-AR" uses its language's templates.
+func resolveReceiptOptions(req ReceiptRequest) (format, locale, version string, err error) {
+	format = strings.ToLower(req.Format)
+	switch format {
+	case "":
+		format = ReceiptFormatHTML
+	case "txt":
+		format = ReceiptFormatText
+	case ReceiptFormatHTML, ReceiptFormatText, ReceiptFormatPDF:
+	default:
+		return "", "", "", apperrors.NewValidationError("format must be html, text or pdf", nil)
+	}
+
+	locale = strings.ToLower(req.Locale)
+	if language, _, found := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-"); found {
+		locale = language
+	}
+	if locale == "" {
+		locale = defaultReceiptLocale
+	}
+
+	version = req.Version
+	if version == "" {
+		version = latestReceiptTemplateVersion
+	}
+
+	if _, statErr := fs.Stat(receiptTemplates, path.Join("templates/receipts", version)); statErr != nil {
+		return "", "", "", apperrors.NewValidationError(fmt.Sprintf("unknown receipt template version: %s", req.Version), nil)
+	}
+	if _, ok := receiptLocales[locale]; !ok {
+		return "", "", "", apperrors.NewValidationError(fmt.Sprintf("unsupported receipt locale: %s", req.Locale), nil)
+	}
+	if _, statErr := fs.Stat(receiptTemplates, path.Join("templates/receipts", version, locale)); statErr != nil {
+		return "", "", "", apperrors.NewValidationError(fmt.Sprintf("receipt template %s has no %s locale", version, locale), nil)
+	}
+
+	return format, locale, version, nil
+}
+
+// buildReceipt collects a payment's refunds from its events, oldest first
+func buildReceipt(payment *types.Payment, events []types.PaymentEvent) (*Receipt, error) {
+	receipt := &Receipt{
+		Payment:       *payment,
+		Refunds:       []ReceiptRefund{},
+		RefundedTotal: types.NewMoney(0, payment.Amount.Currency),
+	}
+
+	for _, event := range events {
+		if event.EventType != refundEventType {
+			continue
+		}
+
+		refunded, err := receipt.RefundedTotal.Add(event.Amount)
+		if err != nil {
+			return nil, fmt.Errorf("refund %s: %w", event.ID, err)
+		}
+		receipt.RefundedTotal = refunded
+
+		reason, _ := event.Metadata["reason"].(string)
+		receipt.Refunds = append(receipt.Refunds, ReceiptRefund{
+			ID:         event.ID,
+			Amount:     event.Amount,
+			Reason:     reason,
+			RefundedAt: event.Timestamp,
+		})
+	}
+
+	net, err := payment.Amount.Sub(receipt.RefundedTotal)
+	if err != nil {
+		return nil, err
+	}
+	receipt.NetAmount = net
+
+	return receipt, nil
+}
+
+// renderReceipt renders a receipt with the templates of its version and
+// locale. PDF receipts lay out the plain-text rendering.
+func renderReceipt(receipt *Receipt, format string) (*ReceiptDocument, error) {
+	dir := path.Join("templates/receipts", receipt.TemplateVersion, receipt.Locale)
+	funcs := receiptTemplateFuncs(receiptLocales[receipt.Locale])
+	filename := "receipt-" + receipt.Payment.ID
+
+	var body bytes.Buffer
+	if format == ReceiptFormatHTML {
+		tmpl, err := htmltemplate.New("receipt.html.tmpl").Funcs(funcs).ParseFS(receiptTemplates, path.Join(dir, "receipt.html.tmpl"))
+		if err != nil {
+			return nil, err
+		}
+		if err := tmpl.Execute(&body, receipt); err != nil {
+			return nil, err
+		}
+		return &ReceiptDocument{ContentType: "text/html; charset=utf-8", Filename: filename + ".html", Body: body.Bytes()}, nil
+	}
+
+	tmpl, err := texttemplate.New("receipt.txt.tmpl").Funcs(funcs).ParseFS(receiptTemplates, path.Join(dir, "receipt.txt.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(&body, receipt); err != nil {
+		return nil, err
+	}
+
+	if format == ReceiptFormatPDF {
+		return &ReceiptDocument{ContentType: "application/pdf", Filename: filename + ".pdf", Body: writePDF(body.String())}, nil
+	}
+	return &ReceiptDocument{ContentType: "text/plain; charset=utf-8", Filename: filename + ".txt", Body: body.Bytes()}, nil
+}
+
+// receiptTemplateFuncs formats amounts and dates for a locale
+func receiptTemplateFuncs(locale receiptLocale) map[string]interface{} {
+	return map[string]interface{}{
+		"money": func(m types.Money) string {
+			return strings.Replace(m.Decimal(), ".", locale.decimalSeparator, 1) + " " + m.Currency
+		},
+		"date": func(t time.Time) string {
+			return t.UTC().Format(locale.dateLayout)
+		},
+	}
+}
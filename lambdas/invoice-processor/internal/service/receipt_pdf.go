@@ -0,0 +1,102 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// PDF page layout in points: A4 in 10pt Courier, which fits 80 characters a
+// line between the margins
+const (
+	pdfPageWidth  = 595
+	pdfPageHeight = 842
+	pdfMargin     = 56
+	pdfFontSize   = 10
+	pdfLeading    = 14
+	pdfLineLength = 80
+)
+
+// writePDF lays text out line by line on as many A4 pages as it takes, in the
+// standard Courier font so plain-text columns stay aligned. Lines longer than
+// a page is wide are wrapped. Standard fonts only cover Latin-1, so any other
+// character is written as '?'.
+func writePDF(text string) []byte {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		runes := []rune(strings.ReplaceAll(line, "\t", "    "))
+		for len(runes) > pdfLineLength {
+			lines = append(lines, string(runes[:pdfLineLength]))
+			runes = runes[pdfLineLength:]
+		}
+		lines = append(lines, string(runes))
+	}
+
+	perPage := (pdfPageHeight - 2*pdfMargin) / pdfLeading
+	var pages [][]string
+	for len(lines) > perPage {
+		pages = append(pages, lines[:perPage])
+		lines = lines[perPage:]
+	}
+	pages = append(pages, lines)
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects 1 to 3 are the catalog, the page tree and the font; each page
+	// is then followed by its content stream
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, page := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 5+2*i))
+
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", pdfFontSize, pdfLeading, pdfMargin, pdfPageHeight-pdfMargin-pdfFontSize)
+		for _, line := range page {
+			content.WriteByte('(')
+			content.Write(pdfText(line))
+			content.WriteString(") Tj T*\n")
+		}
+		content.WriteString("ET")
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes()
+}
+
+// pdfText encodes a line as the bytes of a PDF literal string in
+// WinAnsiEncoding, escaping the delimiters
+func pdfText(line string) []byte {
+	encoded := make([]byte, 0, len(line))
+	for _, r := range line {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			encoded = append(encoded, '\\', byte(r))
+		case r < 0x20 || (r >= 0x7f && r < 0xa0) || r > 0xff:
+			encoded = append(encoded, '?')
+		default:
+			encoded = append(encoded, byte(r))
+		}
+	}
+	return encoded
+}
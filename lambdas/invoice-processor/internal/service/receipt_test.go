@@ -0,0 +1,114 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/draftea-coding-challenge/shared/observability"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestReceipt(t *testing.T) *Receipt {
+	paidAt := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	payment := &types.Payment{
+		ID:         "pay-1",
+		UserID:     "user123",
+		Amount:     types.NewMoney(10050, "USD"),
+		Status:     types.PaymentStatusPartiallyRefunded,
+		ExternalID: "gw_abc123",
+		CreatedAt:  paidAt,
+	}
+	events := []types.PaymentEvent{
+		{ID: "evt-1", EventType: "PAYMENT_CREATED", Amount: payment.Amount, Timestamp: paidAt},
+		{ID: "ref-1", EventType: refundEventType, Amount: types.NewMoney(2500, "USD"), Timestamp: paidAt.Add(time.Hour), Metadata: map[string]interface{}{"reason": "Seat <unavailable>"}},
+		{ID: "ref-2", EventType: refundEventType, Amount: types.NewMoney(1000, "USD"), Timestamp: paidAt.Add(2 * time.Hour)},
+	}
+
+	receipt, err := buildReceipt(payment, events)
+	require.NoError(t, err)
+	receipt.Locale = "en"
+	receipt.TemplateVersion = latestReceiptTemplateVersion
+	receipt.GeneratedAt = paidAt.Add(24 * time.Hour)
+	return receipt
+}
+
+func TestBuildReceipt(t *testing.T) {
+	receipt := newTestReceipt(t)
+
+	require.Len(t, receipt.Refunds, 2)
+	assert.Equal(t, "ref-1", receipt.Refunds[0].ID)
+	assert.Equal(t, "Seat <unavailable>", receipt.Refunds[0].Reason)
+	assert.Equal(t, types.NewMoney(3500, "USD"), receipt.RefundedTotal)
+	assert.Equal(t, types.NewMoney(6550, "USD"), receipt.NetAmount)
+}
+
+func TestRenderReceipt(t *testing.T) {
+	receipt := newTestReceipt(t)
+
+	text, err := renderReceipt(receipt, ReceiptFormatText)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain; charset=utf-8", text.ContentType)
+	assert.Contains(t, string(text.Body), "Partially refunded")
+	assert.Contains(t, string(text.Body), "100.50 USD")
+	assert.Contains(t, string(text.Body), "gw_abc123")
+	assert.Contains(t, string(text.Body), "65.50 USD")
+
+	html, err := renderReceipt(receipt, ReceiptFormatHTML)
+	require.NoError(t, err)
+	assert.Equal(t, "receipt-pay-1.html", html.Filename)
+	assert.Contains(t, string(html.Body), "Seat &lt;unavailable&gt;")
+
+	receipt.Locale = "es"
+	text, err = renderReceipt(receipt, ReceiptFormatText)
+	require.NoError(t, err)
+	assert.Contains(t, string(text.Body), "Reembolsado parcialmente")
+	assert.Contains(t, string(text.Body), "100,50 USD")
+	assert.Contains(t, string(text.Body), "15/01/2024 10:30 UTC")
+
+	pdf, err := renderReceipt(receipt, ReceiptFormatPDF)
+	require.NoError(t, err)
+	assert.Equal(t, "application/pdf", pdf.ContentType)
+	assert.True(t, bytes.HasPrefix(pdf.Body, []byte("%PDF-1.4")))
+	assert.True(t, bytes.HasSuffix(pdf.Body, []byte("%%EOF\n")))
+	assert.Contains(t, string(pdf.Body), "(COMPROBANTE DE PAGO) Tj")
+}
+
+func TestResolveReceiptOptions(t *testing.T) {
+	format, locale, version, err := resolveReceiptOptions(ReceiptRequest{PaymentID: "pay-1", Locale: "es-AR", Format: "PDF"})
+	require.NoError(t, err)
+	assert.Equal(t, ReceiptFormatPDF, format)
+	assert.Equal(t, "es", locale)
+	assert.Equal(t, latestReceiptTemplateVersion, version)
+
+	format, locale, _, err = resolveReceiptOptions(ReceiptRequest{PaymentID: "pay-1"})
+	require.NoError(t, err)
+	assert.Equal(t, ReceiptFormatHTML, format)
+	assert.Equal(t, defaultReceiptLocale, locale)
+}
+
+func TestGetReceipt_ValidationError(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewPaymentService(nil, logger)
+
+	cases := map[string]ReceiptRequest{
+		"payment ID is required":               {},
+		"format must be html, text or pdf":     {PaymentID: "pay-1", Format: "docx"},
+		"unsupported receipt locale":           {PaymentID: "pay-1", Locale: "fr"},
+		"unknown receipt template version: v0": {PaymentID: "pay-1", Version: "v0"},
+	}
+
+	for expected, req := range cases {
+		_, err := service.GetReceipt(context.Background(), req)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), expected)
+	}
+}
+
+func TestPDFText(t *testing.T) {
+	assert.Equal(t, []byte("a\\(b\\)\\\\ \xf1 ?"), pdfText("a(b)\\ ñ €"))
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/draftea-coding-challenge/lambdas/invoice-processor/internal/repository"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// scheduleBatchSize is how many due schedules, and how many running runs,
+// one scheduler invocation handles. The rest are left for the next one.
+const scheduleBatchSize = 25
+
+// Step Functions statuses of a saga execution. SUCCEEDED is a saga that
+// ended in PaymentSuccess; every other final status means the payment failed.
+const (
+	sagaExecutionRunning   = "RUNNING"
+	sagaExecutionSucceeded = "SUCCEEDED"
+)
+
+// ScheduleRunReport summarises one scheduler invocation
+type ScheduleRunReport struct {
+	Started  int `json:"started"`
+	Finished int `json:"finished"`
+	Failed   int `json:"failed"`
+	Paused   int `json:"paused"`
+}
+
+// WithSagaClient sets the client the scheduler starts payment sagas with
+func (s *PaymentService) WithSagaClient(saga *repository.SagaClient) *PaymentService {
+	s.saga = saga
+	return s
+}
+
+// RunSchedules is the scheduler: it records the outcome of runs whose saga
+// has finished, then starts the saga for every schedule that is due. It is
+// run every minute.
+func (s *PaymentService) RunSchedules(ctx context.Context) (*ScheduleRunReport, error) {
+	if s.saga == nil {
+		return nil, fmt.Errorf("payment saga is not configured")
+	}
+
+	report := &ScheduleRunReport{}
+
+	runs, err := s.repo.ListRunningRuns(ctx, scheduleBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	for i := range runs {
+		s.finishRun(ctx, &runs[i], report)
+	}
+
+	schedules, err := s.repo.ListDueSchedules(ctx, time.Now(), scheduleBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	for i := range schedules {
+		s.startRun(ctx, &schedules[i], report)
+	}
+
+	s.logger.Info("Payment schedules run", map[string]interface{}{
+		"started":  report.Started,
+		"finished": report.Finished,
+		"failed":   report.Failed,
+		"paused":   report.Paused,
+	})
+
+	return report, nil
+}
+
+// startRun starts the saga for a due schedule's occurrence and records the
+// run. The execution name and the payment's idempotency key are derived from
+// the occurrence, so an occurrence started twice, by overlapping invocations
+// or a retry after a failed write, still makes one payment.
+func (s *PaymentService) startRun(ctx context.Context, schedule *types.PaymentSchedule, report *ScheduleRunReport) {
+	now := time.Now().UTC()
+	occurrence := schedule.NextRunAt.UTC()
+
+	run := &types.ScheduleRun{
+		ScheduleID:     schedule.ID,
+		OccurrenceAt:   occurrence,
+		UserID:         schedule.UserID,
+		Amount:         schedule.Amount,
+		Status:         types.ScheduleRunStatusRunning,
+		IdempotencyKey: occurrenceIdempotencyKey(schedule.ID, occurrence),
+		StartedAt:      now,
+	}
+
+	metadata := make(map[string]string, len(schedule.Metadata)+3)
+	for k, v := range schedule.Metadata {
+		metadata[k] = v
+	}
+	metadata["idempotencyKey"] = run.IdempotencyKey
+	metadata["scheduleId"] = schedule.ID
+	metadata["occurrenceAt"] = occurrence.Format(time.RFC3339)
+
+	executionArn, startErr := s.saga.Start(ctx, occurrenceExecutionName(schedule.ID, occurrence), repository.SagaInput{
+		UserID:   schedule.UserID,
+		Amount:   schedule.Amount,
+		Metadata: metadata,
+	})
+
+	if startErr != nil {
+		s.logger.Error("Failed to start scheduled payment", startErr, map[string]interface{}{
+			"scheduleId": schedule.ID,
+			"occurrence": occurrence,
+		})
+		run.Status = types.ScheduleRunStatusFailed
+		run.Error = startErr.Error()
+		run.FinishedAt = &now
+	} else {
+		run.ExecutionArn = executionArn
+	}
+
+	// Occurrences missed while the scheduler was behind are skipped rather
+	// than charged all at once
+	after := occurrence
+	if now.After(after) {
+		after = now
+	}
+	next, err := nextOccurrence(schedule, after)
+	if err != nil {
+		s.logger.Error("Failed to compute next occurrence", err, map[string]interface{}{
+			"scheduleId": schedule.ID,
+		})
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		version := schedule.Version
+		schedule.NextRunAt = next
+		if run.Status == types.ScheduleRunStatusFailed {
+			applyRunOutcome(schedule, run)
+		}
+
+		err := s.repo.RecordRun(ctx, schedule, version, run)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, repository.ErrScheduleChanged) || attempt > 0 {
+			s.logger.Error("Failed to record schedule run", err, map[string]interface{}{
+				"scheduleId": schedule.ID,
+				"occurrence": occurrence,
+			})
+			return
+		}
+
+		// The schedule was paused or cancelled since it was read, and the run
+		// is recorded against its new state, or another invocation already
+		// recorded this occurrence and moved the schedule on
+		if schedule, err = s.repo.GetSchedule(ctx, run.ScheduleID); err != nil {
+			s.logger.Error("Failed to get payment schedule", err, map[string]interface{}{
+				"scheduleId": run.ScheduleID,
+			})
+			return
+		}
+		if schedule.NextRunAt == nil || !schedule.NextRunAt.Equal(occurrence) {
+			return
+		}
+	}
+
+	if startErr != nil {
+		report.Failed++
+		s.reportPause(schedule, report)
+		return
+	}
+	report.Started++
+}
+
+// finishRun records the outcome of a run whose saga has finished. Runs still
+// in progress are checked again on the next invocation.
+func (s *PaymentService) finishRun(ctx context.Context, run *types.ScheduleRun, report *ScheduleRunReport) {
+	execution, err := s.saga.Describe(ctx, run.ExecutionArn)
+	if err != nil {
+		s.logger.Error("Failed to check scheduled payment", err, map[string]interface{}{
+			"scheduleId":   run.ScheduleID,
+			"executionArn": run.ExecutionArn,
+		})
+		return
+	}
+	if execution.Status == sagaExecutionRunning {
+		return
+	}
+
+	now := time.Now().UTC()
+	run.FinishedAt = &now
+	run.Status = types.ScheduleRunStatusSucceeded
+	if execution.Status != sagaExecutionSucceeded {
+		run.Status = types.ScheduleRunStatusFailed
+		run.Error = execution.Status
+		if execution.Error != "" {
+			run.Error = fmt.Sprintf("%s: %s", execution.Error, execution.Cause)
+		}
+	}
+
+	schedule, err := s.repo.GetSchedule(ctx, run.ScheduleID)
+	if err != nil {
+		s.logger.Error("Failed to get payment schedule", err, map[string]interface{}{
+			"scheduleId": run.ScheduleID,
+		})
+		return
+	}
+
+	version := schedule.Version
+	applyRunOutcome(schedule, run)
+
+	if err := s.repo.FinishRun(ctx, schedule, version, run); err != nil {
+		if !errors.Is(err, repository.ErrScheduleChanged) {
+			s.logger.Error("Failed to record schedule run outcome", err, map[string]interface{}{
+				"scheduleId": run.ScheduleID,
+				"occurrence": run.OccurrenceAt,
+			})
+		}
+		return
+	}
+
+	report.Finished++
+	if run.Status == types.ScheduleRunStatusFailed {
+		report.Failed++
+		s.reportPause(schedule, report)
+	}
+}
+
+func (s *PaymentService) reportPause(schedule *types.PaymentSchedule, report *ScheduleRunReport) {
+	if schedule.Status != types.ScheduleStatusPaused || schedule.ConsecutiveFailures < schedule.MaxFailures {
+		return
+	}
+
+	report.Paused++
+	s.logger.Warn("Payment schedule paused after consecutive failures", map[string]interface{}{
+		"scheduleId": schedule.ID,
+		"userId":     schedule.UserID,
+		"failures":   schedule.ConsecutiveFailures,
+	})
+}
+
+// applyRunOutcome updates a schedule for the outcome of one of its runs. A
+// success clears the failure count and completes a one-off schedule. A
+// failure counts towards MaxFailures, pausing the schedule when reached; a
+// one-off schedule below it is retried after scheduleRetryDelay. Schedules
+// paused or cancelled while the run was in progress keep their status.
+func applyRunOutcome(schedule *types.PaymentSchedule, run *types.ScheduleRun) {
+	if schedule.LastRunAt == nil || !run.OccurrenceAt.Before(*schedule.LastRunAt) {
+		occurrence := run.OccurrenceAt
+		schedule.LastRunAt = &occurrence
+		schedule.LastRunStatus = run.Status
+	}
+
+	if run.Status == types.ScheduleRunStatusSucceeded {
+		schedule.ConsecutiveFailures = 0
+		if schedule.Status == types.ScheduleStatusActive && schedule.NextRunAt == nil {
+			schedule.Status = types.ScheduleStatusCompleted
+		}
+		return
+	}
+
+	schedule.ConsecutiveFailures++
+	if schedule.Status != types.ScheduleStatusActive {
+		return
+	}
+	if schedule.ConsecutiveFailures >= schedule.MaxFailures {
+		schedule.Status = types.ScheduleStatusPaused
+		return
+	}
+	if schedule.NextRunAt == nil {
+		retryAt := run.FinishedAt.Add(scheduleRetryDelay)
+		schedule.NextRunAt = &retryAt
+	}
+}
+
+// occurrenceIdempotencyKey is the payment idempotency key of one occurrence
+func occurrenceIdempotencyKey(scheduleID string, occurrence time.Time) string {
+	return fmt.Sprintf("schedule#%s#%s", scheduleID, occurrence.UTC().Format(time.RFC3339))
+}
+
+// occurrenceExecutionName is the saga execution name of one occurrence. Step
+// Functions names allow letters, digits, "-" and "_" only.
+func occurrenceExecutionName(scheduleID string, occurrence time.Time) string {
+	return fmt.Sprintf("schedule-%s-%d", scheduleID, occurrence.Unix())
+}
@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/draftea-coding-challenge/lambdas/invoice-processor/internal/repository"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/draftea-coding-challenge/shared/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	// defaultScheduleMaxFailures is how many runs in a row may fail before a
+	// schedule is paused, unless the schedule sets its own
+	defaultScheduleMaxFailures = 3
+
+	// minScheduleInterval matches how often the scheduler runs
+	minScheduleInterval = time.Minute
+
+	// scheduleRetryDelay is how long a failed one-off schedule waits before
+	// its next attempt. Recurring schedules wait for their next occurrence.
+	scheduleRetryDelay = 15 * time.Minute
+
+	// scheduleRunsLimit is how many of a schedule's runs are returned, newest first
+	scheduleRunsLimit = 50
+)
+
+// CreateScheduleRequest registers a payment to run once at RunAt, or on a
+// cron expression or interval from RunAt on. A zero RunAt means now.
+type CreateScheduleRequest struct {
+	UserID      string            `json:"userId"`
+	Amount      types.Money       `json:"amount"`
+	Metadata    map[string]string `json:"metadata,omitempty"`
+	RunAt       time.Time         `json:"runAt,omitempty"`
+	Cron        string            `json:"cron,omitempty"`
+	Interval    string            `json:"interval,omitempty"`
+	MaxFailures int               `json:"maxFailures,omitempty"`
+}
+
+// CreateSchedule registers a scheduled or recurring payment. Its first
+// occurrence is RunAt, or the first cron match at or after it.
+func (s *PaymentService) CreateSchedule(ctx context.Context, req CreateScheduleRequest) (*types.PaymentSchedule, error) {
+	if err := s.validateCreateScheduleRequest(req); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	runAt := req.RunAt.UTC()
+	if req.RunAt.IsZero() {
+		runAt = now
+	}
+
+	schedule := &types.PaymentSchedule{
+		ID:          uuid.New().String(),
+		UserID:      req.UserID,
+		Amount:      req.Amount,
+		Metadata:    req.Metadata,
+		RunAt:       runAt,
+		Cron:        req.Cron,
+		Interval:    req.Interval,
+		Status:      types.ScheduleStatusActive,
+		MaxFailures: req.MaxFailures,
+		Version:     1,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if schedule.MaxFailures == 0 {
+		schedule.MaxFailures = defaultScheduleMaxFailures
+	}
+
+	first := runAt
+	if schedule.Recurring() {
+		next, err := nextOccurrence(schedule, runAt.Add(-time.Nanosecond))
+		if err != nil {
+			return nil, apperrors.NewValidationError(err.Error(), nil)
+		}
+		if next == nil {
+			return nil, apperrors.NewValidationError("schedule never runs", map[string]interface{}{
+				"cron": req.Cron,
+			})
+		}
+		first = *next
+	}
+	schedule.NextRunAt = &first
+
+	if err := s.repo.CreateSchedule(ctx, schedule); err != nil {
+		s.logger.Error("Failed to create payment schedule", err, map[string]interface{}{
+			"userId": req.UserID,
+		})
+		return nil, fmt.Errorf("failed to create payment schedule: %w", err)
+	}
+
+	s.logger.Info("Payment schedule created", map[string]interface{}{
+		"scheduleId": schedule.ID,
+		"userId":     schedule.UserID,
+		"amount":     schedule.Amount,
+		"nextRunAt":  first,
+	})
+
+	return schedule, nil
+}
+
+// GetSchedule retrieves a payment schedule by ID
+func (s *PaymentService) GetSchedule(ctx context.Context, scheduleID string) (*types.PaymentSchedule, error) {
+	if scheduleID == "" {
+		return nil, apperrors.NewValidationError("schedule ID is required", nil)
+	}
+
+	return s.repo.GetSchedule(ctx, scheduleID)
+}
+
+// ListScheduleRuns returns the latest runs of a payment schedule, newest first
+func (s *PaymentService) ListScheduleRuns(ctx context.Context, scheduleID string) ([]types.ScheduleRun, error) {
+	if _, err := s.GetSchedule(ctx, scheduleID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListRuns(ctx, scheduleID, scheduleRunsLimit)
+}
+
+// PauseSchedule stops an active schedule from running until it is resumed.
+// A run already in progress still completes and is recorded.
+func (s *PaymentService) PauseSchedule(ctx context.Context, scheduleID string) (*types.PaymentSchedule, error) {
+	return s.changeSchedule(ctx, scheduleID, func(schedule *types.PaymentSchedule, now time.Time) error {
+		if schedule.Status != types.ScheduleStatusActive {
+			return apperrors.NewScheduleStatusError(schedule.ID, string(schedule.Status))
+		}
+		schedule.Status = types.ScheduleStatusPaused
+		return nil
+	})
+}
+
+// ResumeSchedule reactivates a paused schedule and clears its failure count.
+// It runs next at its first occurrence after now; occurrences missed while
+// paused are skipped, and a one-off schedule runs right away.
+func (s *PaymentService) ResumeSchedule(ctx context.Context, scheduleID string) (*types.PaymentSchedule, error) {
+	return s.changeSchedule(ctx, scheduleID, func(schedule *types.PaymentSchedule, now time.Time) error {
+		if schedule.Status != types.ScheduleStatusPaused {
+			return apperrors.NewScheduleStatusError(schedule.ID, string(schedule.Status))
+		}
+
+		next := &now
+		if schedule.Recurring() {
+			var err error
+			if next, err = nextOccurrence(schedule, now); err != nil {
+				return err
+			}
+			if next == nil {
+				return apperrors.NewScheduleStatusError(schedule.ID, "finished")
+			}
+		}
+
+		schedule.Status = types.ScheduleStatusActive
+		schedule.ConsecutiveFailures = 0
+		schedule.NextRunAt = next
+		return nil
+	})
+}
+
+// CancelSchedule ends an active or paused schedule for good
+func (s *PaymentService) CancelSchedule(ctx context.Context, scheduleID string) (*types.PaymentSchedule, error) {
+	return s.changeSchedule(ctx, scheduleID, func(schedule *types.PaymentSchedule, now time.Time) error {
+		if schedule.Status != types.ScheduleStatusActive && schedule.Status != types.ScheduleStatusPaused {
+			return apperrors.NewScheduleStatusError(schedule.ID, string(schedule.Status))
+		}
+		schedule.Status = types.ScheduleStatusCancelled
+		return nil
+	})
+}
+
+// changeSchedule applies change to the current state of a schedule and saves
+// it with optimistic locking
+func (s *PaymentService) changeSchedule(ctx context.Context, scheduleID string, change func(*types.PaymentSchedule, time.Time) error) (*types.PaymentSchedule, error) {
+	schedule, err := s.GetSchedule(ctx, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	version := schedule.Version
+	if err := change(schedule, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.UpdateSchedule(ctx, schedule, version); err != nil {
+		if errors.Is(err, repository.ErrScheduleChanged) {
+			return nil, apperrors.NewConcurrentUpdateError("payment schedule")
+		}
+		s.logger.Error("Failed to update payment schedule", err, map[string]interface{}{
+			"scheduleId": scheduleID,
+		})
+		return nil, err
+	}
+
+	s.logger.Info("Payment schedule updated", map[string]interface{}{
+		"scheduleId": schedule.ID,
+		"status":     schedule.Status,
+	})
+
+	return schedule, nil
+}
+
+// nextOccurrence returns a schedule's first occurrence strictly after after,
+// or nil if it has none. Interval schedules keep the phase of RunAt.
+func nextOccurrence(schedule *types.PaymentSchedule, after time.Time) (*time.Time, error) {
+	after = after.UTC()
+
+	switch {
+	case schedule.Cron != "":
+		cron, err := utils.ParseCron(schedule.Cron)
+		if err != nil {
+			return nil, err
+		}
+		next := cron.Next(after)
+		if next.IsZero() {
+			return nil, nil
+		}
+		return &next, nil
+
+	case schedule.Interval != "":
+		interval, err := time.ParseDuration(schedule.Interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval %q: %w", schedule.Interval, err)
+		}
+		next := schedule.RunAt.UTC()
+		if !next.After(after) {
+			next = next.Add((after.Sub(next)/interval + 1) * interval)
+		}
+		return &next, nil
+
+	default:
+		return nil, nil
+	}
+}
+
+// validateCreateScheduleRequest validates the schedule creation request
+func (s *PaymentService) validateCreateScheduleRequest(req CreateScheduleRequest) error {
+	if err := s.validateCreatePaymentRequest(CreatePaymentRequest{
+		UserID: req.UserID,
+		Amount: req.Amount,
+	}); err != nil {
+		return apperrors.NewValidationError(err.Error(), nil)
+	}
+
+	if req.Cron != "" && req.Interval != "" {
+		return apperrors.NewValidationError("a schedule takes either cron or interval, not both", nil)
+	}
+
+	if req.Cron != "" {
+		if _, err := utils.ParseCron(req.Cron); err != nil {
+			return apperrors.NewValidationError(err.Error(), nil)
+		}
+	}
+
+	if req.Interval != "" {
+		interval, err := time.ParseDuration(req.Interval)
+		if err != nil {
+			return apperrors.NewValidationError("invalid interval", map[string]interface{}{
+				"interval": req.Interval,
+			})
+		}
+		if interval < minScheduleInterval {
+			return apperrors.NewValidationError("interval must be at least one minute", map[string]interface{}{
+				"interval": req.Interval,
+			})
+		}
+	}
+
+	if req.MaxFailures < 0 {
+		return apperrors.NewValidationError("maxFailures cannot be negative", nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/draftea-coding-challenge/shared/observability"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateSchedule_ValidationError(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewPaymentService(nil, logger)
+
+	valid := CreateScheduleRequest{
+		UserID: "user123",
+		Amount: types.NewMoney(10000, "USD"),
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*CreateScheduleRequest)
+	}{
+		{"missing user", func(r *CreateScheduleRequest) { r.UserID = "" }},
+		{"zero amount", func(r *CreateScheduleRequest) { r.Amount = types.NewMoney(0, "USD") }},
+		{"cron and interval", func(r *CreateScheduleRequest) { r.Cron, r.Interval = "0 0 1 * *", "24h" }},
+		{"invalid cron", func(r *CreateScheduleRequest) { r.Cron = "0 0 32 * *" }},
+		{"invalid interval", func(r *CreateScheduleRequest) { r.Interval = "monthly" }},
+		{"interval too short", func(r *CreateScheduleRequest) { r.Interval = "30s" }},
+		{"negative max failures", func(r *CreateScheduleRequest) { r.MaxFailures = -1 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := valid
+			tt.modify(&req)
+
+			_, err := service.CreateSchedule(context.Background(), req)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNextOccurrence(t *testing.T) {
+	runAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	after := time.Date(2024, 1, 3, 12, 0, 0, 0, time.UTC)
+
+	interval := &types.PaymentSchedule{RunAt: runAt, Interval: "24h"}
+	next, err := nextOccurrence(interval, after)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 1, 4, 9, 0, 0, 0, time.UTC), *next)
+
+	// The first occurrence of an interval schedule is RunAt itself
+	next, err = nextOccurrence(interval, runAt.Add(-time.Nanosecond))
+	assert.NoError(t, err)
+	assert.Equal(t, runAt, *next)
+
+	monthly := &types.PaymentSchedule{RunAt: runAt, Cron: "0 9 1 * *"}
+	next, err = nextOccurrence(monthly, after)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC), *next)
+
+	oneOff := &types.PaymentSchedule{RunAt: runAt}
+	next, err = nextOccurrence(oneOff, after)
+	assert.NoError(t, err)
+	assert.Nil(t, next)
+}
+
+func TestApplyRunOutcome_PausesAfterMaxFailures(t *testing.T) {
+	nextRunAt := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+	schedule := &types.PaymentSchedule{
+		Cron:        "0 9 1 * *",
+		Status:      types.ScheduleStatusActive,
+		NextRunAt:   &nextRunAt,
+		MaxFailures: 2,
+	}
+	finishedAt := time.Date(2024, 1, 1, 9, 5, 0, 0, time.UTC)
+
+	failed := &types.ScheduleRun{
+		OccurrenceAt: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+		Status:       types.ScheduleRunStatusFailed,
+		FinishedAt:   &finishedAt,
+	}
+	applyRunOutcome(schedule, failed)
+	assert.Equal(t, types.ScheduleStatusActive, schedule.Status)
+	assert.Equal(t, 1, schedule.ConsecutiveFailures)
+	assert.Equal(t, nextRunAt, *schedule.NextRunAt)
+
+	succeeded := &types.ScheduleRun{
+		OccurrenceAt: failed.OccurrenceAt.Add(time.Hour),
+		Status:       types.ScheduleRunStatusSucceeded,
+		FinishedAt:   &finishedAt,
+	}
+	applyRunOutcome(schedule, succeeded)
+	assert.Equal(t, 0, schedule.ConsecutiveFailures)
+	assert.Equal(t, types.ScheduleRunStatusSucceeded, schedule.LastRunStatus)
+
+	applyRunOutcome(schedule, failed)
+	applyRunOutcome(schedule, failed)
+	assert.Equal(t, types.ScheduleStatusPaused, schedule.Status)
+	assert.Equal(t, 2, schedule.ConsecutiveFailures)
+	// An older run finishing late does not replace the latest outcome
+	assert.Equal(t, succeeded.OccurrenceAt, *schedule.LastRunAt)
+}
+
+func TestApplyRunOutcome_OneOff(t *testing.T) {
+	finishedAt := time.Date(2024, 1, 1, 9, 5, 0, 0, time.UTC)
+	schedule := &types.PaymentSchedule{
+		Status:      types.ScheduleStatusActive,
+		MaxFailures: 3,
+	}
+
+	// A failed one-off schedule is retried
+	applyRunOutcome(schedule, &types.ScheduleRun{
+		Status:     types.ScheduleRunStatusFailed,
+		FinishedAt: &finishedAt,
+	})
+	assert.Equal(t, types.ScheduleStatusActive, schedule.Status)
+	assert.Equal(t, finishedAt.Add(scheduleRetryDelay), *schedule.NextRunAt)
+
+	// and completes once its payment succeeds
+	schedule.NextRunAt = nil
+	applyRunOutcome(schedule, &types.ScheduleRun{
+		Status:     types.ScheduleRunStatusSucceeded,
+		FinishedAt: &finishedAt,
+	})
+	assert.Equal(t, types.ScheduleStatusCompleted, schedule.Status)
+
+	// A schedule cancelled while its run was in progress stays cancelled
+	cancelled := &types.PaymentSchedule{Status: types.ScheduleStatusCancelled, MaxFailures: 1}
+	applyRunOutcome(cancelled, &types.ScheduleRun{
+		Status:     types.ScheduleRunStatusFailed,
+		FinishedAt: &finishedAt,
+	})
+	assert.Equal(t, types.ScheduleStatusCancelled, cancelled.Status)
+	assert.Nil(t, cancelled.NextRunAt)
+}
+
+func TestOccurrenceKeys_Deterministic(t *testing.T) {
+	occurrence := time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC)
+	local := occurrence.In(time.FixedZone("ART", -3*60*60))
+
+	assert.Equal(t, "schedule#sch-1#2024-02-01T09:00:00Z", occurrenceIdempotencyKey("sch-1", occurrence))
+	assert.Equal(t, occurrenceIdempotencyKey("sch-1", occurrence), occurrenceIdempotencyKey("sch-1", local))
+	assert.Equal(t, "schedule-sch-1-1706778000", occurrenceExecutionName("sch-1", occurrence))
+	assert.NotEqual(t, occurrenceExecutionName("sch-1", occurrence), occurrenceExecutionName("sch-1", occurrence.Add(time.Minute)))
+}
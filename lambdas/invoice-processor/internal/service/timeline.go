@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// Services that record PaymentEvents, named as they are deployed
+const (
+	actorInvoiceProcessor = "invoice-processor"
+	actorWalletService    = "wallet-service"
+	actorRefundService    = "refund-service"
+	actorUnknown          = "unknown"
+)
+
+// legacyTimelineEvents maps the event types recorded before event types were
+// namespaced to their namespaced name and the service recording them
+var legacyTimelineEvents = map[string]struct {
+	eventType string
+	actor     string
+}{
+	"PAYMENT_CREATED": {eventType: "payment.created", actor: actorInvoiceProcessor},
+	refundEventType:   {eventType: string(types.EventRefundCompleted), actor: actorRefundService},
+}
+
+// timelineActors names the service recording each event type namespace
+var timelineActors = map[string]string{
+	"payment": actorInvoiceProcessor,
+	"invoice": actorInvoiceProcessor,
+	"wallet":  actorWalletService,
+	"refund":  actorRefundService,
+}
+
+// TimelineEntry is one event of a payment's history, normalized across the
+// services that record them. EventType is namespaced, e.g. "wallet.debited";
+// SourceEventType is the type as it was recorded. CorrelationID falls back
+// to the payment's when the event did not record one.
+type TimelineEntry struct {
+	EventID         string                 `json:"eventId"`
+	EventType       string                 `json:"eventType"`
+	SourceEventType string                 `json:"sourceEventType"`
+	Actor           string                 `json:"actor"`
+	Status          string                 `json:"status,omitempty"`
+	Amount          *types.Money           `json:"amount,omitempty"`
+	CorrelationID   string                 `json:"correlationId,omitempty"`
+	Timestamp       time.Time              `json:"timestamp"`
+	Details         map[string]interface{} `json:"details,omitempty"`
+}
+
+// PaymentTimeline is the history of a payment, oldest event first
+type PaymentTimeline struct {
+	PaymentID     string          `json:"paymentId"`
+	Status        string          `json:"status"`
+	CorrelationID string          `json:"correlationId,omitempty"`
+	Events        []TimelineEntry `json:"events"`
+}
+
+// GetPaymentTimeline returns the events every service recorded for a payment
+// as one chronological timeline
+func (s *PaymentService) GetPaymentTimeline(ctx context.Context, paymentID string) (*PaymentTimeline, error) {
+	if paymentID == "" {
+		return nil, apperrors.NewValidationError("payment ID is required", nil)
+	}
+
+	payment, err := s.repo.GetPayment(ctx, paymentID)
+	if err != nil {
+		return nil, apperrors.NewNotFoundError("payment")
+	}
+
+	events, err := s.repo.ListPaymentEvents(ctx, payment.ID)
+	if err != nil {
+		s.logger.Error("Failed to list payment events", err, map[string]interface{}{
+			"paymentId": payment.ID,
+		})
+		return nil, err
+	}
+
+	return buildTimeline(payment, events), nil
+}
+
+// buildTimeline normalizes a payment's events and orders them by time. The
+// events' sort key is their timestamp as a string, which does not order
+// timestamps written with different precision or offsets, so they are
+// sorted again here; events at the same instant keep their stored order.
+func buildTimeline(payment *types.Payment, events []types.PaymentEvent) *PaymentTimeline {
+	timeline := &PaymentTimeline{
+		PaymentID:     payment.ID,
+		Status:        strings.ToLower(string(payment.Status)),
+		CorrelationID: payment.CorrelationID,
+		Events:        make([]TimelineEntry, 0, len(events)),
+	}
+
+	for _, event := range events {
+		eventType, actor := normalizeEventType(event.EventType)
+
+		entry := TimelineEntry{
+			EventID:         event.ID,
+			EventType:       eventType,
+			SourceEventType: event.EventType,
+			Actor:           actor,
+			Status:          strings.ToLower(event.Status),
+			CorrelationID:   event.CorrelationID,
+			Timestamp:       event.Timestamp.UTC(),
+			Details:         event.Metadata,
+		}
+		if entry.CorrelationID == "" {
+			entry.CorrelationID = payment.CorrelationID
+		}
+		if event.Amount.Currency != "" {
+			amount := event.Amount
+			entry.Amount = &amount
+		}
+
+		timeline.Events = append(timeline.Events, entry)
+	}
+
+	sort.SliceStable(timeline.Events, func(i, j int) bool {
+		return timeline.Events[i].Timestamp.Before(timeline.Events[j].Timestamp)
+	})
+
+	return timeline
+}
+
+// normalizeEventType returns the namespaced name of a recorded event type and
+// the service that records it
+func normalizeEventType(recorded string) (string, string) {
+	if legacy, ok := legacyTimelineEvents[recorded]; ok {
+		return legacy.eventType, legacy.actor
+	}
+
+	eventType := strings.ToLower(recorded)
+	namespace, _, found := strings.Cut(eventType, ".")
+	if !found {
+		return eventType, actorUnknown
+	}
+	if actor, ok := timelineActors[namespace]; ok {
+		return eventType, actor
+	}
+	return eventType, actorUnknown
+}
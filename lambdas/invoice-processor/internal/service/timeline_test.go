@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/draftea-coding-challenge/shared/observability"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildTimeline(t *testing.T) {
+	createdAt := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	payment := &types.Payment{
+		ID:            "pay-1",
+		Status:        types.PaymentStatusRefunded,
+		CorrelationID: "exec-456",
+	}
+	local := time.FixedZone("UTC+5", 5*60*60)
+	events := []types.PaymentEvent{
+		{ID: "evt-1", EventType: "PAYMENT_CREATED", Status: "PENDING", Amount: types.NewMoney(5000, "USD"), CorrelationID: "exec-456", Timestamp: createdAt},
+		{ID: "evt-3", EventType: "REFUNDED", Status: "completed", Amount: types.NewMoney(5000, "USD"), CorrelationID: "exec-456", Timestamp: createdAt.Add(time.Hour)},
+		// Read back after the refund, since its timestamp key was written in
+		// another offset and sorts later as a string
+		{ID: "evt-2", EventType: string(types.EventWalletDebited), Status: "SUCCESS", Amount: types.NewMoney(5000, "USD"), Timestamp: createdAt.Add(time.Minute).In(local)},
+		{ID: "evt-4", EventType: "SOMETHING_ELSE", Timestamp: createdAt.Add(2 * time.Hour)},
+	}
+
+	timeline := buildTimeline(payment, events)
+
+	assert.Equal(t, "refunded", timeline.Status)
+	require.Len(t, timeline.Events, 4)
+
+	var ids []string
+	for _, entry := range timeline.Events {
+		ids = append(ids, entry.EventID)
+		assert.Equal(t, "exec-456", entry.CorrelationID, entry.EventID)
+	}
+	assert.Equal(t, []string{"evt-1", "evt-2", "evt-3", "evt-4"}, ids)
+
+	assert.Equal(t, "payment.created", timeline.Events[0].EventType)
+	assert.Equal(t, actorInvoiceProcessor, timeline.Events[0].Actor)
+	assert.Equal(t, "wallet.debited", timeline.Events[1].EventType)
+	assert.Equal(t, actorWalletService, timeline.Events[1].Actor)
+	assert.Equal(t, "success", timeline.Events[1].Status)
+	assert.Equal(t, time.UTC, timeline.Events[1].Timestamp.Location())
+	assert.Equal(t, string(types.EventRefundCompleted), timeline.Events[2].EventType)
+	assert.Equal(t, "REFUNDED", timeline.Events[2].SourceEventType)
+	assert.Equal(t, actorRefundService, timeline.Events[2].Actor)
+	assert.Equal(t, actorUnknown, timeline.Events[3].Actor)
+	assert.Nil(t, timeline.Events[3].Amount)
+}
+
+func TestGetPaymentTimeline_InvalidPaymentID(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewPaymentService(nil, logger)
+
+	_, err := service.GetPaymentTimeline(context.Background(), "")
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "payment ID is required")
+}
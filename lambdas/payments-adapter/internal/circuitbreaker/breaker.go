@@ -71,7 +71,7 @@ func (c *CircuitBreakerClient) GetPaymentStatus(ctx context.Context, externalID
 }
 
 // RefundPayment processes a refund with circuit breaker protection
-func (c *CircuitBreakerClient) RefundPayment(ctx context.Context, externalID string, amount float64) (*gateway.GatewayResponse, error) {
+func (c *CircuitBreakerClient) RefundPayment(ctx context.Context, externalID string, amount types.Money) (*gateway.GatewayResponse, error) {
 	result, err := c.breaker.Execute(func() (interface{}, error) {
 		return c.client.RefundPayment(ctx, externalID, amount)
 	})
@@ -15,7 +15,7 @@ import (
 type PaymentGatewayClient interface {
 	ProcessPayment(ctx context.Context, payment *types.Payment) (*GatewayResponse, error)
 	GetPaymentStatus(ctx context.Context, externalID string) (*GatewayResponse, error)
-	RefundPayment(ctx context.Context, externalID string, amount float64) (*GatewayResponse, error)
+	RefundPayment(ctx context.Context, externalID string, amount types.Money) (*GatewayResponse, error)
 }
 
 // GatewayResponse represents a response from the payment gateway
@@ -29,8 +29,7 @@ type GatewayResponse struct {
 // GatewayRequest represents a request to the payment gateway
 type GatewayRequest struct {
 	PaymentID     string            `json:"paymentId"`
-	Amount        float64           `json:"amount"`
-	Currency      string            `json:"currency"`
+	Amount        types.Money       `json:"amount"`
 	UserID        string            `json:"userId"`
 	CorrelationID string            `json:"correlationId"`
 	Metadata      map[string]string `json:"metadata,omitempty"`
@@ -59,7 +58,6 @@ func (c *Client) ProcessPayment(ctx context.Context, payment *types.Payment) (*G
 	request := &GatewayRequest{
 		PaymentID:     payment.ID,
 		Amount:        payment.Amount,
-		Currency:      payment.Currency,
 		UserID:        payment.UserID,
 		CorrelationID: payment.CorrelationID,
 		Metadata:      payment.Metadata,
@@ -124,7 +122,7 @@ func (c *Client) GetPaymentStatus(ctx context.Context, externalID string) (*Gate
 }
 
 // RefundPayment processes a refund through the gateway
-func (c *Client) RefundPayment(ctx context.Context, externalID string, amount float64) (*GatewayResponse, error) {
+func (c *Client) RefundPayment(ctx context.Context, externalID string, amount types.Money) (*GatewayResponse, error) {
 	request := map[string]interface{}{
 		"externalId": externalID,
 		"amount":     amount,
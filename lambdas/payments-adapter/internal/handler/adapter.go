@@ -133,6 +133,10 @@ func (h *PaymentAdapterHandler) handleStepFunctionRequest(ctx context.Context, i
 		return h.processPaymentFromStepFunction(ctx, input)
 	case "check_status":
 		return h.checkStatusFromStepFunction(ctx, input)
+	case "process_deposit":
+		return h.processDepositFromStepFunction(ctx, input)
+	case "refund_payment":
+		return h.refundPaymentFromStepFunction(ctx, input)
 	default:
 		return types.LambdaResponse{
 			Success: false,
@@ -207,3 +211,27 @@ func (h *PaymentAdapterHandler) checkStatusFromStepFunction(ctx context.Context,
 	}
 	return *resp, nil
 }
+
+// processDepositFromStepFunction charges a wallet deposit via Step Functions
+func (h *PaymentAdapterHandler) processDepositFromStepFunction(ctx context.Context, input *types.StepFunctionInput) (types.LambdaResponse, error) {
+	resp, err := h.service.ProcessStepFunctionDeposit(ctx, input)
+	if err != nil {
+		return types.LambdaResponse{
+			Success: false,
+			Error:   err.Error(),
+		}, nil
+	}
+	return *resp, nil
+}
+
+// refundPaymentFromStepFunction refunds a gateway charge via Step Functions
+func (h *PaymentAdapterHandler) refundPaymentFromStepFunction(ctx context.Context, input *types.StepFunctionInput) (types.LambdaResponse, error) {
+	resp, err := h.service.RefundStepFunctionPayment(ctx, input)
+	if err != nil {
+		return types.LambdaResponse{
+			Success: false,
+			Error:   err.Error(),
+		}, nil
+	}
+	return *resp, nil
+}
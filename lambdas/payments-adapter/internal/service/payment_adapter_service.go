@@ -31,8 +31,7 @@ func NewPaymentAdapterService(gatewayClient gateway.PaymentGatewayClient, logger
 type ProcessPaymentRequest struct {
 	PaymentID     string            `json:"paymentId"`
 	UserID        string            `json:"userId"`
-	Amount        float64           `json:"amount"`
-	Currency      string            `json:"currency"`
+	Amount        types.Money       `json:"amount"`
 	Status        string            `json:"status"`
 	CorrelationID string            `json:"correlationId"`
 	Metadata      map[string]string `json:"metadata,omitempty"`
@@ -55,7 +54,6 @@ func (s *PaymentAdapterService) ProcessPayment(ctx context.Context, req *Process
 		ID:            req.PaymentID,
 		UserID:        req.UserID,
 		Amount:        req.Amount,
-		Currency:      req.Currency,
 		Status:        types.PaymentStatus(req.Status),
 		CorrelationID: req.CorrelationID,
 		Metadata:      req.Metadata,
@@ -137,7 +135,6 @@ func (s *PaymentAdapterService) ProcessStepFunctionPayment(ctx context.Context,
 		ID:            input.PaymentID,
 		UserID:        input.UserID,
 		Amount:        input.Amount,
-		Currency:      input.Currency,
 		Status:        types.PaymentStatus(input.Status),
 		CorrelationID: input.CorrelationID,
 		Metadata:      input.Metadata,
@@ -194,6 +191,83 @@ func (s *PaymentAdapterService) CheckStepFunctionStatus(ctx context.Context, inp
 	}, nil
 }
 
+// ProcessStepFunctionDeposit charges a wallet top-up from Step Function input.
+// The deposit is only credited by the deposit flow once the charge is approved.
+func (s *PaymentAdapterService) ProcessStepFunctionDeposit(ctx context.Context, input *types.StepFunctionInput) (*types.LambdaResponse, error) {
+	metadata := map[string]string{}
+	for key, value := range input.Metadata {
+		metadata[key] = value
+	}
+	metadata["type"] = "deposit"
+
+	resp, err := s.ProcessPayment(ctx, &ProcessPaymentRequest{
+		PaymentID:     input.PaymentID,
+		UserID:        input.UserID,
+		Amount:        input.Amount,
+		Status:        string(types.PaymentStatusPending),
+		CorrelationID: input.CorrelationID,
+		Metadata:      metadata,
+	})
+	if err != nil {
+		return &types.LambdaResponse{
+			Success: false,
+			Error:   err.Error(),
+		}, nil
+	}
+
+	return &types.LambdaResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"externalId": resp.ExternalID,
+			"status":     resp.Status,
+			"message":    resp.Message,
+		},
+	}, nil
+}
+
+// RefundStepFunctionPayment refunds a gateway charge from Step Function input
+func (s *PaymentAdapterService) RefundStepFunctionPayment(ctx context.Context, input *types.StepFunctionInput) (*types.LambdaResponse, error) {
+	if input.ExternalID == "" {
+		return &types.LambdaResponse{
+			Success: false,
+			Error:   "externalId is required",
+		}, nil
+	}
+	if !input.Amount.IsPositive() {
+		return &types.LambdaResponse{
+			Success: false,
+			Error:   "amount must be greater than 0",
+		}, nil
+	}
+
+	resp, err := s.gateway.RefundPayment(ctx, input.ExternalID, input.Amount)
+	if err != nil {
+		s.logger.Error("Failed to refund payment from Step Function", err, map[string]interface{}{
+			"paymentId":  input.PaymentID,
+			"externalId": input.ExternalID,
+		})
+		return &types.LambdaResponse{
+			Success: false,
+			Error:   err.Error(),
+		}, nil
+	}
+
+	s.logger.Info("Payment refunded", map[string]interface{}{
+		"paymentId":  input.PaymentID,
+		"externalId": input.ExternalID,
+		"status":     resp.Status,
+	})
+
+	return &types.LambdaResponse{
+		Success: resp.Status == "refunded",
+		Data: map[string]interface{}{
+			"externalId": resp.ExternalID,
+			"status":     resp.Status,
+			"message":    resp.Message,
+		},
+	}, nil
+}
+
 // GetCircuitBreakerState returns the current state of the circuit breaker
 func (s *PaymentAdapterService) GetCircuitBreakerState() string {
 	return s.gateway.GetState()
@@ -207,10 +281,10 @@ func (s *PaymentAdapterService) validateProcessPaymentRequest(req *ProcessPaymen
 	if req.UserID == "" {
 		return fmt.Errorf("userID is required")
 	}
-	if req.Amount <= 0 {
+	if !req.Amount.IsPositive() {
 		return fmt.Errorf("amount must be greater than 0")
 	}
-	if req.Currency == "" || len(req.Currency) != 3 {
+	if len(req.Amount.Currency) != 3 {
 		return fmt.Errorf("invalid currency format")
 	}
 	return nil
@@ -4,7 +4,9 @@ import (
 	"context"
 	"testing"
 
+	"github.com/draftea-coding-challenge/lambdas/payments-adapter/internal/gateway"
 	"github.com/draftea-coding-challenge/shared/observability"
+	"github.com/draftea-coding-challenge/shared/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,8 +15,7 @@ func TestProcessPayment_ValidationError(t *testing.T) {
 	req := &ProcessPaymentRequest{
 		PaymentID: "",
 		UserID:    "user123",
-		Amount:    100.00,
-		Currency:  "USD",
+		Amount:    types.NewMoney(10000, "USD"),
 	}
 
 	logger := observability.NewLogger(context.Background(), "test")
@@ -32,8 +33,7 @@ func TestProcessPayment_InvalidAmount(t *testing.T) {
 	req := &ProcessPaymentRequest{
 		PaymentID: "pay123",
 		UserID:    "user123",
-		Amount:    -100.00,
-		Currency:  "USD",
+		Amount:    types.NewMoney(-10000, "USD"),
 	}
 
 	logger := observability.NewLogger(context.Background(), "test")
@@ -51,8 +51,7 @@ func TestProcessPayment_MissingCurrency(t *testing.T) {
 	req := &ProcessPaymentRequest{
 		PaymentID: "pay123",
 		UserID:    "user123",
-		Amount:    100.00,
-		Currency:  "",
+		Amount:    types.NewMoney(10000, ""),
 	}
 
 	logger := observability.NewLogger(context.Background(), "test")
@@ -70,8 +69,7 @@ func TestProcessPayment_MissingUserID(t *testing.T) {
 	req := &ProcessPaymentRequest{
 		PaymentID: "pay123",
 		UserID:    "",
-		Amount:    100.00,
-		Currency:  "USD",
+		Amount:    types.NewMoney(10000, "USD"),
 	}
 
 	logger := observability.NewLogger(context.Background(), "test")
@@ -83,3 +81,74 @@ func TestProcessPayment_MissingUserID(t *testing.T) {
 	assert.Nil(t, result)
 	assert.Contains(t, err.Error(), "userID is required")
 }
+
+type fakeGateway struct {
+	processed *types.Payment
+	refunded  string
+	response  *gateway.GatewayResponse
+}
+
+func (g *fakeGateway) ProcessPayment(ctx context.Context, payment *types.Payment) (*gateway.GatewayResponse, error) {
+	g.processed = payment
+	return g.response, nil
+}
+
+func (g *fakeGateway) GetPaymentStatus(ctx context.Context, externalID string) (*gateway.GatewayResponse, error) {
+	return g.response, nil
+}
+
+func (g *fakeGateway) RefundPayment(ctx context.Context, externalID string, amount types.Money) (*gateway.GatewayResponse, error) {
+	g.refunded = externalID
+	return g.response, nil
+}
+
+func TestProcessStepFunctionDeposit_TagsCharge(t *testing.T) {
+	gw := &fakeGateway{response: &gateway.GatewayResponse{ExternalID: "ext123", Status: "approved"}}
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewPaymentAdapterService(gw, logger)
+
+	result, err := service.ProcessStepFunctionDeposit(context.Background(), &types.StepFunctionInput{
+		PaymentID: "dep123",
+		UserID:    "user123",
+		Amount:    types.NewMoney(5000, "USD"),
+		Metadata:  map[string]string{"source": "card"},
+	})
+
+	assert.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Equal(t, "approved", result.Data.(map[string]interface{})["status"])
+	assert.Equal(t, "deposit", gw.processed.Metadata["type"])
+	assert.Equal(t, "card", gw.processed.Metadata["source"])
+}
+
+func TestProcessStepFunctionDeposit_ValidationError(t *testing.T) {
+	gw := &fakeGateway{}
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewPaymentAdapterService(gw, logger)
+
+	result, err := service.ProcessStepFunctionDeposit(context.Background(), &types.StepFunctionInput{
+		PaymentID: "dep123",
+		UserID:    "user123",
+		Amount:    types.NewMoney(0, "USD"),
+	})
+
+	assert.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Error, "amount must be greater than 0")
+	assert.Nil(t, gw.processed)
+}
+
+func TestRefundStepFunctionPayment_NotRefunded(t *testing.T) {
+	gw := &fakeGateway{response: &gateway.GatewayResponse{ExternalID: "ext123", Status: "failed"}}
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewPaymentAdapterService(gw, logger)
+
+	result, err := service.RefundStepFunctionPayment(context.Background(), &types.StepFunctionInput{
+		ExternalID: "ext123",
+		Amount:     types.NewMoney(5000, "USD"),
+	})
+
+	assert.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Equal(t, "ext123", gw.refunded)
+}
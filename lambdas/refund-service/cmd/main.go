@@ -9,6 +9,7 @@ import (
 	"github.com/draftea-coding-challenge/lambdas/refund-service/internal/handler"
 	"github.com/draftea-coding-challenge/lambdas/refund-service/internal/repository"
 	"github.com/draftea-coding-challenge/lambdas/refund-service/internal/service"
+	"github.com/draftea-coding-challenge/shared/idempotency"
 	"github.com/draftea-coding-challenge/shared/observability"
 )
 
@@ -26,10 +27,16 @@ func main() {
 	if walletsTable == "" {
 		walletsTable = "Wallets"
 	}
+	transactionsTable := getEnv("WALLET_TRANSACTIONS_TABLE", "WalletTransactions")
 	eventsTable := os.Getenv("EVENTS_TABLE")
 	if eventsTable == "" {
 		eventsTable = "PaymentEvents"
 	}
+	ledgerTable := os.Getenv("LEDGER_TABLE")
+	if ledgerTable == "" {
+		ledgerTable = "Ledger"
+	}
+	idempotencyTable := getEnv("IDEMPOTENCY_TABLE", "Idempotency")
 
 	// Initialize logger
 	logger := &observability.Logger{
@@ -38,13 +45,14 @@ func main() {
 	}
 
 	// Create repository
-	refundRepo := repository.NewRefundRepository(db, paymentsTable, walletsTable, eventsTable)
+	refundRepo := repository.NewRefundRepository(db, paymentsTable, walletsTable, transactionsTable, eventsTable, ledgerTable)
 
 	// Create service
 	refundService := service.NewRefundService(refundRepo, logger)
 
 	// Create handler
-	refundHandler := handler.NewRefundHandler(refundService, logger)
+	refundHandler := handler.NewRefundHandler(refundService, logger).
+		WithIdempotency(idempotency.NewMiddleware(idempotency.NewStore(db, idempotencyTable), logger))
 
 	// Start Lambda
 	lambda.Start(refundHandler.HandleRequest)
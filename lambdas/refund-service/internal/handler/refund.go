@@ -3,18 +3,22 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/draftea-coding-challenge/lambdas/refund-service/internal/service"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/idempotency"
 	"github.com/draftea-coding-challenge/shared/observability"
 	"github.com/draftea-coding-challenge/shared/types"
 	"github.com/draftea-coding-challenge/shared/utils"
 )
 
 type RefundHandler struct {
-	service *service.RefundService
-	logger  *observability.Logger
+	service     *service.RefundService
+	idempotency *idempotency.Middleware
+	logger      *observability.Logger
 }
 
 func NewRefundHandler(service *service.RefundService, logger *observability.Logger) *RefundHandler {
@@ -24,6 +28,13 @@ func NewRefundHandler(service *service.RefundService, logger *observability.Logg
 	}
 }
 
+// WithIdempotency makes /refund/process idempotent for requests carrying an
+// Idempotency-Key header
+func (h *RefundHandler) WithIdempotency(middleware *idempotency.Middleware) *RefundHandler {
+	h.idempotency = middleware
+	return h
+}
+
 func (h *RefundHandler) HandleRequest(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	h.logger.Info("Received refund request", map[string]interface{}{
 		"path":   request.Path,
@@ -39,7 +50,7 @@ func (h *RefundHandler) HandleRequest(ctx context.Context, request events.APIGat
 	// Handle API Gateway request
 	switch request.Path {
 	case "/refund/process":
-		return h.processRefund(ctx, request)
+		return h.idempotency.Wrap(h.processRefund)(ctx, request)
 	case "/refund/status":
 		return h.getRefundStatus(ctx, request)
 	default:
@@ -82,6 +93,10 @@ func (h *RefundHandler) processRefund(ctx context.Context, request events.APIGat
 		h.logger.Error("Failed to process refund", err, map[string]interface{}{
 			"payment_id": refundRequest.PaymentID,
 		})
+		var appErr *apperrors.AppError
+		if errors.As(err, &appErr) {
+			return utils.AppErrorResponse(appErr)
+		}
 		return utils.ErrorResponse(500, err.Error())
 	}
 
@@ -1,29 +1,39 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/ledger"
 	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/google/uuid"
 )
 
 // RefundRepository handles data access for refunds
 type RefundRepository struct {
-	db               *dynamodb.DynamoDB
-	paymentsTable    string
-	walletsTable     string
-	eventsTable      string
+	db                *dynamodb.DynamoDB
+	paymentsTable     string
+	walletsTable      string
+	transactionsTable string
+	eventsTable       string
+	ledger            *ledger.Store
 }
 
 // NewRefundRepository creates a new refund repository
-func NewRefundRepository(db *dynamodb.DynamoDB, paymentsTable, walletsTable, eventsTable string) *RefundRepository {
+func NewRefundRepository(db *dynamodb.DynamoDB, paymentsTable, walletsTable, transactionsTable, eventsTable, ledgerTable string) *RefundRepository {
 	return &RefundRepository{
-		db:            db,
-		paymentsTable: paymentsTable,
-		walletsTable:  walletsTable,
-		eventsTable:   eventsTable,
+		db:                db,
+		paymentsTable:     paymentsTable,
+		walletsTable:      walletsTable,
+		transactionsTable: transactionsTable,
+		eventsTable:       eventsTable,
+		ledger:            ledger.NewStore(db, ledgerTable),
 	}
 }
 
@@ -53,53 +63,223 @@ func (r *RefundRepository) GetPayment(paymentID string) (*types.Payment, error)
 	return &payment, nil
 }
 
-// UpdatePayment updates a payment record
-func (r *RefundRepository) UpdatePayment(payment *types.Payment) error {
-	av, err := dynamodbattribute.MarshalMap(payment)
+// ErrPaymentStatusConflict is returned when a payment's status changed after
+// it was read, e.g. because another refund of it went through first
+var ErrPaymentStatusConflict = errors.New("payment status was changed concurrently")
+
+// errWalletChanged is returned when the wallet was written between reading
+// it and crediting it
+var errWalletChanged = errors.New("wallet was changed concurrently")
+
+// Wallet write retry tuning. Each attempt re-reads the wallet.
+const (
+	maxWalletAttempts = 5
+	walletRetryDelay  = 20 * time.Millisecond
+)
+
+// RefundPayment adds amount back to the payment's wallet and moves the
+// payment to status. One transaction writes the wallet's new balance, the
+// payment's new status, a CREDIT WalletTransactions row, a wallet.credited
+// event and the given journal entries, so either all of them are recorded or
+// none is. The payment update is conditional on its status still being the
+// one it was read with, so a payment is refunded at most once from each
+// status; ErrPaymentStatusConflict is returned when it is not. A wallet
+// written concurrently is read again, up to maxWalletAttempts times.
+func (r *RefundRepository) RefundPayment(payment *types.Payment, status types.PaymentStatus, amount types.Money, refundID string, entries ...*ledger.JournalEntry) error {
+	for attempt := 1; ; attempt++ {
+		err := r.refundPayment(payment, status, amount, refundID, entries)
+		if !errors.Is(err, errWalletChanged) || attempt == maxWalletAttempts {
+			return err
+		}
+		time.Sleep(time.Duration(attempt) * walletRetryDelay)
+	}
+}
+
+func (r *RefundRepository) refundPayment(payment *types.Payment, status types.PaymentStatus, amount types.Money, refundID string, entries []*ledger.JournalEntry) error {
+	// Refunds go back to the wallet that paid, so it must exist in the same
+	// currency. A closed wallet cannot be credited; a frozen one can.
+	wallet, err := r.getWallet(payment.UserID)
+	if err != nil {
+		return err
+	}
+	if wallet == nil {
+		return apperrors.NewNotFoundError("wallet")
+	}
+	if walletStatus := wallet.CurrentStatus(); !walletStatus.AllowsCredits() {
+		return apperrors.NewWalletNotActiveError(wallet.UserID, string(walletStatus))
+	}
+	balance, err := wallet.Balance.Add(amount)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payment: %w", err)
+		return apperrors.NewCurrencyMismatchError(wallet.Balance.Currency, amount.Currency)
 	}
 
-	_, err = r.db.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String(r.paymentsTable),
-		Item:      av,
-	})
+	now := time.Now().UTC()
+	transaction := &types.WalletTransaction{
+		// Keyed by the refund, as a payment can be refunded in parts
+		ID:            fmt.Sprintf("%s#%s#%s", payment.UserID, refundID, types.TransactionTypeCredit),
+		UserID:        payment.UserID,
+		PaymentID:     payment.ID,
+		Type:          types.TransactionTypeCredit,
+		Amount:        amount,
+		BalanceBefore: &wallet.Balance,
+		BalanceAfter:  &balance,
+		Timestamp:     now,
+	}
+
+	transactionItem, err := dynamodbattribute.MarshalMap(transaction)
 	if err != nil {
-		return fmt.Errorf("failed to update payment: %w", err)
+		return fmt.Errorf("failed to marshal wallet transaction: %w", err)
 	}
+	transactionItem["Timestamp"] = &dynamodb.AttributeValue{S: aws.String(types.TimestampKey(now))}
 
-	return nil
-}
+	eventItem, err := dynamodbattribute.MarshalMap(newCreditEvent(payment, transaction, refundID))
+	if err != nil {
+		return fmt.Errorf("failed to marshal wallet event: %w", err)
+	}
+
+	var journalItems []*dynamodb.TransactWriteItem
+	for _, entry := range entries {
+		items, err := r.ledger.WriteItems(entry)
+		if err != nil {
+			return fmt.Errorf("failed to credit wallet: %w", err)
+		}
+		journalItems = append(journalItems, items...)
+	}
 
-// CreditWallet adds funds to a user's wallet
-func (r *RefundRepository) CreditWallet(userID string, amount float64) error {
-	// First check if wallet exists, create if not
-	_, err := r.db.UpdateItem(&dynamodb.UpdateItemInput{
+	// Conditioned on Version, like wallet-service's own writes, which also
+	// keep the denormalized Available amount in step with the balance
+	credited := *wallet
+	credited.Balance = balance
+	walletUpdate := &dynamodb.Update{
 		TableName: aws.String(r.walletsTable),
 		Key: map[string]*dynamodb.AttributeValue{
 			"UserID": {
-				S: aws.String(userID),
+				S: aws.String(payment.UserID),
+			},
+		},
+		UpdateExpression: aws.String("SET Balance.Amount = :balance, Available = :available, Version = :newVersion, UpdatedAt = :updatedAt"),
+		ConditionExpression: aws.String("Version = :currentVersion AND Balance.Currency = :currency AND " +
+			"(attribute_not_exists(#status) OR #status <> :closed)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":closed": {
+				S: aws.String(string(types.WalletStatusClosed)),
+			},
+			":balance": {
+				N: aws.String(strconv.FormatInt(balance.Amount, 10)),
+			},
+			":available": {
+				N: aws.String(strconv.FormatInt(credited.Available().Amount, 10)),
+			},
+			":currency": {
+				S: aws.String(amount.Currency),
+			},
+			":currentVersion": {
+				N: aws.String(strconv.Itoa(wallet.Version)),
 			},
+			":newVersion": {
+				N: aws.String(strconv.Itoa(wallet.Version + 1)),
+			},
+			":updatedAt": {
+				S: aws.String(now.Format(time.RFC3339)),
+			},
+		},
+	}
+
+	paymentUpdate := &dynamodb.Update{
+		TableName: aws.String(r.paymentsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(payment.ID),
+			},
+		},
+		UpdateExpression:    aws.String("SET #status = :status, UpdatedAt = :updatedAt"),
+		ConditionExpression: aws.String("#status = :current"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
 		},
-		UpdateExpression: aws.String("SET Balance = if_not_exists(Balance, :zero) + :amount"),
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":amount": {
-				N: aws.String(fmt.Sprintf("%.2f", amount)),
+			":status": {
+				S: aws.String(string(status)),
+			},
+			":current": {
+				S: aws.String(string(payment.Status)),
+			},
+			":updatedAt": {
+				S: aws.String(time.Now().Format(time.RFC3339)),
+			},
+		},
+	}
+
+	transactItems := []*dynamodb.TransactWriteItem{
+		{Update: walletUpdate},
+		{Update: paymentUpdate},
+		{
+			Put: &dynamodb.Put{
+				TableName:           aws.String(r.transactionsTable),
+				Item:                transactionItem,
+				ConditionExpression: aws.String("attribute_not_exists(ID)"),
 			},
-			":zero": {
-				N: aws.String("0"),
+		},
+		{
+			Put: &dynamodb.Put{
+				TableName:           aws.String(r.eventsTable),
+				Item:                eventItem,
+				ConditionExpression: aws.String("attribute_not_exists(PaymentID)"),
 			},
 		},
-		ReturnValues: aws.String("UPDATED_NEW"),
+	}
+	_, err = r.db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: append(transactItems, journalItems...),
 	})
-	
 	if err != nil {
+		var canceled *dynamodb.TransactionCanceledException
+		if errors.As(err, &canceled) && len(canceled.CancellationReasons) > 1 {
+			reasons := canceled.CancellationReasons
+			switch {
+			case aws.StringValue(reasons[1].Code) == "ConditionalCheckFailed":
+				return ErrPaymentStatusConflict
+			case aws.StringValue(reasons[0].Code) == "ConditionalCheckFailed",
+				aws.StringValue(reasons[0].Code) == "TransactionConflict":
+				// Every check was made on the wallet as read, so it has changed since
+				return errWalletChanged
+			}
+		}
 		return fmt.Errorf("failed to credit wallet: %w", err)
 	}
 
 	return nil
 }
 
+// newCreditEvent builds the wallet.credited event recorded alongside a
+// refund's wallet transaction, as wallet-service records one for its credits
+func newCreditEvent(payment *types.Payment, transaction *types.WalletTransaction, refundID string) *types.PaymentEvent {
+	event := &types.PaymentEvent{
+		ID:            fmt.Sprintf("%s#%s", payment.ID, uuid.New().String()),
+		PaymentID:     payment.ID,
+		UserID:        transaction.UserID,
+		EventType:     string(types.EventWalletCredited),
+		Amount:        transaction.Amount,
+		Status:        "SUCCESS",
+		CorrelationID: payment.CorrelationID,
+		Metadata: map[string]interface{}{
+			"transactionId": transaction.ID,
+			"type":          transaction.Type,
+			"balanceBefore": *transaction.BalanceBefore,
+			"balanceAfter":  *transaction.BalanceAfter,
+			"refundId":      refundID,
+		},
+		Timestamp: transaction.Timestamp,
+	}
+	if repaid := transaction.OverdraftRepaid(); !repaid.IsZero() {
+		event.Metadata["overdraftRepaid"] = repaid
+	}
+
+	return event
+}
+
 // LogPaymentEvent logs a payment event
 func (r *RefundRepository) LogPaymentEvent(event *types.PaymentEvent) error {
 	av, err := dynamodbattribute.MarshalMap(event)
@@ -119,7 +299,19 @@ func (r *RefundRepository) LogPaymentEvent(event *types.PaymentEvent) error {
 }
 
 // GetWalletBalance retrieves the current balance of a wallet
-func (r *RefundRepository) GetWalletBalance(userID string) (float64, error) {
+func (r *RefundRepository) GetWalletBalance(userID string) (types.Money, error) {
+	wallet, err := r.getWallet(userID)
+	if err != nil || wallet == nil {
+		// Wallet doesn't exist, return 0
+		return types.Money{}, err
+	}
+
+	return wallet.Balance, nil
+}
+
+// getWallet reads a wallet with a consistent read, or returns nil if the user
+// has none
+func (r *RefundRepository) getWallet(userID string) (*types.Wallet, error) {
 	result, err := r.db.GetItem(&dynamodb.GetItemInput{
 		TableName: aws.String(r.walletsTable),
 		Key: map[string]*dynamodb.AttributeValue{
@@ -127,20 +319,20 @@ func (r *RefundRepository) GetWalletBalance(userID string) (float64, error) {
 				S: aws.String(userID),
 			},
 		},
+		ConsistentRead: aws.Bool(true),
 	})
 	if err != nil {
-		return 0, fmt.Errorf("failed to get wallet: %w", err)
+		return nil, fmt.Errorf("failed to get wallet: %w", err)
 	}
 
 	if result.Item == nil {
-		// Wallet doesn't exist, return 0
-		return 0, nil
+		return nil, nil
 	}
 
 	var wallet types.Wallet
 	if err := dynamodbattribute.UnmarshalMap(result.Item, &wallet); err != nil {
-		return 0, fmt.Errorf("failed to unmarshal wallet: %w", err)
+		return nil, fmt.Errorf("failed to unmarshal wallet: %w", err)
 	}
 
-	return wallet.Balance, nil
+	return &wallet, nil
 }
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCreditEvent(t *testing.T) {
+	payment := &types.Payment{ID: "pay-1", UserID: "user123", CorrelationID: "exec-456"}
+	before, after := types.NewMoney(-1000, "USD"), types.NewMoney(1500, "USD")
+	transaction := &types.WalletTransaction{
+		ID:            "user123#ref-1#CREDIT",
+		UserID:        "user123",
+		PaymentID:     "pay-1",
+		Type:          types.TransactionTypeCredit,
+		Amount:        types.NewMoney(2500, "USD"),
+		BalanceBefore: &before,
+		BalanceAfter:  &after,
+		Timestamp:     time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+	}
+
+	event := newCreditEvent(payment, transaction, "ref-1")
+
+	// Replayed by wallet reconciliation like any other credit
+	assert.Equal(t, string(types.EventWalletCredited), event.EventType)
+	assert.Equal(t, "pay-1", event.PaymentID)
+	assert.Equal(t, "user123", event.UserID)
+	assert.Equal(t, transaction.Amount, event.Amount)
+	assert.Equal(t, "exec-456", event.CorrelationID)
+	assert.Equal(t, transaction.Timestamp, event.Timestamp)
+	assert.Equal(t, "user123#ref-1#CREDIT", event.Metadata["transactionId"])
+	assert.Equal(t, "ref-1", event.Metadata["refundId"])
+	assert.Equal(t, types.NewMoney(1000, "USD"), event.Metadata["overdraftRepaid"])
+}
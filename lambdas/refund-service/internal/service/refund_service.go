@@ -2,10 +2,14 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/draftea-coding-challenge/lambdas/refund-service/internal/repository"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/ledger"
 	"github.com/draftea-coding-challenge/shared/observability"
 	"github.com/draftea-coding-challenge/shared/types"
 	"github.com/google/uuid"
@@ -27,18 +31,18 @@ func NewRefundService(repo *repository.RefundRepository, logger *observability.L
 
 // RefundRequest represents a refund request
 type RefundRequest struct {
-	PaymentID string  `json:"payment_id"`
-	Amount    float64 `json:"amount"`
-	Reason    string  `json:"reason"`
+	PaymentID string      `json:"payment_id"`
+	Amount    types.Money `json:"amount"`
+	Reason    string      `json:"reason"`
 }
 
 // RefundResponse represents a refund response
 type RefundResponse struct {
-	PaymentID string  `json:"payment_id"`
-	Amount    float64 `json:"amount"`
-	Status    string  `json:"status"`
-	Reason    string  `json:"reason,omitempty"`
-	RefundID  string  `json:"refund_id,omitempty"`
+	PaymentID string      `json:"payment_id"`
+	Amount    types.Money `json:"amount"`
+	Status    string      `json:"status"`
+	Reason    string      `json:"reason,omitempty"`
+	RefundID  string      `json:"refund_id,omitempty"`
 }
 
 // ProcessRefund processes a refund request
@@ -60,22 +64,27 @@ func (s *RefundService) ProcessRefund(ctx context.Context, req *RefundRequest) (
 		return nil, fmt.Errorf("payment not found: %w", err)
 	}
 
-	// Check payment status
-	if payment.Status == types.PaymentStatusRefunded {
-		return nil, fmt.Errorf("payment already refunded")
+	// Validate refund amount
+	cmp, err := req.Amount.Cmp(payment.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("refund currency does not match payment: %w", err)
 	}
-
-	if payment.Status != types.PaymentStatusCompleted {
-		return nil, fmt.Errorf("only completed payments can be refunded")
+	if cmp > 0 {
+		return nil, fmt.Errorf("refund amount exceeds payment amount")
 	}
 
-	// Validate refund amount
-	if req.Amount > payment.Amount {
-		return nil, fmt.Errorf("refund amount exceeds payment amount")
+	// Check payment status
+	status := types.PaymentStatusRefunded
+	if cmp < 0 {
+		status = types.PaymentStatusPartiallyRefunded
+	}
+	if !payment.Status.CanTransitionTo(status) {
+		return nil, apperrors.NewPaymentStatusConflictError(payment.ID, string(payment.Status), string(status))
 	}
 
-	// Credit wallet
-	if err := s.repo.CreditWallet(payment.UserID, req.Amount); err != nil {
+	// Credit wallet and update payment status
+	refundID := uuid.New().String()
+	if err := s.creditRefund(ctx, payment, status, req.Amount, refundID); err != nil {
 		s.logger.Error("Failed to credit wallet", err, map[string]interface{}{
 			"user_id": payment.UserID,
 			"amount":  req.Amount,
@@ -83,19 +92,7 @@ func (s *RefundService) ProcessRefund(ctx context.Context, req *RefundRequest) (
 		return nil, fmt.Errorf("failed to process refund: %w", err)
 	}
 
-	// Update payment status
-	payment.Status = types.PaymentStatusRefunded
-	payment.UpdatedAt = time.Now()
-	
-	if err := s.repo.UpdatePayment(payment); err != nil {
-		s.logger.Error("Failed to update payment status", err, map[string]interface{}{
-			"payment_id": payment.ID,
-		})
-		// Log error but don't fail the refund since wallet was already credited
-	}
-
 	// Log refund event
-	refundID := uuid.New().String()
 	event := &types.PaymentEvent{
 		ID:            refundID,
 		PaymentID:     payment.ID,
@@ -127,7 +124,7 @@ func (s *RefundService) ProcessRefund(ctx context.Context, req *RefundRequest) (
 	return &RefundResponse{
 		PaymentID: payment.ID,
 		Amount:    req.Amount,
-		Status:    "refunded",
+		Status:    strings.ToLower(string(status)),
 		Reason:    req.Reason,
 		RefundID:  refundID,
 	}, nil
@@ -184,21 +181,23 @@ func (s *RefundService) ProcessStepFunctionRefund(ctx context.Context, input *ty
 		}, nil
 	}
 
+	if !payment.Status.CanTransitionTo(types.PaymentStatusRefunded) {
+		return &types.LambdaResponse{
+			Success: false,
+			Error:   apperrors.NewPaymentStatusConflictError(payment.ID, string(payment.Status), string(types.PaymentStatusRefunded)).Error(),
+		}, nil
+	}
+
 	// Credit wallet with full payment amount
-	if err := s.repo.CreditWallet(payment.UserID, payment.Amount); err != nil {
+	refundID := uuid.New().String()
+	if err := s.creditRefund(ctx, payment, types.PaymentStatusRefunded, payment.Amount, refundID); err != nil {
 		return &types.LambdaResponse{
 			Success: false,
 			Error:   "Failed to credit wallet",
 		}, nil
 	}
 
-	// Update payment status
-	payment.Status = types.PaymentStatusRefunded
-	payment.UpdatedAt = time.Now()
-	s.repo.UpdatePayment(payment)
-
 	// Log refund event
-	refundID := uuid.New().String()
 	event := &types.PaymentEvent{
 		ID:            refundID,
 		PaymentID:     payment.ID,
@@ -247,10 +246,43 @@ func (s *RefundService) CheckStepFunctionRefundStatus(ctx context.Context, input
 
 // RefundStatusResponse represents a refund status response
 type RefundStatusResponse struct {
-	PaymentID string  `json:"payment_id"`
-	Status    string  `json:"status"`
-	Refunded  bool    `json:"refunded"`
-	Amount    float64 `json:"amount"`
+	PaymentID string      `json:"payment_id"`
+	Status    string      `json:"status"`
+	Refunded  bool        `json:"refunded"`
+	Amount    types.Money `json:"amount"`
+}
+
+// creditRefund pays a refund back into the payment's wallet and moves the
+// payment to status. The refund is posted as owed, taken back from revenue,
+// and as paid out of refunds payable into the wallet, in the same write that
+// credits the wallet and updates the payment. A refund that lost a race with
+// another refund of the payment writes nothing and returns a status conflict.
+func (s *RefundService) creditRefund(ctx context.Context, payment *types.Payment, status types.PaymentStatus, amount types.Money, refundID string) error {
+	now := time.Now().UTC()
+
+	approved, err := ledger.RefundApproved(fmt.Sprintf("%s#%s#REFUND_APPROVED", payment.ID, refundID), payment.ID, amount, now)
+	if err != nil {
+		return err
+	}
+
+	paid, err := ledger.RefundPaid(fmt.Sprintf("%s#%s#REFUND_PAID", payment.ID, refundID), payment.UserID, payment.ID, amount, now)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.RefundPayment(payment, status, amount, refundID, approved, paid); err != nil {
+		if errors.Is(err, repository.ErrPaymentStatusConflict) {
+			current := payment.Status
+			if latest, getErr := s.repo.GetPayment(payment.ID); getErr == nil {
+				current = latest.Status
+			}
+			return apperrors.NewPaymentStatusConflictError(payment.ID, string(current), string(status))
+		}
+		return err
+	}
+
+	payment.Status = status
+	payment.UpdatedAt = now
+	return nil
 }
 
 // validateRefundRequest validates a refund request
@@ -258,7 +290,7 @@ func (s *RefundService) validateRefundRequest(req *RefundRequest) error {
 	if req.PaymentID == "" {
 		return fmt.Errorf("payment_id is required")
 	}
-	if req.Amount <= 0 {
+	if !req.Amount.IsPositive() {
 		return fmt.Errorf("amount must be greater than 0")
 	}
 	if req.Reason == "" {
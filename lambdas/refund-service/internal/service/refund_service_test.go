@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/draftea-coding-challenge/shared/observability"
+	"github.com/draftea-coding-challenge/shared/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -12,7 +13,7 @@ func TestProcessRefund_ValidationError(t *testing.T) {
 	// Test with invalid payment ID
 	req := &RefundRequest{
 		PaymentID: "",
-		Amount:    50.00,
+		Amount:    types.NewMoney(5000, "USD"),
 		Reason:    "Customer request",
 	}
 
@@ -29,7 +30,7 @@ func TestProcessRefund_InvalidAmount(t *testing.T) {
 	// Test with invalid refund amount
 	req := &RefundRequest{
 		PaymentID: "pay123",
-		Amount:    -50.00,
+		Amount:    types.NewMoney(-5000, "USD"),
 		Reason:    "Customer request",
 	}
 
@@ -46,7 +47,7 @@ func TestProcessRefund_MissingReason(t *testing.T) {
 	// Test with missing reason
 	req := &RefundRequest{
 		PaymentID: "pay123",
-		Amount:    50.00,
+		Amount:    types.NewMoney(5000, "USD"),
 		Reason:    "",
 	}
 
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/draftea-coding-challenge/lambdas/wallet-notifier/internal/handler"
+	"github.com/draftea-coding-challenge/lambdas/wallet-notifier/internal/publisher"
+	"github.com/draftea-coding-challenge/lambdas/wallet-notifier/internal/service"
+	"github.com/draftea-coding-challenge/shared/observability"
+)
+
+func main() {
+	// Initialize logger
+	logger := observability.NewLogger(context.Background(), "wallet-notifier")
+
+	// Initialize AWS session
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region: aws.String(getEnv("AWS_REGION", "us-east-1")),
+	}))
+
+	// Initialize SNS client
+	var snsClient *sns.SNS
+
+	// Set endpoint for local development
+	if endpoint := os.Getenv("SNS_ENDPOINT"); endpoint != "" {
+		snsClient = sns.New(sess, &aws.Config{
+			Endpoint: aws.String(endpoint),
+		})
+		logger.Info("Using custom SNS endpoint", map[string]interface{}{
+			"endpoint": endpoint,
+		})
+	} else {
+		snsClient = sns.New(sess)
+	}
+
+	topicArn := getEnv("WALLET_EVENTS_TOPIC_ARN", "arn:aws:sns:us-east-1:000000000000:WalletEvents")
+
+	// Initialize publisher and service
+	eventPublisher := publisher.NewSNSPublisher(snsClient, topicArn)
+	notifierService := service.NewNotifierService(eventPublisher, logger)
+
+	// Initialize handler
+	h := handler.NewStreamHandler(notifierService, logger)
+
+	// Start Lambda handler
+	lambda.Start(h.HandleRequest)
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/draftea-coding-challenge/lambdas/wallet-notifier/internal/service"
+	"github.com/draftea-coding-challenge/shared/observability"
+)
+
+type StreamHandler struct {
+	service *service.NotifierService
+	logger  *observability.Logger
+}
+
+func NewStreamHandler(service *service.NotifierService, logger *observability.Logger) *StreamHandler {
+	return &StreamHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// HandleRequest processes a batch of Wallets table stream records in order.
+// It stops at the first record it cannot publish and reports it as the
+// batch's failure, so the stream retries from that record and no later
+// change of the same wallet is published ahead of it. Once the stream's
+// retries run out the batch goes to the dead letter queue.
+func (h *StreamHandler) HandleRequest(ctx context.Context, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	h.logger.Info("Processing wallet stream batch", map[string]interface{}{
+		"records": len(event.Records),
+	})
+
+	for _, record := range event.Records {
+		if err := h.service.ProcessRecord(ctx, record); err != nil {
+			h.logger.Error("Failed to process wallet stream record", err, map[string]interface{}{
+				"eventId":        record.EventID,
+				"sequenceNumber": record.Change.SequenceNumber,
+			})
+			return events.DynamoDBEventResponse{
+				BatchItemFailures: []events.DynamoDBBatchItemFailure{
+					{ItemIdentifier: record.Change.SequenceNumber},
+				},
+			}, nil
+		}
+	}
+
+	return events.DynamoDBEventResponse{}, nil
+}
@@ -0,0 +1,59 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// EventPublisher interface for publishing wallet events to subscribers
+type EventPublisher interface {
+	PublishBalanceChanged(ctx context.Context, event *types.WalletBalanceChanged) error
+}
+
+// SNSPublisher implements EventPublisher on an SNS topic. Subscribers such as
+// SQS queues can filter on the eventType and userId message attributes.
+type SNSPublisher struct {
+	client   *sns.SNS
+	topicArn string
+}
+
+// NewSNSPublisher creates a publisher for the wallet events topic
+func NewSNSPublisher(client *sns.SNS, topicArn string) *SNSPublisher {
+	return &SNSPublisher{
+		client:   client,
+		topicArn: topicArn,
+	}
+}
+
+// PublishBalanceChanged publishes a balance change as a JSON message
+func (p *SNSPublisher) PublishBalanceChanged(ctx context.Context, event *types.WalletBalanceChanged) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	_, err = p.client.PublishWithContext(ctx, &sns.PublishInput{
+		TopicArn: aws.String(p.topicArn),
+		Message:  aws.String(string(body)),
+		MessageAttributes: map[string]*sns.MessageAttributeValue{
+			"eventType": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(string(event.EventType)),
+			},
+			"userId": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(event.UserID),
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish event %s: %w", event.EventID, err)
+	}
+
+	return nil
+}
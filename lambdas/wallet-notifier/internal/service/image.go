@@ -0,0 +1,65 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// decodeWallet decodes a Wallets table stream image with the same attribute
+// mapping the wallet service writes it with
+func decodeWallet(image map[string]events.DynamoDBAttributeValue) (*types.Wallet, error) {
+	if len(image) == 0 {
+		return nil, fmt.Errorf("image is empty, is the stream view type NEW_AND_OLD_IMAGES?")
+	}
+
+	item := make(map[string]*dynamodb.AttributeValue, len(image))
+	for name, value := range image {
+		item[name] = toAttributeValue(value)
+	}
+
+	var wallet types.Wallet
+	if err := dynamodbattribute.UnmarshalMap(item, &wallet); err != nil {
+		return nil, err
+	}
+
+	return &wallet, nil
+}
+
+// toAttributeValue converts a stream attribute value to its DynamoDB API form
+func toAttributeValue(value events.DynamoDBAttributeValue) *dynamodb.AttributeValue {
+	switch value.DataType() {
+	case events.DataTypeString:
+		return &dynamodb.AttributeValue{S: aws.String(value.String())}
+	case events.DataTypeNumber:
+		return &dynamodb.AttributeValue{N: aws.String(value.Number())}
+	case events.DataTypeBinary:
+		return &dynamodb.AttributeValue{B: value.Binary()}
+	case events.DataTypeBoolean:
+		return &dynamodb.AttributeValue{BOOL: aws.Bool(value.Boolean())}
+	case events.DataTypeStringSet:
+		return &dynamodb.AttributeValue{SS: aws.StringSlice(value.StringSet())}
+	case events.DataTypeNumberSet:
+		return &dynamodb.AttributeValue{NS: aws.StringSlice(value.NumberSet())}
+	case events.DataTypeBinarySet:
+		return &dynamodb.AttributeValue{BS: value.BinarySet()}
+	case events.DataTypeList:
+		list := make([]*dynamodb.AttributeValue, 0, len(value.List()))
+		for _, item := range value.List() {
+			list = append(list, toAttributeValue(item))
+		}
+		return &dynamodb.AttributeValue{L: list}
+	case events.DataTypeMap:
+		m := make(map[string]*dynamodb.AttributeValue, len(value.Map()))
+		for name, item := range value.Map() {
+			m[name] = toAttributeValue(item)
+		}
+		return &dynamodb.AttributeValue{M: m}
+	default:
+		return &dynamodb.AttributeValue{NULL: aws.Bool(true)}
+	}
+}
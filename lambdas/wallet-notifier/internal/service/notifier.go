@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/draftea-coding-challenge/lambdas/wallet-notifier/internal/publisher"
+	"github.com/draftea-coding-challenge/shared/observability"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+const (
+	// publishAttempts is how many times a change is published before the
+	// record is handed back to the stream, which retries the batch from it
+	publishAttempts = 3
+
+	// publishBackoff is the wait before the second attempt, doubled before
+	// every attempt after it
+	publishBackoff = 100 * time.Millisecond
+)
+
+// NotifierService turns changes on the Wallets table stream into wallet
+// events and publishes them
+type NotifierService struct {
+	publisher publisher.EventPublisher
+	logger    *observability.Logger
+	attempts  int
+	backoff   time.Duration
+}
+
+// NewNotifierService creates a new notifier service
+func NewNotifierService(publisher publisher.EventPublisher, logger *observability.Logger) *NotifierService {
+	return &NotifierService{
+		publisher: publisher,
+		logger:    logger,
+		attempts:  publishAttempts,
+		backoff:   publishBackoff,
+	}
+}
+
+// ProcessRecord publishes the balance change of one stream record. Records
+// that do not change a balance, such as status changes, credit limits and
+// ledger flushes, are skipped.
+func (s *NotifierService) ProcessRecord(ctx context.Context, record events.DynamoDBEventRecord) error {
+	if events.DynamoDBOperationType(record.EventName) == events.DynamoDBOperationTypeRemove {
+		return nil
+	}
+
+	newWallet, err := decodeWallet(record.Change.NewImage)
+	if err != nil {
+		return fmt.Errorf("failed to decode new image of record %s: %w", record.EventID, err)
+	}
+	var oldWallet *types.Wallet
+	if record.Change.OldImage != nil {
+		if oldWallet, err = decodeWallet(record.Change.OldImage); err != nil {
+			return fmt.Errorf("failed to decode old image of record %s: %w", record.EventID, err)
+		}
+	}
+
+	changedAt := record.Change.ApproximateCreationDateTime.UTC()
+	event := newBalanceChanged(record.EventID, oldWallet, newWallet, changedAt)
+	if event == nil {
+		return nil
+	}
+
+	if err := s.publish(ctx, event); err != nil {
+		s.logger.Error("Failed to publish wallet balance change", err, map[string]interface{}{
+			"eventId": event.EventID,
+			"userId":  event.UserID,
+		})
+		return err
+	}
+
+	s.logger.Info("Wallet balance change published", map[string]interface{}{
+		"eventId": event.EventID,
+		"userId":  event.UserID,
+		"delta":   event.Delta,
+		"version": event.Version,
+	})
+
+	return nil
+}
+
+// publish publishes an event, retrying with exponential backoff
+func (s *NotifierService) publish(ctx context.Context, event *types.WalletBalanceChanged) error {
+	backoff := s.backoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = s.publisher.PublishBalanceChanged(ctx, event); err == nil {
+			return nil
+		}
+		if attempt >= s.attempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		s.logger.Warn("Retrying wallet event publish", map[string]interface{}{
+			"eventId": event.EventID,
+			"attempt": attempt,
+			"error":   err.Error(),
+		})
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// newBalanceChanged builds the event for a wallet going from before to after, or
+// returns nil if neither its balance nor its held amount changed. before is nil
+// for a wallet just created, which starts from zero.
+func newBalanceChanged(eventID string, before, after *types.Wallet, changedAt time.Time) *types.WalletBalanceChanged {
+	currency := after.Balance.Currency
+	previousBalance := types.NewMoney(0, currency)
+	previousHeld := types.NewMoney(0, currency)
+	if before != nil {
+		previousBalance, previousHeld = before.Balance, before.Held
+	}
+
+	if previousBalance.Amount == after.Balance.Amount && previousHeld.Amount == after.Held.Amount {
+		return nil
+	}
+
+	event := &types.WalletBalanceChanged{
+		EventID:         eventID,
+		EventType:       types.EventWalletBalanceChanged,
+		UserID:          after.UserID,
+		PreviousBalance: previousBalance,
+		Balance:         after.Balance,
+		Delta:           types.NewMoney(after.Balance.Amount-previousBalance.Amount, currency),
+		PreviousHeld:    previousHeld,
+		Held:            after.Held,
+		Available:       after.Available(),
+		Status:          after.CurrentStatus(),
+		Version:         after.Version,
+		ChangedAt:       changedAt,
+	}
+
+	// A last transaction new on this image is the one this write applied;
+	// one already on the old image belongs to an earlier write
+	if tx := after.LastTransaction; tx != nil && (before == nil || before.LastTransaction == nil || before.LastTransaction.ID != tx.ID) {
+		event.TransactionID = tx.ID
+		event.TransactionType = tx.Type
+		event.PaymentID = tx.PaymentID
+	}
+
+	return event
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/draftea-coding-challenge/shared/observability"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePublisher struct {
+	failures  int
+	published []*types.WalletBalanceChanged
+	calls     int
+}
+
+func (p *fakePublisher) PublishBalanceChanged(ctx context.Context, event *types.WalletBalanceChanged) error {
+	p.calls++
+	if p.calls <= p.failures {
+		return errors.New("topic unavailable")
+	}
+	p.published = append(p.published, event)
+	return nil
+}
+
+func newTestService(publisher *fakePublisher) *NotifierService {
+	service := NewNotifierService(publisher, observability.NewLogger(context.Background(), "test"))
+	service.backoff = 0
+	return service
+}
+
+func TestNewBalanceChanged(t *testing.T) {
+	changedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	before := &types.Wallet{
+		UserID:  "user123",
+		Balance: types.NewMoney(10000, "USD"),
+		Held:    types.NewMoney(2000, "USD"),
+		Version: 4,
+	}
+	after := *before
+	after.Balance = types.NewMoney(7500, "USD")
+	after.Version = 5
+	after.LastTransaction = &types.WalletTransaction{ID: "tx-1", Type: "DEBIT", PaymentID: "pay-1"}
+
+	event := newBalanceChanged("evt-1", before, &after, changedAt)
+	require.NotNil(t, event)
+	assert.Equal(t, types.EventWalletBalanceChanged, event.EventType)
+	assert.Equal(t, int64(-2500), event.Delta.Amount)
+	assert.Equal(t, int64(10000), event.PreviousBalance.Amount)
+	assert.Equal(t, int64(5500), event.Available.Amount)
+	assert.Equal(t, types.WalletStatusActive, event.Status)
+	assert.Equal(t, 5, event.Version)
+	assert.Equal(t, "tx-1", event.TransactionID)
+	assert.Equal(t, "pay-1", event.PaymentID)
+
+	// A status change leaves the balance as it was
+	frozen := after
+	frozen.Status = types.WalletStatusFrozen
+	frozen.Version = 6
+	assert.Nil(t, newBalanceChanged("evt-2", &after, &frozen, changedAt))
+
+	// A hold changes Held only and carries no transaction, even though the
+	// last single write is still named on the wallet
+	held := frozen
+	held.Held = types.NewMoney(3000, "USD")
+	event = newBalanceChanged("evt-3", &frozen, &held, changedAt)
+	require.NotNil(t, event)
+	assert.Equal(t, int64(0), event.Delta.Amount)
+	assert.Equal(t, int64(3000), event.Held.Amount)
+	assert.Empty(t, event.TransactionID)
+}
+
+func TestNewBalanceChanged_NewWallet(t *testing.T) {
+	granted := &types.Wallet{UserID: "user123", Balance: types.NewMoney(100000, "USD"), Version: 1}
+	event := newBalanceChanged("evt-1", nil, granted, time.Now())
+	require.NotNil(t, event)
+	assert.Equal(t, types.NewMoney(0, "USD"), event.PreviousBalance)
+	assert.Equal(t, int64(100000), event.Delta.Amount)
+
+	empty := &types.Wallet{UserID: "user456", Balance: types.NewMoney(0, "USD"), Version: 1}
+	assert.Nil(t, newBalanceChanged("evt-2", nil, empty, time.Now()))
+}
+
+func TestPublish_RetriesThenGivesUp(t *testing.T) {
+	event := &types.WalletBalanceChanged{EventID: "evt-1", UserID: "user123"}
+
+	publisher := &fakePublisher{failures: 2}
+	assert.NoError(t, newTestService(publisher).publish(context.Background(), event))
+	assert.Equal(t, 3, publisher.calls)
+	assert.Len(t, publisher.published, 1)
+
+	publisher = &fakePublisher{failures: publishAttempts}
+	assert.Error(t, newTestService(publisher).publish(context.Background(), event))
+	assert.Equal(t, publishAttempts, publisher.calls)
+	assert.Empty(t, publisher.published)
+}
+
+func TestProcessRecord_SkipsRemove(t *testing.T) {
+	publisher := &fakePublisher{}
+	err := newTestService(publisher).ProcessRecord(context.Background(), events.DynamoDBEventRecord{
+		EventID:   "evt-1",
+		EventName: string(events.DynamoDBOperationTypeRemove),
+	})
+	assert.NoError(t, err)
+	assert.Zero(t, publisher.calls)
+}
+
+func TestToAttributeValue(t *testing.T) {
+	var image map[string]events.DynamoDBAttributeValue
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"UserID": {"S": "user123"},
+		"Balance": {"M": {"Amount": {"N": "7500"}, "Currency": {"S": "USD"}}},
+		"Tags": {"L": [{"S": "vip"}, {"NULL": true}]},
+		"Frozen": {"BOOL": false}
+	}`), &image))
+
+	assert.Equal(t, "user123", aws.StringValue(toAttributeValue(image["UserID"]).S))
+
+	balance := toAttributeValue(image["Balance"])
+	assert.Equal(t, "7500", aws.StringValue(balance.M["Amount"].N))
+	assert.Equal(t, "USD", aws.StringValue(balance.M["Currency"].S))
+
+	tags := toAttributeValue(image["Tags"])
+	require.Len(t, tags.L, 2)
+	assert.Equal(t, "vip", aws.StringValue(tags.L[0].S))
+	assert.True(t, aws.BoolValue(tags.L[1].NULL))
+
+	assert.False(t, aws.BoolValue(toAttributeValue(image["Frozen"]).BOOL))
+}
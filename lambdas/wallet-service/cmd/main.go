@@ -11,7 +11,9 @@ import (
 	"github.com/draftea-coding-challenge/lambdas/wallet-service/internal/handler"
 	"github.com/draftea-coding-challenge/lambdas/wallet-service/internal/repository"
 	"github.com/draftea-coding-challenge/lambdas/wallet-service/internal/service"
+	"github.com/draftea-coding-challenge/shared/idempotency"
 	"github.com/draftea-coding-challenge/shared/observability"
+	"github.com/draftea-coding-challenge/shared/types"
 )
 
 func main() {
@@ -40,15 +42,52 @@ func main() {
 
 	// Initialize repository
 	walletsTable := getEnv("WALLETS_TABLE", "Wallets")
+	transactionsTable := getEnv("WALLET_TRANSACTIONS_TABLE", "WalletTransactions")
+	holdsTable := getEnv("WALLET_HOLDS_TABLE", "WalletHolds")
 	eventsTable := getEnv("PAYMENT_EVENTS_TABLE", "PaymentEvents")
+	reportsTable := getEnv("RECONCILIATION_REPORTS_TABLE", "ReconciliationReports")
+	ledgerTable := getEnv("LEDGER_TABLE", "Ledger")
 
-	repo := repository.NewWalletRepository(dynamoClient, walletsTable, eventsTable)
+	metrics := observability.NewMetricsCollector(logger, dynamoClient, "wallet-service")
+	repo := repository.NewWalletRepository(dynamoClient, metrics, walletsTable, transactionsTable, holdsTable, eventsTable, reportsTable, ledgerTable)
+
+	// Onboarding grants credited to new wallets, e.g. "USD:1000.00,EUR:500"
+	grants, err := service.ParseOnboardingGrants(os.Getenv("WALLET_ONBOARDING_GRANTS"))
+	if err != nil {
+		logger.Error("Invalid WALLET_ONBOARDING_GRANTS", err, nil)
+		os.Exit(1)
+	}
+
+	// Default spending limits per currency, e.g. "USD:500.00,EUR:450";
+	// users can be given their own limits, which are kept on their wallets
+	var limits service.SpendingLimitDefaults
+	for _, setting := range []struct {
+		env   string
+		limit *map[string]types.Money
+	}{
+		{"WALLET_DAILY_LIMIT", &limits.Daily},
+		{"WALLET_WEEKLY_LIMIT", &limits.Weekly},
+		{"WALLET_MONTHLY_LIMIT", &limits.Monthly},
+	} {
+		limit, err := service.ParseSpendingLimit(os.Getenv(setting.env))
+		if err != nil {
+			logger.Error("Invalid "+setting.env, err, nil)
+			os.Exit(1)
+		}
+		*setting.limit = limit
+	}
 
 	// Initialize service
-	walletService := service.NewWalletService(repo, logger)
+	walletService := service.NewWalletService(repo, logger).
+		WithOnboardingGrants(grants).
+		WithSpendingLimits(limits)
+
+	// Idempotency keys of debits and credits sent over HTTP
+	idempotencyStore := idempotency.NewStore(dynamoClient, getEnv("IDEMPOTENCY_TABLE", "Idempotency"))
 
 	// Initialize handler
-	h := handler.NewWalletHandler(walletService, logger)
+	h := handler.NewWalletHandler(walletService, logger).
+		WithIdempotency(idempotency.NewMiddleware(idempotencyStore, logger))
 
 	// Start Lambda handler
 	lambda.Start(h.HandleRequest)
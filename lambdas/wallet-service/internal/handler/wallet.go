@@ -3,18 +3,24 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/draftea-coding-challenge/lambdas/wallet-service/internal/service"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/idempotency"
 	"github.com/draftea-coding-challenge/shared/observability"
 	"github.com/draftea-coding-challenge/shared/types"
 	"github.com/draftea-coding-challenge/shared/utils"
 )
 
 type WalletHandler struct {
-	service *service.WalletService
-	logger  *observability.Logger
+	service     *service.WalletService
+	idempotency *idempotency.Middleware
+	logger      *observability.Logger
 }
 
 func NewWalletHandler(service *service.WalletService, logger *observability.Logger) *WalletHandler {
@@ -24,6 +30,13 @@ func NewWalletHandler(service *service.WalletService, logger *observability.Logg
 	}
 }
 
+// WithIdempotency makes /wallet/debit and /wallet/credit idempotent for
+// requests carrying an Idempotency-Key header
+func (h *WalletHandler) WithIdempotency(middleware *idempotency.Middleware) *WalletHandler {
+	h.idempotency = middleware
+	return h
+}
+
 func (h *WalletHandler) HandleRequest(ctx context.Context, request interface{}) (interface{}, error) {
 	// Try to handle as API Gateway request first
 	if apiReq, ok := request.(events.APIGatewayProxyRequest); ok {
@@ -33,12 +46,34 @@ func (h *WalletHandler) HandleRequest(ctx context.Context, request interface{})
 		})
 
 		switch apiReq.Path {
+		case "/wallet":
+			return h.handleCreateWallet(ctx, apiReq)
 		case "/wallet/debit":
-			return h.handleDebit(ctx, apiReq)
+			return h.idempotency.Wrap(h.handleDebit)(ctx, apiReq)
 		case "/wallet/credit":
-			return h.handleCredit(ctx, apiReq)
+			return h.idempotency.Wrap(h.handleCredit)(ctx, apiReq)
 		case "/wallet/balance":
 			return h.handleGetBalance(ctx, apiReq)
+		case "/wallet/transactions":
+			return h.handleListTransactions(ctx, apiReq)
+		case "/wallet/hold":
+			return h.handleHold(ctx, apiReq)
+		case "/wallet/capture":
+			return h.handleCapture(ctx, apiReq)
+		case "/wallet/release":
+			return h.handleRelease(ctx, apiReq)
+		case "/wallet/transfer":
+			return h.handleTransfer(ctx, apiReq)
+		case "/wallet/limits":
+			return h.handleSpendingLimits(ctx, apiReq)
+		case "/wallet/status":
+			return h.handleSetWalletStatus(ctx, apiReq)
+		case "/wallet/credit-limit":
+			return h.handleSetCreditLimit(ctx, apiReq)
+		case "/wallet/statement":
+			return h.handleStatement(ctx, apiReq)
+		case "/wallet/ledger":
+			return h.handleWalletLedger(ctx, apiReq)
 		default:
 			return events.APIGatewayProxyResponse{
 				StatusCode: 404,
@@ -94,14 +129,52 @@ func (h *WalletHandler) HandleRequest(ctx context.Context, request interface{})
 			if body, ok := inputMap["body"].(string); ok {
 				apiReq.Body = body
 			}
+			if headers, ok := inputMap["headers"].(map[string]interface{}); ok {
+				apiReq.Headers = make(map[string]string, len(headers))
+				for name, value := range headers {
+					if str, ok := value.(string); ok {
+						apiReq.Headers[name] = str
+					}
+				}
+			}
+			if params, ok := inputMap["queryStringParameters"].(map[string]interface{}); ok {
+				apiReq.QueryStringParameters = make(map[string]string, len(params))
+				for key, value := range params {
+					if str, ok := value.(string); ok {
+						apiReq.QueryStringParameters[key] = str
+					}
+				}
+			}
 
 			switch path {
+			case "/wallet":
+				return h.handleCreateWallet(ctx, apiReq)
 			case "/wallet/debit":
-				return h.handleDebit(ctx, apiReq)
+				return h.idempotency.Wrap(h.handleDebit)(ctx, apiReq)
 			case "/wallet/credit":
-				return h.handleCredit(ctx, apiReq)
+				return h.idempotency.Wrap(h.handleCredit)(ctx, apiReq)
 			case "/wallet/balance":
 				return h.handleGetBalance(ctx, apiReq)
+			case "/wallet/transactions":
+				return h.handleListTransactions(ctx, apiReq)
+			case "/wallet/hold":
+				return h.handleHold(ctx, apiReq)
+			case "/wallet/capture":
+				return h.handleCapture(ctx, apiReq)
+			case "/wallet/release":
+				return h.handleRelease(ctx, apiReq)
+			case "/wallet/transfer":
+				return h.handleTransfer(ctx, apiReq)
+			case "/wallet/limits":
+				return h.handleSpendingLimits(ctx, apiReq)
+			case "/wallet/status":
+				return h.handleSetWalletStatus(ctx, apiReq)
+			case "/wallet/credit-limit":
+				return h.handleSetCreditLimit(ctx, apiReq)
+			case "/wallet/statement":
+				return h.handleStatement(ctx, apiReq)
+			case "/wallet/ledger":
+				return h.handleWalletLedger(ctx, apiReq)
 			default:
 				return events.APIGatewayProxyResponse{
 					StatusCode: 404,
@@ -122,6 +195,25 @@ func (h *WalletHandler) HandleRequest(ctx context.Context, request interface{})
 	}, nil
 }
 
+func (h *WalletHandler) handleCreateWallet(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req service.CreateWalletRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		h.logger.Error("Failed to unmarshal request", err, nil)
+		return utils.ErrorResponse(400, "invalid request format")
+	}
+
+	result, err := h.service.CreateWallet(ctx, req)
+	if err != nil {
+		h.logger.Error("Failed to create wallet", err, nil)
+		return errorResponse(err, "failed to create wallet")
+	}
+
+	if result.Created {
+		return utils.SuccessResponse(201, result)
+	}
+	return utils.SuccessResponse(200, result)
+}
+
 func (h *WalletHandler) handleDebit(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	var req service.DebitRequest
 	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
@@ -135,16 +227,13 @@ func (h *WalletHandler) handleDebit(ctx context.Context, request events.APIGatew
 		"paymentId": req.PaymentID,
 	})
 
-	wallet, err := h.service.DebitWallet(ctx, req)
+	result, err := h.service.DebitWallet(ctx, req)
 	if err != nil {
-		if err.Error()[:12] == "insufficient" {
-			return utils.ErrorResponse(400, err.Error())
-		}
 		h.logger.Error("Failed to debit wallet", err, nil)
-		return utils.ErrorResponse(500, "failed to debit wallet")
+		return errorResponse(err, "failed to debit wallet")
 	}
 
-	return utils.SuccessResponse(200, wallet)
+	return utils.SuccessResponse(200, result)
 }
 
 func (h *WalletHandler) handleCredit(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -161,13 +250,13 @@ func (h *WalletHandler) handleCredit(ctx context.Context, request events.APIGate
 		"reason":    req.RefundReason,
 	})
 
-	wallet, err := h.service.CreditWallet(ctx, req)
+	result, err := h.service.CreditWallet(ctx, req)
 	if err != nil {
 		h.logger.Error("Failed to credit wallet", err, nil)
-		return utils.ErrorResponse(500, "failed to credit wallet")
+		return errorResponse(err, "failed to credit wallet")
 	}
 
-	return utils.SuccessResponse(200, wallet)
+	return utils.SuccessResponse(200, result)
 }
 
 func (h *WalletHandler) handleStepFunctionInput(ctx context.Context, input map[string]interface{}, action string) (interface{}, error) {
@@ -177,9 +266,38 @@ func (h *WalletHandler) handleStepFunctionInput(ctx context.Context, input map[s
 	})
 
 	switch action {
+	case "create_wallet":
+		var req service.CreateWalletRequest
+		if err := decodeInput(input, &req); err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		result, err := h.service.CreateWallet(ctx, req)
+		if err != nil {
+			h.logger.Error("Failed to create wallet", err, nil)
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		return types.LambdaResponse{
+			Success: true,
+			Data:    result,
+		}, nil
+
 	case "check_balance":
 		userID, _ := input["userId"].(string)
-		amount, _ := input["amount"].(float64)
+		amount, err := utils.MoneyFromInput(input["amount"])
+		if err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
 
 		wallet, err := h.service.GetBalance(ctx, userID)
 		if err != nil {
@@ -190,20 +308,71 @@ func (h *WalletHandler) handleStepFunctionInput(ctx context.Context, input map[s
 			}, nil
 		}
 
-		// Check if balance is sufficient
-		hasSufficient := wallet.Balance >= amount
+		// A frozen or closed wallet cannot pay, whatever its balance
+		if status := wallet.CurrentStatus(); !status.AllowsDebits() {
+			return types.LambdaResponse{
+				Success: false,
+				Data: map[string]interface{}{
+					"balance": wallet.Balance,
+					"status":  status,
+				},
+				Error: apperrors.NewWalletNotActiveError(userID, string(status)).Error(),
+			}, nil
+		}
+
+		// Check if balance is sufficient, excluding funds reserved by holds
+		// and including the wallet's credit line
+		cmp, err := wallet.Available().Cmp(amount)
+		if err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+		hasSufficient := cmp >= 0
+		data := map[string]interface{}{
+			"balance":              wallet.Balance,
+			"available":            wallet.Available(),
+			"held":                 wallet.Held,
+			"creditLimit":          wallet.CreditLimit,
+			"overdraft":            wallet.Overdraft(),
+			"hasSufficientBalance": hasSufficient,
+		}
+		if !hasSufficient {
+			return types.LambdaResponse{
+				Success: false,
+				Data:    data,
+			}, nil
+		}
+
+		// Enough funds is not enough if the user would go over a spending limit
+		if err := h.service.CheckSpendingLimits(ctx, wallet, amount); err != nil {
+			var appErr *apperrors.AppError
+			if errors.As(err, &appErr) && appErr.Code == apperrors.ErrCodeSpendingLimit {
+				data["spendingLimit"] = appErr.Details
+			}
+			return types.LambdaResponse{
+				Success: false,
+				Data:    data,
+				Error:   err.Error(),
+			}, nil
+		}
+
 		return types.LambdaResponse{
-			Success: hasSufficient,
-			Data: map[string]interface{}{
-				"balance":              wallet.Balance,
-				"hasSufficientBalance": hasSufficient,
-			},
+			Success: true,
+			Data:    data,
 		}, nil
 
 	case "debit":
 		userID, _ := input["userId"].(string)
-		amount, _ := input["amount"].(float64)
 		paymentID, _ := input["paymentId"].(string)
+		amount, err := utils.MoneyFromInput(input["amount"])
+		if err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
 
 		req := service.DebitRequest{
 			UserID:    userID,
@@ -211,7 +380,7 @@ func (h *WalletHandler) handleStepFunctionInput(ctx context.Context, input map[s
 			PaymentID: paymentID,
 		}
 
-		wallet, err := h.service.DebitWallet(ctx, req)
+		result, err := h.service.DebitWallet(ctx, req)
 		if err != nil {
 			h.logger.Error("Failed to debit wallet", err, nil)
 			return types.LambdaResponse{
@@ -222,14 +391,20 @@ func (h *WalletHandler) handleStepFunctionInput(ctx context.Context, input map[s
 
 		return types.LambdaResponse{
 			Success: true,
-			Data:    wallet,
+			Data:    result,
 		}, nil
 
 	case "credit":
 		userID, _ := input["userId"].(string)
-		amount, _ := input["amount"].(float64)
 		paymentID, _ := input["paymentId"].(string)
 		reason, _ := input["reason"].(string)
+		amount, err := utils.MoneyFromInput(input["amount"])
+		if err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
 
 		req := service.CreditRequest{
 			UserID:       userID,
@@ -238,18 +413,219 @@ func (h *WalletHandler) handleStepFunctionInput(ctx context.Context, input map[s
 			RefundReason: reason,
 		}
 
-		_, err := h.service.CreditWallet(ctx, req)
+		result, err := h.service.CreditWallet(ctx, req)
 		if err != nil {
 			h.logger.Error("Failed to credit wallet", err, nil)
-			return map[string]interface{}{
-				"statusCode": 500,
-				"body":       fmt.Sprintf(`{"error": "%s"}`, err.Error()),
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
 			}, nil
 		}
 
-		return map[string]interface{}{
-			"statusCode": 200,
-			"body":       `{"success": true}`,
+		return types.LambdaResponse{
+			Success: true,
+			Data:    result,
+		}, nil
+
+	case "hold":
+		var req service.HoldRequest
+		if err := decodeInput(input, &req); err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		result, err := h.service.Hold(ctx, req)
+		if err != nil {
+			h.logger.Error("Failed to hold wallet funds", err, nil)
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		return types.LambdaResponse{
+			Success: true,
+			Data:    result,
+		}, nil
+
+	case "capture":
+		var req service.CaptureRequest
+		if err := decodeInput(input, &req); err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		result, err := h.service.Capture(ctx, req)
+		if err != nil {
+			h.logger.Error("Failed to capture wallet hold", err, nil)
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		return types.LambdaResponse{
+			Success: true,
+			Data:    result,
+		}, nil
+
+	case "release":
+		var req service.ReleaseRequest
+		if err := decodeInput(input, &req); err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		result, err := h.service.Release(ctx, req)
+		if err != nil {
+			h.logger.Error("Failed to release wallet hold", err, nil)
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		return types.LambdaResponse{
+			Success: true,
+			Data:    result,
+		}, nil
+
+	case "check_deposit":
+		var req service.DepositRequest
+		if err := decodeInput(input, &req); err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		wallet, err := h.service.CheckDeposit(ctx, req)
+		if err != nil {
+			h.logger.Error("Deposit rejected", err, nil)
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		return types.LambdaResponse{
+			Success: true,
+			Data:    wallet,
+		}, nil
+
+	case "deposit":
+		var req service.DepositRequest
+		if err := decodeInput(input, &req); err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		result, err := h.service.Deposit(ctx, req)
+		if err != nil {
+			h.logger.Error("Failed to deposit to wallet", err, nil)
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		return types.LambdaResponse{
+			Success: true,
+			Data:    result,
+		}, nil
+
+	case "transfer":
+		var req service.TransferRequest
+		if err := decodeInput(input, &req); err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		result, err := h.service.Transfer(ctx, req)
+		if err != nil {
+			h.logger.Error("Failed to transfer between wallets", err, nil)
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		return types.LambdaResponse{
+			Success: true,
+			Data:    result,
+		}, nil
+
+	case "release_expired_holds":
+		released, err := h.service.ReleaseExpiredHolds(ctx)
+		if err != nil {
+			h.logger.Error("Failed to release expired holds", err, nil)
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		return types.LambdaResponse{
+			Success: true,
+			Data: map[string]interface{}{
+				"released": released,
+			},
+		}, nil
+
+	case "reconcile_wallets":
+		var req service.ReconcileRequest
+		if err := decodeInput(input, &req); err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		report, err := h.service.ReconcileWallets(ctx, req)
+		if err != nil {
+			h.logger.Error("Failed to reconcile wallets", err, nil)
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		return types.LambdaResponse{
+			Success: true,
+			Data:    report,
+		}, nil
+
+	case "list_transactions":
+		var req service.ListTransactionsRequest
+		if err := decodeInput(input, &req); err != nil {
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		history, err := h.service.ListTransactions(ctx, req)
+		if err != nil {
+			h.logger.Error("Failed to list wallet transactions", err, nil)
+			return types.LambdaResponse{
+				Success: false,
+				Error:   err.Error(),
+			}, nil
+		}
+
+		return types.LambdaResponse{
+			Success: true,
+			Data:    history,
 		}, nil
 
 	default:
@@ -271,12 +647,16 @@ func (h *WalletHandler) handleGetBalance(ctx context.Context, request events.API
 		h.logger.Error("Failed to get balance", err, map[string]interface{}{
 			"userId": userID,
 		})
-		return utils.ErrorResponse(500, "failed to get balance")
+		return errorResponse(err, "failed to get balance")
 	}
 
 	body, _ := json.Marshal(map[string]interface{}{
-		"userId":  wallet.UserID,
-		"balance": wallet.Balance,
+		"userId":      wallet.UserID,
+		"balance":     wallet.Balance,
+		"available":   wallet.Available(),
+		"held":        wallet.Held,
+		"creditLimit": wallet.CreditLimit,
+		"overdraft":   wallet.Overdraft(),
 	})
 
 	return events.APIGatewayProxyResponse{
@@ -284,3 +664,257 @@ func (h *WalletHandler) handleGetBalance(ctx context.Context, request events.API
 		Body:       string(body),
 	}, nil
 }
+
+func (h *WalletHandler) handleHold(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req service.HoldRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		h.logger.Error("Failed to unmarshal request", err, nil)
+		return utils.ErrorResponse(400, "invalid request format")
+	}
+
+	result, err := h.service.Hold(ctx, req)
+	if err != nil {
+		h.logger.Error("Failed to hold wallet funds", err, nil)
+		return errorResponse(err, "failed to hold wallet funds")
+	}
+
+	return utils.SuccessResponse(200, result)
+}
+
+func (h *WalletHandler) handleCapture(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req service.CaptureRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		h.logger.Error("Failed to unmarshal request", err, nil)
+		return utils.ErrorResponse(400, "invalid request format")
+	}
+
+	result, err := h.service.Capture(ctx, req)
+	if err != nil {
+		h.logger.Error("Failed to capture wallet hold", err, nil)
+		return errorResponse(err, "failed to capture wallet hold")
+	}
+
+	return utils.SuccessResponse(200, result)
+}
+
+func (h *WalletHandler) handleRelease(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req service.ReleaseRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		h.logger.Error("Failed to unmarshal request", err, nil)
+		return utils.ErrorResponse(400, "invalid request format")
+	}
+
+	result, err := h.service.Release(ctx, req)
+	if err != nil {
+		h.logger.Error("Failed to release wallet hold", err, nil)
+		return errorResponse(err, "failed to release wallet hold")
+	}
+
+	return utils.SuccessResponse(200, result)
+}
+
+func (h *WalletHandler) handleTransfer(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req service.TransferRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		h.logger.Error("Failed to unmarshal request", err, nil)
+		return utils.ErrorResponse(400, "invalid request format")
+	}
+
+	result, err := h.service.Transfer(ctx, req)
+	if err != nil {
+		h.logger.Error("Failed to transfer between wallets", err, nil)
+		return errorResponse(err, "failed to transfer between wallets")
+	}
+
+	return utils.SuccessResponse(200, result)
+}
+
+// handleSpendingLimits returns a user's spending allowances on GET and
+// overrides their limits on PUT
+func (h *WalletHandler) handleSpendingLimits(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if request.HTTPMethod == "GET" {
+		userID := request.QueryStringParameters["userId"]
+		if userID == "" {
+			return utils.ErrorResponse(400, "userId is required")
+		}
+
+		result, err := h.service.GetSpendingLimits(ctx, userID)
+		if err != nil {
+			h.logger.Error("Failed to get spending limits", err, nil)
+			return errorResponse(err, "failed to get spending limits")
+		}
+
+		return utils.SuccessResponse(200, result)
+	}
+
+	var req service.SetSpendingLimitsRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		h.logger.Error("Failed to unmarshal request", err, nil)
+		return utils.ErrorResponse(400, "invalid request format")
+	}
+
+	result, err := h.service.SetSpendingLimits(ctx, req)
+	if err != nil {
+		h.logger.Error("Failed to set spending limits", err, nil)
+		return errorResponse(err, "failed to set spending limits")
+	}
+
+	return utils.SuccessResponse(200, result)
+}
+
+// handleSetWalletStatus is the admin endpoint that freezes, unfreezes or
+// closes a wallet
+func (h *WalletHandler) handleSetWalletStatus(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req service.SetWalletStatusRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		h.logger.Error("Failed to unmarshal request", err, nil)
+		return utils.ErrorResponse(400, "invalid request format")
+	}
+
+	wallet, err := h.service.SetWalletStatus(ctx, req)
+	if err != nil {
+		h.logger.Error("Failed to change wallet status", err, nil)
+		return errorResponse(err, "failed to change wallet status")
+	}
+
+	return utils.SuccessResponse(200, wallet)
+}
+
+// handleSetCreditLimit sets how far below zero a wallet's balance may go
+func (h *WalletHandler) handleSetCreditLimit(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req service.SetCreditLimitRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		h.logger.Error("Failed to unmarshal request", err, nil)
+		return utils.ErrorResponse(400, "invalid request format")
+	}
+
+	wallet, err := h.service.SetCreditLimit(ctx, req)
+	if err != nil {
+		h.logger.Error("Failed to set wallet credit limit", err, nil)
+		return errorResponse(err, "failed to set wallet credit limit")
+	}
+
+	return utils.SuccessResponse(200, wallet)
+}
+
+func (h *WalletHandler) handleListTransactions(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	params := request.QueryStringParameters
+	req := service.ListTransactionsRequest{
+		UserID: params["userId"],
+		From:   params["from"],
+		To:     params["to"],
+		Type:   params["type"],
+		Cursor: params["cursor"],
+	}
+	if req.UserID == "" {
+		return utils.ErrorResponse(400, "userId is required")
+	}
+	if limit := params["limit"]; limit != "" {
+		parsed, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil {
+			return utils.ErrorResponse(400, "invalid limit")
+		}
+		req.Limit = parsed
+	}
+
+	history, err := h.service.ListTransactions(ctx, req)
+	if err != nil {
+		h.logger.Error("Failed to list wallet transactions", err, map[string]interface{}{
+			"userId": req.UserID,
+		})
+		return errorResponse(err, "failed to list wallet transactions")
+	}
+
+	return utils.SuccessResponse(200, history)
+}
+
+// handleStatement exports a user's statement for a period as JSON, the
+// default, or as a CSV file
+func (h *WalletHandler) handleStatement(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	params := request.QueryStringParameters
+	req := service.StatementRequest{
+		UserID: params["userId"],
+		From:   params["from"],
+		To:     params["to"],
+	}
+	if req.UserID == "" {
+		return utils.ErrorResponse(400, "userId is required")
+	}
+
+	format := strings.ToLower(params["format"])
+	if format == "" {
+		format = service.StatementFormatJSON
+	}
+	if format != service.StatementFormatJSON && format != service.StatementFormatCSV {
+		return utils.ErrorResponse(400, "format must be csv or json")
+	}
+
+	statement, err := h.service.GetStatement(ctx, req)
+	if err != nil {
+		h.logger.Error("Failed to build wallet statement", err, map[string]interface{}{
+			"userId": req.UserID,
+		})
+		return errorResponse(err, "failed to build wallet statement")
+	}
+
+	if format == service.StatementFormatJSON {
+		return utils.SuccessResponse(200, statement)
+	}
+
+	var body strings.Builder
+	if err := statement.WriteCSV(&body); err != nil {
+		h.logger.Error("Failed to write wallet statement", err, nil)
+		return utils.ErrorResponse(500, "failed to write wallet statement")
+	}
+
+	filename := fmt.Sprintf("statement-%s-%s-%s.csv", req.UserID, statement.From.Format("20060102"), statement.To.Format("20060102"))
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Body:       body.String(),
+		Headers: map[string]string{
+			"Content-Type":        "text/csv",
+			"Content-Disposition": fmt.Sprintf("attachment; filename=%q", filename),
+		},
+	}, nil
+}
+
+// handleWalletLedger returns a user's wallet balance with its ledger account
+// balance and postings
+func (h *WalletHandler) handleWalletLedger(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	userID := request.QueryStringParameters["userId"]
+	if userID == "" {
+		return utils.ErrorResponse(400, "userId is required")
+	}
+
+	account, err := h.service.GetWalletAccount(ctx, userID)
+	if err != nil {
+		h.logger.Error("Failed to get wallet ledger account", err, map[string]interface{}{
+			"userId": userID,
+		})
+		return errorResponse(err, "failed to get wallet ledger account")
+	}
+
+	return utils.SuccessResponse(200, account)
+}
+
+// decodeInput copies a Step Function input map into a typed request
+func decodeInput(input map[string]interface{}, v interface{}) error {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("invalid input: %w", err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid input: %w", err)
+	}
+	return nil
+}
+
+// errorResponse maps typed application errors to their HTTP status, code and details.
+// Any other error is reported as a 500 with the given fallback message.
+func errorResponse(err error, fallback string) (events.APIGatewayProxyResponse, error) {
+	var appErr *apperrors.AppError
+	if errors.As(err, &appErr) && appErr.StatusCode < 500 {
+		return utils.AppErrorResponse(appErr)
+	}
+	return utils.ErrorResponse(500, fallback)
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// balanceFloor is the lowest balance a wallet may have before a debit of
+// amount: the debit applies while Balance >= amount - CreditLimit, so the
+// balance never goes below -CreditLimit
+func balanceFloor(wallet *types.Wallet, amount types.Money) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{
+		N: aws.String(strconv.FormatInt(amount.Amount-wallet.CreditLimit.Amount, 10)),
+	}
+}
+
+// SetCreditLimit sets how far below zero the wallet's balance may go,
+// recording the reason and actor in a wallet.credit_limit_set event written
+// in the same transaction. The change bumps Version, so writes that read the
+// wallet before it retry with the new limit. A limit cannot be lowered below
+// what the wallet already owes on it, holds included.
+func (r *WalletRepository) SetCreditLimit(ctx context.Context, userID string, limit types.Money, reason, actor string) (*types.Wallet, error) {
+	var wallet *types.Wallet
+	err := r.withRetry(ctx, userID, "credit_limit", func() (err error) {
+		wallet, err = r.setCreditLimit(ctx, userID, limit, reason, actor)
+		return err
+	})
+	return wallet, err
+}
+
+func (r *WalletRepository) setCreditLimit(ctx context.Context, userID string, limit types.Money, reason, actor string) (*types.Wallet, error) {
+	wallet, err := r.GetWallet(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if status := wallet.CurrentStatus(); status == types.WalletStatusClosed {
+		return nil, apperrors.NewWalletNotActiveError(userID, string(status))
+	}
+	if !wallet.Balance.SameCurrency(limit) {
+		return nil, apperrors.NewCurrencyMismatchError(wallet.Balance.Currency, limit.Currency)
+	}
+
+	updated := *wallet
+	updated.CreditLimit = limit
+	if updated.Available().IsNegative() {
+		return nil, apperrors.NewValidationError("credit limit does not cover the wallet's overdraft and holds", map[string]interface{}{
+			"overdraft": wallet.Overdraft(),
+			"held":      wallet.Held,
+		})
+	}
+
+	limitItem, err := dynamodbattribute.MarshalMap(limit)
+	if err != nil {
+		return nil, apperrors.NewLedgerWriteError(fmt.Errorf("failed to marshal credit limit: %w", err))
+	}
+
+	now := time.Now().UTC()
+	event := &types.PaymentEvent{
+		ID:        fmt.Sprintf("%s#%s", userID, uuid.New().String()),
+		PaymentID: walletCreditLimitEventID(userID),
+		UserID:    userID,
+		EventType: string(types.EventWalletCreditLimitSet),
+		Amount:    limit,
+		Status:    "SUCCESS",
+		Metadata: map[string]interface{}{
+			"previousLimit": wallet.CreditLimit,
+			"creditLimit":   limit,
+			"overdraft":     wallet.Overdraft(),
+			"reason":        reason,
+			"actor":         actor,
+		},
+		Timestamp: now,
+	}
+	eventPut, err := r.putEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.writeTransaction(ctx, wallet, "credit_limit", []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String(r.walletsTable),
+				Key: map[string]*dynamodb.AttributeValue{
+					"UserID": {
+						S: aws.String(userID),
+					},
+				},
+				UpdateExpression:    aws.String("SET CreditLimit = :limit, #available = :available, Version = :newVersion, UpdatedAt = :updatedAt"),
+				ConditionExpression: aws.String("Version = :currentVersion"),
+				ExpressionAttributeNames: map[string]*string{
+					"#available": aws.String(availableAttribute),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":limit": {
+						M: limitItem,
+					},
+					":available": availableValue(wallet.Balance, wallet.Held, limit),
+					":newVersion": {
+						N: aws.String(fmt.Sprintf("%d", wallet.Version+1)),
+					},
+					":currentVersion": {
+						N: aws.String(fmt.Sprintf("%d", wallet.Version)),
+					},
+					":updatedAt": {
+						S: aws.String(now.Format(time.RFC3339)),
+					},
+				},
+			},
+		},
+		eventPut,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	updated.Version++
+	updated.UpdatedAt = now
+	return &updated, nil
+}
+
+// walletCreditLimitEventID is the PaymentEvents partition holding a wallet's
+// credit limit changes, which belong to no payment
+func walletCreditLimitEventID(userID string) string {
+	return fmt.Sprintf("wallet-credit-limit#%s", userID)
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWallet_CreditLine(t *testing.T) {
+	wallet := &types.Wallet{
+		UserID:      "user123",
+		Balance:     types.NewMoney(-2000, "USD"),
+		Held:        types.NewMoney(1000, "USD"),
+		CreditLimit: types.NewMoney(5000, "USD"),
+	}
+
+	assert.Equal(t, types.NewMoney(2000, "USD"), wallet.Available())
+	assert.Equal(t, types.NewMoney(2000, "USD"), wallet.Overdraft())
+	assert.Equal(t, "-4500", *balanceFloor(wallet, types.NewMoney(500, "USD")).N)
+	assert.Equal(t, "2000", *availableValue(wallet.Balance, wallet.Held, wallet.CreditLimit).N)
+}
+
+func TestNewTransactionEvent_Overdraft(t *testing.T) {
+	// A debit that uses up the balance draws the rest on the credit line
+	debit := newTransactionEvent(&types.WalletTransaction{
+		PaymentID:     "pay-1",
+		Type:          types.TransactionTypeDebit,
+		Amount:        types.NewMoney(3000, "USD"),
+		BalanceBefore: usd(1000),
+		BalanceAfter:  usd(-2000),
+	})
+	assert.Equal(t, types.NewMoney(2000, "USD"), debit.Metadata["overdraftDrawn"])
+	assert.NotContains(t, debit.Metadata, "overdraftRepaid")
+
+	// A credit repays the overdraft before it adds to the balance
+	credit := newTransactionEvent(&types.WalletTransaction{
+		PaymentID:     "dep-1",
+		Type:          types.TransactionTypeDeposit,
+		Amount:        types.NewMoney(5000, "USD"),
+		BalanceBefore: usd(-2000),
+		BalanceAfter:  usd(3000),
+	})
+	assert.Equal(t, types.NewMoney(2000, "USD"), credit.Metadata["overdraftRepaid"])
+	assert.NotContains(t, credit.Metadata, "overdraftDrawn")
+
+	// Nothing is recorded while the balance stays above zero
+	plain := newTransactionEvent(&types.WalletTransaction{
+		PaymentID:     "pay-2",
+		Type:          types.TransactionTypeDebit,
+		Amount:        types.NewMoney(500, "USD"),
+		BalanceBefore: usd(1000),
+		BalanceAfter:  usd(500),
+	})
+	assert.NotContains(t, plain.Metadata, "overdraftDrawn")
+	assert.NotContains(t, plain.Metadata, "overdraftRepaid")
+}
+
+// usd is a USD balance snapshot of amount minor units
+func usd(amount int64) *types.Money {
+	money := types.NewMoney(amount, "USD")
+	return &money
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/google/uuid"
+)
+
+// The debit benchmarks run against a real DynamoDB with the tables from
+// scripts/create-tables.sh, and are skipped unless DYNAMODB_ENDPOINT is set:
+//
+//	make docker-up create-tables
+//	cd lambdas/wallet-service
+//	DYNAMODB_ENDPOINT=http://localhost:4566 AWS_ACCESS_KEY_ID=test AWS_SECRET_ACCESS_KEY=test \
+//	    go test -run '^$' -bench Debit -benchtime 500x ./internal/repository
+
+// BenchmarkDebit_ReadModifyWrite is the debit as WalletService ran it before
+// the single-write path: look up the transaction, read the wallet, read it
+// again and write with optimistic locking, then read it for the response.
+func BenchmarkDebit_ReadModifyWrite(b *testing.B) {
+	repo, userID := dynamoWallet(b)
+	ctx := context.Background()
+	amount := types.NewMoney(1, "USD")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		paymentID := fmt.Sprintf("bench-rmw-%d", i)
+		if _, err := repo.GetTransaction(ctx, userID, paymentID, types.TransactionTypeDebit); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := repo.GetWallet(ctx, userID); err != nil {
+			b.Fatal(err)
+		}
+		if _, _, err := repo.debitWallet(ctx, userID, amount, paymentID, nil); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := repo.GetWallet(ctx, userID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkDebit_SingleWrite is the debit as WalletService runs it now
+func BenchmarkDebit_SingleWrite(b *testing.B) {
+	repo, userID := dynamoWallet(b)
+	ctx := context.Background()
+	amount := types.NewMoney(1, "USD")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := repo.DebitWallet(ctx, userID, amount, fmt.Sprintf("bench-single-%d", i), nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// dynamoWallet connects to DYNAMODB_ENDPOINT and creates a wallet that
+// cannot run out of funds during a benchmark or test. It has no spending
+// limits, and its spending windows are set so debits can take the single write.
+func dynamoWallet(tb testing.TB) (*WalletRepository, string) {
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		tb.Skip("DYNAMODB_ENDPOINT is not set")
+	}
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:   aws.String("us-east-1"),
+		Endpoint: aws.String(endpoint),
+	}))
+	repo := NewWalletRepository(dynamodb.New(sess), nil, "Wallets", "WalletTransactions", "WalletHolds", "PaymentEvents", "ReconciliationReports", "Ledger")
+
+	now := time.Now()
+	userID := "bench-" + uuid.New().String()
+	_, err := repo.CreateWallet(context.Background(), &types.Wallet{
+		UserID:    userID,
+		Balance:   types.NewMoney(1<<40, "USD"),
+		Held:      types.NewMoney(0, "USD"),
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	limits := &types.SpendingLimits{UserID: userID, UpdatedBy: "test", UpdatedAt: now}
+	if _, err := repo.SetSpendingLimits(context.Background(), limits, nil); err != nil {
+		tb.Fatal(err)
+	}
+
+	return repo, userID
+}
@@ -2,7 +2,10 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -10,24 +13,51 @@ import (
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 	"github.com/google/uuid"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/ledger"
+	"github.com/draftea-coding-challenge/shared/observability"
 	"github.com/draftea-coding-challenge/shared/types"
 )
 
+var (
+	// ErrTransactionExists is returned when a wallet transaction for the same
+	// user, payment and type has already been committed
+	ErrTransactionExists = errors.New("wallet transaction already exists")
+
+	// ErrWalletExists is returned when creating a wallet for a user who has one
+	ErrWalletExists = errors.New("wallet already exists")
+)
+
+// onboardingPaymentID stands in for the payment of a wallet's onboarding
+// grant, so each wallet has at most one GRANT transaction
+const onboardingPaymentID = "onboarding"
+
 type WalletRepository struct {
-	db              *dynamodb.DynamoDB
-	walletsTable    string
-	eventsTable     string
+	db                *dynamodb.DynamoDB
+	metrics           *observability.MetricsCollector
+	walletsTable      string
+	transactionsTable string
+	holdsTable        string
+	eventsTable       string
+	reportsTable      string
+	ledger            *ledger.Store
 }
 
-func NewWalletRepository(db *dynamodb.DynamoDB, walletsTable, eventsTable string) *WalletRepository {
+func NewWalletRepository(db *dynamodb.DynamoDB, metrics *observability.MetricsCollector, walletsTable, transactionsTable, holdsTable, eventsTable, reportsTable, ledgerTable string) *WalletRepository {
 	return &WalletRepository{
-		db:           db,
-		walletsTable: walletsTable,
-		eventsTable:  eventsTable,
+		db:                db,
+		metrics:           metrics,
+		walletsTable:      walletsTable,
+		transactionsTable: transactionsTable,
+		holdsTable:        holdsTable,
+		eventsTable:       eventsTable,
+		reportsTable:      reportsTable,
+		ledger:            ledger.NewStore(db, ledgerTable),
 	}
 }
 
-// GetWallet retrieves wallet for a user, creates if not exists
+// GetWallet retrieves wallet for a user. A user without a wallet gets a
+// not found error: wallets are only created by CreateWallet.
 func (r *WalletRepository) GetWallet(ctx context.Context, userID string) (*types.Wallet, error) {
 	result, err := r.db.GetItemWithContext(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(r.walletsTable),
@@ -36,27 +66,16 @@ func (r *WalletRepository) GetWallet(ctx context.Context, userID string) (*types
 				S: aws.String(userID),
 			},
 		},
+		// Writes are conditioned on Version, so always read the latest one
+		ConsistentRead: aws.Bool(true),
 	})
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to get wallet: %w", err)
 	}
 
-	// Create wallet if doesn't exist
 	if result.Item == nil {
-		wallet := &types.Wallet{
-			UserID:    userID,
-			Balance:   1000.0, // Initial balance
-			Currency:  "USD",
-			Version:   0,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
-		}
-
-		if err := r.CreateWallet(ctx, wallet); err != nil {
-			return nil, err
-		}
-		return wallet, nil
+		return nil, apperrors.NewNotFoundError("wallet")
 	}
 
 	var wallet types.Wallet
@@ -67,129 +86,276 @@ func (r *WalletRepository) GetWallet(ctx context.Context, userID string) (*types
 	return &wallet, nil
 }
 
-// CreateWallet creates a new wallet
-func (r *WalletRepository) CreateWallet(ctx context.Context, wallet *types.Wallet) error {
+// CreateWallet creates a new wallet whose balance is the onboarding grant. A
+// non-zero grant is recorded as a GRANT transaction written together with the
+// wallet, and returned. ErrWalletExists is returned if the user has a wallet.
+func (r *WalletRepository) CreateWallet(ctx context.Context, wallet *types.Wallet) (*types.WalletTransaction, error) {
 	item, err := dynamodbattribute.MarshalMap(wallet)
 	if err != nil {
-		return fmt.Errorf("failed to marshal wallet: %w", err)
+		return nil, fmt.Errorf("failed to marshal wallet: %w", err)
 	}
+	item[availableAttribute] = availableValue(wallet.Balance, wallet.Held, wallet.CreditLimit)
 
-	_, err = r.db.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+	walletPut := &dynamodb.Put{
 		TableName:           aws.String(r.walletsTable),
 		Item:                item,
 		ConditionExpression: aws.String("attribute_not_exists(UserID)"),
-	})
+	}
 
+	if wallet.Balance.IsZero() {
+		_, err = r.db.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+			TableName:           walletPut.TableName,
+			Item:                walletPut.Item,
+			ConditionExpression: walletPut.ConditionExpression,
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				return nil, ErrWalletExists
+			}
+			return nil, fmt.Errorf("failed to create wallet: %w", err)
+		}
+		return nil, nil
+	}
+
+	opening := types.NewMoney(0, wallet.Balance.Currency)
+	grant := &types.WalletTransaction{
+		ID:            transactionID(wallet.UserID, onboardingPaymentID, types.TransactionTypeGrant),
+		UserID:        wallet.UserID,
+		PaymentID:     onboardingPaymentID,
+		Type:          types.TransactionTypeGrant,
+		Amount:        wallet.Balance,
+		BalanceBefore: &opening,
+		BalanceAfter:  &wallet.Balance,
+		Timestamp:     time.Now().UTC(),
+	}
+
+	transactionPut, err := r.putTransaction(grant)
+	if err != nil {
+		return nil, err
+	}
+
+	eventPut, err := r.putEvent(newTransactionEvent(grant))
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
-			return fmt.Errorf("wallet already exists for user %s", wallet.UserID)
+		return nil, err
+	}
+
+	journalItems, err := r.journalItems(grant)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.db.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]*dynamodb.TransactWriteItem{
+			{Put: walletPut},
+			transactionPut,
+			eventPut,
+		}, journalItems...),
+	})
+	if err != nil {
+		var canceled *dynamodb.TransactionCanceledException
+		if errors.As(err, &canceled) && len(canceled.CancellationReasons) > 1 {
+			// A grant row without its wallet can only mean the wallet exists too
+			for _, reason := range canceled.CancellationReasons[:2] {
+				if aws.StringValue(reason.Code) == "ConditionalCheckFailed" {
+					return nil, ErrWalletExists
+				}
+			}
 		}
-		return fmt.Errorf("failed to create wallet: %w", err)
+		return nil, apperrors.NewLedgerWriteError(fmt.Errorf("failed to create wallet: %w", err))
+	}
+
+	return grant, nil
+}
+
+// DebitWallet debits amount from wallet and returns the transaction. It first
+// tries a single conditional write (see applyInPlace), which returns no
+// wallet. When that condition fails it reads the wallet and writes with
+// optimistic locking, retrying when another write changes the wallet between
+// the read and the update, which also reports why the write failed; that path
+// also returns the wallet as the debit left it.
+//
+// The debit counts against the wallet's spending limits, its own or else
+// defaults, which are keyed by period; both paths check them in the write.
+func (r *WalletRepository) DebitWallet(ctx context.Context, userID string, amount types.Money, paymentID string, defaults map[string]types.Money) (*types.WalletTransaction, *types.Wallet, error) {
+	transaction, err := r.applyInPlace(ctx, userID, types.TransactionTypeDebit, amount, paymentID, defaults)
+	if !errors.Is(err, errNeedsRead) {
+		return transaction, nil, err
 	}
 
-	return nil
+	var wallet *types.Wallet
+	err = r.withRetry(ctx, userID, "debit", func() (err error) {
+		transaction, wallet, err = r.debitWallet(ctx, userID, amount, paymentID, defaults)
+		return err
+	})
+	return transaction, wallet, err
 }
 
-// DebitWallet debits amount from wallet with optimistic locking
-func (r *WalletRepository) DebitWallet(ctx context.Context, userID string, amount float64, paymentID string) (*types.WalletTransaction, error) {
+func (r *WalletRepository) debitWallet(ctx context.Context, userID string, amount types.Money, paymentID string, defaults map[string]types.Money) (*types.WalletTransaction, *types.Wallet, error) {
 	wallet, err := r.GetWallet(ctx, userID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if err := checkStatus(wallet, true); err != nil {
+		return nil, nil, err
+	}
+
+	newBalance, err := wallet.Balance.Sub(amount)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	if wallet.Balance < amount {
-		return nil, fmt.Errorf("insufficient balance: available=%f, required=%f", wallet.Balance, amount)
+	// Funds reserved by holds cannot be debited directly; the credit line can
+	if available := wallet.Available(); available.Amount < amount.Amount {
+		return nil, nil, apperrors.NewInsufficientFundsError(available, amount)
+	}
+
+	now := time.Now().UTC()
+	spending, err := r.spend(ctx, wallet, amount, defaults, now)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	newBalance := wallet.Balance - amount
 	transaction := &types.WalletTransaction{
-		ID:            uuid.New().String(),
+		ID:            transactionID(userID, paymentID, types.TransactionTypeDebit),
 		UserID:        userID,
 		PaymentID:     paymentID,
-		Type:          "DEBIT",
+		Type:          types.TransactionTypeDebit,
 		Amount:        amount,
-		BalanceBefore: wallet.Balance,
-		BalanceAfter:  newBalance,
-		Timestamp:     time.Now(),
+		BalanceBefore: &wallet.Balance,
+		BalanceAfter:  &newBalance,
+		Timestamp:     now,
 	}
 
-	// Update wallet with optimistic locking
-	_, err = r.db.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+	// Update wallet with optimistic locking, together with its ledger records
+	update := &dynamodb.Update{
 		TableName: aws.String(r.walletsTable),
 		Key: map[string]*dynamodb.AttributeValue{
 			"UserID": {
 				S: aws.String(userID),
 			},
 		},
-		UpdateExpression: aws.String("SET Balance = :balance, Version = :newVersion, UpdatedAt = :updatedAt"),
-		ConditionExpression: aws.String("Version = :currentVersion AND Balance >= :amount"),
+		UpdateExpression: aws.String("SET Balance.Amount = :balance, #available = :available, Version = :newVersion, UpdatedAt = :updatedAt"),
+		ExpressionAttributeNames: map[string]*string{
+			"#available": aws.String(availableAttribute),
+		},
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 			":balance": {
-				N: aws.String(fmt.Sprintf("%f", newBalance)),
+				N: aws.String(strconv.FormatInt(newBalance.Amount, 10)),
 			},
+			":available": availableValue(newBalance, wallet.Held, wallet.CreditLimit),
 			":newVersion": {
 				N: aws.String(fmt.Sprintf("%d", wallet.Version+1)),
 			},
 			":currentVersion": {
 				N: aws.String(fmt.Sprintf("%d", wallet.Version)),
 			},
-			":amount": {
-				N: aws.String(fmt.Sprintf("%f", amount)),
+			":floor": balanceFloor(wallet, amount),
+			":currency": {
+				S: aws.String(amount.Currency),
 			},
 			":updatedAt": {
 				S: aws.String(time.Now().Format(time.RFC3339)),
 			},
 		},
-	})
+	}
+	statusCheck := addStatusCondition(update.ExpressionAttributeNames, update.ExpressionAttributeValues, true)
+	update.ConditionExpression = aws.String("Version = :currentVersion AND Balance.Currency = :currency AND " +
+		statusCheck + " AND Balance.Amount >= :floor")
+	if err := setSpending(update, spending); err != nil {
+		return nil, nil, err
+	}
 
-	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
-			return nil, fmt.Errorf("concurrent update detected or insufficient balance")
+	if err := r.commitTransaction(ctx, wallet, update, transaction); err != nil {
+		// Same Version but a failed condition means the status or balance check failed
+		var conditionErr *walletConditionError
+		if errors.As(err, &conditionErr) {
+			if err := checkStatus(&conditionErr.current, true); err != nil {
+				return nil, nil, err
+			}
+			return nil, nil, apperrors.NewInsufficientFundsError(conditionErr.current.Available(), amount)
 		}
-		return nil, fmt.Errorf("failed to debit wallet: %w", err)
+		return nil, nil, err
 	}
 
-	// Record transaction event
-	if err := r.recordEvent(ctx, transaction); err != nil {
-		// Log error but don't fail the operation
-		fmt.Printf("Failed to record transaction event: %v\n", err)
+	committed := committedWallet(wallet, newBalance)
+	committed.Spending = spending
+	return transaction, committed, nil
+}
+
+// CreditWallet credits amount to wallet (for refunds) and returns the
+// transaction. Like DebitWallet it tries a single conditional write before
+// falling back to read and retry, and returns the wallet only from the latter.
+func (r *WalletRepository) CreditWallet(ctx context.Context, userID string, amount types.Money, paymentID string) (*types.WalletTransaction, *types.Wallet, error) {
+	return r.credit(ctx, userID, types.TransactionTypeCredit, amount, paymentID)
+}
+
+// DepositWallet credits a top-up the gateway has charged as a DEPOSIT
+// transaction, keyed by the deposit ID so it is credited at most once
+func (r *WalletRepository) DepositWallet(ctx context.Context, userID string, amount types.Money, depositID string) (*types.WalletTransaction, *types.Wallet, error) {
+	return r.credit(ctx, userID, types.TransactionTypeDeposit, amount, depositID)
+}
+
+// credit adds amount to the wallet as a transaction of the given type
+func (r *WalletRepository) credit(ctx context.Context, userID, transactionType string, amount types.Money, paymentID string) (*types.WalletTransaction, *types.Wallet, error) {
+	transaction, err := r.applyInPlace(ctx, userID, transactionType, amount, paymentID, nil)
+	if !errors.Is(err, errNeedsRead) {
+		return transaction, nil, err
 	}
 
-	return transaction, nil
+	var wallet *types.Wallet
+	err = r.withRetry(ctx, userID, strings.ToLower(transactionType), func() (err error) {
+		transaction, wallet, err = r.creditWallet(ctx, userID, transactionType, amount, paymentID)
+		return err
+	})
+	return transaction, wallet, err
 }
 
-// CreditWallet credits amount to wallet (for refunds)
-func (r *WalletRepository) CreditWallet(ctx context.Context, userID string, amount float64, paymentID string) (*types.WalletTransaction, error) {
+func (r *WalletRepository) creditWallet(ctx context.Context, userID, transactionType string, amount types.Money, paymentID string) (*types.WalletTransaction, *types.Wallet, error) {
 	wallet, err := r.GetWallet(ctx, userID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	if err := checkStatus(wallet, false); err != nil {
+		return nil, nil, err
+	}
+
+	newBalance, err := wallet.Balance.Add(amount)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	newBalance := wallet.Balance + amount
 	transaction := &types.WalletTransaction{
-		ID:            uuid.New().String(),
+		ID:            transactionID(userID, paymentID, transactionType),
 		UserID:        userID,
 		PaymentID:     paymentID,
-		Type:          "CREDIT",
+		Type:          transactionType,
 		Amount:        amount,
-		BalanceBefore: wallet.Balance,
-		BalanceAfter:  newBalance,
-		Timestamp:     time.Now(),
+		BalanceBefore: &wallet.Balance,
+		BalanceAfter:  &newBalance,
+		Timestamp:     time.Now().UTC(),
 	}
 
-	// Update wallet with optimistic locking
-	_, err = r.db.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+	// Update wallet with optimistic locking, together with its ledger records
+	update := &dynamodb.Update{
 		TableName: aws.String(r.walletsTable),
 		Key: map[string]*dynamodb.AttributeValue{
 			"UserID": {
 				S: aws.String(userID),
 			},
 		},
-		UpdateExpression: aws.String("SET Balance = :balance, Version = :newVersion, UpdatedAt = :updatedAt"),
-		ConditionExpression: aws.String("Version = :currentVersion"),
+		UpdateExpression: aws.String("SET Balance.Amount = :balance, #available = :available, Version = :newVersion, UpdatedAt = :updatedAt"),
+		ExpressionAttributeNames: map[string]*string{
+			"#available": aws.String(availableAttribute),
+		},
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 			":balance": {
-				N: aws.String(fmt.Sprintf("%f", newBalance)),
+				N: aws.String(strconv.FormatInt(newBalance.Amount, 10)),
+			},
+			":available": availableValue(newBalance, wallet.Held, wallet.CreditLimit),
+			":currency": {
+				S: aws.String(amount.Currency),
 			},
 			":newVersion": {
 				N: aws.String(fmt.Sprintf("%d", wallet.Version+1)),
@@ -201,24 +367,219 @@ func (r *WalletRepository) CreditWallet(ctx context.Context, userID string, amou
 				S: aws.String(time.Now().Format(time.RFC3339)),
 			},
 		},
-	})
+	}
+	statusCheck := addStatusCondition(update.ExpressionAttributeNames, update.ExpressionAttributeValues, false)
+	update.ConditionExpression = aws.String("Version = :currentVersion AND Balance.Currency = :currency AND " + statusCheck)
+
+	if err := r.commitTransaction(ctx, wallet, update, transaction); err != nil {
+		// Same Version but a failed condition means the status check failed
+		var conditionErr *walletConditionError
+		if errors.As(err, &conditionErr) {
+			if err := checkStatus(&conditionErr.current, false); err != nil {
+				return nil, nil, err
+			}
+		}
+		return nil, nil, err
+	}
+
+	return transaction, committedWallet(wallet, newBalance), nil
+}
+
+// committedWallet is wallet as it is after an optimistic-locking update set its balance
+func committedWallet(wallet *types.Wallet, balance types.Money) *types.Wallet {
+	committed := *wallet
+	committed.Balance = balance
+	committed.Version++
+	committed.UpdatedAt = time.Now()
+	return &committed
+}
+
+// commitTransaction applies a wallet update and writes its WalletTransaction
+// row, PaymentEvent and journal entry in a single TransactWriteItems call, so
+// the balance never changes without an audit record. Failures are returned as
+// *apperrors.AppError and mean nothing was written.
+func (r *WalletRepository) commitTransaction(ctx context.Context, wallet *types.Wallet, update *dynamodb.Update, transaction *types.WalletTransaction) error {
+	items, err := r.commitItems(update, transaction)
+	if err != nil {
+		return err
+	}
+
+	// A failed condition on the transaction row means the same
+	// (user, payment, type) was already applied
+	return r.writeTransaction(ctx, wallet, transaction.Type, items, map[int]error{1: ErrTransactionExists})
+}
+
+// commitItems builds the items written by commitTransaction: the wallet
+// update, then the transaction row, its event and its journal entry
+func (r *WalletRepository) commitItems(update *dynamodb.Update, transaction *types.WalletTransaction) ([]*dynamodb.TransactWriteItem, error) {
+	transactionPut, err := r.putTransaction(transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	eventPut, err := r.putEvent(newTransactionEvent(transaction))
+	if err != nil {
+		return nil, err
+	}
 
+	journalItems, err := r.journalItems(transaction)
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
-			return nil, fmt.Errorf("concurrent update detected")
+		return nil, err
+	}
+
+	return append([]*dynamodb.TransactWriteItem{
+		{Update: update},
+		transactionPut,
+		eventPut,
+	}, journalItems...), nil
+}
+
+// writeTransaction runs items, whose first item must be the conditional
+// update of wallet, in one TransactWriteItems call. conditionErrors maps the
+// index of another item to the error returned when its condition fails.
+//
+// A failed wallet condition is reported as ErrVersionConflict when the wallet
+// was changed by another write since it was read, and as *walletConditionError
+// when Version still matched and one of the other checks failed.
+func (r *WalletRepository) writeTransaction(ctx context.Context, wallet *types.Wallet, operation string, items []*dynamodb.TransactWriteItem, conditionErrors map[int]error) error {
+	return r.writeWallets(ctx, []*types.Wallet{wallet}, operation, items, conditionErrors)
+}
+
+// writeWallets is writeTransaction for items that update several wallets:
+// the first len(wallets) items must be the conditional updates of wallets,
+// in order. A *walletConditionError names the wallet whose check failed.
+func (r *WalletRepository) writeWallets(ctx context.Context, wallets []*types.Wallet, operation string, items []*dynamodb.TransactWriteItem, conditionErrors map[int]error) error {
+	for i := range wallets {
+		items[i].Update.ReturnValuesOnConditionCheckFailure = aws.String(dynamodb.ReturnValuesOnConditionCheckFailureAllOld)
+	}
+
+	_, err := r.db.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	return transactionError(wallets, operation, conditionErrors, err)
+}
+
+// transactionError maps the error of the TransactWriteItems call made by
+// writeWallets to the one it returns. A nil err is returned as is.
+func transactionError(wallets []*types.Wallet, operation string, conditionErrors map[int]error, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var canceled *dynamodb.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		reasons := canceled.CancellationReasons
+		for i := len(wallets); i < len(reasons); i++ {
+			if conditionErr, ok := conditionErrors[i]; ok && aws.StringValue(reasons[i].Code) == "ConditionalCheckFailed" {
+				return conditionErr
+			}
+		}
+		for i, reason := range reasons {
+			code := aws.StringValue(reason.Code)
+			if i < len(wallets) && code == "ConditionalCheckFailed" {
+				return walletConditionFailure(wallets[i], reason.Item)
+			}
+			if code == "TransactionConflict" {
+				return ErrVersionConflict
+			}
 		}
-		return nil, fmt.Errorf("failed to credit wallet: %w", err)
 	}
 
-	// Record transaction event
-	if err := r.recordEvent(ctx, transaction); err != nil {
-		fmt.Printf("Failed to record transaction event: %v\n", err)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionConflictException {
+		return ErrVersionConflict
 	}
 
-	return transaction, nil
+	return apperrors.NewLedgerWriteError(fmt.Errorf("failed to %s wallet: %w", strings.ToLower(operation), err))
 }
 
-func (r *WalletRepository) recordEvent(ctx context.Context, transaction *types.WalletTransaction) error {
+// walletConditionFailure tells a lost optimistic-lock race apart from a failed
+// balance or currency check by comparing the Version of the wallet as it was
+// when the condition failed with the one that was read
+func walletConditionFailure(wallet *types.Wallet, item map[string]*dynamodb.AttributeValue) error {
+	if len(item) == 0 {
+		// Nothing to compare; re-reading runs every check again
+		return ErrVersionConflict
+	}
+
+	var current types.Wallet
+	if err := dynamodbattribute.UnmarshalMap(item, &current); err != nil || current.Version != wallet.Version {
+		return ErrVersionConflict
+	}
+
+	return &walletConditionError{current: current}
+}
+
+// putTransaction builds the write of a new WalletTransactions row. Its
+// Timestamp is written with types.TimestampKeyLayout, as the
+// UserTransactionsIndex range key must sort in time order.
+func (r *WalletRepository) putTransaction(transaction *types.WalletTransaction) (*dynamodb.TransactWriteItem, error) {
+	item, err := dynamodbattribute.MarshalMap(transaction)
+	if err != nil {
+		return nil, apperrors.NewLedgerWriteError(fmt.Errorf("failed to marshal transaction: %w", err))
+	}
+	item["Timestamp"] = &dynamodb.AttributeValue{S: aws.String(types.TimestampKey(transaction.Timestamp))}
+
+	return &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName:           aws.String(r.transactionsTable),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(ID)"),
+		},
+	}, nil
+}
+
+// putEvent builds the write of a new PaymentEvents entry
+func (r *WalletRepository) putEvent(event *types.PaymentEvent) (*dynamodb.TransactWriteItem, error) {
+	item, err := dynamodbattribute.MarshalMap(event)
+	if err != nil {
+		return nil, apperrors.NewLedgerWriteError(fmt.Errorf("failed to marshal event: %w", err))
+	}
+
+	return &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName:           aws.String(r.eventsTable),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(PaymentID)"),
+		},
+	}, nil
+}
+
+// GetTransaction returns the committed transaction of the given type for a
+// user's payment, or nil if there is none
+func (r *WalletRepository) GetTransaction(ctx context.Context, userID, paymentID, transactionType string) (*types.WalletTransaction, error) {
+	result, err := r.db.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.transactionsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(transactionID(userID, paymentID, transactionType)),
+			},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet transaction: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var transaction types.WalletTransaction
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &transaction); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal wallet transaction: %w", err)
+	}
+
+	return &transaction, nil
+}
+
+// transactionID derives the WalletTransactions key from the user, payment and
+// transaction type, so each payment can be debited and credited at most once
+func transactionID(userID, paymentID, transactionType string) string {
+	return fmt.Sprintf("%s#%s#%s", userID, paymentID, transactionType)
+}
+
+// newTransactionEvent builds the PaymentEvent recorded alongside a wallet transaction
+func newTransactionEvent(transaction *types.WalletTransaction) *types.PaymentEvent {
 	event := &types.PaymentEvent{
 		ID:        fmt.Sprintf("%s#%s", transaction.PaymentID, uuid.New().String()),
 		PaymentID: transaction.PaymentID,
@@ -229,25 +590,120 @@ func (r *WalletRepository) recordEvent(ctx context.Context, transaction *types.W
 		Metadata: map[string]interface{}{
 			"transactionId": transaction.ID,
 			"type":          transaction.Type,
-			"balanceBefore": transaction.BalanceBefore,
-			"balanceAfter":  transaction.BalanceAfter,
 		},
 		Timestamp: transaction.Timestamp,
 	}
+	if transaction.BalanceBefore != nil && transaction.BalanceAfter != nil {
+		event.Metadata["balanceBefore"] = *transaction.BalanceBefore
+		event.Metadata["balanceAfter"] = *transaction.BalanceAfter
+	}
+	if drawn := transaction.OverdraftDrawn(); !drawn.IsZero() {
+		event.Metadata["overdraftDrawn"] = drawn
+	}
+	if repaid := transaction.OverdraftRepaid(); !repaid.IsZero() {
+		event.Metadata["overdraftRepaid"] = repaid
+	}
 
-	if transaction.Type == "CREDIT" {
+	switch transaction.Type {
+	case types.TransactionTypeCredit:
+		event.EventType = string(types.EventWalletCredited)
+	case types.TransactionTypeGrant:
+		event.EventType = string(types.EventWalletCreated)
+	case types.TransactionTypeDeposit:
+		event.EventType = string(types.EventWalletDeposited)
+	case types.TransactionTypeTransferOut:
+		event.EventType = string(types.EventWalletTransferred)
+	case types.TransactionTypeTransferIn:
+		// The receiving leg of a transfer is a credit to its wallet
 		event.EventType = string(types.EventWalletCredited)
 	}
 
-	item, err := dynamodbattribute.MarshalMap(event)
+	return event
+}
+
+// userTransactionsIndex is the WalletTransactions GSI keyed by UserID and Timestamp
+const userTransactionsIndex = "UserTransactionsIndex"
+
+// TransactionQuery filters a user's wallet transaction history. Zero From/To
+// leave that end of the range open; an empty Type matches every type.
+type TransactionQuery struct {
+	UserID            string
+	From              time.Time
+	To                time.Time
+	Type              string
+	Limit             int64
+	ExclusiveStartKey map[string]*dynamodb.AttributeValue
+}
+
+// TransactionPage is one page of wallet transactions, newest first
+type TransactionPage struct {
+	Transactions     []types.WalletTransaction
+	LastEvaluatedKey map[string]*dynamodb.AttributeValue
+}
+
+// ListTransactions returns a user's wallet transactions from the
+// UserTransactionsIndex, newest first. Type is applied as a filter, so a page
+// can hold fewer than Limit items while LastEvaluatedKey is still set.
+func (r *WalletRepository) ListTransactions(ctx context.Context, query TransactionQuery) (*TransactionPage, error) {
+	keyCondition := "UserID = :userId"
+	names := map[string]*string{}
+	values := map[string]*dynamodb.AttributeValue{
+		":userId": {
+			S: aws.String(query.UserID),
+		},
+	}
+
+	switch {
+	case !query.From.IsZero() && !query.To.IsZero():
+		keyCondition += " AND #ts BETWEEN :from AND :to"
+	case !query.From.IsZero():
+		keyCondition += " AND #ts >= :from"
+	case !query.To.IsZero():
+		keyCondition += " AND #ts <= :to"
+	}
+	if !query.From.IsZero() {
+		values[":from"] = &dynamodb.AttributeValue{S: aws.String(types.TimestampKey(query.From))}
+	}
+	if !query.To.IsZero() {
+		values[":to"] = &dynamodb.AttributeValue{S: aws.String(types.TimestampKey(query.To))}
+	}
+	if !query.From.IsZero() || !query.To.IsZero() {
+		names["#ts"] = aws.String("Timestamp")
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(r.transactionsTable),
+		IndexName:                 aws.String(userTransactionsIndex),
+		KeyConditionExpression:    aws.String(keyCondition),
+		ExpressionAttributeValues: values,
+		ScanIndexForward:          aws.Bool(false),
+		ExclusiveStartKey:         query.ExclusiveStartKey,
+	}
+
+	if query.Type != "" {
+		input.FilterExpression = aws.String("#type = :type")
+		names["#type"] = aws.String("Type")
+		values[":type"] = &dynamodb.AttributeValue{S: aws.String(query.Type)}
+	}
+	if len(names) > 0 {
+		input.ExpressionAttributeNames = names
+	}
+	if query.Limit > 0 {
+		input.Limit = aws.Int64(query.Limit)
+	}
+
+	result, err := r.db.QueryWithContext(ctx, input)
 	if err != nil {
-		return fmt.Errorf("failed to marshal event: %w", err)
+		return nil, fmt.Errorf("failed to query wallet transactions: %w", err)
 	}
 
-	_, err = r.db.PutItemWithContext(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(r.eventsTable),
-		Item:      item,
-	})
+	page := &TransactionPage{
+		Transactions:     []types.WalletTransaction{},
+		LastEvaluatedKey: result.LastEvaluatedKey,
+	}
+	if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &page.Transactions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal wallet transactions: %w", err)
+	}
 
-	return err
-}
\ No newline at end of file
+	return page, nil
+}
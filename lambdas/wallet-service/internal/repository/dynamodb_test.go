@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutTransaction_FixedWidthTimestamp(t *testing.T) {
+	repo := NewWalletRepository(nil, nil, "Wallets", "WalletTransactions", "WalletHolds", "PaymentEvents", "ReconciliationReports", "Ledger")
+	second := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	// RFC3339Nano would write these as ...:00Z and ...:00.5Z, which sort the wrong way
+	later := second.Add(500 * time.Millisecond)
+
+	put, err := repo.putTransaction(&types.WalletTransaction{ID: "user123#pay-1#DEBIT", Timestamp: second})
+	require.NoError(t, err)
+	key := *put.Put.Item["Timestamp"].S
+
+	assert.Equal(t, "2024-01-15T10:30:00.000000000Z", key)
+	assert.Less(t, key, types.TimestampKey(later))
+	assert.Equal(t, key, types.TimestampKey(second.In(time.FixedZone("UTC-3", -3*60*60))))
+}
+
+func TestNewTransactionEvent_EventTypes(t *testing.T) {
+	expected := map[string]types.EventType{
+		types.TransactionTypeDebit:       types.EventWalletDebited,
+		types.TransactionTypeCredit:      types.EventWalletCredited,
+		types.TransactionTypeGrant:       types.EventWalletCreated,
+		types.TransactionTypeDeposit:     types.EventWalletDeposited,
+		types.TransactionTypeTransferOut: types.EventWalletTransferred,
+		types.TransactionTypeTransferIn:  types.EventWalletCredited,
+	}
+
+	for transactionType, eventType := range expected {
+		event := newTransactionEvent(&types.WalletTransaction{
+			UserID:    "user123",
+			PaymentID: "pay-1",
+			Type:      transactionType,
+			Amount:    types.NewMoney(1500, "USD"),
+		})
+
+		assert.Equal(t, string(eventType), event.EventType, transactionType)
+	}
+}
+
+// A retry derives the same key as the first attempt, so the condition on its
+// row fails instead of the payment being applied twice
+func TestTransactionID(t *testing.T) {
+	cases := []struct {
+		name      string
+		userID    string
+		paymentID string
+		txType    string
+		want      string
+	}{
+		{name: "debit", userID: "user123", paymentID: "pay-1", txType: types.TransactionTypeDebit, want: "user123#pay-1#DEBIT"},
+		{name: "credit of the same payment", userID: "user123", paymentID: "pay-1", txType: types.TransactionTypeCredit, want: "user123#pay-1#CREDIT"},
+		{name: "another payment", userID: "user123", paymentID: "pay-2", txType: types.TransactionTypeDebit, want: "user123#pay-2#DEBIT"},
+		{name: "another user", userID: "user456", paymentID: "pay-1", txType: types.TransactionTypeDebit, want: "user456#pay-1#DEBIT"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, transactionID(tc.userID, tc.paymentID, tc.txType))
+		})
+	}
+}
+
+func TestCommitItems(t *testing.T) {
+	repo := NewWalletRepository(nil, nil, "Wallets", "WalletTransactions", "WalletHolds", "PaymentEvents", "ReconciliationReports", "Ledger")
+	update := &dynamodb.Update{TableName: aws.String("Wallets")}
+
+	for _, transactionType := range []string{types.TransactionTypeDebit, types.TransactionTypeCredit} {
+		items, err := repo.commitItems(update, &types.WalletTransaction{
+			ID:        transactionID("user123", "pay-1", transactionType),
+			UserID:    "user123",
+			PaymentID: "pay-1",
+			Type:      transactionType,
+			Amount:    types.NewMoney(500, "USD"),
+			Timestamp: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+		})
+		require.NoError(t, err, transactionType)
+
+		// The balance, its row, its event and its journal entry commit together
+		require.Greater(t, len(items), 3, transactionType)
+		assert.Same(t, update, items[0].Update, transactionType)
+		assert.Equal(t, "WalletTransactions", *items[1].Put.TableName, transactionType)
+		assert.Equal(t, "attribute_not_exists(ID)", *items[1].Put.ConditionExpression, transactionType)
+		assert.Equal(t, "PaymentEvents", *items[2].Put.TableName, transactionType)
+		for _, item := range items[3:] {
+			assert.Equal(t, "Ledger", *item.Put.TableName, transactionType)
+		}
+	}
+}
+
+func TestTransactionError(t *testing.T) {
+	errRowExists := errors.New("row exists")
+
+	cases := []struct {
+		name    string
+		version int
+		err     error
+		wantErr error
+		// wantCode is checked when the error must be an *apperrors.AppError
+		wantCode string
+		// wantCondition is set when the wallet's own checks failed
+		wantCondition bool
+	}{
+		{name: "committed"},
+		{
+			name:    "another item's condition failed",
+			err:     canceled(nil, "None", "ConditionalCheckFailed", "None"),
+			wantErr: errRowExists,
+		},
+		{
+			name:          "wallet checks failed at the version that was read",
+			err:           canceled(walletItem(0), "ConditionalCheckFailed", "None", "None"),
+			wantCondition: true,
+		},
+		{
+			name:    "wallet changed since it was read",
+			version: 4,
+			err:     canceled(walletItem(5), "ConditionalCheckFailed", "None", "None"),
+			wantErr: ErrVersionConflict,
+		},
+		{
+			name:    "wallet condition failed without the old item",
+			err:     canceled(nil, "ConditionalCheckFailed", "None", "None"),
+			wantErr: ErrVersionConflict,
+		},
+		{
+			name:    "conflicting transaction on an item",
+			err:     canceled(nil, "None", "None", "TransactionConflict"),
+			wantErr: ErrVersionConflict,
+		},
+		{
+			name:    "transaction conflict",
+			err:     awserr.New(dynamodb.ErrCodeTransactionConflictException, "conflict", nil),
+			wantErr: ErrVersionConflict,
+		},
+		{
+			name:     "any other failure",
+			err:      errors.New("connection reset"),
+			wantCode: apperrors.ErrCodeLedgerWrite,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			read := &types.Wallet{UserID: "user123", Version: tc.version}
+			err := transactionError([]*types.Wallet{read}, types.TransactionTypeDebit, map[int]error{1: errRowExists}, tc.err)
+
+			var conditionErr *walletConditionError
+			var appErr *apperrors.AppError
+			switch {
+			case tc.wantErr != nil:
+				assert.ErrorIs(t, err, tc.wantErr)
+			case tc.wantCondition:
+				require.True(t, errors.As(err, &conditionErr))
+				assert.Equal(t, read.Version, conditionErr.current.Version)
+			case tc.wantCode != "":
+				require.True(t, errors.As(err, &appErr))
+				assert.Equal(t, tc.wantCode, appErr.Code)
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// canceled builds the error of a cancelled TransactWriteItems call with one
+// reason per item. The first item is the wallet, returned as item when its
+// condition failed.
+func canceled(item map[string]*dynamodb.AttributeValue, codes ...string) error {
+	reasons := make([]*dynamodb.CancellationReason, len(codes))
+	for i, code := range codes {
+		reasons[i] = &dynamodb.CancellationReason{Code: aws.String(code)}
+	}
+	reasons[0].Item = item
+
+	return &dynamodb.TransactionCanceledException{
+		Message_:            aws.String("Transaction cancelled"),
+		CancellationReasons: reasons,
+	}
+}
+
+// walletItem is a wallet item as ReturnValuesOnConditionCheckFailure returns it
+func walletItem(version int) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"UserID":  {S: aws.String("user123")},
+		"Version": {N: aws.String(strconv.Itoa(version))},
+	}
+}
@@ -0,0 +1,409 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// statusExpiresIndex is the WalletHolds GSI keyed by Status and ExpiresAt
+const statusExpiresIndex = "StatusExpiresIndex"
+
+var (
+	// ErrHoldExists is returned when a payment already has a hold
+	ErrHoldExists = errors.New("wallet hold already exists")
+
+	// ErrHoldNotActive is returned when a hold was captured, released or
+	// expired by someone else after it was read
+	ErrHoldNotActive = errors.New("wallet hold is not active")
+)
+
+// PlaceHold reserves amount from the wallet's available balance for a
+// payment. A hold is a debit waiting to be captured, so it is counted against
+// the wallet's spending limits, its own or else defaults, which are keyed by
+// period, when it is placed; releasing it gives the amount back.
+func (r *WalletRepository) PlaceHold(ctx context.Context, userID string, amount types.Money, paymentID string, expiresAt time.Time, defaults map[string]types.Money) (*types.WalletHold, error) {
+	var hold *types.WalletHold
+	err := r.withRetry(ctx, userID, "hold", func() (err error) {
+		hold, err = r.placeHold(ctx, userID, amount, paymentID, expiresAt, defaults)
+		return err
+	})
+	return hold, err
+}
+
+func (r *WalletRepository) placeHold(ctx context.Context, userID string, amount types.Money, paymentID string, expiresAt time.Time, defaults map[string]types.Money) (*types.WalletHold, error) {
+	wallet, err := r.GetWallet(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkStatus(wallet, true); err != nil {
+		return nil, err
+	}
+
+	if !wallet.Balance.SameCurrency(amount) {
+		return nil, fmt.Errorf("%w: %s and %s", types.ErrCurrencyMismatch, wallet.Balance.Currency, amount.Currency)
+	}
+
+	if available := wallet.Available(); available.Amount < amount.Amount {
+		return nil, apperrors.NewInsufficientFundsError(available, amount)
+	}
+
+	now := time.Now().UTC()
+	spending, err := r.spend(ctx, wallet, amount, defaults, now)
+	if err != nil {
+		return nil, err
+	}
+
+	hold := &types.WalletHold{
+		ID:        holdID(userID, paymentID),
+		UserID:    userID,
+		PaymentID: paymentID,
+		Amount:    amount,
+		Status:    types.HoldStatusHeld,
+		ExpiresAt: expiresAt.UTC(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	holdItem, err := marshalHold(hold)
+	if err != nil {
+		return nil, err
+	}
+
+	eventPut, err := r.putEvent(newHoldEvent(hold, types.EventWalletHoldPlaced, now))
+	if err != nil {
+		return nil, err
+	}
+
+	held := types.NewMoney(wallet.Held.Amount+amount.Amount, wallet.Balance.Currency)
+	walletUpdate := r.holdWalletUpdate(wallet, wallet.Balance, held, true)
+	if err := setSpending(walletUpdate, spending); err != nil {
+		return nil, err
+	}
+
+	err = r.writeTransaction(ctx, wallet, "hold", []*dynamodb.TransactWriteItem{
+		{Update: walletUpdate},
+		{
+			Put: &dynamodb.Put{
+				TableName:           aws.String(r.holdsTable),
+				Item:                holdItem,
+				ConditionExpression: aws.String("attribute_not_exists(ID)"),
+			},
+		},
+		eventPut,
+	}, map[int]error{1: ErrHoldExists})
+	if err != nil {
+		return nil, holdStatusError(err)
+	}
+
+	return hold, nil
+}
+
+// CaptureHold turns an active hold into a DEBIT transaction. The transaction
+// uses the same key as DebitWallet, so a payment is never debited twice.
+func (r *WalletRepository) CaptureHold(ctx context.Context, hold *types.WalletHold) (*types.WalletTransaction, error) {
+	var transaction *types.WalletTransaction
+	err := r.withRetry(ctx, hold.UserID, "capture", func() (err error) {
+		transaction, err = r.captureHold(ctx, hold)
+		return err
+	})
+	return transaction, err
+}
+
+func (r *WalletRepository) captureHold(ctx context.Context, hold *types.WalletHold) (*types.WalletTransaction, error) {
+	wallet, err := r.GetWallet(ctx, hold.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkStatus(wallet, true); err != nil {
+		return nil, err
+	}
+
+	newBalance, err := wallet.Balance.Sub(hold.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	transaction := &types.WalletTransaction{
+		ID:            transactionID(hold.UserID, hold.PaymentID, types.TransactionTypeDebit),
+		UserID:        hold.UserID,
+		PaymentID:     hold.PaymentID,
+		Type:          types.TransactionTypeDebit,
+		Amount:        hold.Amount,
+		BalanceBefore: &wallet.Balance,
+		BalanceAfter:  &newBalance,
+		Timestamp:     now,
+	}
+
+	transactionPut, err := r.putTransaction(transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	event := newTransactionEvent(transaction)
+	event.Metadata["holdId"] = hold.ID
+	eventPut, err := r.putEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	journalItems, err := r.journalItems(transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	held := types.NewMoney(wallet.Held.Amount-hold.Amount.Amount, wallet.Balance.Currency)
+	err = r.writeTransaction(ctx, wallet, "capture", append([]*dynamodb.TransactWriteItem{
+		{Update: r.holdWalletUpdate(wallet, newBalance, held, true)},
+		transactionPut,
+		{Update: r.holdStatusUpdate(hold, types.HoldStatusCaptured, now)},
+		eventPut,
+	}, journalItems...), map[int]error{1: ErrTransactionExists, 2: ErrHoldNotActive})
+	if err != nil {
+		return nil, holdStatusError(err)
+	}
+
+	return transaction, nil
+}
+
+// ReleaseHold returns an active hold's amount to the available balance and
+// marks it with status, which is either RELEASED or EXPIRED. The amount is
+// also taken off the wallet's spending in the periods the hold was placed in,
+// if they have not ended.
+func (r *WalletRepository) ReleaseHold(ctx context.Context, hold *types.WalletHold, status types.HoldStatus) (*types.WalletHold, error) {
+	var released *types.WalletHold
+	err := r.withRetry(ctx, hold.UserID, "release", func() (err error) {
+		released, err = r.releaseHold(ctx, hold, status)
+		return err
+	})
+	return released, err
+}
+
+func (r *WalletRepository) releaseHold(ctx context.Context, hold *types.WalletHold, status types.HoldStatus) (*types.WalletHold, error) {
+	wallet, err := r.GetWallet(ctx, hold.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	released := *hold
+	released.Status = status
+	released.UpdatedAt = now
+
+	event := newHoldEvent(&released, types.EventWalletHoldReleased, now)
+	eventPut, err := r.putEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	held := types.NewMoney(wallet.Held.Amount-hold.Amount.Amount, wallet.Balance.Currency)
+	walletUpdate := r.holdWalletUpdate(wallet, wallet.Balance, held, false)
+	if spending := unspend(wallet, hold.Amount, hold.CreatedAt); spending != nil {
+		if err := setSpending(walletUpdate, spending); err != nil {
+			return nil, err
+		}
+	}
+
+	err = r.writeTransaction(ctx, wallet, "release", []*dynamodb.TransactWriteItem{
+		{Update: walletUpdate},
+		{Update: r.holdStatusUpdate(hold, status, now)},
+		eventPut,
+	}, map[int]error{1: ErrHoldNotActive})
+	if err != nil {
+		return nil, err
+	}
+
+	return &released, nil
+}
+
+// GetHold returns the hold placed for a user's payment, or nil if there is none
+func (r *WalletRepository) GetHold(ctx context.Context, userID, paymentID string) (*types.WalletHold, error) {
+	result, err := r.db.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.holdsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(holdID(userID, paymentID)),
+			},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet hold: %w", err)
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var hold types.WalletHold
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &hold); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal wallet hold: %w", err)
+	}
+
+	return &hold, nil
+}
+
+// ListExpiredHolds returns up to limit holds that are still HELD but expired before now
+func (r *WalletRepository) ListExpiredHolds(ctx context.Context, now time.Time, limit int64) ([]types.WalletHold, error) {
+	result, err := r.db.QueryWithContext(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(r.holdsTable),
+		IndexName:              aws.String(statusExpiresIndex),
+		KeyConditionExpression: aws.String("#status = :held AND ExpiresAt <= :now"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":held": {
+				S: aws.String(string(types.HoldStatusHeld)),
+			},
+			":now": {
+				S: aws.String(types.TimestampKey(now)),
+			},
+		},
+		Limit: aws.Int64(limit),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired holds: %w", err)
+	}
+
+	holds := []types.WalletHold{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &holds); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal wallet holds: %w", err)
+	}
+
+	return holds, nil
+}
+
+// holdWalletUpdate sets a wallet's balance and held amount, and so its
+// available amount, with optimistic locking. Placing and capturing a hold
+// spend the wallet's funds and so also require it to allow debits; releasing
+// one does not.
+func (r *WalletRepository) holdWalletUpdate(wallet *types.Wallet, balance, held types.Money, debit bool) *dynamodb.Update {
+	heldItem, _ := dynamodbattribute.MarshalMap(held)
+
+	update := &dynamodb.Update{
+		TableName: aws.String(r.walletsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"UserID": {
+				S: aws.String(wallet.UserID),
+			},
+		},
+		UpdateExpression:    aws.String("SET Balance.Amount = :balance, Held = :held, #available = :available, Version = :newVersion, UpdatedAt = :updatedAt"),
+		ConditionExpression: aws.String("Version = :currentVersion"),
+		ExpressionAttributeNames: map[string]*string{
+			"#available": aws.String(availableAttribute),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":balance": {
+				N: aws.String(strconv.FormatInt(balance.Amount, 10)),
+			},
+			":available": availableValue(balance, held, wallet.CreditLimit),
+			":held": {
+				M: heldItem,
+			},
+			":newVersion": {
+				N: aws.String(fmt.Sprintf("%d", wallet.Version+1)),
+			},
+			":currentVersion": {
+				N: aws.String(fmt.Sprintf("%d", wallet.Version)),
+			},
+			":updatedAt": {
+				S: aws.String(time.Now().Format(time.RFC3339)),
+			},
+		},
+	}
+	if debit {
+		update.ConditionExpression = aws.String("Version = :currentVersion AND " +
+			addStatusCondition(update.ExpressionAttributeNames, update.ExpressionAttributeValues, true))
+	}
+
+	return update
+}
+
+// holdStatusError reports a failed status check on a hold write that only
+// changed the wallet's status since it was read
+func holdStatusError(err error) error {
+	var conditionErr *walletConditionError
+	if errors.As(err, &conditionErr) {
+		if statusErr := checkStatus(&conditionErr.current, true); statusErr != nil {
+			return statusErr
+		}
+	}
+	return err
+}
+
+// holdStatusUpdate moves an active hold to status
+func (r *WalletRepository) holdStatusUpdate(hold *types.WalletHold, status types.HoldStatus, now time.Time) *dynamodb.Update {
+	return &dynamodb.Update{
+		TableName: aws.String(r.holdsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"ID": {
+				S: aws.String(hold.ID),
+			},
+		},
+		UpdateExpression:    aws.String("SET #status = :status, UpdatedAt = :updatedAt"),
+		ConditionExpression: aws.String("#status = :held"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("Status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":status": {
+				S: aws.String(string(status)),
+			},
+			":held": {
+				S: aws.String(string(types.HoldStatusHeld)),
+			},
+			":updatedAt": {
+				S: aws.String(now.Format(time.RFC3339Nano)),
+			},
+		},
+	}
+}
+
+// marshalHold builds a WalletHolds item. ExpiresAt is the sort key of
+// StatusExpiresIndex, so it is written in the fixed-width TimestampKey format
+// that ListExpiredHolds compares against.
+func marshalHold(hold *types.WalletHold) (map[string]*dynamodb.AttributeValue, error) {
+	item, err := dynamodbattribute.MarshalMap(hold)
+	if err != nil {
+		return nil, apperrors.NewLedgerWriteError(fmt.Errorf("failed to marshal hold: %w", err))
+	}
+	item["ExpiresAt"] = &dynamodb.AttributeValue{S: aws.String(types.TimestampKey(hold.ExpiresAt))}
+
+	return item, nil
+}
+
+// holdID derives the WalletHolds key, allowing a single hold per payment
+func holdID(userID, paymentID string) string {
+	return fmt.Sprintf("%s#%s", userID, paymentID)
+}
+
+// newHoldEvent builds the PaymentEvent recorded alongside a hold change
+func newHoldEvent(hold *types.WalletHold, eventType types.EventType, now time.Time) *types.PaymentEvent {
+	return &types.PaymentEvent{
+		ID:        fmt.Sprintf("%s#%s", hold.PaymentID, uuid.New().String()),
+		PaymentID: hold.PaymentID,
+		UserID:    hold.UserID,
+		EventType: string(eventType),
+		Amount:    hold.Amount,
+		Status:    "SUCCESS",
+		Metadata: map[string]interface{}{
+			"holdId":     hold.ID,
+			"holdStatus": string(hold.Status),
+			"expiresAt":  hold.ExpiresAt,
+		},
+		Timestamp: now,
+	}
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshalHold_FixedWidthExpiresAt(t *testing.T) {
+	expiresAt := time.Date(2024, 1, 15, 10, 45, 0, 0, time.UTC)
+	// RFC3339Nano would write ...:00Z and ...:00.25Z, and "Z" sorts after "."
+	later := expiresAt.Add(250 * time.Millisecond)
+
+	item, err := marshalHold(&types.WalletHold{ID: "user123#pay-1", ExpiresAt: expiresAt})
+	require.NoError(t, err)
+	key := *item["ExpiresAt"].S
+
+	assert.Equal(t, "2024-01-15T10:45:00.000000000Z", key)
+	assert.Less(t, key, types.TimestampKey(later))
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/ledger"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// journalEntry is the double-entry record of a wallet transaction. It uses the
+// transaction's ID, so the ledger holds at most one entry per transaction. A
+// transfer is recorded once, by its TRANSFER_OUT leg.
+func journalEntry(transaction *types.WalletTransaction) (*ledger.JournalEntry, error) {
+	id, userID, amount, at := transaction.ID, transaction.UserID, transaction.Amount, transaction.Timestamp
+
+	switch transaction.Type {
+	case types.TransactionTypeDebit:
+		return ledger.WalletDebit(id, userID, transaction.PaymentID, amount, at)
+	case types.TransactionTypeCredit:
+		return ledger.WalletCredit(id, userID, transaction.PaymentID, amount, at)
+	case types.TransactionTypeDeposit:
+		return ledger.WalletDeposit(id, userID, transaction.PaymentID, amount, at)
+	case types.TransactionTypeGrant:
+		return ledger.WalletGrant(id, userID, amount, at)
+	case types.TransactionTypeTransferOut:
+		return ledger.WalletTransfer(id, userID, transaction.CounterpartyID, transaction.TransferID, amount, at)
+	default:
+		return nil, fmt.Errorf("no journal entry for %s transactions", transaction.Type)
+	}
+}
+
+// journalItems builds the ledger writes of a wallet transaction, to be
+// appended to the TransactWriteItems call that changes the balance
+func (r *WalletRepository) journalItems(transaction *types.WalletTransaction) ([]*dynamodb.TransactWriteItem, error) {
+	entry, err := journalEntry(transaction)
+	if err != nil {
+		return nil, apperrors.NewLedgerWriteError(err)
+	}
+
+	items, err := r.ledger.WriteItems(entry)
+	if err != nil {
+		return nil, apperrors.NewLedgerWriteError(err)
+	}
+
+	return items, nil
+}
+
+// GetWalletAccount returns the balance of a user's ledger account, rebuilt
+// from its postings, together with the postings, oldest first
+func (r *WalletRepository) GetWalletAccount(ctx context.Context, userID, currency string) (types.Money, []ledger.Line, error) {
+	return r.ledger.AccountBalance(ctx, ledger.WalletAccount(userID), currency)
+}
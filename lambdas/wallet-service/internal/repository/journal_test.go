@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/draftea-coding-challenge/shared/ledger"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalEntry(t *testing.T) {
+	amount := types.NewMoney(1500, "USD")
+	now := time.Now().UTC()
+	cases := map[string]struct {
+		debit, credit ledger.Account
+	}{
+		types.TransactionTypeDebit:       {ledger.WalletAccount("user1"), ledger.GatewayClearing},
+		types.TransactionTypeCredit:      {ledger.GatewayClearing, ledger.WalletAccount("user1")},
+		types.TransactionTypeDeposit:     {ledger.GatewayClearing, ledger.WalletAccount("user1")},
+		types.TransactionTypeGrant:       {ledger.Promotions, ledger.WalletAccount("user1")},
+		types.TransactionTypeTransferOut: {ledger.WalletAccount("user1"), ledger.WalletAccount("user2")},
+	}
+
+	for transactionType, expected := range cases {
+		transaction := &types.WalletTransaction{
+			ID:             transactionID("user1", "pay-1", transactionType),
+			UserID:         "user1",
+			PaymentID:      "pay-1",
+			Type:           transactionType,
+			Amount:         amount,
+			Timestamp:      now,
+			TransferID:     "pay-1",
+			CounterpartyID: "user2",
+		}
+
+		entry, err := journalEntry(transaction)
+		assert.NoError(t, err, transactionType)
+		assert.Equal(t, transaction.ID, entry.ID)
+		assert.Equal(t, []ledger.Posting{
+			{Account: expected.debit, Side: ledger.Debit, Amount: amount},
+			{Account: expected.credit, Side: ledger.Credit, Amount: amount},
+		}, entry.Postings, transactionType)
+	}
+
+	// The receiving leg of a transfer is part of the sender's entry
+	_, err := journalEntry(&types.WalletTransaction{ID: "in", Type: types.TransactionTypeTransferIn, Amount: amount})
+	assert.Error(t, err)
+}
@@ -0,0 +1,311 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// SetSpendingLimits stores the user's own spending limits on their wallet,
+// replacing any previous ones, and returns the wallet with its spending
+// windows set to the new limits. defaults are the default limits in the
+// wallet's currency, keyed by period. Limits are not a balance change, so
+// Version is only checked, not bumped.
+func (r *WalletRepository) SetSpendingLimits(ctx context.Context, limits *types.SpendingLimits, defaults map[string]types.Money) (*types.Wallet, error) {
+	var wallet *types.Wallet
+	err := r.withRetry(ctx, limits.UserID, "spending_limits", func() (err error) {
+		wallet, err = r.setSpendingLimits(ctx, limits, defaults)
+		return err
+	})
+	return wallet, err
+}
+
+func (r *WalletRepository) setSpendingLimits(ctx context.Context, limits *types.SpendingLimits, defaults map[string]types.Money) (*types.Wallet, error) {
+	wallet, err := r.GetWallet(ctx, limits.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated := *wallet
+	updated.SpendingLimits = limits
+	spending, err := r.CurrentSpending(ctx, &updated, defaults, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	updated.Spending = spending
+
+	limitsItem, err := dynamodbattribute.MarshalMap(limits)
+	if err != nil {
+		return nil, apperrors.NewLedgerWriteError(fmt.Errorf("failed to marshal spending limits: %w", err))
+	}
+
+	update := &dynamodb.Update{
+		TableName: aws.String(r.walletsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"UserID": {
+				S: aws.String(limits.UserID),
+			},
+		},
+		UpdateExpression:    aws.String("SET SpendingLimits = :limits"),
+		ConditionExpression: aws.String("Version = :currentVersion"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":limits": {
+				M: limitsItem,
+			},
+			":currentVersion": {
+				N: aws.String(fmt.Sprintf("%d", wallet.Version)),
+			},
+		},
+	}
+	if err := setSpending(update, spending); err != nil {
+		return nil, err
+	}
+
+	err = r.writeTransaction(ctx, wallet, "spending_limits", []*dynamodb.TransactWriteItem{
+		{Update: update},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &updated, nil
+}
+
+// CurrentSpending returns the wallet's spending windows as they stand at now:
+// a window of a period that has ended starts over, and every window takes the
+// wallet's current limits, its own or else defaults, which are keyed by
+// period. A wallet that has never recorded its spending has it summed from its
+// DEBIT and TRANSFER_OUT transactions plus its held funds.
+func (r *WalletRepository) CurrentSpending(ctx context.Context, wallet *types.Wallet, defaults map[string]types.Money, now time.Time) (*types.Spending, error) {
+	spending := &types.Spending{}
+	if wallet.Spending != nil {
+		*spending = *wallet.Spending
+	} else {
+		seeded, err := r.seedSpending(ctx, wallet, now)
+		if err != nil {
+			return nil, err
+		}
+		spending = seeded
+	}
+
+	limits := wallet.SpendingLimits.Resolve(defaults, wallet.Balance.Currency)
+	spending.Defaults = spendingDefaultsKey(defaults)
+	for _, period := range types.SpendingPeriods {
+		window := spending.Window(period)
+		if key := types.SpendingPeriodKey(period, now); window.Period != key {
+			*window = types.SpendingWindow{Period: key}
+		}
+
+		window.Limit = nil
+		var limit int64
+		if money, ok := limits[period]; ok {
+			limit = money.Amount
+			window.Limit = &limit
+		}
+		window.Remaining = limit - window.Spent
+	}
+
+	return spending, nil
+}
+
+// seedSpending sums the wallet's spending in the periods containing now from
+// its transactions, for a wallet written before it recorded its spending
+func (r *WalletRepository) seedSpending(ctx context.Context, wallet *types.Wallet, now time.Time) (*types.Spending, error) {
+	earliest := now
+	for _, period := range types.SpendingPeriods {
+		if start := types.SpendingPeriodStart(period, now); start.Before(earliest) {
+			earliest = start
+		}
+	}
+
+	transactions, err := r.ListSpendingSince(ctx, wallet.UserID, earliest)
+	if err != nil {
+		return nil, err
+	}
+
+	spending := &types.Spending{}
+	for _, period := range types.SpendingPeriods {
+		spent, err := spentSince(transactions, types.SpendingPeriodStart(period, now), wallet.Held)
+		if err != nil {
+			return nil, err
+		}
+		*spending.Window(period) = types.SpendingWindow{
+			Period: types.SpendingPeriodKey(period, now),
+			Spent:  spent.Amount,
+		}
+	}
+
+	return spending, nil
+}
+
+// spend returns the wallet's spending after it spends amount at now, or a
+// spending limit error for the first period whose allowance does not cover it
+func (r *WalletRepository) spend(ctx context.Context, wallet *types.Wallet, amount types.Money, defaults map[string]types.Money, now time.Time) (*types.Spending, error) {
+	spending, err := r.CurrentSpending(ctx, wallet, defaults, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, period := range types.SpendingPeriods {
+		window := spending.Window(period)
+		if window.Limit != nil && window.Remaining < amount.Amount {
+			return nil, apperrors.NewSpendingLimitExceededError(period,
+				types.NewMoney(*window.Limit, amount.Currency),
+				types.NewMoney(max(window.Remaining, 0), amount.Currency),
+				amount)
+		}
+		window.Spent += amount.Amount
+		window.Remaining -= amount.Amount
+	}
+
+	return spending, nil
+}
+
+// unspend returns the wallet's spending with amount, spent at spentAt, given
+// back in every window still covering that time, or nil if the wallet has no
+// spending recorded
+func unspend(wallet *types.Wallet, amount types.Money, spentAt time.Time) *types.Spending {
+	if wallet.Spending == nil {
+		return nil
+	}
+
+	spending := *wallet.Spending
+	for _, period := range types.SpendingPeriods {
+		window := spending.Window(period)
+		if window.Period != types.SpendingPeriodKey(period, spentAt) {
+			continue
+		}
+		back := min(amount.Amount, window.Spent)
+		window.Spent -= back
+		window.Remaining += back
+	}
+
+	return &spending
+}
+
+// setSpending adds setting the wallet's spending to update
+func setSpending(update *dynamodb.Update, spending *types.Spending) error {
+	spendingItem, err := dynamodbattribute.MarshalMap(spending)
+	if err != nil {
+		return apperrors.NewLedgerWriteError(fmt.Errorf("failed to marshal spending: %w", err))
+	}
+
+	update.UpdateExpression = aws.String(aws.StringValue(update.UpdateExpression) + ", Spending = :spending")
+	update.ExpressionAttributeValues[":spending"] = &dynamodb.AttributeValue{
+		M: spendingItem,
+	}
+	return nil
+}
+
+// addSpendingCheck adds the names and values of a debit's spending check to
+// an update, and returns its condition and the SET clauses that count the
+// debit in every window. Each window must be the one of the period containing
+// at and, if it has a limit, have room for :amount; the windows must have been
+// set with defaults, so a change of the default limits is picked up by the
+// next write that reads the wallet.
+func addSpendingCheck(names map[string]*string, values map[string]*dynamodb.AttributeValue, defaults map[string]types.Money, at time.Time) (condition, set string) {
+	names["#spending"] = aws.String("Spending")
+	names["#defaults"] = aws.String("Defaults")
+	names["#period"] = aws.String("Period")
+	names["#limit"] = aws.String("Limit")
+	names["#spent"] = aws.String("Spent")
+	names["#remaining"] = aws.String("Remaining")
+	values[":spendingDefaults"] = &dynamodb.AttributeValue{
+		S: aws.String(spendingDefaultsKey(defaults)),
+	}
+
+	conditions := []string{"#spending.#defaults = :spendingDefaults"}
+	var sets []string
+	for _, period := range types.SpendingPeriods {
+		window := "#spending.#" + period
+		names["#"+period] = aws.String(strings.ToUpper(period[:1]) + period[1:])
+		values[":"+period] = &dynamodb.AttributeValue{
+			S: aws.String(types.SpendingPeriodKey(period, at)),
+		}
+
+		conditions = append(conditions, fmt.Sprintf(
+			"%[1]s.#period = :%[2]s AND (attribute_not_exists(%[1]s.#limit) OR %[1]s.#remaining >= :amount)", window, period))
+		sets = append(sets, fmt.Sprintf(
+			"%[1]s.#spent = %[1]s.#spent + :amount, %[1]s.#remaining = %[1]s.#remaining - :amount", window))
+	}
+
+	return strings.Join(conditions, " AND "), strings.Join(sets, ", ")
+}
+
+// spendingDefaultsKey names a set of default limits, keyed by period, as
+// recorded in a wallet's Spending.Defaults
+func spendingDefaultsKey(defaults map[string]types.Money) string {
+	parts := make([]string, 0, len(types.SpendingPeriods))
+	for _, period := range types.SpendingPeriods {
+		limit := "none"
+		if money, ok := defaults[period]; ok {
+			limit = money.Currency + ":" + strconv.FormatInt(money.Amount, 10)
+		}
+		parts = append(parts, period+"="+limit)
+	}
+	return strings.Join(parts, ",")
+}
+
+// spentSince adds up the transactions at or after since, plus held
+func spentSince(transactions []types.WalletTransaction, since time.Time, held types.Money) (types.Money, error) {
+	spent := held
+	for _, transaction := range transactions {
+		if transaction.Timestamp.Before(since) {
+			continue
+		}
+		total, err := spent.Add(transaction.Amount)
+		if err != nil {
+			return types.Money{}, err
+		}
+		spent = total
+	}
+	return spent, nil
+}
+
+// ListSpendingSince returns the user's DEBIT and TRANSFER_OUT transactions
+// from since onwards, reading every page of the UserTransactionsIndex
+func (r *WalletRepository) ListSpendingSince(ctx context.Context, userID string, since time.Time) ([]types.WalletTransaction, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.transactionsTable),
+		IndexName:              aws.String(userTransactionsIndex),
+		KeyConditionExpression: aws.String("UserID = :userId AND #ts >= :since"),
+		FilterExpression:       aws.String("#type IN (:debit, :transferOut)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#ts":   aws.String("Timestamp"),
+			"#type": aws.String("Type"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":userId":      {S: aws.String(userID)},
+			":since":       {S: aws.String(types.TimestampKey(since))},
+			":debit":       {S: aws.String(types.TransactionTypeDebit)},
+			":transferOut": {S: aws.String(types.TransactionTypeTransferOut)},
+		},
+	}
+
+	var transactions []types.WalletTransaction
+	for {
+		result, err := r.db.QueryWithContext(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query wallet spending: %w", err)
+		}
+
+		var page []types.WalletTransaction
+		if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal wallet transactions: %w", err)
+		}
+		transactions = append(transactions, page...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return transactions, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCurrentSpending(t *testing.T) {
+	repo := NewWalletRepository(nil, nil, "Wallets", "WalletTransactions", "WalletHolds", "PaymentEvents", "ReconciliationReports", "Ledger")
+	now := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	weekly := types.NewMoney(80000, "USD")
+	wallet := &types.Wallet{
+		UserID:         "user123",
+		Balance:        types.NewMoney(100000, "USD"),
+		SpendingLimits: &types.SpendingLimits{Weekly: &weekly},
+		Spending: &types.Spending{
+			Defaults: "stale",
+			Daily:    types.SpendingWindow{Period: "2024-01-14", Spent: 7000},
+			Weekly:   types.SpendingWindow{Period: "2024-W03", Spent: 12000},
+			Monthly:  types.SpendingWindow{Period: "2024-01", Spent: 30000},
+		},
+	}
+	defaults := map[string]types.Money{
+		types.SpendingPeriodDaily:  types.NewMoney(50000, "USD"),
+		types.SpendingPeriodWeekly: types.NewMoney(100000, "USD"),
+	}
+
+	spending, err := repo.CurrentSpending(context.Background(), wallet, defaults, now)
+	require.NoError(t, err)
+
+	daily, limited := int64(50000), int64(80000)
+	assert.Equal(t, &types.Spending{
+		Defaults: "daily=USD:50000,weekly=USD:100000,monthly=none",
+		// Yesterday's spending no longer counts
+		Daily: types.SpendingWindow{Period: "2024-01-15", Limit: &daily, Spent: 0, Remaining: 50000},
+		// The user's own limit wins over the default
+		Weekly:  types.SpendingWindow{Period: "2024-W03", Limit: &limited, Spent: 12000, Remaining: 68000},
+		Monthly: types.SpendingWindow{Period: "2024-01", Spent: 30000, Remaining: -30000},
+	}, spending)
+	// The wallet that was read is left untouched
+	assert.Equal(t, "stale", wallet.Spending.Defaults)
+}
+
+func TestSpend(t *testing.T) {
+	repo := NewWalletRepository(nil, nil, "Wallets", "WalletTransactions", "WalletHolds", "PaymentEvents", "ReconciliationReports", "Ledger")
+	now := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	defaults := map[string]types.Money{types.SpendingPeriodWeekly: types.NewMoney(10000, "USD")}
+	wallet := &types.Wallet{
+		UserID:  "user123",
+		Balance: types.NewMoney(100000, "USD"),
+		Spending: &types.Spending{
+			Daily:   types.SpendingWindow{Period: "2024-01-15", Spent: 4000},
+			Weekly:  types.SpendingWindow{Period: "2024-W03", Spent: 8000},
+			Monthly: types.SpendingWindow{Period: "2024-01", Spent: 8000},
+		},
+	}
+
+	cases := []struct {
+		name   string
+		amount int64
+		period string
+	}{
+		{name: "fits the allowance", amount: 2000},
+		{name: "exceeds the weekly limit", amount: 2001, period: types.SpendingPeriodWeekly},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			spending, err := repo.spend(context.Background(), wallet, types.NewMoney(tc.amount, "USD"), defaults, now)
+			if tc.period != "" {
+				var appErr *apperrors.AppError
+				require.True(t, errors.As(err, &appErr))
+				assert.Equal(t, apperrors.ErrCodeSpendingLimit, appErr.Code)
+				assert.Equal(t, tc.period, appErr.Details["period"])
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, 4000+tc.amount, spending.Daily.Spent)
+			assert.Equal(t, 8000+tc.amount, spending.Weekly.Spent)
+			assert.Equal(t, 10000-8000-tc.amount, spending.Weekly.Remaining)
+		})
+	}
+}
+
+func TestUnspend(t *testing.T) {
+	wallet := &types.Wallet{
+		Spending: &types.Spending{
+			Daily:   types.SpendingWindow{Period: "2024-01-15", Spent: 1000, Remaining: 4000},
+			Weekly:  types.SpendingWindow{Period: "2024-W03", Spent: 6000, Remaining: 4000},
+			Monthly: types.SpendingWindow{Period: "2024-01", Spent: 9000, Remaining: -9000},
+		},
+	}
+
+	// Held last Sunday: only the month it was counted in is still running
+	spending := unspend(wallet, types.NewMoney(2000, "USD"), time.Date(2024, 1, 14, 23, 0, 0, 0, time.UTC))
+	require.NotNil(t, spending)
+	assert.Equal(t, int64(1000), spending.Daily.Spent)
+	assert.Equal(t, int64(6000), spending.Weekly.Spent)
+	assert.Equal(t, int64(7000), spending.Monthly.Spent)
+	assert.Equal(t, int64(-7000), spending.Monthly.Remaining)
+
+	// Spent never goes below zero
+	spending = unspend(wallet, types.NewMoney(2000, "USD"), time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC))
+	assert.Equal(t, int64(0), spending.Daily.Spent)
+	assert.Equal(t, int64(5000), spending.Daily.Remaining)
+
+	assert.Nil(t, unspend(&types.Wallet{}, types.NewMoney(2000, "USD"), time.Now()))
+}
+
+func TestSpentSince(t *testing.T) {
+	now := time.Now().UTC()
+	transactions := []types.WalletTransaction{
+		{Type: types.TransactionTypeDebit, Amount: types.NewMoney(1000, "USD"), Timestamp: now.Add(-time.Hour)},
+		{Type: types.TransactionTypeTransferOut, Amount: types.NewMoney(2000, "USD"), Timestamp: now.Add(-3 * 24 * time.Hour)},
+	}
+
+	spent, err := spentSince(transactions, now.Add(-24*time.Hour), types.NewMoney(500, "USD"))
+	assert.NoError(t, err)
+	assert.Equal(t, types.NewMoney(1500, "USD"), spent)
+
+	spent, err = spentSince(transactions, now.Add(-7*24*time.Hour), types.NewMoney(0, "USD"))
+	assert.NoError(t, err)
+	assert.Equal(t, types.NewMoney(3000, "USD"), spent)
+}
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// ledgerEventTypes are the PaymentEvents written by every write that changes
+// a wallet's balance or bumps its Version, refund-service's refund credits
+// included
+var ledgerEventTypes = []types.EventType{
+	types.EventWalletCreated,
+	types.EventWalletDebited,
+	types.EventWalletCredited,
+	types.EventWalletDeposited,
+	types.EventWalletTransferred,
+	types.EventWalletHoldPlaced,
+	types.EventWalletHoldReleased,
+	types.EventWalletStatusChanged,
+	types.EventWalletCreditLimitSet,
+}
+
+// ScanLedgerEvents calls fn with each page of wallet ledger events in the
+// PaymentEvents table, in no particular order. The scan reads consistently,
+// so every event written before it started is seen.
+func (r *WalletRepository) ScanLedgerEvents(ctx context.Context, fn func(events []types.PaymentEvent) error) error {
+	placeholders := ""
+	values := map[string]*dynamodb.AttributeValue{}
+	for i, eventType := range ledgerEventTypes {
+		placeholder := fmt.Sprintf(":type%d", i)
+		if i > 0 {
+			placeholders += ", "
+		}
+		placeholders += placeholder
+		values[placeholder] = &dynamodb.AttributeValue{S: aws.String(string(eventType))}
+	}
+
+	input := &dynamodb.ScanInput{
+		TableName:                 aws.String(r.eventsTable),
+		FilterExpression:          aws.String("EventType IN (" + placeholders + ")"),
+		ExpressionAttributeValues: values,
+		ConsistentRead:            aws.Bool(true),
+	}
+
+	for {
+		result, err := r.db.ScanWithContext(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to scan wallet events: %w", err)
+		}
+
+		var page []types.PaymentEvent
+		if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return fmt.Errorf("failed to unmarshal wallet events: %w", err)
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// ScanWallets calls fn with each page of the Wallets table, read consistently
+func (r *WalletRepository) ScanWallets(ctx context.Context, fn func(wallets []types.Wallet) error) error {
+	input := &dynamodb.ScanInput{
+		TableName:      aws.String(r.walletsTable),
+		ConsistentRead: aws.Bool(true),
+	}
+
+	for {
+		result, err := r.db.ScanWithContext(ctx, input)
+		if err != nil {
+			return fmt.Errorf("failed to scan wallets: %w", err)
+		}
+
+		var page []types.Wallet
+		if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return fmt.Errorf("failed to unmarshal wallets: %w", err)
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// PutWalletDrift stores one wallet's entry of a reconciliation report
+func (r *WalletRepository) PutWalletDrift(ctx context.Context, drift *types.WalletDrift) error {
+	item, err := dynamodbattribute.MarshalMap(drift)
+	if err != nil {
+		return fmt.Errorf("failed to marshal wallet drift: %w", err)
+	}
+
+	_, err = r.db.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.reportsTable),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put wallet drift: %w", err)
+	}
+
+	return nil
+}
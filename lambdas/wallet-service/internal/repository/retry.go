@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// Optimistic-lock retry tuning. Each retry re-reads the wallet, so the delays
+// only need to spread out writers that raced on the same Version.
+const (
+	maxWriteAttempts = 5
+	baseRetryDelay   = 20 * time.Millisecond
+	maxRetryDelay    = 400 * time.Millisecond
+)
+
+// ErrVersionConflict is returned when the wallet was changed by another write
+// between reading it and applying an update conditioned on its Version
+var ErrVersionConflict = errors.New("wallet version conflict")
+
+// walletConditionError is returned when a wallet update's condition failed
+// while its Version still matched, so a balance or currency check failed
+// rather than a concurrent write. current is the wallet as DynamoDB saw it.
+type walletConditionError struct {
+	current types.Wallet
+}
+
+func (e *walletConditionError) Error() string {
+	return fmt.Sprintf("wallet %s condition check failed at version %d", e.current.UserID, e.current.Version)
+}
+
+// withRetry runs attempt, which must re-read the wallet it updates, until it
+// no longer fails with ErrVersionConflict. After maxWriteAttempts it gives up
+// with a concurrent update error. Retry counts are reported to metrics.
+func (r *WalletRepository) withRetry(ctx context.Context, userID, operation string, attempt func() error) error {
+	for retries := 0; ; retries++ {
+		err := attempt()
+		if !errors.Is(err, ErrVersionConflict) {
+			r.recordRetries(ctx, operation, retries, err)
+			return err
+		}
+
+		if retries+1 >= maxWriteAttempts {
+			err = apperrors.NewConcurrentUpdateError(fmt.Sprintf("wallet %s", userID))
+			r.recordRetries(ctx, operation, retries, err)
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryDelay(retries + 1)):
+		}
+	}
+}
+
+// retryDelay returns a random delay up to an exponentially growing ceiling
+// ("full jitter"), so writers that conflicted once do not collide again
+func retryDelay(retry int) time.Duration {
+	ceiling := maxRetryDelay
+	if retry < 16 {
+		if d := baseRetryDelay << uint(retry-1); d < ceiling {
+			ceiling = d
+		}
+	}
+	return time.Duration(rand.Int63n(int64(ceiling))) + time.Millisecond
+}
+
+// recordRetries reports how many retries an operation needed. Operations that
+// succeeded on the first attempt are not reported.
+func (r *WalletRepository) recordRetries(ctx context.Context, operation string, retries int, err error) {
+	if r.metrics == nil || retries == 0 {
+		return
+	}
+
+	outcome := "success"
+	var appErr *apperrors.AppError
+	switch {
+	case errors.As(err, &appErr) && appErr.Code == apperrors.ErrCodeConcurrentUpdate:
+		outcome = "exhausted"
+	case err != nil:
+		outcome = "failed"
+	}
+
+	r.metrics.RecordRetryAttempts(ctx, "wallet_"+operation, retries, outcome)
+}
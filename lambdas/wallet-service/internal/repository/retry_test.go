@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRetry_RetriesVersionConflicts(t *testing.T) {
+	repo := &WalletRepository{}
+	attempts := 0
+
+	err := repo.withRetry(context.Background(), "user123", "debit", func() error {
+		attempts++
+		if attempts < 3 {
+			return ErrVersionConflict
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestWithRetry_GivesUpAfterMaxAttempts(t *testing.T) {
+	repo := &WalletRepository{}
+	attempts := 0
+
+	err := repo.withRetry(context.Background(), "user123", "debit", func() error {
+		attempts++
+		return ErrVersionConflict
+	})
+
+	var appErr *apperrors.AppError
+	assert.True(t, errors.As(err, &appErr))
+	assert.Equal(t, apperrors.ErrCodeConcurrentUpdate, appErr.Code)
+	assert.Equal(t, maxWriteAttempts, attempts)
+}
+
+func TestWithRetry_DoesNotRetryInsufficientFunds(t *testing.T) {
+	repo := &WalletRepository{}
+	attempts := 0
+
+	err := repo.withRetry(context.Background(), "user123", "debit", func() error {
+		attempts++
+		return apperrors.NewInsufficientFundsError(types.NewMoney(100, "USD"), types.NewMoney(500, "USD"))
+	})
+
+	var appErr *apperrors.AppError
+	assert.True(t, errors.As(err, &appErr))
+	assert.Equal(t, apperrors.ErrCodeInsufficientFunds, appErr.Code)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestWalletConditionFailure_WithoutItemIsConflict(t *testing.T) {
+	read := &types.Wallet{UserID: "user123", Version: 4}
+
+	// Without the old item there is nothing to compare, so re-read and check again
+	assert.ErrorIs(t, walletConditionFailure(read, nil), ErrVersionConflict)
+}
+
+func TestRetryDelay_StaysWithinBounds(t *testing.T) {
+	for retry := 1; retry <= 20; retry++ {
+		delay := retryDelay(retry)
+		assert.Greater(t, int64(delay), int64(0))
+		assert.LessOrEqual(t, int64(delay), int64(maxRetryDelay+1e6))
+	}
+}
@@ -0,0 +1,190 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// availableAttribute is the Wallets attribute holding Balance minus Held plus
+// CreditLimit in minor units. It is denormalized so a debit can check available funds in a
+// condition expression without reading the wallet first; every balance or
+// hold write keeps it in step, and a write that cannot removes it instead.
+const availableAttribute = "Available"
+
+// errNeedsRead is returned by applyInPlace when its condition failed. The
+// caller falls back to reading the wallet, which finds out why.
+var errNeedsRead = errors.New("wallet must be read before writing")
+
+// applyInPlace applies a debit or credit without reading the wallet: one
+// TransactWriteItems call changes the balance with an arithmetic expression
+// and writes the transaction's WalletTransactions row, PaymentEvent and
+// journal entry. The row is conditioned on not existing yet, so a repeated
+// payment writes nothing and ErrTransactionExists is returned. A debit is
+// also counted in the wallet's spending windows, conditioned on them having
+// room for it under the wallet's limits; defaults are the default limits in
+// the amount's currency, keyed by period.
+//
+// The balance the write left is not known, so the transaction records no
+// BalanceBefore or BalanceAfter, and no wallet is returned. Wallets with a
+// credit line are left to the read path, which records how much of the
+// overdraft each transaction draws or repays.
+//
+// errNeedsRead is returned when the wallet's condition failed: it does not
+// exist, has another currency, has a status that does not allow the change,
+// has too little available, has a credit line, has no Available attribute
+// yet, or, for a debit, has spending windows of past periods, set with other
+// default limits, or without room for the amount. It is also returned when
+// the write raced another one.
+func (r *WalletRepository) applyInPlace(ctx context.Context, userID, transactionType string, amount types.Money, paymentID string, defaults map[string]types.Money) (*types.WalletTransaction, error) {
+	transaction := &types.WalletTransaction{
+		ID:        transactionID(userID, paymentID, transactionType),
+		UserID:    userID,
+		PaymentID: paymentID,
+		Type:      transactionType,
+		Amount:    amount,
+		Timestamp: time.Now().UTC(),
+	}
+
+	items, err := r.singleWriteItems(transaction, defaults)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.db.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if err != nil {
+		var canceled *dynamodb.TransactionCanceledException
+		if errors.As(err, &canceled) && len(canceled.CancellationReasons) > 1 {
+			reasons := canceled.CancellationReasons
+			switch {
+			case aws.StringValue(reasons[1].Code) == "ConditionalCheckFailed":
+				return nil, ErrTransactionExists
+			case aws.StringValue(reasons[0].Code) == "ConditionalCheckFailed":
+				return nil, errNeedsRead
+			}
+			for _, reason := range reasons {
+				if aws.StringValue(reason.Code) == "TransactionConflict" {
+					// Raced another write; the read path retries it
+					return nil, errNeedsRead
+				}
+			}
+		}
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionConflictException {
+			return nil, errNeedsRead
+		}
+		return nil, apperrors.NewLedgerWriteError(fmt.Errorf("failed to %s wallet: %w", strings.ToLower(transactionType), err))
+	}
+
+	return transaction, nil
+}
+
+// singleWriteItems builds the TransactWriteItems of applyInPlace: the
+// conditional arithmetic update of the wallet, then the transaction's row,
+// event and journal entry
+func (r *WalletRepository) singleWriteItems(transaction *types.WalletTransaction, defaults map[string]types.Money) ([]*dynamodb.TransactWriteItem, error) {
+	last, err := dynamodbattribute.MarshalMap(transaction)
+	if err != nil {
+		return nil, apperrors.NewLedgerWriteError(fmt.Errorf("failed to marshal transaction: %w", err))
+	}
+
+	transactionPut, err := r.putTransaction(transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	eventPut, err := r.putEvent(newTransactionEvent(transaction))
+	if err != nil {
+		return nil, err
+	}
+
+	journalItems, err := r.journalItems(transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	debit := transaction.Type == types.TransactionTypeDebit
+	operator, check := "+", "attribute_exists(#available)"
+	if debit {
+		operator, check = "-", "#available >= :amount"
+	}
+
+	names := map[string]*string{
+		"#available": aws.String(availableAttribute),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":amount": {
+			N: aws.String(strconv.FormatInt(transaction.Amount.Amount, 10)),
+		},
+		":currency": {
+			S: aws.String(transaction.Amount.Currency),
+		},
+		":zero": {
+			N: aws.String("0"),
+		},
+		":one": {
+			N: aws.String("1"),
+		},
+		":updatedAt": {
+			S: aws.String(time.Now().Format(time.RFC3339)),
+		},
+		":last": {
+			M: last,
+		},
+	}
+	condition := "Balance.Currency = :currency AND " + addStatusCondition(names, values, debit) + " AND " + check +
+		" AND (attribute_not_exists(CreditLimit) OR CreditLimit.Amount = :zero)"
+	set := fmt.Sprintf("Balance.Amount = Balance.Amount %[1]s :amount, #available = #available %[1]s :amount, "+
+		"Version = Version + :one, UpdatedAt = :updatedAt, LastTransaction = :last", operator)
+	if debit {
+		spendingCheck, spendingSet := addSpendingCheck(names, values, defaults, transaction.Timestamp)
+		condition += " AND " + spendingCheck
+		set += ", " + spendingSet
+	}
+
+	return append([]*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String(r.walletsTable),
+				Key: map[string]*dynamodb.AttributeValue{
+					"UserID": {
+						S: aws.String(transaction.UserID),
+					},
+				},
+				UpdateExpression:          aws.String("SET " + set),
+				ConditionExpression:       aws.String(condition),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			},
+		},
+		transactionPut,
+		eventPut,
+	}, journalItems...), nil
+}
+
+// signedAmount is how much a transaction added to the balance: negative for debits
+func signedAmount(transaction *types.WalletTransaction) types.Money {
+	if transaction.Type == types.TransactionTypeDebit {
+		return transaction.Amount.Neg()
+	}
+	return transaction.Amount
+}
+
+// availableValue is the Available attribute for a wallet with the given
+// balance, held amount and credit limit
+func availableValue(balance, held, creditLimit types.Money) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{
+		N: aws.String(strconv.FormatInt(balance.Amount-held.Amount+creditLimit.Amount, 10)),
+	}
+}
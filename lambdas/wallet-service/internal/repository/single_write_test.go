@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedAmount(t *testing.T) {
+	debit := &types.WalletTransaction{Type: types.TransactionTypeDebit, Amount: types.NewMoney(1500, "USD")}
+	credit := &types.WalletTransaction{Type: types.TransactionTypeCredit, Amount: types.NewMoney(1500, "USD")}
+
+	assert.Equal(t, types.NewMoney(-1500, "USD"), signedAmount(debit))
+	assert.Equal(t, types.NewMoney(1500, "USD"), signedAmount(credit))
+}
+
+func TestCommittedWallet(t *testing.T) {
+	wallet := &types.Wallet{
+		UserID:  "user123",
+		Balance: types.NewMoney(10000, "USD"),
+		Held:    types.NewMoney(2500, "USD"),
+		Version: 3,
+	}
+
+	committed := committedWallet(wallet, types.NewMoney(8000, "USD"))
+
+	assert.Equal(t, int64(8000), committed.Balance.Amount)
+	assert.Equal(t, 4, committed.Version)
+	assert.Equal(t, int64(5500), committed.Available().Amount)
+	// The wallet that was read is left untouched
+	assert.Equal(t, 3, wallet.Version)
+	assert.Equal(t, "5500", *availableValue(committed.Balance, committed.Held, committed.CreditLimit).N)
+}
+
+func TestSingleWriteItems(t *testing.T) {
+	repo := NewWalletRepository(nil, nil, "Wallets", "WalletTransactions", "WalletHolds", "PaymentEvents", "ReconciliationReports", "Ledger")
+	transaction := &types.WalletTransaction{
+		ID:        transactionID("user123", "pay-1", types.TransactionTypeDebit),
+		UserID:    "user123",
+		PaymentID: "pay-1",
+		Type:      types.TransactionTypeDebit,
+		Amount:    types.NewMoney(1500, "USD"),
+		Timestamp: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC),
+	}
+
+	defaults := map[string]types.Money{types.SpendingPeriodDaily: types.NewMoney(50000, "USD")}
+	items, err := repo.singleWriteItems(transaction, defaults)
+	require.NoError(t, err)
+	require.Greater(t, len(items), 3)
+
+	// The balance changes in place, without a Version read beforehand
+	wallet := items[0].Update
+	require.NotNil(t, wallet)
+	assert.Equal(t, "Wallets", *wallet.TableName)
+	assert.Contains(t, *wallet.UpdateExpression, "Balance.Amount = Balance.Amount - :amount")
+	assert.Contains(t, *wallet.ConditionExpression, "#available >= :amount")
+	assert.NotContains(t, *wallet.ConditionExpression, "Version")
+	assert.Equal(t, "1500", *wallet.ExpressionAttributeValues[":amount"].N)
+
+	// The debit is counted in the current spending windows, which must have room for it
+	assert.Contains(t, *wallet.UpdateExpression, "#spending.#daily.#spent = #spending.#daily.#spent + :amount")
+	assert.Contains(t, *wallet.ConditionExpression, "#spending.#daily.#period = :daily AND "+
+		"(attribute_not_exists(#spending.#daily.#limit) OR #spending.#daily.#remaining >= :amount)")
+	assert.Equal(t, "2024-01-15", *wallet.ExpressionAttributeValues[":daily"].S)
+	assert.Equal(t, "2024-W03", *wallet.ExpressionAttributeValues[":weekly"].S)
+	assert.Equal(t, "daily=USD:50000,weekly=none,monthly=none", *wallet.ExpressionAttributeValues[":spendingDefaults"].S)
+
+	// The row is written in the same call, and only once per payment
+	row := items[1].Put
+	require.NotNil(t, row)
+	assert.Equal(t, "WalletTransactions", *row.TableName)
+	assert.Equal(t, "attribute_not_exists(ID)", *row.ConditionExpression)
+
+	assert.Equal(t, "PaymentEvents", *items[2].Put.TableName)
+	for _, item := range items[3:] {
+		assert.Equal(t, "Ledger", *item.Put.TableName)
+	}
+}
+
+// TestApplyInPlace_RepeatedPayment runs against DYNAMODB_ENDPOINT, like the
+// debit benchmarks. A repeated debit or credit must fail before it writes:
+// any write to the wallet moves its Version and reaches the table's stream.
+func TestApplyInPlace_RepeatedPayment(t *testing.T) {
+	repo, userID := dynamoWallet(t)
+	ctx := context.Background()
+	amount := types.NewMoney(1500, "USD")
+
+	for _, transactionType := range []string{types.TransactionTypeDebit, types.TransactionTypeCredit} {
+		first, err := repo.applyInPlace(ctx, userID, transactionType, amount, "pay-1", nil)
+		require.NoError(t, err, transactionType)
+		stored := storedWallet(t, repo, userID)
+
+		_, err = repo.applyInPlace(ctx, userID, transactionType, amount, "pay-1", nil)
+		assert.ErrorIs(t, err, ErrTransactionExists, transactionType)
+		assert.Equal(t, stored, storedWallet(t, repo, userID), transactionType)
+
+		recorded, err := repo.GetTransaction(ctx, userID, "pay-1", transactionType)
+		require.NoError(t, err)
+		assert.Equal(t, first.ID, recorded.ID, transactionType)
+	}
+}
+
+// storedWallet reads a wallet item exactly as it is stored
+func storedWallet(t *testing.T, repo *WalletRepository, userID string) map[string]*dynamodb.AttributeValue {
+	result, err := repo.db.GetItemWithContext(context.Background(), &dynamodb.GetItemInput{
+		TableName: aws.String(repo.walletsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"UserID": {
+				S: aws.String(userID),
+			},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	require.NoError(t, err)
+	require.NotNil(t, result.Item)
+	return result.Item
+}
@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// ListTransactionsUntil returns every transaction of the user up to and
+// including until, oldest first, reading every page of the
+// UserTransactionsIndex
+func (r *WalletRepository) ListTransactionsUntil(ctx context.Context, userID string, until time.Time) ([]types.WalletTransaction, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.transactionsTable),
+		IndexName:              aws.String(userTransactionsIndex),
+		KeyConditionExpression: aws.String("UserID = :userId AND #ts <= :until"),
+		ExpressionAttributeNames: map[string]*string{
+			"#ts": aws.String("Timestamp"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":userId": {S: aws.String(userID)},
+			":until":  {S: aws.String(types.TimestampKey(until))},
+		},
+		ScanIndexForward: aws.Bool(true),
+	}
+
+	var transactions []types.WalletTransaction
+	for {
+		result, err := r.db.QueryWithContext(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query wallet transactions: %w", err)
+		}
+
+		var page []types.WalletTransaction
+		if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal wallet transactions: %w", err)
+		}
+		transactions = append(transactions, page...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return transactions, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/google/uuid"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// ErrStatusUnchanged is returned when a wallet already has the requested status
+var ErrStatusUnchanged = errors.New("wallet status unchanged")
+
+// Condition fragments admitting a wallet whose status allows a debit or a
+// credit. Wallets without a Status are ACTIVE. Putting them in the write's
+// own condition means a freeze applies to any write that commits after it,
+// whatever the writer read before.
+const (
+	debitStatusCondition  = "(attribute_not_exists(#status) OR #status = :active)"
+	creditStatusCondition = "(attribute_not_exists(#status) OR #status <> :closed)"
+)
+
+// addStatusCondition adds the names and values used by the debit or credit
+// status condition to a wallet write, and returns the condition
+func addStatusCondition(names map[string]*string, values map[string]*dynamodb.AttributeValue, debit bool) string {
+	names["#status"] = aws.String("Status")
+	if debit {
+		values[":active"] = &dynamodb.AttributeValue{S: aws.String(string(types.WalletStatusActive))}
+		return debitStatusCondition
+	}
+	values[":closed"] = &dynamodb.AttributeValue{S: aws.String(string(types.WalletStatusClosed))}
+	return creditStatusCondition
+}
+
+// checkStatus returns a wallet not active error if wallet's status does not
+// allow a debit, or a credit
+func checkStatus(wallet *types.Wallet, debit bool) error {
+	status := wallet.CurrentStatus()
+	if debit && !status.AllowsDebits() || !debit && !status.AllowsCredits() {
+		return apperrors.NewWalletNotActiveError(wallet.UserID, string(status))
+	}
+	return nil
+}
+
+// SetWalletStatus moves the wallet to status, recording the reason and actor
+// on the wallet and in a wallet.status_changed event written in the same
+// transaction. The change bumps Version, so writes that read the wallet
+// before it retry and see the new status. A closed wallet cannot change
+// status, and only a wallet with no balance and no holds can be closed.
+func (r *WalletRepository) SetWalletStatus(ctx context.Context, userID string, status types.WalletStatus, reason, actor string) (*types.Wallet, error) {
+	var wallet *types.Wallet
+	err := r.withRetry(ctx, userID, "status", func() (err error) {
+		wallet, err = r.setWalletStatus(ctx, userID, status, reason, actor)
+		return err
+	})
+	return wallet, err
+}
+
+func (r *WalletRepository) setWalletStatus(ctx context.Context, userID string, status types.WalletStatus, reason, actor string) (*types.Wallet, error) {
+	wallet, err := r.GetWallet(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	previous := wallet.CurrentStatus()
+	if previous == status {
+		return nil, ErrStatusUnchanged
+	}
+	if previous == types.WalletStatusClosed {
+		return nil, apperrors.NewWalletNotActiveError(userID, string(previous))
+	}
+	if status == types.WalletStatusClosed && (!wallet.Balance.IsZero() || !wallet.Held.IsZero()) {
+		return nil, apperrors.NewValidationError("only a wallet with no balance and no holds can be closed", map[string]interface{}{
+			"balance": wallet.Balance,
+			"held":    wallet.Held,
+		})
+	}
+
+	now := time.Now().UTC()
+	condition := "Version = :currentVersion"
+	values := map[string]*dynamodb.AttributeValue{
+		":status":    {S: aws.String(string(status))},
+		":reason":    {S: aws.String(reason)},
+		":actor":     {S: aws.String(actor)},
+		":changedAt": {S: aws.String(now.Format(time.RFC3339Nano))},
+		":newVersion": {
+			N: aws.String(fmt.Sprintf("%d", wallet.Version+1)),
+		},
+		":currentVersion": {
+			N: aws.String(fmt.Sprintf("%d", wallet.Version)),
+		},
+	}
+	if status == types.WalletStatusClosed {
+		condition += " AND Balance.Amount = :zero AND Held.Amount = :zero"
+		values[":zero"] = &dynamodb.AttributeValue{N: aws.String("0")}
+	}
+
+	event := &types.PaymentEvent{
+		ID:        fmt.Sprintf("%s#%s", userID, uuid.New().String()),
+		PaymentID: walletStatusEventID(userID),
+		UserID:    userID,
+		EventType: string(types.EventWalletStatusChanged),
+		Amount:    wallet.Balance,
+		Status:    string(status),
+		Metadata: map[string]interface{}{
+			"previousStatus": string(previous),
+			"status":         string(status),
+			"reason":         reason,
+			"actor":          actor,
+		},
+		Timestamp: now,
+	}
+	eventPut, err := r.putEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.writeTransaction(ctx, wallet, "status", []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String(r.walletsTable),
+				Key: map[string]*dynamodb.AttributeValue{
+					"UserID": {
+						S: aws.String(userID),
+					},
+				},
+				UpdateExpression: aws.String("SET #status = :status, StatusReason = :reason, StatusChangedBy = :actor, " +
+					"StatusChangedAt = :changedAt, Version = :newVersion, UpdatedAt = :changedAt"),
+				ConditionExpression: aws.String(condition),
+				ExpressionAttributeNames: map[string]*string{
+					"#status": aws.String("Status"),
+				},
+				ExpressionAttributeValues: values,
+			},
+		},
+		eventPut,
+	}, nil)
+	if err != nil {
+		// Same Version but a failed condition means the wallet was not empty
+		var conditionErr *walletConditionError
+		if errors.As(err, &conditionErr) {
+			return nil, apperrors.NewValidationError("only a wallet with no balance and no holds can be closed", nil)
+		}
+		return nil, err
+	}
+
+	updated := *wallet
+	updated.Status = status
+	updated.StatusReason = reason
+	updated.StatusChangedBy = actor
+	updated.StatusChangedAt = &now
+	updated.Version++
+	updated.UpdatedAt = now
+	return &updated, nil
+}
+
+// walletStatusEventID is the PaymentEvents partition holding a wallet's status
+// changes, which belong to no payment
+func walletStatusEventID(userID string) string {
+	return fmt.Sprintf("wallet-status#%s", userID)
+}
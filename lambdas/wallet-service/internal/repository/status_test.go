@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"testing"
+
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckStatus(t *testing.T) {
+	frozen := &types.Wallet{UserID: "user123", Status: types.WalletStatusFrozen}
+
+	err := checkStatus(frozen, true)
+	var appErr *apperrors.AppError
+	assert.ErrorAs(t, err, &appErr)
+	assert.Equal(t, apperrors.ErrCodeWalletNotActive, appErr.Code)
+	assert.NoError(t, checkStatus(frozen, false))
+
+	assert.NoError(t, checkStatus(&types.Wallet{UserID: "user123"}, true))
+	assert.Error(t, checkStatus(&types.Wallet{UserID: "user123", Status: types.WalletStatusClosed}, false))
+}
+
+func TestHoldWalletUpdate_StatusCondition(t *testing.T) {
+	repo := NewWalletRepository(nil, nil, "Wallets", "WalletTransactions", "WalletHolds", "PaymentEvents", "ReconciliationReports", "Ledger")
+	wallet := &types.Wallet{
+		UserID:  "user123",
+		Balance: types.NewMoney(10000, "USD"),
+		Version: 3,
+	}
+
+	place := repo.holdWalletUpdate(wallet, wallet.Balance, types.NewMoney(2500, "USD"), true)
+	assert.Equal(t, "Version = :currentVersion AND (attribute_not_exists(#status) OR #status = :active)", *place.ConditionExpression)
+	assert.Equal(t, "ACTIVE", *place.ExpressionAttributeValues[":active"].S)
+
+	release := repo.holdWalletUpdate(wallet, wallet.Balance, types.NewMoney(0, "USD"), false)
+	assert.Equal(t, "Version = :currentVersion", *release.ConditionExpression)
+	assert.NotContains(t, release.ExpressionAttributeNames, "#status")
+}
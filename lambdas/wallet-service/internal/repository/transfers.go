@@ -0,0 +1,213 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// Transfer moves amount from one user's wallet to another's. Both wallet
+// updates, conditioned on the Version that was read, are written in one
+// TransactWriteItems call together with the TRANSFER_OUT and TRANSFER_IN
+// rows, which share transferID, a wallet.transferred event for the sender and
+// a wallet.credited event for the receiver.
+// Either both wallets change or neither does. Money sent counts against the
+// source wallet's spending limits, its own or else defaults, which are keyed
+// by period. Returns both legs and the source wallet as the transfer left it.
+func (r *WalletRepository) Transfer(ctx context.Context, fromUserID, toUserID string, amount types.Money, transferID string, defaults map[string]types.Money) (out, in *types.WalletTransaction, from *types.Wallet, err error) {
+	err = r.withRetry(ctx, fromUserID, "transfer", func() (err error) {
+		out, in, from, err = r.transfer(ctx, fromUserID, toUserID, amount, transferID, defaults)
+		return err
+	})
+	return out, in, from, err
+}
+
+func (r *WalletRepository) transfer(ctx context.Context, fromUserID, toUserID string, amount types.Money, transferID string, defaults map[string]types.Money) (*types.WalletTransaction, *types.WalletTransaction, *types.Wallet, error) {
+	source, err := r.GetWallet(ctx, fromUserID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	destination, err := r.GetWallet(ctx, toUserID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if err := checkStatus(source, true); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := checkStatus(destination, false); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if !source.Balance.SameCurrency(amount) {
+		return nil, nil, nil, apperrors.NewCurrencyMismatchError(source.Balance.Currency, amount.Currency)
+	}
+	if !destination.Balance.SameCurrency(amount) {
+		return nil, nil, nil, apperrors.NewCurrencyMismatchError(destination.Balance.Currency, amount.Currency)
+	}
+
+	// Funds reserved by holds cannot be transferred
+	if available := source.Available(); available.Amount < amount.Amount {
+		return nil, nil, nil, apperrors.NewInsufficientFundsError(available, amount)
+	}
+
+	sourceBalance, err := source.Balance.Sub(amount)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	destinationBalance, err := destination.Balance.Add(amount)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	now := time.Now().UTC()
+	spending, err := r.spend(ctx, source, amount, defaults, now)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	out := &types.WalletTransaction{
+		ID:             transactionID(fromUserID, transferID, types.TransactionTypeTransferOut),
+		UserID:         fromUserID,
+		PaymentID:      transferID,
+		Type:           types.TransactionTypeTransferOut,
+		Amount:         amount,
+		BalanceBefore:  &source.Balance,
+		BalanceAfter:   &sourceBalance,
+		Timestamp:      now,
+		TransferID:     transferID,
+		CounterpartyID: toUserID,
+	}
+	// PaymentEvents is keyed by (PaymentID, Timestamp), so the receiving leg,
+	// whose event shares the transfer's PaymentID, is stamped just after the
+	// sending one
+	in := &types.WalletTransaction{
+		ID:             transactionID(toUserID, transferID, types.TransactionTypeTransferIn),
+		UserID:         toUserID,
+		PaymentID:      transferID,
+		Type:           types.TransactionTypeTransferIn,
+		Amount:         amount,
+		BalanceBefore:  &destination.Balance,
+		BalanceAfter:   &destinationBalance,
+		Timestamp:      now.Add(time.Nanosecond),
+		TransferID:     transferID,
+		CounterpartyID: fromUserID,
+	}
+
+	outPut, err := r.putTransaction(out)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	inPut, err := r.putTransaction(in)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Each leg is recorded in its own wallet's events, naming the other one
+	outEvent := newTransactionEvent(out)
+	outEvent.Metadata["counterpartyId"] = toUserID
+	outEvent.Metadata["counterpartyTransactionId"] = in.ID
+	outEventPut, err := r.putEvent(outEvent)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	inEvent := newTransactionEvent(in)
+	inEvent.Metadata["counterpartyId"] = fromUserID
+	inEvent.Metadata["counterpartyTransactionId"] = out.ID
+	inEventPut, err := r.putEvent(inEvent)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// One journal entry moves the amount between both wallet accounts
+	journalItems, err := r.journalItems(out)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	sourceUpdate := r.transferUpdate(source, sourceBalance, amount, true)
+	if err := setSpending(sourceUpdate, spending); err != nil {
+		return nil, nil, nil, err
+	}
+
+	err = r.writeWallets(ctx, []*types.Wallet{source, destination}, "transfer", append([]*dynamodb.TransactWriteItem{
+		{Update: sourceUpdate},
+		{Update: r.transferUpdate(destination, destinationBalance, amount, false)},
+		outPut,
+		inPut,
+		outEventPut,
+		inEventPut,
+	}, journalItems...), map[int]error{2: ErrTransactionExists, 3: ErrTransactionExists})
+	if err != nil {
+		// Same Version but a failed condition means a status, balance or currency check failed
+		var conditionErr *walletConditionError
+		if errors.As(err, &conditionErr) {
+			current := conditionErr.current
+			if err := checkStatus(&current, current.UserID == fromUserID); err != nil {
+				return nil, nil, nil, err
+			}
+			if !current.Balance.SameCurrency(amount) {
+				return nil, nil, nil, apperrors.NewCurrencyMismatchError(current.Balance.Currency, amount.Currency)
+			}
+			return nil, nil, nil, apperrors.NewInsufficientFundsError(current.Available(), amount)
+		}
+		return nil, nil, nil, err
+	}
+
+	from := committedWallet(source, sourceBalance)
+	from.Spending = spending
+	return out, in, from, nil
+}
+
+// transferUpdate builds the optimistic-locking update of one side of a
+// transfer. Each side checks its status allows the debit or credit, and the
+// debited side also checks the balance and credit line cover amount.
+func (r *WalletRepository) transferUpdate(wallet *types.Wallet, balance, amount types.Money, debit bool) *dynamodb.Update {
+	update := &dynamodb.Update{
+		TableName: aws.String(r.walletsTable),
+		Key: map[string]*dynamodb.AttributeValue{
+			"UserID": {
+				S: aws.String(wallet.UserID),
+			},
+		},
+		UpdateExpression: aws.String("SET Balance.Amount = :balance, #available = :available, Version = :newVersion, UpdatedAt = :updatedAt"),
+		ExpressionAttributeNames: map[string]*string{
+			"#available": aws.String(availableAttribute),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":balance": {
+				N: aws.String(strconv.FormatInt(balance.Amount, 10)),
+			},
+			":available": availableValue(balance, wallet.Held, wallet.CreditLimit),
+			":newVersion": {
+				N: aws.String(fmt.Sprintf("%d", wallet.Version+1)),
+			},
+			":currentVersion": {
+				N: aws.String(fmt.Sprintf("%d", wallet.Version)),
+			},
+			":currency": {
+				S: aws.String(amount.Currency),
+			},
+			":updatedAt": {
+				S: aws.String(time.Now().Format(time.RFC3339)),
+			},
+		},
+	}
+
+	condition := "Version = :currentVersion AND Balance.Currency = :currency AND " +
+		addStatusCondition(update.ExpressionAttributeNames, update.ExpressionAttributeValues, debit)
+	if debit {
+		condition += " AND Balance.Amount >= :floor"
+		update.ExpressionAttributeValues[":floor"] = balanceFloor(wallet, amount)
+	}
+	update.ConditionExpression = aws.String(condition)
+
+	return update
+}
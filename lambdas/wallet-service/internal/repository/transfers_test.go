@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferUpdate(t *testing.T) {
+	repo := NewWalletRepository(nil, nil, "Wallets", "WalletTransactions", "WalletHolds", "PaymentEvents", "ReconciliationReports", "Ledger")
+	wallet := &types.Wallet{
+		UserID:  "user123",
+		Balance: types.NewMoney(10000, "USD"),
+		Held:    types.NewMoney(2500, "USD"),
+		Version: 3,
+		// Debits may take the balance down to -5000
+		CreditLimit: types.NewMoney(5000, "USD"),
+	}
+	amount := types.NewMoney(1500, "USD")
+
+	debit := repo.transferUpdate(wallet, types.NewMoney(8500, "USD"), amount, true)
+	assert.Equal(t, "Version = :currentVersion AND Balance.Currency = :currency AND "+
+		"(attribute_not_exists(#status) OR #status = :active) AND Balance.Amount >= :floor", *debit.ConditionExpression)
+	assert.Equal(t, "-3500", *debit.ExpressionAttributeValues[":floor"].N)
+	assert.Equal(t, "11000", *debit.ExpressionAttributeValues[":available"].N)
+	assert.Equal(t, "4", *debit.ExpressionAttributeValues[":newVersion"].N)
+	assert.Equal(t, "ACTIVE", *debit.ExpressionAttributeValues[":active"].S)
+
+	credit := repo.transferUpdate(wallet, types.NewMoney(11500, "USD"), amount, false)
+	assert.Equal(t, "Version = :currentVersion AND Balance.Currency = :currency AND "+
+		"(attribute_not_exists(#status) OR #status <> :closed)", *credit.ConditionExpression)
+	assert.Equal(t, "CLOSED", *credit.ExpressionAttributeValues[":closed"].S)
+	assert.NotContains(t, credit.ExpressionAttributeValues, ":floor")
+	assert.Equal(t, "14000", *credit.ExpressionAttributeValues[":available"].N)
+}
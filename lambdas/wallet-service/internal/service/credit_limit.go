@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// SetCreditLimitRequest represents an administrative change of a wallet's
+// credit limit. Reason and Actor are required and recorded with the change.
+type SetCreditLimitRequest struct {
+	UserID        string      `json:"userId"`
+	CreditLimit   types.Money `json:"creditLimit"`
+	Reason        string      `json:"reason"`
+	Actor         string      `json:"actor"`
+	CorrelationID string      `json:"correlationId"`
+}
+
+// SetCreditLimit lets a trusted user's wallet go below zero, down to
+// -CreditLimit, e.g. to enter a contest while a deposit is still settling. A
+// zero limit turns the credit line off; it cannot be set below the wallet's
+// current overdraft and holds.
+func (s *WalletService) SetCreditLimit(ctx context.Context, req SetCreditLimitRequest) (*types.Wallet, error) {
+	if err := s.validateSetCreditLimitRequest(req); err != nil {
+		return nil, err
+	}
+
+	wallet, err := s.repo.SetCreditLimit(ctx, req.UserID, req.CreditLimit, req.Reason, req.Actor)
+	if err != nil {
+		s.logger.Error("Failed to set wallet credit limit", err, map[string]interface{}{
+			"userId":      req.UserID,
+			"creditLimit": req.CreditLimit,
+			"actor":       req.Actor,
+		})
+		return nil, err
+	}
+
+	s.logger.Info("Wallet credit limit set", map[string]interface{}{
+		"userId":        req.UserID,
+		"creditLimit":   req.CreditLimit,
+		"overdraft":     wallet.Overdraft(),
+		"reason":        req.Reason,
+		"actor":         req.Actor,
+		"correlationId": req.CorrelationID,
+	})
+
+	return wallet, nil
+}
+
+// validateSetCreditLimitRequest validates set credit limit request
+func (s *WalletService) validateSetCreditLimitRequest(req SetCreditLimitRequest) error {
+	if req.UserID == "" {
+		return apperrors.NewValidationError("userID is required", nil)
+	}
+	if req.CreditLimit.Currency == "" {
+		return apperrors.NewValidationError("creditLimit currency is required", nil)
+	}
+	if req.CreditLimit.IsNegative() {
+		return apperrors.NewValidationError("creditLimit must not be negative", map[string]interface{}{
+			"creditLimit": req.CreditLimit,
+		})
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		return apperrors.NewValidationError("reason is required", nil)
+	}
+	if strings.TrimSpace(req.Actor) == "" {
+		return apperrors.NewValidationError("actor is required", nil)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// DepositRequest represents a top-up of a user's wallet. DepositID identifies
+// the deposit flow execution and ExternalID the gateway charge that funded it.
+type DepositRequest struct {
+	UserID        string      `json:"userId"`
+	Amount        types.Money `json:"amount"`
+	DepositID     string      `json:"depositId"`
+	ExternalID    string      `json:"externalId,omitempty"`
+	CorrelationID string      `json:"correlationId"`
+}
+
+// CheckDeposit verifies a deposit can be credited before the user is
+// charged: the wallet must exist and hold the deposit's currency
+func (s *WalletService) CheckDeposit(ctx context.Context, req DepositRequest) (*types.Wallet, error) {
+	if err := s.validateDepositRequest(req); err != nil {
+		return nil, err
+	}
+
+	wallet, err := s.repo.GetWallet(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !wallet.Balance.SameCurrency(req.Amount) {
+		return nil, apperrors.NewValidationError(
+			fmt.Sprintf("wallet currency is %s, deposit is %s", wallet.Balance.Currency, req.Amount.Currency), nil)
+	}
+
+	return wallet, nil
+}
+
+// Deposit credits a top-up that the payment gateway has approved. Each
+// deposit is credited at most once: repeating it returns the original transaction.
+func (s *WalletService) Deposit(ctx context.Context, req DepositRequest) (*TransactionResult, error) {
+	if err := s.validateDepositRequest(req); err != nil {
+		return nil, err
+	}
+	if req.ExternalID == "" {
+		return nil, apperrors.NewValidationError("externalId is required", nil)
+	}
+
+	transaction, wallet, err := s.repo.DepositWallet(ctx, req.UserID, req.Amount, req.DepositID)
+	if err != nil {
+		// A repeated deposit is replayed rather than credited twice
+		if result, replayErr := s.replayTransaction(ctx, req.UserID, req.DepositID, types.TransactionTypeDeposit, req.Amount); result != nil || replayErr != nil {
+			return result, replayErr
+		}
+		s.logger.Error("Failed to deposit to wallet", err, map[string]interface{}{
+			"userId":     req.UserID,
+			"amount":     req.Amount,
+			"depositId":  req.DepositID,
+			"externalId": req.ExternalID,
+		})
+		return nil, err
+	}
+
+	s.logger.Info("Wallet deposit credited", map[string]interface{}{
+		"userId":        req.UserID,
+		"amount":        req.Amount,
+		"transactionId": transaction.ID,
+		"depositId":     req.DepositID,
+		"externalId":    req.ExternalID,
+		"correlationId": req.CorrelationID,
+	})
+
+	return &TransactionResult{
+		Wallet:      wallet,
+		Transaction: transaction,
+	}, nil
+}
+
+// validateDepositRequest validates deposit request
+func (s *WalletService) validateDepositRequest(req DepositRequest) error {
+	if req.UserID == "" {
+		return apperrors.NewValidationError("userID is required", nil)
+	}
+	if !req.Amount.IsPositive() {
+		return apperrors.NewValidationError("amount must be greater than 0", nil)
+	}
+	if len(req.Amount.Currency) != 3 {
+		return apperrors.NewValidationError("invalid currency format", nil)
+	}
+	if req.DepositID == "" {
+		return apperrors.NewValidationError("depositId is required", nil)
+	}
+	return nil
+}
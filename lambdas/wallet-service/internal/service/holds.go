@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/draftea-coding-challenge/lambdas/wallet-service/internal/repository"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+const (
+	// defaultHoldTTL is how long a hold reserves funds when the request does not say
+	defaultHoldTTL = 15 * time.Minute
+
+	// maxHoldTTL bounds how long funds can stay reserved for a single payment
+	maxHoldTTL = 7 * 24 * time.Hour
+
+	// expiredHoldBatchSize is how many expired holds one sweep releases
+	expiredHoldBatchSize = 100
+)
+
+// HoldRequest represents a request to reserve funds for a payment
+type HoldRequest struct {
+	UserID        string      `json:"userId"`
+	Amount        types.Money `json:"amount"`
+	PaymentID     string      `json:"paymentId"`
+	CorrelationID string      `json:"correlationId"`
+	TTLSeconds    int64       `json:"ttlSeconds,omitempty"`
+}
+
+// CaptureRequest represents a request to debit the funds held for a payment
+type CaptureRequest struct {
+	UserID        string `json:"userId"`
+	PaymentID     string `json:"paymentId"`
+	CorrelationID string `json:"correlationId"`
+}
+
+// ReleaseRequest represents a request to give back the funds held for a payment
+type ReleaseRequest struct {
+	UserID        string `json:"userId"`
+	PaymentID     string `json:"paymentId"`
+	CorrelationID string `json:"correlationId"`
+	Reason        string `json:"reason,omitempty"`
+}
+
+// HoldResult is the outcome of a hold or release
+type HoldResult struct {
+	Wallet *types.Wallet     `json:"wallet"`
+	Hold   *types.WalletHold `json:"hold"`
+}
+
+// Hold reserves an amount against the user's available balance. Holding the
+// same payment again returns the existing hold.
+func (s *WalletService) Hold(ctx context.Context, req HoldRequest) (*HoldResult, error) {
+	if err := s.validateHoldRequest(req); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.GetHold(ctx, req.UserID, req.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return s.replayHold(ctx, existing, req.Amount)
+	}
+
+	ttl := defaultHoldTTL
+	if req.TTLSeconds > 0 {
+		ttl = time.Duration(req.TTLSeconds) * time.Second
+	}
+
+	// A hold is a debit waiting to be captured, so it counts against spending limits
+	hold, err := s.repo.PlaceHold(ctx, req.UserID, req.Amount, req.PaymentID, time.Now().Add(ttl), s.defaultLimits(req.Amount.Currency))
+	if errors.Is(err, repository.ErrHoldExists) {
+		// A concurrent retry of the same request committed first
+		if existing, err = s.repo.GetHold(ctx, req.UserID, req.PaymentID); err != nil {
+			return nil, err
+		}
+		return s.replayHold(ctx, existing, req.Amount)
+	}
+	if err != nil {
+		s.logger.Error("Failed to hold wallet funds", err, map[string]interface{}{
+			"userId":    req.UserID,
+			"amount":    req.Amount,
+			"paymentId": req.PaymentID,
+		})
+		return nil, err
+	}
+
+	s.logger.Info("Wallet funds held", map[string]interface{}{
+		"userId":    req.UserID,
+		"amount":    req.Amount,
+		"paymentId": req.PaymentID,
+		"expiresAt": hold.ExpiresAt,
+	})
+
+	return s.holdResult(ctx, hold)
+}
+
+// Capture debits the funds held for a payment. Capturing an already captured
+// hold returns the original transaction.
+func (s *WalletService) Capture(ctx context.Context, req CaptureRequest) (*TransactionResult, error) {
+	if req.UserID == "" {
+		return nil, fmt.Errorf("userID is required")
+	}
+	if req.PaymentID == "" {
+		return nil, fmt.Errorf("paymentID is required")
+	}
+
+	hold, err := s.repo.GetHold(ctx, req.UserID, req.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+	if hold == nil {
+		return nil, apperrors.NewNotFoundError("hold")
+	}
+
+	switch {
+	case hold.Status == types.HoldStatusCaptured:
+		return s.replayTransaction(ctx, req.UserID, req.PaymentID, types.TransactionTypeDebit, hold.Amount)
+	case hold.Status != types.HoldStatusHeld:
+		return nil, apperrors.NewHoldNotActiveError(req.PaymentID, string(hold.Status))
+	case time.Now().After(hold.ExpiresAt):
+		if _, err := s.repo.ReleaseHold(ctx, hold, types.HoldStatusExpired); err != nil && !errors.Is(err, repository.ErrHoldNotActive) {
+			return nil, err
+		}
+		return nil, apperrors.NewHoldNotActiveError(req.PaymentID, string(types.HoldStatusExpired))
+	}
+
+	transaction, err := s.repo.CaptureHold(ctx, hold)
+	if errors.Is(err, repository.ErrTransactionExists) {
+		// The payment was already debited, by a concurrent capture or directly
+		return s.replayTransaction(ctx, req.UserID, req.PaymentID, types.TransactionTypeDebit, hold.Amount)
+	}
+	if errors.Is(err, repository.ErrHoldNotActive) {
+		return nil, s.holdNotActiveError(ctx, req.UserID, req.PaymentID)
+	}
+	if err != nil {
+		s.logger.Error("Failed to capture wallet hold", err, map[string]interface{}{
+			"userId":    req.UserID,
+			"paymentId": req.PaymentID,
+		})
+		return nil, err
+	}
+
+	wallet, err := s.repo.GetWallet(ctx, req.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get updated wallet: %w", err)
+	}
+
+	s.logger.Info("Wallet hold captured", map[string]interface{}{
+		"userId":     req.UserID,
+		"amount":     hold.Amount,
+		"newBalance": wallet.Balance,
+		"paymentId":  req.PaymentID,
+	})
+
+	return &TransactionResult{
+		Wallet:      wallet,
+		Transaction: transaction,
+	}, nil
+}
+
+// Release gives the funds held for a payment back to the available balance.
+// Releasing a hold that is already released or expired is a no-op.
+func (s *WalletService) Release(ctx context.Context, req ReleaseRequest) (*HoldResult, error) {
+	if req.UserID == "" {
+		return nil, fmt.Errorf("userID is required")
+	}
+	if req.PaymentID == "" {
+		return nil, fmt.Errorf("paymentID is required")
+	}
+
+	hold, err := s.repo.GetHold(ctx, req.UserID, req.PaymentID)
+	if err != nil {
+		return nil, err
+	}
+	if hold == nil {
+		return nil, apperrors.NewNotFoundError("hold")
+	}
+
+	switch hold.Status {
+	case types.HoldStatusReleased, types.HoldStatusExpired:
+		return s.holdResult(ctx, hold)
+	case types.HoldStatusCaptured:
+		return nil, apperrors.NewHoldNotActiveError(req.PaymentID, string(hold.Status))
+	}
+
+	released, err := s.repo.ReleaseHold(ctx, hold, types.HoldStatusReleased)
+	if errors.Is(err, repository.ErrHoldNotActive) {
+		return nil, s.holdNotActiveError(ctx, req.UserID, req.PaymentID)
+	}
+	if err != nil {
+		s.logger.Error("Failed to release wallet hold", err, map[string]interface{}{
+			"userId":    req.UserID,
+			"paymentId": req.PaymentID,
+		})
+		return nil, err
+	}
+
+	s.logger.Info("Wallet hold released", map[string]interface{}{
+		"userId":    req.UserID,
+		"amount":    hold.Amount,
+		"paymentId": req.PaymentID,
+		"reason":    req.Reason,
+	})
+
+	return s.holdResult(ctx, released)
+}
+
+// ReleaseExpiredHolds releases one batch of holds whose expiry has passed and
+// returns how many were released. It is run on a schedule.
+func (s *WalletService) ReleaseExpiredHolds(ctx context.Context) (int, error) {
+	holds, err := s.repo.ListExpiredHolds(ctx, time.Now(), expiredHoldBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for i := range holds {
+		hold := &holds[i]
+		if _, err := s.repo.ReleaseHold(ctx, hold, types.HoldStatusExpired); err != nil {
+			// Captured or released concurrently, or retried on the next sweep
+			if !errors.Is(err, repository.ErrHoldNotActive) {
+				s.logger.Error("Failed to release expired hold", err, map[string]interface{}{
+					"userId":    hold.UserID,
+					"paymentId": hold.PaymentID,
+				})
+			}
+			continue
+		}
+		released++
+	}
+
+	s.logger.Info("Expired wallet holds released", map[string]interface{}{
+		"expired":  len(holds),
+		"released": released,
+	})
+
+	return released, nil
+}
+
+// replayHold returns an existing hold for a repeated hold request. A repeat
+// with a different amount is rejected rather than replayed.
+func (s *WalletService) replayHold(ctx context.Context, hold *types.WalletHold, amount types.Money) (*HoldResult, error) {
+	if hold.Amount != amount {
+		return nil, apperrors.NewDuplicatePaymentError(hold.PaymentID)
+	}
+	if hold.Status != types.HoldStatusHeld && hold.Status != types.HoldStatusCaptured {
+		return nil, apperrors.NewHoldNotActiveError(hold.PaymentID, string(hold.Status))
+	}
+	return s.holdResult(ctx, hold)
+}
+
+// holdNotActiveError reports the status a hold was moved to by a concurrent
+// capture, release or expiry
+func (s *WalletService) holdNotActiveError(ctx context.Context, userID, paymentID string) error {
+	hold, err := s.repo.GetHold(ctx, userID, paymentID)
+	if err != nil {
+		return err
+	}
+	if hold == nil {
+		return apperrors.NewNotFoundError("hold")
+	}
+	return apperrors.NewHoldNotActiveError(paymentID, string(hold.Status))
+}
+
+// holdResult pairs a hold with the current state of its wallet
+func (s *WalletService) holdResult(ctx context.Context, hold *types.WalletHold) (*HoldResult, error) {
+	wallet, err := s.repo.GetWallet(ctx, hold.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet: %w", err)
+	}
+
+	return &HoldResult{
+		Wallet: wallet,
+		Hold:   hold,
+	}, nil
+}
+
+// validateHoldRequest validates hold request
+func (s *WalletService) validateHoldRequest(req HoldRequest) error {
+	if req.UserID == "" {
+		return fmt.Errorf("userID is required")
+	}
+	if !req.Amount.IsPositive() {
+		return fmt.Errorf("amount must be greater than 0")
+	}
+	if len(req.Amount.Currency) != 3 {
+		return fmt.Errorf("invalid currency format")
+	}
+	if req.PaymentID == "" {
+		return fmt.Errorf("paymentID is required")
+	}
+	if req.TTLSeconds < 0 || time.Duration(req.TTLSeconds)*time.Second > maxHoldTTL {
+		return fmt.Errorf("ttlSeconds must be between 0 and %d", int64(maxHoldTTL/time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/ledger"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// WalletAccount is a user's wallet next to its ledger account. The stored
+// balance is a projection of the account: every wallet-service and refund
+// credit or debit posts its journal entry in the same write that changes the
+// balance, so the two differ only for changes made before the ledger existed.
+type WalletAccount struct {
+	UserID        string         `json:"userId"`
+	Account       ledger.Account `json:"account"`
+	Balance       types.Money    `json:"balance"`
+	LedgerBalance types.Money    `json:"ledgerBalance"`
+	Difference    types.Money    `json:"difference"`
+	InBalance     bool           `json:"inBalance"`
+	Postings      []ledger.Line  `json:"postings"`
+}
+
+// GetWalletAccount returns a user's wallet balance with the balance rebuilt
+// from every posting to the wallet's ledger account
+func (s *WalletService) GetWalletAccount(ctx context.Context, userID string) (*WalletAccount, error) {
+	if userID == "" {
+		return nil, apperrors.NewValidationError("userID is required", nil)
+	}
+
+	wallet, err := s.repo.GetWallet(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ledgerBalance, lines, err := s.repo.GetWalletAccount(ctx, userID, wallet.Balance.Currency)
+	if err != nil {
+		s.logger.Error("Failed to read wallet ledger account", err, map[string]interface{}{
+			"userId": userID,
+		})
+		return nil, err
+	}
+
+	difference, err := wallet.Balance.Sub(ledgerBalance)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WalletAccount{
+		UserID:        userID,
+		Account:       ledger.WalletAccount(userID),
+		Balance:       wallet.Balance,
+		LedgerBalance: ledgerBalance,
+		Difference:    difference,
+		InBalance:     difference.IsZero(),
+		Postings:      lines,
+	}, nil
+}
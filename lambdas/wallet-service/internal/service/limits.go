@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// Spending limit periods, each a calendar day, week or month in UTC
+const (
+	PeriodDaily   = types.SpendingPeriodDaily
+	PeriodWeekly  = types.SpendingPeriodWeekly
+	PeriodMonthly = types.SpendingPeriodMonthly
+)
+
+// SpendingLimitDefaults are the limits, keyed by currency, applied to users
+// without an override for a period. A currency without an entry is unlimited.
+type SpendingLimitDefaults struct {
+	Daily   map[string]types.Money
+	Weekly  map[string]types.Money
+	Monthly map[string]types.Money
+}
+
+// ParseSpendingLimit parses a default limit for one period as a
+// comma-separated list of CURRENCY:AMOUNT pairs, such as "USD:500.00,EUR:450"
+func ParseSpendingLimit(value string) (map[string]types.Money, error) {
+	return parseCurrencyAmounts(value, "spending limit")
+}
+
+// WithSpendingLimits sets the default spending limits
+func (s *WalletService) WithSpendingLimits(defaults SpendingLimitDefaults) *WalletService {
+	s.limits = defaults
+	return s
+}
+
+// SpendingAllowance is how much of a period's limit a user has spent and has left
+type SpendingAllowance struct {
+	Period    string      `json:"period"`
+	Limit     types.Money `json:"limit"`
+	Spent     types.Money `json:"spent"`
+	Remaining types.Money `json:"remaining"`
+}
+
+// SetSpendingLimitsRequest represents a request to override a user's
+// spending limits. An omitted period uses the default limit.
+type SetSpendingLimitsRequest struct {
+	UserID    string       `json:"userId"`
+	Daily     *types.Money `json:"daily,omitempty"`
+	Weekly    *types.Money `json:"weekly,omitempty"`
+	Monthly   *types.Money `json:"monthly,omitempty"`
+	UpdatedBy string       `json:"updatedBy"`
+}
+
+// SpendingLimitsResult is a user's limit overrides and the allowance left in
+// each limited period
+type SpendingLimitsResult struct {
+	UserID     string                `json:"userId"`
+	Overrides  *types.SpendingLimits `json:"overrides,omitempty"`
+	Allowances []SpendingAllowance   `json:"allowances"`
+}
+
+// GetSpendingLimits returns the user's overrides and remaining allowances
+func (s *WalletService) GetSpendingLimits(ctx context.Context, userID string) (*SpendingLimitsResult, error) {
+	if userID == "" {
+		return nil, apperrors.NewValidationError("userID is required", nil)
+	}
+
+	wallet, err := s.repo.GetWallet(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	allowances, err := s.spendingAllowances(ctx, wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SpendingLimitsResult{
+		UserID:     userID,
+		Overrides:  wallet.SpendingLimits,
+		Allowances: allowances,
+	}, nil
+}
+
+// SetSpendingLimits stores per-user overrides of the default limits on the
+// user's wallet. The limits must be in the currency of the wallet.
+func (s *WalletService) SetSpendingLimits(ctx context.Context, req SetSpendingLimitsRequest) (*SpendingLimitsResult, error) {
+	if req.UserID == "" {
+		return nil, apperrors.NewValidationError("userID is required", nil)
+	}
+	if req.UpdatedBy == "" {
+		return nil, apperrors.NewValidationError("updatedBy is required", nil)
+	}
+
+	wallet, err := s.repo.GetWallet(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	limits := map[string]*types.Money{
+		PeriodDaily:   req.Daily,
+		PeriodWeekly:  req.Weekly,
+		PeriodMonthly: req.Monthly,
+	}
+	for _, period := range types.SpendingPeriods {
+		limit := limits[period]
+		if limit == nil {
+			continue
+		}
+		if limit.IsNegative() {
+			return nil, apperrors.NewValidationError(period+" limit must not be negative", nil)
+		}
+		if !limit.SameCurrency(wallet.Balance) {
+			return nil, apperrors.NewCurrencyMismatchError(wallet.Balance.Currency, limit.Currency)
+		}
+	}
+
+	overrides := &types.SpendingLimits{
+		UserID:    req.UserID,
+		Daily:     req.Daily,
+		Weekly:    req.Weekly,
+		Monthly:   req.Monthly,
+		UpdatedBy: req.UpdatedBy,
+		UpdatedAt: time.Now().UTC(),
+	}
+	wallet, err = s.repo.SetSpendingLimits(ctx, overrides, s.defaultLimits(wallet.Balance.Currency))
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("Spending limits updated", map[string]interface{}{
+		"userId":    req.UserID,
+		"daily":     req.Daily,
+		"weekly":    req.Weekly,
+		"monthly":   req.Monthly,
+		"updatedBy": req.UpdatedBy,
+	})
+
+	allowances, err := s.spendingAllowances(ctx, wallet)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SpendingLimitsResult{
+		UserID:     req.UserID,
+		Overrides:  overrides,
+		Allowances: allowances,
+	}, nil
+}
+
+// CheckSpendingLimits returns a spending limit error if spending amount from
+// wallet now would exceed any of the user's limits. It only reports on the
+// wallet as it was read: debits, holds and transfers check the limits again
+// in the write that counts them, so concurrent ones cannot overshoot.
+func (s *WalletService) CheckSpendingLimits(ctx context.Context, wallet *types.Wallet, amount types.Money) error {
+	allowances, err := s.spendingAllowances(ctx, wallet)
+	if err != nil {
+		return err
+	}
+
+	for _, allowance := range allowances {
+		if amount.SameCurrency(allowance.Remaining) && amount.Amount > allowance.Remaining.Amount {
+			return apperrors.NewSpendingLimitExceededError(allowance.Period, allowance.Limit, allowance.Remaining, amount)
+		}
+	}
+
+	return nil
+}
+
+// spendingAllowances returns the allowance left in every period that has a
+// limit in the wallet's currency, shortest period first. Spending is counted
+// on the wallet by every debit, hold and transfer.
+func (s *WalletService) spendingAllowances(ctx context.Context, wallet *types.Wallet) ([]SpendingAllowance, error) {
+	currency := wallet.Balance.Currency
+	spending, err := s.repo.CurrentSpending(ctx, wallet, s.defaultLimits(currency), time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	allowances := []SpendingAllowance{}
+	for _, period := range types.SpendingPeriods {
+		window := spending.Window(period)
+		if window.Limit == nil {
+			continue
+		}
+
+		allowances = append(allowances, SpendingAllowance{
+			Period:    period,
+			Limit:     types.NewMoney(*window.Limit, currency),
+			Spent:     types.NewMoney(window.Spent, currency),
+			Remaining: types.NewMoney(max(window.Remaining, 0), currency),
+		})
+	}
+
+	return allowances, nil
+}
+
+// defaultLimits returns the default limit of every period that has one in
+// currency, keyed by period
+func (s *WalletService) defaultLimits(currency string) map[string]types.Money {
+	currency = strings.ToUpper(currency)
+	defaults := map[string]map[string]types.Money{
+		PeriodDaily:   s.limits.Daily,
+		PeriodWeekly:  s.limits.Weekly,
+		PeriodMonthly: s.limits.Monthly,
+	}
+
+	limits := map[string]types.Money{}
+	for _, period := range types.SpendingPeriods {
+		if limit, ok := defaults[period][currency]; ok {
+			limits[period] = limit
+		}
+	}
+	return limits
+}
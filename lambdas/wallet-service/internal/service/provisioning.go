@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/draftea-coding-challenge/lambdas/wallet-service/internal/repository"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// defaultWalletCurrency is used when a create wallet request has no currency
+const defaultWalletCurrency = "USD"
+
+// OnboardingGrants maps a currency to the amount credited to every new wallet
+// in that currency. Currencies without an entry start at zero.
+type OnboardingGrants map[string]types.Money
+
+// ParseOnboardingGrants parses a comma-separated list of CURRENCY:AMOUNT
+// pairs with amounts in major units, such as "USD:1000.00,EUR:500". An empty
+// string means no grants.
+func ParseOnboardingGrants(value string) (OnboardingGrants, error) {
+	grants, err := parseCurrencyAmounts(value, "onboarding grant")
+	if err != nil {
+		return nil, err
+	}
+	return OnboardingGrants(grants), nil
+}
+
+// parseCurrencyAmounts parses a comma-separated list of CURRENCY:AMOUNT pairs
+// into non-negative amounts keyed by currency. name describes an entry in errors.
+func parseCurrencyAmounts(value, name string) (map[string]types.Money, error) {
+	amounts := map[string]types.Money{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) != 3 {
+			return nil, fmt.Errorf("invalid %s %q, expected CURRENCY:AMOUNT", name, entry)
+		}
+
+		amount, err := types.ParseMoney(strings.TrimSpace(parts[1]), strings.TrimSpace(parts[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", name, entry, err)
+		}
+		if amount.IsNegative() {
+			return nil, fmt.Errorf("invalid %s %q: amount must not be negative", name, entry)
+		}
+		if _, ok := amounts[amount.Currency]; ok {
+			return nil, fmt.Errorf("duplicate %s for %s", name, amount.Currency)
+		}
+
+		amounts[amount.Currency] = amount
+	}
+
+	return amounts, nil
+}
+
+// WithOnboardingGrants sets the grants credited to wallets created from now on
+func (s *WalletService) WithOnboardingGrants(grants OnboardingGrants) *WalletService {
+	s.grants = grants
+	return s
+}
+
+// CreateWalletRequest represents a request to provision a user's wallet
+type CreateWalletRequest struct {
+	UserID        string `json:"userId"`
+	Currency      string `json:"currency,omitempty"`
+	CorrelationID string `json:"correlationId"`
+}
+
+// CreateWalletResult is the outcome of a create wallet request. Created is
+// false when the user already had a wallet in that currency, which is
+// returned unchanged; Grant is the onboarding grant, if there was one.
+type CreateWalletResult struct {
+	Wallet  *types.Wallet            `json:"wallet"`
+	Grant   *types.WalletTransaction `json:"grant,omitempty"`
+	Created bool                     `json:"created"`
+}
+
+// CreateWallet provisions a wallet for a user in the requested currency,
+// funded with the onboarding grant for that currency. Repeating the request
+// returns the existing wallet without granting again.
+func (s *WalletService) CreateWallet(ctx context.Context, req CreateWalletRequest) (*CreateWalletResult, error) {
+	if req.UserID == "" {
+		return nil, apperrors.NewValidationError("userID is required", nil)
+	}
+
+	currency := strings.ToUpper(req.Currency)
+	if currency == "" {
+		currency = defaultWalletCurrency
+	}
+	if len(currency) != 3 {
+		return nil, apperrors.NewValidationError("invalid currency format", nil)
+	}
+
+	grant, ok := s.grants[currency]
+	if !ok {
+		grant = types.NewMoney(0, currency)
+	}
+
+	now := time.Now()
+	wallet := &types.Wallet{
+		UserID:      req.UserID,
+		Balance:     grant,
+		Held:        types.NewMoney(0, currency),
+		CreditLimit: types.NewMoney(0, currency),
+		Status:      types.WalletStatusActive,
+		Version:     0,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	transaction, err := s.repo.CreateWallet(ctx, wallet)
+	if errors.Is(err, repository.ErrWalletExists) {
+		existing, err := s.repo.GetWallet(ctx, req.UserID)
+		if err != nil {
+			return nil, err
+		}
+		if existing.Balance.Currency != currency {
+			return nil, apperrors.NewWalletExistsError(req.UserID, existing.Balance.Currency)
+		}
+		return &CreateWalletResult{Wallet: existing}, nil
+	}
+	if err != nil {
+		s.logger.Error("Failed to create wallet", err, map[string]interface{}{
+			"userId":   req.UserID,
+			"currency": currency,
+		})
+		return nil, err
+	}
+
+	s.logger.Info("Wallet created", map[string]interface{}{
+		"userId":        req.UserID,
+		"grant":         grant,
+		"correlationId": req.CorrelationID,
+	})
+
+	return &CreateWalletResult{
+		Wallet:  wallet,
+		Grant:   transaction,
+		Created: true,
+	}, nil
+}
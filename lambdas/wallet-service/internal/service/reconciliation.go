@@ -0,0 +1,280 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/draftea-coding-challenge/lambdas/wallet-service/internal/repository"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/google/uuid"
+)
+
+// defaultReconciliationActor is recorded on wallets frozen by a
+// reconciliation run that did not name its actor
+const defaultReconciliationActor = "wallet-reconciliation"
+
+// Reasons a wallet appears in a reconciliation report
+const (
+	DriftBalance  = "BALANCE_MISMATCH"
+	DriftVersion  = "VERSION_MISMATCH"
+	DriftCurrency = "CURRENCY_MISMATCH"
+	DriftNoWallet = "WALLET_MISSING"
+)
+
+// ReconcileRequest represents a reconciliation run. With Freeze set, every
+// settled wallet whose balance does not match its ledger is frozen.
+type ReconcileRequest struct {
+	Freeze bool   `json:"freeze"`
+	Actor  string `json:"actor,omitempty"`
+}
+
+// ReconciliationReport summarises a reconciliation run. Drifts are also
+// stored in the reconciliation reports table under ReportID.
+type ReconciliationReport struct {
+	ReportID       string              `json:"reportId"`
+	StartedAt      time.Time           `json:"startedAt"`
+	FinishedAt     time.Time           `json:"finishedAt"`
+	WalletsChecked int                 `json:"walletsChecked"`
+	EventsReplayed int                 `json:"eventsReplayed"`
+	Frozen         int                 `json:"frozen"`
+	Drifts         []types.WalletDrift `json:"drifts"`
+}
+
+// ReconcileWallets replays every wallet ledger event and compares each
+// wallet's stored balance and Version with the replayed ones. A wallet's
+// Version is bumped once by every ledger event except its creation, and a
+// transfer counts for both wallets.
+//
+// Both tables are scanned while writes go on. A wallet written after the run
+// started is reported as not settled, since its difference may be a write the
+// replay missed, and is never frozen. Refunds are credited by refund-service,
+// which records them with a wallet.credited event like wallet-service does.
+func (s *WalletService) ReconcileWallets(ctx context.Context, req ReconcileRequest) (*ReconciliationReport, error) {
+	report := &ReconciliationReport{
+		ReportID:  uuid.New().String(),
+		StartedAt: time.Now().UTC(),
+		Drifts:    []types.WalletDrift{},
+	}
+
+	replay := ledgerReplay{}
+	err := s.repo.ScanLedgerEvents(ctx, func(events []types.PaymentEvent) error {
+		for _, event := range events {
+			replay.apply(event)
+		}
+		report.EventsReplayed += len(events)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// UpdatedAt is stored to the second
+	settledBefore := report.StartedAt.Truncate(time.Second)
+	err = s.repo.ScanWallets(ctx, func(wallets []types.Wallet) error {
+		for _, wallet := range wallets {
+			report.WalletsChecked++
+			if drift := replay.compare(wallet); drift != nil {
+				drift.Settled = wallet.UpdatedAt.Before(settledBefore)
+				report.Drifts = append(report.Drifts, *drift)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	report.Drifts = append(report.Drifts, replay.unmatched()...)
+
+	actor := req.Actor
+	if actor == "" {
+		actor = defaultReconciliationActor
+	}
+	for i := range report.Drifts {
+		drift := &report.Drifts[i]
+		drift.ReportID = report.ReportID
+		drift.DetectedAt = report.StartedAt
+
+		if req.Freeze && drift.Settled && drift.HasReason(DriftBalance) {
+			drift.Frozen = s.freezeDrifted(ctx, drift, actor)
+			if drift.Frozen {
+				report.Frozen++
+			}
+		}
+
+		if err := s.repo.PutWalletDrift(ctx, drift); err != nil {
+			return nil, err
+		}
+	}
+	report.FinishedAt = time.Now().UTC()
+
+	s.logger.Info("Wallet reconciliation completed", map[string]interface{}{
+		"reportId":       report.ReportID,
+		"walletsChecked": report.WalletsChecked,
+		"eventsReplayed": report.EventsReplayed,
+		"drifts":         len(report.Drifts),
+		"frozen":         report.Frozen,
+	})
+
+	return report, nil
+}
+
+// freezeDrifted freezes a wallet whose balance drifted, and reports whether
+// it is frozen now
+func (s *WalletService) freezeDrifted(ctx context.Context, drift *types.WalletDrift, actor string) bool {
+	reason := fmt.Sprintf("reconciliation %s: balance %s, ledger %s", drift.ReportID, drift.StoredBalance, drift.ReplayedBalance)
+	_, err := s.repo.SetWalletStatus(ctx, drift.UserID, types.WalletStatusFrozen, reason, actor)
+	if err == nil || errors.Is(err, repository.ErrStatusUnchanged) {
+		return true
+	}
+
+	// A closed wallet stays closed, which blocks it as well
+	var appErr *apperrors.AppError
+	if !errors.As(err, &appErr) || appErr.Code != apperrors.ErrCodeWalletNotActive {
+		s.logger.Error("Failed to freeze drifted wallet", err, map[string]interface{}{
+			"reportId": drift.ReportID,
+			"userId":   drift.UserID,
+		})
+	}
+	return false
+}
+
+// replayedWallet is a wallet's balance and Version as rebuilt from its events
+type replayedWallet struct {
+	balance       types.Money
+	version       int
+	events        int
+	mixedCurrency bool
+	matched       bool
+}
+
+// ledgerReplay rebuilds every wallet from its ledger events, keyed by user
+type ledgerReplay map[string]*replayedWallet
+
+// apply adds one ledger event to the wallets it changed. Other events, such
+// as a payment's REFUNDED event next to its wallet.credited one, are ignored.
+// A transfer is replayed for both wallets from the sender's
+// wallet.transferred event, which transfers written before the receiver had
+// an event of its own also have, so the receiver's wallet.credited event for
+// it is skipped.
+func (l ledgerReplay) apply(event types.PaymentEvent) {
+	switch types.EventType(event.EventType) {
+	case types.EventWalletCreated:
+		l.add(event.UserID, &event.Amount, 0)
+	case types.EventWalletDebited:
+		debit := event.Amount.Neg()
+		l.add(event.UserID, &debit, 1)
+	case types.EventWalletCredited, types.EventWalletDeposited:
+		if transactionType, _ := event.Metadata["type"].(string); transactionType == types.TransactionTypeTransferIn {
+			return
+		}
+		l.add(event.UserID, &event.Amount, 1)
+	case types.EventWalletTransferred:
+		out := event.Amount.Neg()
+		l.add(event.UserID, &out, 1)
+		if counterparty, _ := event.Metadata["counterpartyId"].(string); counterparty != "" {
+			l.add(counterparty, &event.Amount, 1)
+		}
+	case types.EventWalletHoldPlaced, types.EventWalletHoldReleased,
+		types.EventWalletStatusChanged, types.EventWalletCreditLimitSet:
+		// Bump Version without moving the balance
+		l.add(event.UserID, nil, 1)
+	}
+}
+
+func (l ledgerReplay) add(userID string, delta *types.Money, versions int) {
+	wallet, ok := l[userID]
+	if !ok {
+		wallet = &replayedWallet{}
+		l[userID] = wallet
+	}
+	wallet.version += versions
+	wallet.events++
+
+	if delta == nil {
+		return
+	}
+	if wallet.balance.Currency == "" {
+		wallet.balance = types.NewMoney(0, delta.Currency)
+	}
+	balance, err := wallet.balance.Add(*delta)
+	if err != nil {
+		wallet.mixedCurrency = true
+		return
+	}
+	wallet.balance = balance
+}
+
+// compare returns the drift between a stored wallet and its replay, or nil
+// if they match
+func (l ledgerReplay) compare(wallet types.Wallet) *types.WalletDrift {
+	replayed, ok := l[wallet.UserID]
+	if !ok {
+		replayed = &replayedWallet{}
+	}
+	replayed.matched = true
+
+	balance := replayed.balance
+	if balance.Currency == "" {
+		balance = types.NewMoney(0, wallet.Balance.Currency)
+	}
+	version := replayed.version
+
+	drift := &types.WalletDrift{
+		UserID:          wallet.UserID,
+		StoredBalance:   wallet.Balance,
+		ReplayedBalance: balance,
+		StoredVersion:   wallet.Version,
+		ExpectedVersion: version,
+		Events:          replayed.events,
+		Reasons:         []string{},
+	}
+
+	difference, err := wallet.Balance.Sub(balance)
+	switch {
+	case err != nil || replayed.mixedCurrency:
+		drift.Reasons = append(drift.Reasons, DriftCurrency)
+	case !difference.IsZero():
+		drift.Difference = difference
+		drift.Reasons = append(drift.Reasons, DriftBalance)
+	}
+	if wallet.Version != version {
+		drift.Reasons = append(drift.Reasons, DriftVersion)
+	}
+
+	if len(drift.Reasons) == 0 {
+		return nil
+	}
+	return drift
+}
+
+// unmatched returns a drift for every user with ledger events but no wallet,
+// in user order
+func (l ledgerReplay) unmatched() []types.WalletDrift {
+	var userIDs []string
+	for userID, replayed := range l {
+		if !replayed.matched {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	sort.Strings(userIDs)
+
+	drifts := []types.WalletDrift{}
+	for _, userID := range userIDs {
+		replayed := l[userID]
+		drifts = append(drifts, types.WalletDrift{
+			UserID:          userID,
+			StoredBalance:   types.NewMoney(0, replayed.balance.Currency),
+			ReplayedBalance: replayed.balance,
+			Difference:      replayed.balance.Neg(),
+			ExpectedVersion: replayed.version,
+			Events:          replayed.events,
+			Reasons:         []string{DriftNoWallet},
+			Settled:         true,
+		})
+	}
+	return drifts
+}
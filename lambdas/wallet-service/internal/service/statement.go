@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"time"
+
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// Statement export formats
+const (
+	StatementFormatJSON = "json"
+	StatementFormatCSV  = "csv"
+)
+
+// Row types marking the balances around a statement's transactions in CSV
+const (
+	statementOpeningRow = "OPENING_BALANCE"
+	statementClosingRow = "CLOSING_BALANCE"
+)
+
+// StatementRequest represents a request for a user's wallet statement
+// between From and To, both RFC3339 timestamps. To defaults to now.
+type StatementRequest struct {
+	UserID string `json:"userId"`
+	From   string `json:"from"`
+	To     string `json:"to,omitempty"`
+}
+
+// Statement is a user's wallet activity over a period, oldest first, with
+// the balance before its first transaction and after its last one
+type Statement struct {
+	UserID         string                    `json:"userId"`
+	From           time.Time                 `json:"from"`
+	To             time.Time                 `json:"to"`
+	OpeningBalance types.Money               `json:"openingBalance"`
+	ClosingBalance types.Money               `json:"closingBalance"`
+	TotalDebits    types.Money               `json:"totalDebits"`
+	TotalCredits   types.Money               `json:"totalCredits"`
+	Transactions   []types.WalletTransaction `json:"transactions"`
+}
+
+// GetStatement builds the user's statement for a period. The opening balance
+// is not read from the wallet but computed by replaying every stored
+// transaction before From, so a statement can start at any past timestamp.
+// Every balance change writes a WalletTransactions row, including refunds
+// credited by refund-service. The balance before and after each transaction
+// is replayed too, since single-write debits and credits do not record it.
+func (s *WalletService) GetStatement(ctx context.Context, req StatementRequest) (*Statement, error) {
+	from, to, err := s.validateStatementRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := s.repo.GetWallet(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, err := s.repo.ListTransactionsUntil(ctx, req.UserID, to)
+	if err != nil {
+		s.logger.Error("Failed to list wallet transactions", err, map[string]interface{}{
+			"userId": req.UserID,
+		})
+		return nil, err
+	}
+
+	currency := wallet.Balance.Currency
+	statement := &Statement{
+		UserID:         req.UserID,
+		From:           from,
+		To:             to,
+		OpeningBalance: types.NewMoney(0, currency),
+		TotalDebits:    types.NewMoney(0, currency),
+		TotalCredits:   types.NewMoney(0, currency),
+		Transactions:   []types.WalletTransaction{},
+	}
+
+	for _, transaction := range transactions {
+		if transaction.Timestamp.Before(from) {
+			if statement.OpeningBalance, err = statement.OpeningBalance.Add(transaction.Delta()); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		total := &statement.TotalCredits
+		if transaction.Delta().IsNegative() {
+			total = &statement.TotalDebits
+		}
+		if *total, err = total.Add(transaction.Amount); err != nil {
+			return nil, err
+		}
+		statement.Transactions = append(statement.Transactions, transaction)
+	}
+
+	statement.ClosingBalance, err = replayBalance(statement.OpeningBalance, statement.Transactions)
+	if err != nil {
+		return nil, err
+	}
+
+	return statement, nil
+}
+
+// replayBalance applies transactions, in order, to opening, and sets the
+// balance before and after each one on it
+func replayBalance(opening types.Money, transactions []types.WalletTransaction) (types.Money, error) {
+	balance := opening
+	for i := range transactions {
+		before := balance
+		next, err := balance.Add(transactions[i].Delta())
+		if err != nil {
+			return types.Money{}, err
+		}
+		balance = next
+		transactions[i].BalanceBefore, transactions[i].BalanceAfter = &before, &next
+	}
+	return balance, nil
+}
+
+// WriteCSV writes the statement as CSV with amounts in major units. The
+// opening and closing balances are the first and last rows.
+func (st *Statement) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	rows := [][]string{
+		{"timestamp", "type", "paymentId", "transferId", "counterpartyId", "amount", "balanceBefore", "balanceAfter", "currency"},
+		{st.From.Format(time.RFC3339), statementOpeningRow, "", "", "", "", "", st.OpeningBalance.Decimal(), st.OpeningBalance.Currency},
+	}
+	for _, transaction := range st.Transactions {
+		rows = append(rows, []string{
+			transaction.Timestamp.Format(time.RFC3339Nano),
+			transaction.Type,
+			transaction.PaymentID,
+			transaction.TransferID,
+			transaction.CounterpartyID,
+			transaction.Delta().Decimal(),
+			statementBalance(transaction.BalanceBefore),
+			statementBalance(transaction.BalanceAfter),
+			transaction.Amount.Currency,
+		})
+	}
+	rows = append(rows, []string{st.To.Format(time.RFC3339), statementClosingRow, "", "", "", "", "", st.ClosingBalance.Decimal(), st.ClosingBalance.Currency})
+
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// statementBalance formats a transaction's balance for CSV, or leaves it
+// empty when it is unknown
+func statementBalance(balance *types.Money) string {
+	if balance == nil {
+		return ""
+	}
+	return balance.Decimal()
+}
+
+// validateStatementRequest validates a statement request and parses its period
+func (s *WalletService) validateStatementRequest(req StatementRequest) (time.Time, time.Time, error) {
+	if req.UserID == "" {
+		return time.Time{}, time.Time{}, apperrors.NewValidationError("userID is required", nil)
+	}
+	if req.From == "" {
+		return time.Time{}, time.Time{}, apperrors.NewValidationError("from is required", nil)
+	}
+
+	from, err := time.Parse(time.RFC3339, req.From)
+	if err != nil {
+		return time.Time{}, time.Time{}, apperrors.NewValidationError("invalid from timestamp, expected RFC3339", nil)
+	}
+	to := time.Now().UTC()
+	if req.To != "" {
+		if to, err = time.Parse(time.RFC3339, req.To); err != nil {
+			return time.Time{}, time.Time{}, apperrors.NewValidationError("invalid to timestamp, expected RFC3339", nil)
+		}
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, apperrors.NewValidationError("from must not be after to", nil)
+	}
+
+	return from, to, nil
+}
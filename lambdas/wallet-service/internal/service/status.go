@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/draftea-coding-challenge/lambdas/wallet-service/internal/repository"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// SetWalletStatusRequest represents an administrative change of a wallet's
+// status. Reason and Actor are required and recorded with the change.
+type SetWalletStatusRequest struct {
+	UserID        string             `json:"userId"`
+	Status        types.WalletStatus `json:"status"`
+	Reason        string             `json:"reason"`
+	Actor         string             `json:"actor"`
+	CorrelationID string             `json:"correlationId"`
+}
+
+// SetWalletStatus freezes, unfreezes or closes a user's wallet. A frozen
+// wallet accepts credits but no debits; a closed one accepts neither and
+// cannot be reopened. Requesting the status the wallet already has returns it
+// unchanged.
+func (s *WalletService) SetWalletStatus(ctx context.Context, req SetWalletStatusRequest) (*types.Wallet, error) {
+	req.Status = types.WalletStatus(strings.ToUpper(string(req.Status)))
+	if err := s.validateSetWalletStatusRequest(req); err != nil {
+		return nil, err
+	}
+
+	wallet, err := s.repo.SetWalletStatus(ctx, req.UserID, req.Status, req.Reason, req.Actor)
+	if errors.Is(err, repository.ErrStatusUnchanged) {
+		return s.repo.GetWallet(ctx, req.UserID)
+	}
+	if err != nil {
+		s.logger.Error("Failed to change wallet status", err, map[string]interface{}{
+			"userId": req.UserID,
+			"status": req.Status,
+			"actor":  req.Actor,
+		})
+		return nil, err
+	}
+
+	s.logger.Info("Wallet status changed", map[string]interface{}{
+		"userId":        req.UserID,
+		"status":        req.Status,
+		"reason":        req.Reason,
+		"actor":         req.Actor,
+		"correlationId": req.CorrelationID,
+	})
+
+	return wallet, nil
+}
+
+// validateSetWalletStatusRequest validates set wallet status request
+func (s *WalletService) validateSetWalletStatusRequest(req SetWalletStatusRequest) error {
+	if req.UserID == "" {
+		return apperrors.NewValidationError("userID is required", nil)
+	}
+	if !req.Status.IsValid() {
+		return apperrors.NewValidationError("status must be ACTIVE, FROZEN or CLOSED", map[string]interface{}{
+			"status": req.Status,
+		})
+	}
+	if strings.TrimSpace(req.Reason) == "" {
+		return apperrors.NewValidationError("reason is required", nil)
+	}
+	if strings.TrimSpace(req.Actor) == "" {
+		return apperrors.NewValidationError("actor is required", nil)
+	}
+	return nil
+}
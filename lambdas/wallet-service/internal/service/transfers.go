@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// TransferRequest represents a transfer between two users' wallets.
+// TransferID is chosen by the caller and makes the transfer idempotent.
+type TransferRequest struct {
+	TransferID    string      `json:"transferId"`
+	FromUserID    string      `json:"fromUserId"`
+	ToUserID      string      `json:"toUserId"`
+	Amount        types.Money `json:"amount"`
+	CorrelationID string      `json:"correlationId"`
+}
+
+// TransferResult is the outcome of a transfer: both legs, and the sender's
+// wallet as the transfer left it. Replayed is set when the request repeated
+// an already applied transfer and no balance changed.
+type TransferResult struct {
+	TransferID string                   `json:"transferId"`
+	Wallet     *types.Wallet            `json:"wallet"`
+	Out        *types.WalletTransaction `json:"out"`
+	In         *types.WalletTransaction `json:"in"`
+	Replayed   bool                     `json:"replayed"`
+}
+
+// Transfer moves amount from one user's wallet to another's atomically. Both
+// wallets must hold the transfer's currency. Each transfer is applied at most
+// once: repeating a request returns the original legs.
+func (s *WalletService) Transfer(ctx context.Context, req TransferRequest) (*TransferResult, error) {
+	if err := s.validateTransferRequest(req); err != nil {
+		return nil, err
+	}
+
+	// Money sent to another user counts against the sender's spending limits
+	out, in, wallet, err := s.repo.Transfer(ctx, req.FromUserID, req.ToUserID, req.Amount, req.TransferID, s.defaultLimits(req.Amount.Currency))
+	if err != nil {
+		// A repeated transfer is replayed, even if the sender could not cover it again
+		if result, replayErr := s.replayTransfer(ctx, req); result != nil || replayErr != nil {
+			return result, replayErr
+		}
+		s.logger.Error("Failed to transfer between wallets", err, map[string]interface{}{
+			"transferId": req.TransferID,
+			"fromUserId": req.FromUserID,
+			"toUserId":   req.ToUserID,
+			"amount":     req.Amount,
+		})
+		return nil, err
+	}
+
+	s.logger.Info("Wallet transfer completed", map[string]interface{}{
+		"transferId":    req.TransferID,
+		"fromUserId":    req.FromUserID,
+		"toUserId":      req.ToUserID,
+		"amount":        req.Amount,
+		"newBalance":    wallet.Balance,
+		"correlationId": req.CorrelationID,
+	})
+
+	return &TransferResult{
+		TransferID: req.TransferID,
+		Wallet:     wallet,
+		Out:        out,
+		In:         in,
+	}, nil
+}
+
+// replayTransfer returns the already committed legs of a transfer, or nil if
+// it has not been applied yet. A repeat with a different amount or recipient
+// is rejected rather than replayed.
+func (s *WalletService) replayTransfer(ctx context.Context, req TransferRequest) (*TransferResult, error) {
+	out, err := s.repo.GetTransaction(ctx, req.FromUserID, req.TransferID, types.TransactionTypeTransferOut)
+	if err != nil || out == nil {
+		return nil, err
+	}
+
+	if out.Amount != req.Amount || out.CounterpartyID != req.ToUserID {
+		return nil, apperrors.NewDuplicatePaymentError(req.TransferID)
+	}
+
+	in, err := s.repo.GetTransaction(ctx, req.ToUserID, req.TransferID, types.TransactionTypeTransferIn)
+	if err != nil {
+		return nil, err
+	}
+
+	wallet, err := s.repo.GetWallet(ctx, req.FromUserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet: %w", err)
+	}
+
+	s.logger.Info("Replaying wallet transfer", map[string]interface{}{
+		"transferId": req.TransferID,
+		"fromUserId": req.FromUserID,
+		"toUserId":   req.ToUserID,
+	})
+
+	return &TransferResult{
+		TransferID: req.TransferID,
+		Wallet:     wallet,
+		Out:        out,
+		In:         in,
+		Replayed:   true,
+	}, nil
+}
+
+// validateTransferRequest validates transfer request
+func (s *WalletService) validateTransferRequest(req TransferRequest) error {
+	if req.TransferID == "" {
+		return apperrors.NewValidationError("transferId is required", nil)
+	}
+	if req.FromUserID == "" {
+		return apperrors.NewValidationError("fromUserId is required", nil)
+	}
+	if req.ToUserID == "" {
+		return apperrors.NewValidationError("toUserId is required", nil)
+	}
+	if req.FromUserID == req.ToUserID {
+		return apperrors.NewValidationError("cannot transfer to the same wallet", nil)
+	}
+	if !req.Amount.IsPositive() {
+		return apperrors.NewValidationError("amount must be greater than 0", nil)
+	}
+	if len(req.Amount.Currency) != 3 {
+		return apperrors.NewValidationError("invalid currency format", nil)
+	}
+	return nil
+}
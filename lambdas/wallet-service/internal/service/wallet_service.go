@@ -3,16 +3,26 @@ package service
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/draftea-coding-challenge/lambdas/wallet-service/internal/repository"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
 	"github.com/draftea-coding-challenge/shared/observability"
 	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/draftea-coding-challenge/shared/utils"
+)
+
+const (
+	defaultTransactionPageSize = 50
+	maxTransactionPageSize     = 100
 )
 
 // WalletService handles business logic for wallets
 type WalletService struct {
 	repo   *repository.WalletRepository
 	logger *observability.Logger
+	grants OnboardingGrants
+	limits SpendingLimitDefaults
 }
 
 // NewWalletService creates a new wallet service
@@ -25,53 +35,63 @@ func NewWalletService(repo *repository.WalletRepository, logger *observability.L
 
 // DebitRequest represents a wallet debit request
 type DebitRequest struct {
-	UserID        string `json:"userId"`
-	Amount        float64 `json:"amount"`
-	PaymentID     string `json:"paymentId"`
-	CorrelationID string `json:"correlationId"`
+	UserID        string      `json:"userId"`
+	Amount        types.Money `json:"amount"`
+	PaymentID     string      `json:"paymentId"`
+	CorrelationID string      `json:"correlationId"`
 }
 
 // CreditRequest represents a wallet credit request
 type CreditRequest struct {
-	UserID        string `json:"userId"`
-	Amount        float64 `json:"amount"`
-	PaymentID     string `json:"paymentId"`
-	CorrelationID string `json:"correlationId"`
-	RefundReason  string `json:"refundReason,omitempty"`
+	UserID        string      `json:"userId"`
+	Amount        types.Money `json:"amount"`
+	PaymentID     string      `json:"paymentId"`
+	CorrelationID string      `json:"correlationId"`
+	RefundReason  string      `json:"refundReason,omitempty"`
 }
 
-// DebitWallet debits amount from user's wallet
-func (s *WalletService) DebitWallet(ctx context.Context, req DebitRequest) (*types.Wallet, error) {
+// TransactionResult is the outcome of a debit or credit. Replayed is set when
+// the request repeated an already applied payment and the balance was left unchanged.
+// Wallet is omitted when a single write applied the transaction without reading it.
+type TransactionResult struct {
+	Wallet      *types.Wallet            `json:"wallet,omitempty"`
+	Transaction *types.WalletTransaction `json:"transaction"`
+	Replayed    bool                     `json:"replayed"`
+}
+
+// ListTransactionsRequest represents a wallet transaction history query.
+// From and To are RFC3339 timestamps; Cursor is the NextCursor of a previous page.
+type ListTransactionsRequest struct {
+	UserID string `json:"userId"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Type   string `json:"type,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+	Limit  int64  `json:"limit,omitempty"`
+}
+
+// TransactionHistory is a page of wallet transactions, newest first
+type TransactionHistory struct {
+	Transactions []types.WalletTransaction `json:"transactions"`
+	NextCursor   string                    `json:"nextCursor,omitempty"`
+}
+
+// DebitWallet debits amount from user's wallet. Each payment is debited at
+// most once: repeating a request returns the original transaction.
+func (s *WalletService) DebitWallet(ctx context.Context, req DebitRequest) (*TransactionResult, error) {
 	// Validate request
 	if err := s.validateDebitRequest(req); err != nil {
 		return nil, err
 	}
 
-	// Get or create wallet
-	wallet, err := s.repo.GetWallet(ctx, req.UserID)
+	// Perform debit, within the user's spending limits; the repository
+	// returns the wallet as the debit left it
+	transaction, wallet, err := s.repo.DebitWallet(ctx, req.UserID, req.Amount, req.PaymentID, s.defaultLimits(req.Amount.Currency))
 	if err != nil {
-		// Create wallet if not exists
-		wallet = &types.Wallet{
-			UserID:  req.UserID,
-			Balance: 0,
-			Version: 0,
-		}
-		if err := s.repo.CreateWallet(ctx, wallet); err != nil {
-			s.logger.Error("Failed to create wallet", err, map[string]interface{}{
-				"userId": req.UserID,
-			})
-			return nil, fmt.Errorf("failed to create wallet: %w", err)
+		// A repeated payment is replayed, even if the wallet could not cover it again
+		if result, replayErr := s.replayTransaction(ctx, req.UserID, req.PaymentID, types.TransactionTypeDebit, req.Amount); result != nil || replayErr != nil {
+			return result, replayErr
 		}
-	}
-
-	// Check balance
-	if wallet.Balance < req.Amount {
-		return nil, fmt.Errorf("insufficient balance: available %f, required %f", wallet.Balance, req.Amount)
-	}
-
-	// Perform debit
-	_, err = s.repo.DebitWallet(ctx, req.UserID, req.Amount, req.PaymentID)
-	if err != nil {
 		s.logger.Error("Failed to debit wallet", err, map[string]interface{}{
 			"userId":    req.UserID,
 			"amount":    req.Amount,
@@ -80,49 +100,34 @@ func (s *WalletService) DebitWallet(ctx context.Context, req DebitRequest) (*typ
 		return nil, err
 	}
 
-	// Get updated wallet
-	updatedWallet, err := s.repo.GetWallet(ctx, req.UserID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get updated wallet: %w", err)
-	}
-
 	s.logger.Info("Wallet debited successfully", map[string]interface{}{
-		"userId":     req.UserID,
-		"amount":     req.Amount,
-		"newBalance": updatedWallet.Balance,
-		"paymentId":  req.PaymentID,
+		"userId":        req.UserID,
+		"amount":        req.Amount,
+		"transactionId": transaction.ID,
+		"paymentId":     req.PaymentID,
 	})
 
-	return updatedWallet, nil
+	return &TransactionResult{
+		Wallet:      wallet,
+		Transaction: transaction,
+	}, nil
 }
 
-// CreditWallet credits amount to user's wallet
-func (s *WalletService) CreditWallet(ctx context.Context, req CreditRequest) (*types.Wallet, error) {
+// CreditWallet credits amount to user's wallet. Each payment is credited at
+// most once: repeating a request returns the original transaction.
+func (s *WalletService) CreditWallet(ctx context.Context, req CreditRequest) (*TransactionResult, error) {
 	// Validate request
 	if err := s.validateCreditRequest(req); err != nil {
 		return nil, err
 	}
 
-	// Get or create wallet
-	wallet, err := s.repo.GetWallet(ctx, req.UserID)
+	// Perform credit; the repository returns the wallet as the credit left it
+	transaction, wallet, err := s.repo.CreditWallet(ctx, req.UserID, req.Amount, req.PaymentID)
 	if err != nil {
-		// Create wallet if not exists
-		wallet = &types.Wallet{
-			UserID:  req.UserID,
-			Balance: 0,
-			Version: 0,
+		// A repeated payment is replayed rather than credited twice
+		if result, replayErr := s.replayTransaction(ctx, req.UserID, req.PaymentID, types.TransactionTypeCredit, req.Amount); result != nil || replayErr != nil {
+			return result, replayErr
 		}
-		if err := s.repo.CreateWallet(ctx, wallet); err != nil {
-			s.logger.Error("Failed to create wallet", err, map[string]interface{}{
-				"userId": req.UserID,
-			})
-			return nil, fmt.Errorf("failed to create wallet: %w", err)
-		}
-	}
-
-	// Perform credit
-	_, err = s.repo.CreditWallet(ctx, req.UserID, req.Amount, req.PaymentID)
-	if err != nil {
 		s.logger.Error("Failed to credit wallet", err, map[string]interface{}{
 			"userId":    req.UserID,
 			"amount":    req.Amount,
@@ -131,46 +136,140 @@ func (s *WalletService) CreditWallet(ctx context.Context, req CreditRequest) (*t
 		return nil, err
 	}
 
-	// Get updated wallet
-	updatedWallet, err := s.repo.GetWallet(ctx, req.UserID)
+	s.logger.Info("Wallet credited successfully", map[string]interface{}{
+		"userId":        req.UserID,
+		"amount":        req.Amount,
+		"transactionId": transaction.ID,
+		"paymentId":     req.PaymentID,
+		"reason":        req.RefundReason,
+	})
+
+	return &TransactionResult{
+		Wallet:      wallet,
+		Transaction: transaction,
+	}, nil
+}
+
+// replayTransaction returns the already committed transaction for a
+// (user, payment, type), or nil if the payment has not been applied yet.
+// A repeat with a different amount is rejected rather than replayed.
+func (s *WalletService) replayTransaction(ctx context.Context, userID, paymentID, transactionType string, amount types.Money) (*TransactionResult, error) {
+	transaction, err := s.repo.GetTransaction(ctx, userID, paymentID, transactionType)
+	if err != nil || transaction == nil {
+		return nil, err
+	}
+
+	if transaction.Amount != amount {
+		return nil, apperrors.NewDuplicatePaymentError(paymentID)
+	}
+
+	wallet, err := s.repo.GetWallet(ctx, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get updated wallet: %w", err)
+		return nil, fmt.Errorf("failed to get wallet: %w", err)
 	}
 
-	s.logger.Info("Wallet credited successfully", map[string]interface{}{
-		"userId":     req.UserID,
-		"amount":     req.Amount,
-		"newBalance": updatedWallet.Balance,
-		"paymentId":  req.PaymentID,
-		"reason":     req.RefundReason,
+	s.logger.Info("Replaying wallet transaction", map[string]interface{}{
+		"userId":        userID,
+		"paymentId":     paymentID,
+		"type":          transactionType,
+		"transactionId": transaction.ID,
 	})
 
-	return updatedWallet, nil
+	return &TransactionResult{
+		Wallet:      wallet,
+		Transaction: transaction,
+		Replayed:    true,
+	}, nil
 }
 
-// GetBalance retrieves wallet balance for a user
+// GetBalance retrieves wallet balance for a user. A user without a wallet
+// gets a not found error; wallets are provisioned with CreateWallet.
 func (s *WalletService) GetBalance(ctx context.Context, userID string) (*types.Wallet, error) {
 	if userID == "" {
 		return nil, fmt.Errorf("userID is required")
 	}
 
-	wallet, err := s.repo.GetWallet(ctx, userID)
+	return s.repo.GetWallet(ctx, userID)
+}
+
+// ListTransactions returns a page of the user's wallet transaction history
+func (s *WalletService) ListTransactions(ctx context.Context, req ListTransactionsRequest) (*TransactionHistory, error) {
+	query, err := s.buildTransactionQuery(req)
 	if err != nil {
-		// Create wallet if not exists
-		wallet = &types.Wallet{
-			UserID:  userID,
-			Balance: 0,
-			Version: 0,
+		return nil, err
+	}
+
+	page, err := s.repo.ListTransactions(ctx, query)
+	if err != nil {
+		s.logger.Error("Failed to list wallet transactions", err, map[string]interface{}{
+			"userId": req.UserID,
+		})
+		return nil, err
+	}
+
+	nextCursor, err := utils.EncodeCursor(page.LastEvaluatedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TransactionHistory{
+		Transactions: page.Transactions,
+		NextCursor:   nextCursor,
+	}, nil
+}
+
+// buildTransactionQuery validates a history request and converts it to a repository query
+func (s *WalletService) buildTransactionQuery(req ListTransactionsRequest) (repository.TransactionQuery, error) {
+	query := repository.TransactionQuery{
+		UserID: req.UserID,
+		Type:   req.Type,
+		Limit:  req.Limit,
+	}
+
+	if req.UserID == "" {
+		return query, apperrors.NewValidationError("userID is required", nil)
+	}
+
+	switch req.Type {
+	case "", types.TransactionTypeDebit, types.TransactionTypeCredit, types.TransactionTypeGrant, types.TransactionTypeDeposit,
+		types.TransactionTypeTransferOut, types.TransactionTypeTransferIn:
+	default:
+		return query, apperrors.NewValidationError(fmt.Sprintf("invalid transaction type: %s", req.Type), nil)
+	}
+
+	var err error
+	if req.From != "" {
+		if query.From, err = time.Parse(time.RFC3339, req.From); err != nil {
+			return query, apperrors.NewValidationError("invalid from timestamp, expected RFC3339", nil)
 		}
-		if err := s.repo.CreateWallet(ctx, wallet); err != nil {
-			s.logger.Error("Failed to create wallet", err, map[string]interface{}{
-				"userId": userID,
-			})
-			return nil, fmt.Errorf("failed to create wallet: %w", err)
+	}
+	if req.To != "" {
+		if query.To, err = time.Parse(time.RFC3339, req.To); err != nil {
+			return query, apperrors.NewValidationError("invalid to timestamp, expected RFC3339", nil)
 		}
 	}
+	if !query.From.IsZero() && !query.To.IsZero() && query.From.After(query.To) {
+		return query, apperrors.NewValidationError("from must not be after to", nil)
+	}
+
+	switch {
+	case req.Limit < 0:
+		return query, apperrors.NewValidationError("limit must be greater than 0", nil)
+	case req.Limit == 0:
+		query.Limit = defaultTransactionPageSize
+	case req.Limit > maxTransactionPageSize:
+		query.Limit = maxTransactionPageSize
+	}
+
+	if query.ExclusiveStartKey, err = utils.DecodeCursor(req.Cursor); err != nil {
+		return query, apperrors.NewValidationError(err.Error(), nil)
+	}
+	// A cursor is only valid for the user whose history produced it
+	if userKey, ok := query.ExclusiveStartKey["UserID"]; req.Cursor != "" && (!ok || userKey.S == nil || *userKey.S != req.UserID) {
+		return query, apperrors.NewValidationError("invalid cursor", nil)
+	}
 
-	return wallet, nil
+	return query, nil
 }
 
 // validateDebitRequest validates debit request
@@ -178,9 +277,12 @@ func (s *WalletService) validateDebitRequest(req DebitRequest) error {
 	if req.UserID == "" {
 		return fmt.Errorf("userID is required")
 	}
-	if req.Amount <= 0 {
+	if !req.Amount.IsPositive() {
 		return fmt.Errorf("amount must be greater than 0")
 	}
+	if len(req.Amount.Currency) != 3 {
+		return fmt.Errorf("invalid currency format")
+	}
 	if req.PaymentID == "" {
 		return fmt.Errorf("paymentID is required")
 	}
@@ -192,9 +294,12 @@ func (s *WalletService) validateCreditRequest(req CreditRequest) error {
 	if req.UserID == "" {
 		return fmt.Errorf("userID is required")
 	}
-	if req.Amount <= 0 {
+	if !req.Amount.IsPositive() {
 		return fmt.Errorf("amount must be greater than 0")
 	}
+	if len(req.Amount.Currency) != 3 {
+		return fmt.Errorf("invalid currency format")
+	}
 	if req.PaymentID == "" {
 		return fmt.Errorf("paymentID is required")
 	}
@@ -2,17 +2,30 @@ package service
 
 import (
 	"context"
+	"errors"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/draftea-coding-challenge/lambdas/wallet-service/internal/repository"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
 	"github.com/draftea-coding-challenge/shared/observability"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/draftea-coding-challenge/shared/utils"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDebitWallet_ValidationError(t *testing.T) {
 	// Test with invalid user ID
 	req := DebitRequest{
 		UserID: "",
-		Amount: 100.00,
+		Amount: types.NewMoney(10000, "USD"),
 	}
 
 	logger := observability.NewLogger(context.Background(), "test")
@@ -28,7 +41,7 @@ func TestDebitWallet_InvalidAmount(t *testing.T) {
 	// Test with invalid amount
 	req := DebitRequest{
 		UserID: "user123",
-		Amount: -100.00,
+		Amount: types.NewMoney(-10000, "USD"),
 	}
 
 	logger := observability.NewLogger(context.Background(), "test")
@@ -44,7 +57,7 @@ func TestCreditWallet_ValidationError(t *testing.T) {
 	// Test with invalid user ID
 	req := CreditRequest{
 		UserID: "",
-		Amount: 100.00,
+		Amount: types.NewMoney(10000, "USD"),
 	}
 
 	logger := observability.NewLogger(context.Background(), "test")
@@ -60,7 +73,7 @@ func TestCreditWallet_InvalidAmount(t *testing.T) {
 	// Test with invalid amount
 	req := CreditRequest{
 		UserID: "user123",
-		Amount: -100.00,
+		Amount: types.NewMoney(-10000, "USD"),
 	}
 
 	logger := observability.NewLogger(context.Background(), "test")
@@ -71,3 +84,464 @@ func TestCreditWallet_InvalidAmount(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "amount must be greater than 0")
 }
+
+func TestListTransactions_ValidationError(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewWalletService(nil, logger)
+
+	cases := map[string]ListTransactionsRequest{
+		"userID is required":           {},
+		"invalid transaction type":     {UserID: "user123", Type: "REFUND"},
+		"invalid from timestamp":       {UserID: "user123", From: "yesterday"},
+		"from must not be after to":    {UserID: "user123", From: "2024-02-01T00:00:00Z", To: "2024-01-01T00:00:00Z"},
+		"limit must be greater than 0": {UserID: "user123", Limit: -1},
+		"invalid cursor":               {UserID: "user123", Cursor: "not-a-cursor"},
+	}
+
+	for expected, req := range cases {
+		_, err := service.ListTransactions(context.Background(), req)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), expected)
+	}
+}
+
+func TestListTransactions_RejectsCursorFromAnotherUser(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewWalletService(nil, logger)
+
+	cursor, err := utils.EncodeCursor(map[string]*dynamodb.AttributeValue{
+		"ID":        {S: aws.String("tx-1")},
+		"UserID":    {S: aws.String("someone-else")},
+		"Timestamp": {S: aws.String("2024-01-15T10:30:00Z")},
+	})
+	assert.NoError(t, err)
+
+	_, err = service.ListTransactions(context.Background(), ListTransactionsRequest{
+		UserID: "user123",
+		Cursor: cursor,
+	})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid cursor")
+}
+
+func TestHold_ValidationError(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewWalletService(nil, logger)
+
+	cases := map[string]HoldRequest{
+		"userID is required":               {Amount: types.NewMoney(1000, "USD"), PaymentID: "pay_1"},
+		"amount must be greater than 0":    {UserID: "user123", Amount: types.NewMoney(0, "USD"), PaymentID: "pay_1"},
+		"paymentID is required":            {UserID: "user123", Amount: types.NewMoney(1000, "USD")},
+		"ttlSeconds must be between 0 and": {UserID: "user123", Amount: types.NewMoney(1000, "USD"), PaymentID: "pay_1", TTLSeconds: -5},
+	}
+
+	for expected, req := range cases {
+		_, err := service.Hold(context.Background(), req)
+
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), expected)
+	}
+}
+
+func TestCaptureAndRelease_ValidationError(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewWalletService(nil, logger)
+
+	_, err := service.Capture(context.Background(), CaptureRequest{UserID: "user123"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "paymentID is required")
+
+	_, err = service.Release(context.Background(), ReleaseRequest{PaymentID: "pay_1"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "userID is required")
+}
+
+func TestWallet_AvailableExcludesHeldFunds(t *testing.T) {
+	wallet := types.Wallet{
+		Balance: types.NewMoney(10000, "USD"),
+		Held:    types.NewMoney(2500, "USD"),
+	}
+
+	assert.Equal(t, types.NewMoney(7500, "USD"), wallet.Available())
+
+	// Wallets created before holds existed have no Held attribute
+	legacy := types.Wallet{Balance: types.NewMoney(10000, "USD")}
+	assert.Equal(t, types.NewMoney(10000, "USD"), legacy.Available())
+}
+
+func TestParseOnboardingGrants(t *testing.T) {
+	grants, err := ParseOnboardingGrants("USD:1000.00, eur:500")
+	assert.NoError(t, err)
+	assert.Equal(t, OnboardingGrants{
+		"USD": types.NewMoney(100000, "USD"),
+		"EUR": types.NewMoney(50000, "EUR"),
+	}, grants)
+
+	grants, err = ParseOnboardingGrants("")
+	assert.NoError(t, err)
+	assert.Empty(t, grants)
+
+	for _, value := range []string{"USD", "USD:abc", "US:10", "USD:-5", "USD:10,USD:20"} {
+		_, err := ParseOnboardingGrants(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestCreateWallet_ValidationError(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewWalletService(nil, logger)
+
+	_, err := service.CreateWallet(context.Background(), CreateWalletRequest{Currency: "USD"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "userID is required")
+
+	_, err = service.CreateWallet(context.Background(), CreateWalletRequest{UserID: "user123", Currency: "DOLLARS"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid currency format")
+}
+
+func TestDeposit_ValidationError(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewWalletService(nil, logger)
+
+	_, err := service.Deposit(context.Background(), DepositRequest{
+		UserID: "user123",
+		Amount: types.NewMoney(5000, "USD"),
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "depositId is required")
+
+	_, err = service.Deposit(context.Background(), DepositRequest{
+		UserID:    "user123",
+		Amount:    types.NewMoney(5000, "USD"),
+		DepositID: "dep123",
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "externalId is required")
+
+	_, err = service.CheckDeposit(context.Background(), DepositRequest{
+		UserID:    "user123",
+		Amount:    types.NewMoney(-5000, "USD"),
+		DepositID: "dep123",
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "amount must be greater than 0")
+}
+
+func TestTransfer_ValidationError(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewWalletService(nil, logger)
+
+	_, err := service.Transfer(context.Background(), TransferRequest{
+		FromUserID: "user123",
+		ToUserID:   "user456",
+		Amount:     types.NewMoney(5000, "USD"),
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "transferId is required")
+
+	_, err = service.Transfer(context.Background(), TransferRequest{
+		TransferID: "tr123",
+		FromUserID: "user123",
+		ToUserID:   "user123",
+		Amount:     types.NewMoney(5000, "USD"),
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot transfer to the same wallet")
+
+	_, err = service.Transfer(context.Background(), TransferRequest{
+		TransferID: "tr123",
+		FromUserID: "user123",
+		ToUserID:   "user456",
+		Amount:     types.NewMoney(0, "USD"),
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "amount must be greater than 0")
+}
+
+func TestDefaultLimits(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewWalletService(nil, logger).WithSpendingLimits(SpendingLimitDefaults{
+		Daily:   map[string]types.Money{"USD": types.NewMoney(50000, "USD")},
+		Monthly: map[string]types.Money{"USD": types.NewMoney(500000, "USD")},
+	})
+
+	expected := map[string]types.Money{
+		PeriodDaily:   types.NewMoney(50000, "USD"),
+		PeriodMonthly: types.NewMoney(500000, "USD"),
+	}
+	assert.Equal(t, expected, service.defaultLimits("USD"))
+	assert.Equal(t, expected, service.defaultLimits("usd"))
+	assert.Empty(t, service.defaultLimits("EUR"))
+}
+
+func TestSetWalletStatus_ValidationError(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewWalletService(nil, logger)
+
+	base := SetWalletStatusRequest{UserID: "user123", Status: types.WalletStatusFrozen, Reason: "chargeback review", Actor: "ops@example.com"}
+	cases := map[string]func(req *SetWalletStatusRequest){
+		"userID is required": func(req *SetWalletStatusRequest) { req.UserID = "" },
+		"status must be":     func(req *SetWalletStatusRequest) { req.Status = "SUSPENDED" },
+		"reason is required": func(req *SetWalletStatusRequest) { req.Reason = " " },
+		"actor is required":  func(req *SetWalletStatusRequest) { req.Actor = "" },
+	}
+	for message, mutate := range cases {
+		req := base
+		mutate(&req)
+		_, err := service.SetWalletStatus(context.Background(), req)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), message)
+	}
+}
+
+func TestWalletStatus_AllowedOperations(t *testing.T) {
+	assert.Equal(t, types.WalletStatusActive, types.Wallet{}.CurrentStatus())
+
+	assert.True(t, types.WalletStatusActive.AllowsDebits())
+	assert.True(t, types.WalletStatusActive.AllowsCredits())
+	assert.False(t, types.WalletStatusFrozen.AllowsDebits())
+	assert.True(t, types.WalletStatusFrozen.AllowsCredits())
+	assert.False(t, types.WalletStatusClosed.AllowsDebits())
+	assert.False(t, types.WalletStatusClosed.AllowsCredits())
+}
+
+func TestGetStatement_ValidationError(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewWalletService(nil, logger)
+
+	cases := map[string]StatementRequest{
+		"userID is required":     {From: "2024-01-01T00:00:00Z"},
+		"from is required":       {UserID: "user123"},
+		"invalid from timestamp": {UserID: "user123", From: "2024-01-01"},
+		"invalid to timestamp":   {UserID: "user123", From: "2024-01-01T00:00:00Z", To: "tomorrow"},
+		"from must not be after": {UserID: "user123", From: "2024-02-01T00:00:00Z", To: "2024-01-01T00:00:00Z"},
+	}
+	for message, req := range cases {
+		_, err := service.GetStatement(context.Background(), req)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), message)
+	}
+}
+
+func TestReplayBalance(t *testing.T) {
+	transactions := []types.WalletTransaction{
+		{Type: types.TransactionTypeGrant, Amount: types.NewMoney(10000, "USD")},
+		{Type: types.TransactionTypeDebit, Amount: types.NewMoney(2500, "USD")},
+		{Type: types.TransactionTypeTransferIn, Amount: types.NewMoney(1000, "USD")},
+		{Type: types.TransactionTypeTransferOut, Amount: types.NewMoney(500, "USD")},
+		{Type: types.TransactionTypeCredit, Amount: types.NewMoney(2500, "USD")},
+	}
+
+	balance, err := replayBalance(types.NewMoney(0, "USD"), transactions)
+	assert.NoError(t, err)
+	assert.Equal(t, types.NewMoney(10500, "USD"), balance)
+	// Single-write rows carry no balances; the replay fills them in
+	assert.Equal(t, types.NewMoney(10000, "USD"), *transactions[1].BalanceBefore)
+	assert.Equal(t, types.NewMoney(7500, "USD"), *transactions[1].BalanceAfter)
+
+	_, err = replayBalance(types.NewMoney(0, "EUR"), transactions)
+	assert.Error(t, err)
+}
+
+func TestStatement_WriteCSV(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before, after := types.NewMoney(10000, "USD"), types.NewMoney(7550, "USD")
+	statement := &Statement{
+		UserID:         "user123",
+		From:           from,
+		To:             from.AddDate(0, 1, 0),
+		OpeningBalance: types.NewMoney(10000, "USD"),
+		ClosingBalance: types.NewMoney(7550, "USD"),
+		Transactions: []types.WalletTransaction{{
+			Type:          types.TransactionTypeDebit,
+			PaymentID:     "pay-1",
+			Amount:        types.NewMoney(2450, "USD"),
+			BalanceBefore: &before,
+			BalanceAfter:  &after,
+			Timestamp:     from.Add(time.Hour),
+		}},
+	}
+
+	var out strings.Builder
+	assert.NoError(t, statement.WriteCSV(&out))
+	assert.Equal(t, "timestamp,type,paymentId,transferId,counterpartyId,amount,balanceBefore,balanceAfter,currency\n"+
+		"2024-01-01T00:00:00Z,OPENING_BALANCE,,,,,,100.00,USD\n"+
+		"2024-01-01T01:00:00Z,DEBIT,pay-1,,,-24.50,100.00,75.50,USD\n"+
+		"2024-02-01T00:00:00Z,CLOSING_BALANCE,,,,,,75.50,USD\n", out.String())
+}
+
+func TestLedgerReplay_Compare(t *testing.T) {
+	replay := ledgerReplay{}
+	for _, event := range []types.PaymentEvent{
+		{UserID: "alice", EventType: string(types.EventWalletCreated), Amount: types.NewMoney(10000, "USD")},
+		{UserID: "alice", EventType: string(types.EventWalletDebited), Amount: types.NewMoney(2500, "USD")},
+		{UserID: "alice", EventType: string(types.EventWalletHoldPlaced), Amount: types.NewMoney(1000, "USD")},
+		{UserID: "alice", EventType: string(types.EventWalletTransferred), Amount: types.NewMoney(500, "USD"),
+			Metadata: map[string]interface{}{"counterpartyId": "bob"}},
+		// The receiving leg's own event is not counted again
+		{UserID: "bob", EventType: string(types.EventWalletCredited), Amount: types.NewMoney(500, "USD"),
+			Metadata: map[string]interface{}{"type": types.TransactionTypeTransferIn, "counterpartyId": "alice"}},
+		{UserID: "carol", EventType: string(types.EventWalletDeposited), Amount: types.NewMoney(700, "USD")},
+	} {
+		replay.apply(event)
+	}
+
+	// alice: 10000 - 2500 - 500, bumped by the debit, hold and transfer
+	assert.Nil(t, replay.compare(types.Wallet{UserID: "alice", Balance: types.NewMoney(7000, "USD"), Version: 3}))
+
+	// bob was credited by the transfer, then by a write with no event
+	drift := replay.compare(types.Wallet{UserID: "bob", Balance: types.NewMoney(2500, "USD"), Version: 2})
+	assert.NotNil(t, drift)
+	assert.Equal(t, types.NewMoney(500, "USD"), drift.ReplayedBalance)
+	assert.Equal(t, types.NewMoney(2000, "USD"), drift.Difference)
+	assert.Equal(t, 1, drift.ExpectedVersion)
+	assert.Equal(t, []string{DriftBalance, DriftVersion}, drift.Reasons)
+
+	unmatched := replay.unmatched()
+	assert.Len(t, unmatched, 1)
+	assert.Equal(t, "carol", unmatched[0].UserID)
+	assert.True(t, unmatched[0].HasReason(DriftNoWallet))
+}
+
+func TestLedgerReplay_Refund(t *testing.T) {
+	replay := ledgerReplay{}
+	for _, event := range []types.PaymentEvent{
+		{UserID: "alice", EventType: string(types.EventWalletCreated), Amount: types.NewMoney(10000, "USD")},
+		{UserID: "alice", PaymentID: "pay-1", EventType: string(types.EventWalletDebited), Amount: types.NewMoney(4000, "USD")},
+		// A partial refund, as refund-service records it
+		{UserID: "alice", PaymentID: "pay-1", EventType: string(types.EventWalletCredited), Amount: types.NewMoney(1500, "USD"),
+			Metadata: map[string]interface{}{"refundId": "ref-1"}},
+		{UserID: "alice", PaymentID: "pay-1", EventType: "REFUNDED", Amount: types.NewMoney(1500, "USD")},
+	} {
+		replay.apply(event)
+	}
+
+	// 10000 - 4000 + 1500, bumped by the debit and the refund credit
+	assert.Nil(t, replay.compare(types.Wallet{UserID: "alice", Balance: types.NewMoney(7500, "USD"), Version: 2}))
+}
+
+func TestGetWalletAccount_ValidationError(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewWalletService(nil, logger)
+
+	_, err := service.GetWalletAccount(context.Background(), "")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "userID is required")
+}
+
+func TestSetCreditLimit_ValidationError(t *testing.T) {
+	logger := observability.NewLogger(context.Background(), "test")
+	service := NewWalletService(nil, logger)
+
+	valid := SetCreditLimitRequest{UserID: "user123", CreditLimit: types.NewMoney(5000, "USD"), Reason: "VIP", Actor: "ops-team"}
+	cases := map[string]func(req *SetCreditLimitRequest){
+		"userID is required":               func(req *SetCreditLimitRequest) { req.UserID = "" },
+		"creditLimit currency is required": func(req *SetCreditLimitRequest) { req.CreditLimit = types.Money{Amount: 5000} },
+		"creditLimit must not be negative": func(req *SetCreditLimitRequest) { req.CreditLimit = types.NewMoney(-1, "USD") },
+		"reason is required":               func(req *SetCreditLimitRequest) { req.Reason = " " },
+		"actor is required":                func(req *SetCreditLimitRequest) { req.Actor = "" },
+	}
+	for message, mutate := range cases {
+		req := valid
+		mutate(&req)
+		_, err := service.SetCreditLimit(context.Background(), req)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), message)
+	}
+}
+
+// TestRepeatedPayment runs against DYNAMODB_ENDPOINT, like the repository's
+// debit benchmarks. A retried debit or credit returns the transaction that was
+// applied the first time and leaves the balance alone.
+func TestRepeatedPayment(t *testing.T) {
+	cases := []struct {
+		name   string
+		apply  func(s *WalletService, userID string, amount types.Money) (*TransactionResult, error)
+		repeat int64
+		// wantCode is set when the repeat must be rejected rather than replayed
+		wantCode string
+	}{
+		{
+			name: "debit",
+			apply: func(s *WalletService, userID string, amount types.Money) (*TransactionResult, error) {
+				return s.DebitWallet(context.Background(), DebitRequest{UserID: userID, Amount: amount, PaymentID: "pay-1"})
+			},
+			repeat: 1500,
+		},
+		{
+			name: "credit",
+			apply: func(s *WalletService, userID string, amount types.Money) (*TransactionResult, error) {
+				return s.CreditWallet(context.Background(), CreditRequest{UserID: userID, Amount: amount, PaymentID: "pay-1"})
+			},
+			repeat: 1500,
+		},
+		{
+			name: "debit with another amount",
+			apply: func(s *WalletService, userID string, amount types.Money) (*TransactionResult, error) {
+				return s.DebitWallet(context.Background(), DebitRequest{UserID: userID, Amount: amount, PaymentID: "pay-1"})
+			},
+			repeat:   2500,
+			wantCode: apperrors.ErrCodeDuplicatePayment,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			service, userID := dynamoService(t)
+
+			first, err := tc.apply(service, userID, types.NewMoney(1500, "USD"))
+			require.NoError(t, err)
+			require.False(t, first.Replayed)
+			balance, err := service.GetBalance(context.Background(), userID)
+			require.NoError(t, err)
+
+			repeated, err := tc.apply(service, userID, types.NewMoney(tc.repeat, "USD"))
+			if tc.wantCode != "" {
+				var appErr *apperrors.AppError
+				require.True(t, errors.As(err, &appErr))
+				assert.Equal(t, tc.wantCode, appErr.Code)
+			} else {
+				require.NoError(t, err)
+				assert.True(t, repeated.Replayed)
+				assert.Equal(t, first.Transaction.ID, repeated.Transaction.ID)
+			}
+
+			after, err := service.GetBalance(context.Background(), userID)
+			require.NoError(t, err)
+			assert.Equal(t, balance.Balance, after.Balance)
+			assert.Equal(t, balance.Version, after.Version)
+		})
+	}
+}
+
+// dynamoService connects to DYNAMODB_ENDPOINT and creates a funded wallet
+// for a new user
+func dynamoService(t *testing.T) (*WalletService, string) {
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_ENDPOINT is not set")
+	}
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:   aws.String("us-east-1"),
+		Endpoint: aws.String(endpoint),
+	}))
+	repo := repository.NewWalletRepository(dynamodb.New(sess), nil, "Wallets", "WalletTransactions", "WalletHolds", "PaymentEvents", "ReconciliationReports", "Ledger")
+
+	now := time.Now()
+	userID := "test-" + uuid.New().String()
+	_, err := repo.CreateWallet(context.Background(), &types.Wallet{
+		UserID:    userID,
+		Balance:   types.NewMoney(100000, "USD"),
+		Held:      types.NewMoney(0, "USD"),
+		Status:    types.WalletStatusActive,
+		CreatedAt: now,
+		UpdatedAt: now,
+	})
+	require.NoError(t, err)
+
+	return NewWalletService(repo, observability.NewLogger(context.Background(), "test")), userID
+}
@@ -10,11 +10,16 @@ import (
 	"time"
 )
 
+// Money mirrors the shared Money type: an integer amount in minor units
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
 // PaymentRequest represents incoming payment request
 type PaymentRequest struct {
 	PaymentID     string            `json:"paymentId"`
-	Amount        float64           `json:"amount"`
-	Currency      string            `json:"currency"`
+	Amount        Money             `json:"amount"`
 	UserID        string            `json:"userId"`
 	CorrelationID string            `json:"correlationId"`
 	Metadata      map[string]string `json:"metadata"`
@@ -91,7 +96,7 @@ func handleProcessPayment(w http.ResponseWriter, r *http.Request) {
 	var status, message string
 	
 	// Special case for testing circuit breaker - amount 999.99 always fails
-	if req.Amount == 999.99 {
+	if req.Amount.Amount == 99999 {
 		status = "error"
 		message = "Simulated gateway error for testing"
 	} else {
@@ -194,9 +199,9 @@ func handleRefundPayment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		ExternalID string  `json:"externalId"`
-		Amount     float64 `json:"amount"`
-		Reason     string  `json:"reason"`
+		ExternalID string `json:"externalId"`
+		Amount     Money  `json:"amount"`
+		Reason     string `json:"reason"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
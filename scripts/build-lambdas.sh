@@ -8,7 +8,7 @@ RED='\033[0;31m'
 NC='\033[0m' # No Color
 
 # Build each Lambda function
-LAMBDAS=("payments-adapter" "wallet-service" "invoice-processor" "refund-service")
+LAMBDAS=("payments-adapter" "wallet-service" "invoice-processor" "refund-service" "wallet-notifier")
 
 for lambda in "${LAMBDAS[@]}"; do
     echo -e "${GREEN}Building $lambda...${NC}"
@@ -21,14 +21,27 @@ aws dynamodb create-table \
     AttributeName=ID,AttributeType=S \
     AttributeName=UserID,AttributeType=S \
     AttributeName=Status,AttributeType=S \
+    AttributeName=CreatedAt,AttributeType=S \
   --key-schema AttributeName=ID,KeyType=HASH \
   --global-secondary-indexes \
-    '[{"IndexName":"UserIndex","KeySchema":[{"AttributeName":"UserID","KeyType":"HASH"}],"Projection":{"ProjectionType":"ALL"}},{"IndexName":"StatusIndex","KeySchema":[{"AttributeName":"Status","KeyType":"HASH"}],"Projection":{"ProjectionType":"ALL"}}]' \
+    '[{"IndexName":"UserIndex","KeySchema":[{"AttributeName":"UserID","KeyType":"HASH"}],"Projection":{"ProjectionType":"ALL"}},{"IndexName":"StatusIndex","KeySchema":[{"AttributeName":"Status","KeyType":"HASH"}],"Projection":{"ProjectionType":"ALL"}},{"IndexName":"UserCreatedAtIndex","KeySchema":[{"AttributeName":"UserID","KeyType":"HASH"},{"AttributeName":"CreatedAt","KeyType":"RANGE"}],"Projection":{"ProjectionType":"ALL"}}]' \
   --billing-mode PAY_PER_REQUEST \
   --endpoint-url $ENDPOINT_URL \
   --region $AWS_DEFAULT_REGION \
   2>/dev/null && echo "✓ Payments table created" || echo "✗ Payments table already exists"
 
+# Payments tables created before payment listing lack its index
+aws dynamodb update-table \
+  --table-name Payments \
+  --attribute-definitions \
+    AttributeName=UserID,AttributeType=S \
+    AttributeName=CreatedAt,AttributeType=S \
+  --global-secondary-index-updates \
+    '[{"Create":{"IndexName":"UserCreatedAtIndex","KeySchema":[{"AttributeName":"UserID","KeyType":"HASH"},{"AttributeName":"CreatedAt","KeyType":"RANGE"}],"Projection":{"ProjectionType":"ALL"}}}]' \
+  --endpoint-url $ENDPOINT_URL \
+  --region $AWS_DEFAULT_REGION \
+  >/dev/null 2>&1 && echo "✓ Payments UserCreatedAtIndex added" || true
+
 # Create Wallets table
 echo -e "${GREEN}Creating Wallets table...${NC}"
 aws dynamodb create-table \
@@ -37,6 +50,7 @@ aws dynamodb create-table \
     AttributeName=UserID,AttributeType=S \
   --key-schema AttributeName=UserID,KeyType=HASH \
   --billing-mode PAY_PER_REQUEST \
+  --stream-specification StreamEnabled=true,StreamViewType=NEW_AND_OLD_IMAGES \
   --endpoint-url $ENDPOINT_URL \
   --region $AWS_DEFAULT_REGION \
   2>/dev/null && echo "✓ Wallets table created" || echo "✗ Wallets table already exists"
@@ -72,11 +86,138 @@ aws dynamodb create-table \
   --region $AWS_DEFAULT_REGION \
   2>/dev/null && echo "✓ WalletTransactions table created" || echo "✗ WalletTransactions table already exists"
 
+# Create WalletHolds table
+echo -e "${GREEN}Creating WalletHolds table...${NC}"
+aws dynamodb create-table \
+  --table-name WalletHolds \
+  --attribute-definitions \
+    AttributeName=ID,AttributeType=S \
+    AttributeName=Status,AttributeType=S \
+    AttributeName=ExpiresAt,AttributeType=S \
+  --key-schema AttributeName=ID,KeyType=HASH \
+  --global-secondary-indexes \
+    '[{"IndexName":"StatusExpiresIndex","KeySchema":[{"AttributeName":"Status","KeyType":"HASH"},{"AttributeName":"ExpiresAt","KeyType":"RANGE"}],"Projection":{"ProjectionType":"ALL"}}]' \
+  --billing-mode PAY_PER_REQUEST \
+  --endpoint-url $ENDPOINT_URL \
+  --region $AWS_DEFAULT_REGION \
+  2>/dev/null && echo "✓ WalletHolds table created" || echo "✗ WalletHolds table already exists"
+
+# Create ReconciliationReports table
+echo -e "${GREEN}Creating ReconciliationReports table...${NC}"
+aws dynamodb create-table \
+  --table-name ReconciliationReports \
+  --attribute-definitions \
+    AttributeName=ReportID,AttributeType=S \
+    AttributeName=UserID,AttributeType=S \
+  --key-schema \
+    AttributeName=ReportID,KeyType=HASH \
+    AttributeName=UserID,KeyType=RANGE \
+  --billing-mode PAY_PER_REQUEST \
+  --endpoint-url $ENDPOINT_URL \
+  --region $AWS_DEFAULT_REGION \
+  2>/dev/null && echo "✓ ReconciliationReports table created" || echo "✗ ReconciliationReports table already exists"
+
+# Create Ledger table
+echo -e "${GREEN}Creating Ledger table...${NC}"
+aws dynamodb create-table \
+  --table-name Ledger \
+  --attribute-definitions \
+    AttributeName=PK,AttributeType=S \
+    AttributeName=SK,AttributeType=S \
+  --key-schema \
+    AttributeName=PK,KeyType=HASH \
+    AttributeName=SK,KeyType=RANGE \
+  --billing-mode PAY_PER_REQUEST \
+  --endpoint-url $ENDPOINT_URL \
+  --region $AWS_DEFAULT_REGION \
+  2>/dev/null && echo "✓ Ledger table created" || echo "✗ Ledger table already exists"
+
+# Create PaymentSchedules table
+echo -e "${GREEN}Creating PaymentSchedules table...${NC}"
+aws dynamodb create-table \
+  --table-name PaymentSchedules \
+  --attribute-definitions \
+    AttributeName=ID,AttributeType=S \
+    AttributeName=Status,AttributeType=S \
+    AttributeName=NextRunAt,AttributeType=S \
+  --key-schema AttributeName=ID,KeyType=HASH \
+  --global-secondary-indexes \
+    '[{"IndexName":"StatusNextRunIndex","KeySchema":[{"AttributeName":"Status","KeyType":"HASH"},{"AttributeName":"NextRunAt","KeyType":"RANGE"}],"Projection":{"ProjectionType":"ALL"}}]' \
+  --billing-mode PAY_PER_REQUEST \
+  --endpoint-url $ENDPOINT_URL \
+  --region $AWS_DEFAULT_REGION \
+  2>/dev/null && echo "✓ PaymentSchedules table created" || echo "✗ PaymentSchedules table already exists"
+
+# Create PaymentScheduleRuns table
+echo -e "${GREEN}Creating PaymentScheduleRuns table...${NC}"
+aws dynamodb create-table \
+  --table-name PaymentScheduleRuns \
+  --attribute-definitions \
+    AttributeName=ScheduleID,AttributeType=S \
+    AttributeName=OccurrenceAt,AttributeType=S \
+    AttributeName=Status,AttributeType=S \
+  --key-schema \
+    AttributeName=ScheduleID,KeyType=HASH \
+    AttributeName=OccurrenceAt,KeyType=RANGE \
+  --global-secondary-indexes \
+    '[{"IndexName":"StatusOccurrenceIndex","KeySchema":[{"AttributeName":"Status","KeyType":"HASH"},{"AttributeName":"OccurrenceAt","KeyType":"RANGE"}],"Projection":{"ProjectionType":"ALL"}}]' \
+  --billing-mode PAY_PER_REQUEST \
+  --endpoint-url $ENDPOINT_URL \
+  --region $AWS_DEFAULT_REGION \
+  2>/dev/null && echo "✓ PaymentScheduleRuns table created" || echo "✗ PaymentScheduleRuns table already exists"
+
+# Create Invoices table
+echo -e "${GREEN}Creating Invoices table...${NC}"
+aws dynamodb create-table \
+  --table-name Invoices \
+  --attribute-definitions \
+    AttributeName=ID,AttributeType=S \
+    AttributeName=MerchantID,AttributeType=S \
+    AttributeName=Number,AttributeType=N \
+  --key-schema AttributeName=ID,KeyType=HASH \
+  --global-secondary-indexes \
+    '[{"IndexName":"MerchantNumberIndex","KeySchema":[{"AttributeName":"MerchantID","KeyType":"HASH"},{"AttributeName":"Number","KeyType":"RANGE"}],"Projection":{"ProjectionType":"ALL"}}]' \
+  --billing-mode PAY_PER_REQUEST \
+  --endpoint-url $ENDPOINT_URL \
+  --region $AWS_DEFAULT_REGION \
+  2>/dev/null && echo "✓ Invoices table created" || echo "✗ Invoices table already exists"
+
+# Create InvoiceCounters table
+echo -e "${GREEN}Creating InvoiceCounters table...${NC}"
+aws dynamodb create-table \
+  --table-name InvoiceCounters \
+  --attribute-definitions \
+    AttributeName=MerchantID,AttributeType=S \
+  --key-schema AttributeName=MerchantID,KeyType=HASH \
+  --billing-mode PAY_PER_REQUEST \
+  --endpoint-url $ENDPOINT_URL \
+  --region $AWS_DEFAULT_REGION \
+  2>/dev/null && echo "✓ InvoiceCounters table created" || echo "✗ InvoiceCounters table already exists"
+
+# Create Idempotency table
+echo -e "${GREEN}Creating Idempotency table...${NC}"
+aws dynamodb create-table \
+  --table-name Idempotency \
+  --attribute-definitions \
+    AttributeName=idempotencyKey,AttributeType=S \
+  --key-schema AttributeName=idempotencyKey,KeyType=HASH \
+  --billing-mode PAY_PER_REQUEST \
+  --endpoint-url $ENDPOINT_URL \
+  --region $AWS_DEFAULT_REGION \
+  2>/dev/null && echo "✓ Idempotency table created" || echo "✗ Idempotency table already exists"
+
+aws dynamodb update-time-to-live \
+  --table-name Idempotency \
+  --time-to-live-specification Enabled=true,AttributeName=expirationTime \
+  --endpoint-url $ENDPOINT_URL \
+  --region $AWS_DEFAULT_REGION \
+  >/dev/null 2>&1 || true
+
 # Seed initial wallet data
 echo -e "${GREEN}Seeding initial wallet data...${NC}"
 aws dynamodb put-item \
   --table-name Wallets \
-  --item '{"UserID": {"S": "user_test_001"}, "Balance": {"N": "1000"}, "Currency": {"S": "USD"}, "Version": {"N": "1"}}' \
+  --item '{"UserID": {"S": "user_test_001"}, "Balance": {"M": {"Amount": {"N": "100000"}, "Currency": {"S": "USD"}}}, "Held": {"M": {"Amount": {"N": "0"}, "Currency": {"S": "USD"}}}, "Available": {"N": "100000"}, "Version": {"N": "1"}}' \
   --endpoint-url $ENDPOINT_URL \
   --region $AWS_DEFAULT_REGION \
   2>/dev/null && echo "✓ Initial wallet created for user_test_001" || echo "✗ Wallet already exists"
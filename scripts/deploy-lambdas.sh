@@ -39,7 +39,7 @@ AWS_ACCESS_KEY_ID=test AWS_SECRET_ACCESS_KEY=test aws lambda create-function \
   --role arn:aws:iam::000000000000:role/lambda-role \
   --handler bootstrap \
   --zip-file fileb://lambdas/invoice-processor/invoice-processor.zip \
-  --environment Variables="{DYNAMODB_ENDPOINT=http://host.docker.internal:4566,SQS_ENDPOINT=http://host.docker.internal:4566}" \
+  --environment Variables="{DYNAMODB_ENDPOINT=http://host.docker.internal:4566,SQS_ENDPOINT=http://host.docker.internal:4566,STEPFUNCTIONS_ENDPOINT=http://host.docker.internal:4566}" \
   --endpoint-url http://localhost:4566 \
   --region us-east-1 \
   2>/dev/null && echo "✓ invoice-processor deployed" || echo "✗ invoice-processor already exists"
@@ -56,6 +56,66 @@ AWS_ACCESS_KEY_ID=test AWS_SECRET_ACCESS_KEY=test aws lambda create-function \
   --region us-east-1 \
   2>/dev/null && echo "✓ refund-service deployed" || echo "✗ refund-service already exists"
 
+# Wallet events: the notifier reads the Wallets table stream and publishes to
+# the WalletEvents topic, which delivers to the wallet-balance-changed queue
+echo -e "${GREEN}Creating wallet events topic and queues...${NC}"
+WALLET_EVENTS_TOPIC_ARN=$(aws sns create-topic \
+  --name WalletEvents \
+  --endpoint-url http://localhost:4566 \
+  --region us-east-1 \
+  --query 'TopicArn' --output text)
+
+for queue in wallet-stream-dlq wallet-balance-changed-dlq; do
+  aws sqs create-queue --queue-name $queue --endpoint-url http://localhost:4566 --region us-east-1 >/dev/null
+done
+
+BALANCE_CHANGED_DLQ_ARN=arn:aws:sqs:us-east-1:000000000000:wallet-balance-changed-dlq
+aws sqs create-queue \
+  --queue-name wallet-balance-changed \
+  --attributes '{"RedrivePolicy":"{\"deadLetterTargetArn\":\"'$BALANCE_CHANGED_DLQ_ARN'\",\"maxReceiveCount\":\"5\"}"}' \
+  --endpoint-url http://localhost:4566 \
+  --region us-east-1 >/dev/null
+
+aws sns subscribe \
+  --topic-arn "$WALLET_EVENTS_TOPIC_ARN" \
+  --protocol sqs \
+  --notification-endpoint arn:aws:sqs:us-east-1:000000000000:wallet-balance-changed \
+  --attributes '{"RawMessageDelivery":"true","FilterPolicy":"{\"eventType\":[\"wallet.balance_changed\"]}"}' \
+  --endpoint-url http://localhost:4566 \
+  --region us-east-1 >/dev/null && echo "✓ wallet-balance-changed queue subscribed to $WALLET_EVENTS_TOPIC_ARN"
+
+echo -e "${GREEN}Deploying wallet-notifier...${NC}"
+AWS_ACCESS_KEY_ID=test AWS_SECRET_ACCESS_KEY=test aws lambda create-function \
+  --function-name wallet-notifier \
+  --runtime provided.al2 \
+  --role arn:aws:iam::000000000000:role/lambda-role \
+  --handler bootstrap \
+  --zip-file fileb://lambdas/wallet-notifier/wallet-notifier.zip \
+  --environment Variables="{SNS_ENDPOINT=http://host.docker.internal:4566,WALLET_EVENTS_TOPIC_ARN=$WALLET_EVENTS_TOPIC_ARN}" \
+  --endpoint-url http://localhost:4566 \
+  --region us-east-1 \
+  2>/dev/null && echo "✓ wallet-notifier deployed" || echo "✗ wallet-notifier already exists"
+
+WALLETS_STREAM_ARN=$(aws dynamodb describe-table \
+  --table-name Wallets \
+  --endpoint-url http://localhost:4566 \
+  --region us-east-1 \
+  --query 'Table.LatestStreamArn' --output text)
+
+echo -e "${GREEN}Connecting Wallets stream to wallet-notifier Lambda...${NC}"
+AWS_ACCESS_KEY_ID=test AWS_SECRET_ACCESS_KEY=test aws lambda create-event-source-mapping \
+  --function-name wallet-notifier \
+  --event-source-arn "$WALLETS_STREAM_ARN" \
+  --starting-position TRIM_HORIZON \
+  --batch-size 100 \
+  --maximum-retry-attempts 10 \
+  --bisect-batch-on-function-error \
+  --function-response-types ReportBatchItemFailures \
+  --destination-config '{"OnFailure":{"Destination":"arn:aws:sqs:us-east-1:000000000000:wallet-stream-dlq"}}' \
+  --endpoint-url http://localhost:4566 \
+  --region us-east-1 \
+  2>/dev/null && echo "✓ wallet-notifier connected" || echo "✗ wallet-notifier mapping already exists"
+
 # Create Step Functions state machine
 echo -e "${GREEN}Creating Step Functions state machine...${NC}"
 aws stepfunctions create-state-machine \
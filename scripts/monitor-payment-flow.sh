@@ -14,6 +14,9 @@ AMOUNT="${2:-50}"
 CURRENCY="${3:-USD}"
 ORDER_ID="${4:-order_$(date +%s)}"
 
+# Amounts travel as integer minor units (cents)
+AMOUNT_MINOR=$(printf "%.0f" "$(echo "$AMOUNT * 100" | bc)")
+
 echo -e "${CYAN}═══════════════════════════════════════════════════════════════════${NC}"
 echo -e "${CYAN}                   PAYMENT PROCESSING MONITOR                      ${NC}"
 echo -e "${CYAN}═══════════════════════════════════════════════════════════════════${NC}"
@@ -31,10 +34,10 @@ echo -e "${BLUE}💰 Checking initial wallet balance...${NC}"
 INITIAL_BALANCE=$(AWS_ACCESS_KEY_ID=test AWS_SECRET_ACCESS_KEY=test aws --endpoint-url=http://localhost:4566 \
     dynamodb get-item --table-name Wallets \
     --key "{\"UserID\":{\"S\":\"$USER_ID\"}}" \
-    --region us-east-1 --output json 2>/dev/null | jq -r '.Item.Balance.N // "0"')
+    --region us-east-1 --output json 2>/dev/null | jq -r '.Item.Balance.M.Amount.N // "0"')
 
 if [ "$INITIAL_BALANCE" != "0" ]; then
-    echo -e "   Initial Balance: ${GREEN}$INITIAL_BALANCE${NC}"
+    echo -e "   Initial Balance: ${GREEN}$INITIAL_BALANCE${NC} (minor units)"
 else
     echo -e "   ${YELLOW}Wallet not found - will be created${NC}"
 fi
@@ -45,7 +48,7 @@ echo -e "${BLUE}🚀 Starting payment flow...${NC}"
 EXECUTION_RESPONSE=$(AWS_ACCESS_KEY_ID=test AWS_SECRET_ACCESS_KEY=test aws --endpoint-url=http://localhost:4566 \
     stepfunctions start-execution \
     --state-machine-arn arn:aws:states:us-east-1:000000000000:stateMachine:PaymentProcessingStateMachine \
-    --input "{\"userId\":\"$USER_ID\",\"amount\":$AMOUNT,\"currency\":\"$CURRENCY\",\"metadata\":{\"orderId\":\"$ORDER_ID\"}}" \
+    --input "{\"userId\":\"$USER_ID\",\"amount\":{\"amount\":$AMOUNT_MINOR,\"currency\":\"$CURRENCY\"},\"metadata\":{\"orderId\":\"$ORDER_ID\"}}" \
     --region us-east-1 --output json 2>/dev/null)
 
 EXECUTION_ARN=$(echo $EXECUTION_RESPONSE | jq -r '.executionArn')
@@ -96,8 +99,14 @@ while [ $WAIT_COUNT -lt $MAX_WAIT ]; do
             "HasSufficientBalance")
                 echo -e "   ${STEP_COUNT}. ${YELLOW}💳 Checking wallet balance...${NC}"
                 ;;
-            "DebitWallet")
-                echo -e "   ${STEP_COUNT}. ${YELLOW}💸 Debiting wallet...${NC}"
+            "HoldFunds")
+                echo -e "   ${STEP_COUNT}. ${YELLOW}🔒 Holding wallet funds...${NC}"
+                ;;
+            "CaptureFunds")
+                echo -e "   ${STEP_COUNT}. ${YELLOW}💸 Capturing held funds...${NC}"
+                ;;
+            "ReleaseFunds")
+                echo -e "   ${STEP_COUNT}. ${YELLOW}🔓 Releasing held funds...${NC}"
                 ;;
             "ProcessPayment")
                 echo -e "   ${STEP_COUNT}. ${YELLOW}⚙️  Processing payment with gateway...${NC}"
@@ -141,9 +150,9 @@ while [ $WAIT_COUNT -lt $MAX_WAIT ]; do
         FINAL_BALANCE=$(AWS_ACCESS_KEY_ID=test AWS_SECRET_ACCESS_KEY=test aws --endpoint-url=http://localhost:4566 \
             dynamodb get-item --table-name Wallets \
             --key "{\"UserID\":{\"S\":\"$USER_ID\"}}" \
-            --region us-east-1 --output json 2>/dev/null | jq -r '.Item.Balance.N // "0"')
+            --region us-east-1 --output json 2>/dev/null | jq -r '.Item.Balance.M.Amount.N // "0"')
         
-        echo -e "   Final Balance: ${GREEN}$FINAL_BALANCE${NC}"
+        echo -e "   Final Balance: ${GREEN}$FINAL_BALANCE${NC} (minor units)"
         
         if [ "$INITIAL_BALANCE" != "0" ]; then
             DEBIT_AMOUNT=$(echo "$INITIAL_BALANCE - $FINAL_BALANCE" | bc)
@@ -171,7 +180,7 @@ while [ $WAIT_COUNT -lt $MAX_WAIT ]; do
             CURRENT_BALANCE=$(AWS_ACCESS_KEY_ID=test AWS_SECRET_ACCESS_KEY=test aws --endpoint-url=http://localhost:4566 \
                 dynamodb get-item --table-name Wallets \
                 --key "{\"UserID\":{\"S\":\"$USER_ID\"}}" \
-                --region us-east-1 --output json 2>/dev/null | jq -r '.Item.Balance.N // "0"')
+                --region us-east-1 --output json 2>/dev/null | jq -r '.Item.Balance.M.Amount.N // "0"')
             
             if [ "$CURRENT_BALANCE" == "$INITIAL_BALANCE" ]; then
                 echo -e "${GREEN}✓ Wallet balance unchanged: $CURRENT_BALANCE${NC}"
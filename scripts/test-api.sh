@@ -18,7 +18,7 @@ curl -X POST "$API_URL/wallet/credit" \
   -H "Content-Type: application/json" \
   -d "{
     \"user_id\": \"$USER_ID\",
-    \"amount\": 100.00,
+    \"amount\": {\"amount\": 10000, \"currency\": \"USD\"},
     \"payment_id\": \"initial-credit\"
   }" | jq .
 
@@ -33,8 +33,7 @@ PAYMENT_RESPONSE=$(curl -X POST "$API_URL/payments" \
   -d "{
     \"payment_id\": \"$PAYMENT_ID\",
     \"user_id\": \"$USER_ID\",
-    \"amount\": 50.00,
-    \"currency\": \"USD\",
+    \"amount\": {\"amount\": 5000, \"currency\": \"USD\"},
     \"description\": \"Test payment\"
   }")
 
@@ -55,7 +54,7 @@ curl -X POST "$API_URL/refunds" \
   -H "Content-Type: application/json" \
   -d "{
     \"payment_id\": \"$PAYMENT_ID\",
-    \"amount\": 50.00,
+    \"amount\": {\"amount\": 5000, \"currency\": \"USD\"},
     \"reason\": \"Test refund\"
   }" | jq .
 
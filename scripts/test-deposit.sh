@@ -0,0 +1,105 @@
+#!/bin/bash
+
+# Colors for output
+RED='\033[0;31m'
+GREEN='\033[0;32m'
+BLUE='\033[0;34m'
+YELLOW='\033[1;33m'
+CYAN='\033[0;36m'
+NC='\033[0m' # No Color
+
+# Default values
+USER_ID="${1:-user_test_001}"
+AMOUNT="${2:-100}"
+CURRENCY="${3:-USD}"
+DEPOSIT_ID="${4:-deposit_$(date +%s)}"
+
+# Amounts travel as integer minor units (cents)
+AMOUNT_MINOR=$(printf "%.0f" "$(echo "$AMOUNT * 100" | bc)")
+
+get_balance() {
+    AWS_ACCESS_KEY_ID=test AWS_SECRET_ACCESS_KEY=test aws --endpoint-url=http://localhost:4566 \
+        dynamodb get-item --table-name Wallets \
+        --key "{\"UserID\":{\"S\":\"$USER_ID\"}}" \
+        --region us-east-1 --output json 2>/dev/null | jq -r '.Item.Balance.M.Amount.N // "0"'
+}
+
+echo -e "${CYAN}═══════════════════════════════════════════════════════════════════${NC}"
+echo -e "${CYAN}                   WALLET DEPOSIT MONITOR                          ${NC}"
+echo -e "${CYAN}═══════════════════════════════════════════════════════════════════${NC}"
+echo ""
+
+echo -e "${YELLOW}📋 Deposit Details:${NC}"
+echo -e "   User ID: ${GREEN}$USER_ID${NC}"
+echo -e "   Amount: ${GREEN}$AMOUNT $CURRENCY${NC}"
+echo -e "   Deposit ID: ${GREEN}$DEPOSIT_ID${NC}"
+echo ""
+
+INITIAL_BALANCE=$(get_balance)
+echo -e "${BLUE}💰 Initial Balance: ${GREEN}$INITIAL_BALANCE${NC} (minor units)"
+echo ""
+
+# The execution name is the deposit ID, so re-running with the same ID is rejected
+# by Step Functions and the wallet is never credited twice
+echo -e "${BLUE}🚀 Starting deposit flow...${NC}"
+EXECUTION_ARN=$(AWS_ACCESS_KEY_ID=test AWS_SECRET_ACCESS_KEY=test aws --endpoint-url=http://localhost:4566 \
+    stepfunctions start-execution \
+    --state-machine-arn arn:aws:states:us-east-1:000000000000:stateMachine:DepositStateMachine \
+    --name "$DEPOSIT_ID" \
+    --input "{\"userId\":\"$USER_ID\",\"amount\":{\"amount\":$AMOUNT_MINOR,\"currency\":\"$CURRENCY\"},\"metadata\":{\"depositId\":\"$DEPOSIT_ID\"}}" \
+    --region us-east-1 --output json 2>/dev/null | jq -r '.executionArn')
+
+if [ -z "$EXECUTION_ARN" ] || [ "$EXECUTION_ARN" == "null" ]; then
+    echo -e "${RED}❌ Failed to start execution${NC}"
+    exit 1
+fi
+
+echo -e "   Execution ID: ${CYAN}${EXECUTION_ARN##*:}${NC}"
+echo ""
+
+# Pending charges are re-checked every 10 seconds, so allow for a few rounds
+MAX_WAIT=60
+WAIT_COUNT=0
+
+while [ $WAIT_COUNT -lt $MAX_WAIT ]; do
+    EXECUTION_DETAILS=$(AWS_ACCESS_KEY_ID=test AWS_SECRET_ACCESS_KEY=test aws --endpoint-url=http://localhost:4566 \
+        stepfunctions describe-execution \
+        --execution-arn "$EXECUTION_ARN" \
+        --region us-east-1 --output json 2>/dev/null)
+
+    STATUS=$(echo $EXECUTION_DETAILS | jq -r '.status')
+
+    if [ "$STATUS" == "SUCCEEDED" ]; then
+        OUTPUT=$(echo $EXECUTION_DETAILS | jq -r '.output' | jq '.')
+        EXTERNAL_ID=$(echo $OUTPUT | jq -r '.chargeResult.Payload.data.externalId // "N/A"')
+        FINAL_BALANCE=$(get_balance)
+
+        echo -e "${GREEN}✅ Deposit credited!${NC}"
+        echo -e "   External ID: ${GREEN}$EXTERNAL_ID${NC}"
+        echo -e "   Final Balance: ${GREEN}$FINAL_BALANCE${NC} (minor units)"
+        echo -e "   Amount Deposited: ${YELLOW}$(echo "$FINAL_BALANCE - $INITIAL_BALANCE" | bc)${NC}"
+        exit 0
+
+    elif [ "$STATUS" == "FAILED" ]; then
+        HISTORY=$(AWS_ACCESS_KEY_ID=test AWS_SECRET_ACCESS_KEY=test aws --endpoint-url=http://localhost:4566 \
+            stepfunctions get-execution-history \
+            --execution-arn "$EXECUTION_ARN" \
+            --region us-east-1 --output json 2>/dev/null)
+        ERROR_INFO=$(echo $HISTORY | jq -r '.events[] | select(.type == "ExecutionFailed") | .executionFailedEventDetails')
+
+        echo -e "${RED}❌ Deposit failed: $(echo $ERROR_INFO | jq -r '.error // "Unknown error"')${NC}"
+
+        CURRENT_BALANCE=$(get_balance)
+        if [ "$CURRENT_BALANCE" == "$INITIAL_BALANCE" ]; then
+            echo -e "${GREEN}✓ Wallet balance unchanged: $CURRENT_BALANCE${NC}"
+        else
+            echo -e "${YELLOW}⚠ Wallet balance changed: $INITIAL_BALANCE -> $CURRENT_BALANCE${NC}"
+        fi
+        exit 1
+    fi
+
+    sleep 0.5
+    WAIT_COUNT=$((WAIT_COUNT + 1))
+done
+
+echo -e "${YELLOW}⚠ Deposit still running after monitoring window: ${EXECUTION_ARN##*:}${NC}"
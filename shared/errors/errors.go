@@ -3,6 +3,8 @@ package errors
 import (
 	"fmt"
 	"net/http"
+
+	"github.com/draftea-coding-challenge/shared/types"
 )
 
 // AppError represents an application-specific error
@@ -37,6 +39,19 @@ const (
 	ErrCodeInternal          = "INTERNAL_ERROR"
 	ErrCodeTimeout           = "TIMEOUT"
 	ErrCodeDuplicatePayment  = "DUPLICATE_PAYMENT"
+	ErrCodeConcurrentUpdate  = "CONCURRENT_UPDATE"
+	ErrCodeLedgerWrite       = "LEDGER_WRITE_FAILED"
+	ErrCodeHoldNotActive     = "HOLD_NOT_ACTIVE"
+	ErrCodeWalletExists      = "WALLET_EXISTS"
+	ErrCodeCurrencyMismatch  = "CURRENCY_MISMATCH"
+	ErrCodeSpendingLimit     = "SPENDING_LIMIT_EXCEEDED"
+	ErrCodeWalletNotActive   = "WALLET_NOT_ACTIVE"
+	ErrCodeScheduleStatus    = "INVALID_SCHEDULE_STATUS"
+	ErrCodeIdempotencyKey    = "IDEMPOTENCY_KEY_REUSED"
+	ErrCodeRequestInProgress = "REQUEST_IN_PROGRESS"
+	ErrCodePaymentStatus     = "INVALID_PAYMENT_STATUS_TRANSITION"
+	ErrCodeInvoiceStatus     = "INVALID_INVOICE_STATUS"
+	ErrCodeReceiptNotReady   = "RECEIPT_NOT_AVAILABLE"
 )
 
 // Constructor functions for common errors
@@ -57,7 +72,7 @@ func NewNotFoundError(resource string) *AppError {
 	}
 }
 
-func NewInsufficientFundsError(available, required float64) *AppError {
+func NewInsufficientFundsError(available, required types.Money) *AppError {
 	return &AppError{
 		Code:       ErrCodeInsufficientFunds,
 		Message:    "Insufficient funds",
@@ -102,10 +117,178 @@ func NewDuplicatePaymentError(paymentID string) *AppError {
 	}
 }
 
+func NewConcurrentUpdateError(resource string) *AppError {
+	return &AppError{
+		Code:       ErrCodeConcurrentUpdate,
+		Message:    fmt.Sprintf("%s was modified concurrently, retry the operation", resource),
+		StatusCode: http.StatusConflict,
+	}
+}
+
+// NewLedgerWriteError reports that a balance change and its ledger records
+// could not be committed. Nothing was written when this error is returned.
+func NewLedgerWriteError(err error) *AppError {
+	return &AppError{
+		Code:       ErrCodeLedgerWrite,
+		Message:    "Failed to record wallet transaction",
+		StatusCode: http.StatusInternalServerError,
+		Err:        err,
+	}
+}
+
+func NewHoldNotActiveError(paymentID, status string) *AppError {
+	return &AppError{
+		Code:       ErrCodeHoldNotActive,
+		Message:    fmt.Sprintf("Hold for payment %s is %s", paymentID, status),
+		StatusCode: http.StatusConflict,
+		Details: map[string]interface{}{
+			"paymentId": paymentID,
+			"status":    status,
+		},
+	}
+}
+
 // Helper function to wrap errors
 func Wrap(err error, message string) error {
 	if err == nil {
 		return nil
 	}
 	return fmt.Errorf("%s: %w", message, err)
-}
\ No newline at end of file
+}
+
+// NewWalletExistsError reports that a user already has a wallet, in currency
+func NewWalletExistsError(userID, currency string) *AppError {
+	return &AppError{
+		Code:       ErrCodeWalletExists,
+		Message:    fmt.Sprintf("User %s already has a %s wallet", userID, currency),
+		StatusCode: http.StatusConflict,
+		Details: map[string]interface{}{
+			"userId":   userID,
+			"currency": currency,
+		},
+	}
+}
+
+// NewCurrencyMismatchError reports an operation on a wallet held in expected
+// with an amount in actual
+func NewCurrencyMismatchError(expected, actual string) *AppError {
+	return &AppError{
+		Code:       ErrCodeCurrencyMismatch,
+		Message:    fmt.Sprintf("Currency mismatch: wallet is in %s, amount is in %s", expected, actual),
+		StatusCode: http.StatusUnprocessableEntity,
+		Details: map[string]interface{}{
+			"expected": expected,
+			"actual":   actual,
+		},
+	}
+}
+
+// NewSpendingLimitExceededError reports a spend of requested that would take
+// the user over their limit for period, with the allowance still remaining
+func NewSpendingLimitExceededError(period string, limit, remaining, requested types.Money) *AppError {
+	return &AppError{
+		Code:       ErrCodeSpendingLimit,
+		Message:    fmt.Sprintf("%s spending limit of %s exceeded", period, limit),
+		StatusCode: http.StatusForbidden,
+		Details: map[string]interface{}{
+			"period":    period,
+			"limit":     limit,
+			"remaining": remaining,
+			"requested": requested,
+		},
+	}
+}
+
+// NewWalletNotActiveError reports a balance change the wallet's status does not allow
+func NewWalletNotActiveError(userID, status string) *AppError {
+	return &AppError{
+		Code:       ErrCodeWalletNotActive,
+		Message:    fmt.Sprintf("Wallet %s is %s", userID, status),
+		StatusCode: http.StatusLocked,
+		Details: map[string]interface{}{
+			"userId": userID,
+			"status": status,
+		},
+	}
+}
+
+// NewScheduleStatusError reports a change a payment schedule's status does not allow
+func NewScheduleStatusError(scheduleID, status string) *AppError {
+	return &AppError{
+		Code:       ErrCodeScheduleStatus,
+		Message:    fmt.Sprintf("Payment schedule %s is %s", scheduleID, status),
+		StatusCode: http.StatusConflict,
+		Details: map[string]interface{}{
+			"scheduleId": scheduleID,
+			"status":     status,
+		},
+	}
+}
+
+// NewIdempotencyKeyReusedError reports an idempotency key sent again with a
+// different request than the one it was first used for
+func NewIdempotencyKeyReusedError(key string) *AppError {
+	return &AppError{
+		Code:       ErrCodeIdempotencyKey,
+		Message:    fmt.Sprintf("Idempotency key %s was already used with a different request", key),
+		StatusCode: http.StatusUnprocessableEntity,
+		Details: map[string]interface{}{
+			"idempotencyKey": key,
+		},
+	}
+}
+
+// NewRequestInProgressError reports a request whose idempotency key is held by
+// an earlier request that has not finished yet
+func NewRequestInProgressError(key string) *AppError {
+	return &AppError{
+		Code:       ErrCodeRequestInProgress,
+		Message:    fmt.Sprintf("A request with idempotency key %s is still in progress, retry later", key),
+		StatusCode: http.StatusConflict,
+		Details: map[string]interface{}{
+			"idempotencyKey": key,
+		},
+	}
+}
+
+// NewPaymentStatusConflictError reports a status change a payment's current
+// status does not allow
+func NewPaymentStatusConflictError(paymentID, status, requested string) *AppError {
+	return &AppError{
+		Code:       ErrCodePaymentStatus,
+		Message:    fmt.Sprintf("Payment %s is %s and cannot be moved to %s", paymentID, status, requested),
+		StatusCode: http.StatusConflict,
+		Details: map[string]interface{}{
+			"paymentId": paymentID,
+			"status":    status,
+			"requested": requested,
+		},
+	}
+}
+
+// NewInvoiceStatusError reports a change an invoice's status does not allow
+func NewInvoiceStatusError(invoiceID, status string) *AppError {
+	return &AppError{
+		Code:       ErrCodeInvoiceStatus,
+		Message:    fmt.Sprintf("Invoice %s is %s", invoiceID, status),
+		StatusCode: http.StatusConflict,
+		Details: map[string]interface{}{
+			"invoiceId": invoiceID,
+			"status":    status,
+		},
+	}
+}
+
+// NewReceiptNotReadyError reports a receipt requested for a payment that has
+// not completed
+func NewReceiptNotReadyError(paymentID, status string) *AppError {
+	return &AppError{
+		Code:       ErrCodeReceiptNotReady,
+		Message:    fmt.Sprintf("No receipt is available for payment %s while it is %s", paymentID, status),
+		StatusCode: http.StatusConflict,
+		Details: map[string]interface{}{
+			"paymentId": paymentID,
+			"status":    status,
+		},
+	}
+}
@@ -0,0 +1,83 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashRequest(t *testing.T) {
+	hash := HashRequest(`{"userId":"user123","amount":{"amount":1000,"currency":"USD"}}`)
+
+	// Field order and whitespace do not change the hash
+	assert.Equal(t, hash, HashRequest(`{ "amount": {"currency": "USD", "amount": 1000}, "userId": "user123" }`))
+
+	// Any change to a value does
+	assert.NotEqual(t, hash, HashRequest(`{"userId":"user123","amount":{"amount":1001,"currency":"USD"}}`))
+
+	// Large numbers are compared exactly
+	assert.NotEqual(t, HashRequest(`{"amount":9007199254740993}`), HashRequest(`{"amount":9007199254740992}`))
+
+	// Bodies that are not JSON are hashed as they are
+	assert.NotEqual(t, HashRequest("a=1&b=2"), HashRequest("b=2&a=1"))
+	assert.NotEqual(t, HashRequest(`{"a":1} {"b":2}`), HashRequest(`{"a":1}`))
+}
+
+func TestCheckExisting(t *testing.T) {
+	completed := &Record{Key: "POST /wallet/debit#k1", RequestHash: "h1", Status: StatusCompleted}
+	assert.NoError(t, checkExisting(completed, "h1"))
+
+	var appErr *apperrors.AppError
+	err := checkExisting(completed, "h2")
+	require.True(t, errors.As(err, &appErr))
+	assert.Equal(t, apperrors.ErrCodeIdempotencyKey, appErr.Code)
+	assert.Equal(t, 422, appErr.StatusCode)
+
+	inProgress := &Record{Key: "POST /wallet/debit#k1", RequestHash: "h1", Status: StatusInProgress}
+	err = checkExisting(inProgress, "h1")
+	require.True(t, errors.As(err, &appErr))
+	assert.Equal(t, apperrors.ErrCodeRequestInProgress, appErr.Code)
+	assert.Equal(t, 409, appErr.StatusCode)
+}
+
+func TestReplay(t *testing.T) {
+	response, err := replay(&Record{
+		Status:   StatusCompleted,
+		Response: `{"statusCode":201,"headers":{"Content-Type":"application/json"},"body":"{\"success\":true}"}`,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 201, response.StatusCode)
+	assert.Equal(t, `{"success":true}`, response.Body)
+	assert.Equal(t, "application/json", response.Headers["Content-Type"])
+	assert.Equal(t, "true", response.Headers[HeaderReplayed])
+}
+
+func TestWrap_WithoutKey(t *testing.T) {
+	calls := 0
+	next := func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		calls++
+		return events.APIGatewayProxyResponse{StatusCode: 200}, nil
+	}
+
+	// A nil middleware and a request without a key both skip the store
+	var disabled *Middleware
+	_, err := disabled.Wrap(next)(context.Background(), events.APIGatewayProxyRequest{
+		Headers: map[string]string{HeaderKey: "k1"},
+	})
+	assert.NoError(t, err)
+
+	_, err = NewMiddleware(nil, nil).Wrap(next)(context.Background(), events.APIGatewayProxyRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestHeaderValue(t *testing.T) {
+	assert.Equal(t, "k1", headerValue(map[string]string{"Idempotency-Key": "k1"}, HeaderKey))
+	assert.Equal(t, "k2", headerValue(map[string]string{"idempotency-key": " k2 "}, HeaderKey))
+	assert.Empty(t, headerValue(nil, HeaderKey))
+}
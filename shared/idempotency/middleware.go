@@ -0,0 +1,151 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/observability"
+	"github.com/draftea-coding-challenge/shared/utils"
+)
+
+const (
+	// HeaderKey is the request header carrying the idempotency key
+	HeaderKey = "Idempotency-Key"
+
+	// HeaderReplayed is set on responses replayed from a stored request
+	HeaderReplayed = "Idempotent-Replayed"
+)
+
+// Handler handles an API Gateway request
+type Handler func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+// storedResponse is a handler response as kept in Record.Response
+type storedResponse struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body"`
+}
+
+// Middleware makes mutating endpoints idempotent for requests that carry an
+// Idempotency-Key header
+type Middleware struct {
+	store  *Store
+	logger *observability.Logger
+}
+
+// NewMiddleware creates an idempotency middleware backed by store
+func NewMiddleware(store *Store, logger *observability.Logger) *Middleware {
+	return &Middleware{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// Wrap runs next at most once per idempotency key. Keys are scoped to the
+// method and path, so one key can be used on different endpoints. A request
+// repeating a key gets the first response back, marked with the
+// Idempotent-Replayed header; one repeating it with a different body gets
+// 422, and one arriving while the first is still running gets 409.
+//
+// Responses with a 5xx status are not stored, so the request can be retried
+// with the same key. Requests without a key, and every request when m is
+// nil, go straight to next.
+func (m *Middleware) Wrap(next Handler) Handler {
+	if m == nil {
+		return next
+	}
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		key := headerValue(request.Headers, HeaderKey)
+		if key == "" {
+			return next(ctx, request)
+		}
+
+		scopedKey := fmt.Sprintf("%s %s#%s", request.HTTPMethod, request.Path, key)
+		hash := HashRequest(request.Body)
+
+		existing, err := m.store.Claim(ctx, scopedKey, hash)
+		if err != nil {
+			var appErr *apperrors.AppError
+			if errors.As(err, &appErr) {
+				return utils.AppErrorResponse(appErr)
+			}
+			m.logger.Error("Failed to claim idempotency key", err, map[string]interface{}{
+				"idempotencyKey": scopedKey,
+			})
+			return utils.ErrorResponse(500, "failed to check idempotency key")
+		}
+		if existing != nil {
+			m.logger.Info("Replaying idempotent response", map[string]interface{}{
+				"idempotencyKey": scopedKey,
+			})
+			return replay(existing)
+		}
+
+		response, err := next(ctx, request)
+		if err != nil || response.StatusCode >= 500 {
+			if releaseErr := m.store.Release(ctx, scopedKey, hash); releaseErr != nil {
+				m.logger.Error("Failed to release idempotency key", releaseErr, map[string]interface{}{
+					"idempotencyKey": scopedKey,
+				})
+			}
+			return response, err
+		}
+
+		stored, err := json.Marshal(storedResponse{
+			StatusCode: response.StatusCode,
+			Headers:    response.Headers,
+			Body:       response.Body,
+		})
+		if err == nil {
+			err = m.store.Complete(ctx, scopedKey, hash, string(stored))
+		}
+		if err != nil {
+			// The response is still returned; the key stays held until its
+			// lease runs out, and a retry after that runs the request again
+			m.logger.Error("Failed to store idempotent response", err, map[string]interface{}{
+				"idempotencyKey": scopedKey,
+			})
+		}
+
+		return response, nil
+	}
+}
+
+// replay rebuilds the response stored for a completed request
+func replay(record *Record) (events.APIGatewayProxyResponse, error) {
+	var stored storedResponse
+	if err := json.Unmarshal([]byte(record.Response), &stored); err != nil {
+		return utils.ErrorResponse(500, "failed to read stored response")
+	}
+
+	headers := make(map[string]string, len(stored.Headers)+1)
+	for name, value := range stored.Headers {
+		headers[name] = value
+	}
+	headers[HeaderReplayed] = "true"
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: stored.StatusCode,
+		Headers:    headers,
+		Body:       stored.Body,
+	}, nil
+}
+
+// headerValue looks a header up by name, ignoring case as HTTP does
+func headerValue(headers map[string]string, name string) string {
+	if value, ok := headers[name]; ok {
+		return strings.TrimSpace(value)
+	}
+	for header, value := range headers {
+		if strings.EqualFold(header, name) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,279 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	apperrors "github.com/draftea-coding-challenge/shared/errors"
+)
+
+const (
+	// DefaultTTL is how long a completed request is replayed for its key
+	DefaultTTL = 24 * time.Hour
+
+	// DefaultLease is how long a claim stays held by a request that never
+	// completes or releases it, e.g. because its Lambda timed out. It is
+	// longer than the Lambda timeout, so a running request keeps its claim.
+	DefaultLease = time.Minute
+)
+
+// Status is the state of a request under an idempotency key
+type Status string
+
+const (
+	StatusInProgress Status = "IN_PROGRESS"
+	StatusCompleted  Status = "COMPLETED"
+)
+
+// Record is an idempotency key as stored in the Idempotency table.
+// ExpirationTime is the table's TTL attribute, in Unix seconds.
+type Record struct {
+	Key            string    `json:"idempotencyKey" dynamodbav:"idempotencyKey"`
+	RequestHash    string    `json:"requestHash" dynamodbav:"requestHash"`
+	Status         Status    `json:"status" dynamodbav:"status"`
+	Response       string    `json:"response,omitempty" dynamodbav:"response,omitempty"`
+	CreatedAt      time.Time `json:"createdAt" dynamodbav:"createdAt"`
+	LockedUntil    int64     `json:"lockedUntil" dynamodbav:"lockedUntil"`
+	ExpirationTime int64     `json:"expirationTime" dynamodbav:"expirationTime"`
+}
+
+// Store keeps idempotency keys in a DynamoDB table keyed by idempotencyKey,
+// with expirationTime as its TTL attribute
+type Store struct {
+	db    *dynamodb.DynamoDB
+	table string
+	ttl   time.Duration
+	lease time.Duration
+}
+
+// NewStore creates an idempotency store over the given table
+func NewStore(db *dynamodb.DynamoDB, table string) *Store {
+	return &Store{
+		db:    db,
+		table: table,
+		ttl:   DefaultTTL,
+		lease: DefaultLease,
+	}
+}
+
+// WithTTL sets how long completed requests are replayed
+func (s *Store) WithTTL(ttl time.Duration) *Store {
+	s.ttl = ttl
+	return s
+}
+
+// Claim claims key for a request whose content hashes to requestHash. It
+// returns nil when the caller now holds the key, and must Complete or Release
+// it. It returns the completed record when the same request already ran,
+// and a conflict error when the key belongs to a request still in progress
+// or to a different request.
+//
+// The claim is a conditional put, which succeeds only if the key is new, has
+// expired, or is held by a request whose lease ran out.
+func (s *Store) Claim(ctx context.Context, key, requestHash string) (*Record, error) {
+	now := time.Now().UTC()
+	record := Record{
+		Key:            key,
+		RequestHash:    requestHash,
+		Status:         StatusInProgress,
+		CreatedAt:      now,
+		LockedUntil:    now.Add(s.lease).Unix(),
+		ExpirationTime: now.Add(s.ttl).Unix(),
+	}
+
+	item, err := dynamodbattribute.MarshalMap(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal idempotency record: %w", err)
+	}
+
+	// DynamoDB deletes expired items some time after they expire, so an
+	// expired record can still be found and is claimed over
+	_, err = s.db.PutItemWithContext(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(s.table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(idempotencyKey) OR expirationTime < :now OR (#status = :inProgress AND lockedUntil < :now)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now":        {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+			":inProgress": {S: aws.String(string(StatusInProgress))},
+		},
+	})
+	if err == nil {
+		return nil, nil
+	}
+	if !isConditionalCheckFailed(err) {
+		return nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+
+	existing, err := s.get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		// Released between the put and the read
+		return nil, apperrors.NewRequestInProgressError(key)
+	}
+
+	if err := checkExisting(existing, requestHash); err != nil {
+		return nil, err
+	}
+
+	return existing, nil
+}
+
+// Complete stores the response of the request holding key, which is
+// returned to every later request with the same key until it expires
+func (s *Store) Complete(ctx context.Context, key, requestHash, response string) error {
+	_, err := s.db.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"idempotencyKey": {S: aws.String(key)},
+		},
+		UpdateExpression:    aws.String("SET #status = :completed, #response = :response"),
+		ConditionExpression: aws.String("#status = :inProgress AND requestHash = :hash"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status":   aws.String("status"),
+			"#response": aws.String("response"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":completed":  {S: aws.String(string(StatusCompleted))},
+			":inProgress": {S: aws.String(string(StatusInProgress))},
+			":hash":       {S: aws.String(requestHash)},
+			":response":   {S: aws.String(response)},
+		},
+	})
+	if err != nil {
+		if isConditionalCheckFailed(err) {
+			return fmt.Errorf("idempotency key %s is no longer held by this request", key)
+		}
+		return fmt.Errorf("failed to complete idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+// Release gives up the claim on key without storing a response, so the
+// request can be retried with the same key
+func (s *Store) Release(ctx context.Context, key, requestHash string) error {
+	_, err := s.db.DeleteItemWithContext(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"idempotencyKey": {S: aws.String(key)},
+		},
+		ConditionExpression: aws.String("#status = :inProgress AND requestHash = :hash"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":inProgress": {S: aws.String(string(StatusInProgress))},
+			":hash":       {S: aws.String(requestHash)},
+		},
+	})
+	if err != nil && !isConditionalCheckFailed(err) {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+
+	return nil
+}
+
+// Do runs fn once for key and stores its result. A later call with the same
+// key and requestHash returns the stored result without running fn, with
+// replayed set. If fn fails, the key is released and the error returned. If
+// only storing the result fails, the result is returned with the error, and
+// the key stays held until its lease runs out.
+func (s *Store) Do(ctx context.Context, key, requestHash string, fn func() (string, error)) (result string, replayed bool, err error) {
+	existing, err := s.Claim(ctx, key, requestHash)
+	if err != nil {
+		return "", false, err
+	}
+	if existing != nil {
+		return existing.Response, true, nil
+	}
+
+	result, err = fn()
+	if err != nil {
+		if releaseErr := s.Release(ctx, key, requestHash); releaseErr != nil {
+			return "", false, fmt.Errorf("%w (%v)", err, releaseErr)
+		}
+		return "", false, err
+	}
+
+	if err := s.Complete(ctx, key, requestHash, result); err != nil {
+		return result, false, err
+	}
+
+	return result, false, nil
+}
+
+func (s *Store) get(ctx context.Context, key string) (*Record, error) {
+	result, err := s.db.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]*dynamodb.AttributeValue{
+			"idempotencyKey": {S: aws.String(key)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var record Record
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal idempotency record: %w", err)
+	}
+
+	return &record, nil
+}
+
+// checkExisting reports whether a request hashing to requestHash may reuse
+// the response of existing, the record that kept it from claiming the key
+func checkExisting(existing *Record, requestHash string) error {
+	if existing.RequestHash != requestHash {
+		return apperrors.NewIdempotencyKeyReusedError(existing.Key)
+	}
+	if existing.Status != StatusCompleted {
+		return apperrors.NewRequestInProgressError(existing.Key)
+	}
+	return nil
+}
+
+// HashRequest hashes a request body. JSON bodies are hashed in a canonical
+// form, so the same request with its fields reordered or spaced differently
+// hashes the same.
+func HashRequest(body string) string {
+	data := []byte(body)
+
+	// Numbers are kept as written, not rounded through float64
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err == nil && !decoder.More() {
+		if canonical, err := json.Marshal(value); err == nil {
+			data = canonical
+		}
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func isConditionalCheckFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
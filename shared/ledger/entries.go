@@ -0,0 +1,60 @@
+package ledger
+
+import (
+	"time"
+
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// transferEntry builds an entry moving amount from the credited account to
+// the debited one
+func transferEntry(id, reference, description string, debit, credit Account, amount types.Money, createdAt time.Time) (*JournalEntry, error) {
+	return NewJournalEntry(id, reference, description, createdAt,
+		Posting{Account: debit, Side: Debit, Amount: amount},
+		Posting{Account: credit, Side: Credit, Amount: amount},
+	)
+}
+
+// WalletDebit records a payment paid from a user's wallet: the money leaves
+// the wallet and waits in gateway clearing until the gateway confirms it
+func WalletDebit(id, userID, paymentID string, amount types.Money, createdAt time.Time) (*JournalEntry, error) {
+	return transferEntry(id, paymentID, "wallet debited for payment", WalletAccount(userID), GatewayClearing, amount, createdAt)
+}
+
+// WalletCredit records a payment's money returned to the wallet it was
+// debited from, reversing WalletDebit
+func WalletCredit(id, userID, paymentID string, amount types.Money, createdAt time.Time) (*JournalEntry, error) {
+	return transferEntry(id, paymentID, "wallet credited for payment", GatewayClearing, WalletAccount(userID), amount, createdAt)
+}
+
+// WalletDeposit records a top-up collected through the gateway
+func WalletDeposit(id, userID, depositID string, amount types.Money, createdAt time.Time) (*JournalEntry, error) {
+	return transferEntry(id, depositID, "wallet deposit", GatewayClearing, WalletAccount(userID), amount, createdAt)
+}
+
+// WalletGrant records the onboarding grant of a new wallet as a promotions expense
+func WalletGrant(id, userID string, amount types.Money, createdAt time.Time) (*JournalEntry, error) {
+	return transferEntry(id, userID, "wallet onboarding grant", Promotions, WalletAccount(userID), amount, createdAt)
+}
+
+// WalletTransfer records money moved between two users' wallets. Both legs
+// of the transfer are one entry.
+func WalletTransfer(id, fromUserID, toUserID, transferID string, amount types.Money, createdAt time.Time) (*JournalEntry, error) {
+	return transferEntry(id, transferID, "wallet transfer", WalletAccount(fromUserID), WalletAccount(toUserID), amount, createdAt)
+}
+
+// GatewayConfirmation records the gateway confirming a payment, which clears
+// it and recognises it as revenue
+func GatewayConfirmation(id, paymentID string, amount types.Money, createdAt time.Time) (*JournalEntry, error) {
+	return transferEntry(id, paymentID, "payment confirmed by gateway", GatewayClearing, Revenue, amount, createdAt)
+}
+
+// RefundApproved records a refund the platform owes, taken back from revenue
+func RefundApproved(id, paymentID string, amount types.Money, createdAt time.Time) (*JournalEntry, error) {
+	return transferEntry(id, paymentID, "refund approved", Revenue, RefundsPayable, amount, createdAt)
+}
+
+// RefundPaid records an approved refund paid back into the user's wallet
+func RefundPaid(id, userID, paymentID string, amount types.Money, createdAt time.Time) (*JournalEntry, error) {
+	return transferEntry(id, paymentID, "refund paid to wallet", RefundsPayable, WalletAccount(userID), amount, createdAt)
+}
@@ -0,0 +1,170 @@
+// Package ledger is a double-entry ledger of every movement of money between
+// user wallets and the platform's own accounts.
+//
+// Each movement is a JournalEntry whose debit and credit postings balance per
+// currency, so a cent that leaves one account always shows up in another and
+// the balance of any account can be rebuilt from its postings alone.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// ErrUnbalanced is returned for a journal entry whose debits and credits differ
+var ErrUnbalanced = errors.New("journal entry does not balance")
+
+// Side is the side of the ledger a posting is on
+type Side string
+
+const (
+	Debit  Side = "DEBIT"
+	Credit Side = "CREDIT"
+)
+
+// Account names a ledger account
+type Account string
+
+// Platform accounts. Every user wallet has its own account, see WalletAccount.
+const (
+	// GatewayClearing holds money in flight between wallets and the payment
+	// gateway. It returns to zero once the gateway confirms each payment.
+	GatewayClearing Account = "gateway_clearing"
+
+	// RefundsPayable holds refunds that were approved but not yet paid
+	// back into a wallet
+	RefundsPayable Account = "refunds_payable"
+
+	// Revenue holds payments confirmed by the gateway, net of refunds
+	Revenue Account = "revenue"
+
+	// Promotions is the expense of onboarding grants credited to new wallets
+	Promotions Account = "promotions"
+)
+
+// walletAccountPrefix starts the account name of every user wallet
+const walletAccountPrefix = "wallet:"
+
+// WalletAccount is the account of a user's wallet. It is a liability of the
+// platform: credits increase it and debits decrease it.
+func WalletAccount(userID string) Account {
+	return Account(walletAccountPrefix + userID)
+}
+
+// WalletUserID returns the user whose wallet the account is, if it is one
+func (a Account) WalletUserID() (string, bool) {
+	userID, ok := strings.CutPrefix(string(a), walletAccountPrefix)
+	return userID, ok && userID != ""
+}
+
+// NormalSide is the side that increases the account's balance: debit for
+// clearing and expense accounts, credit for wallets, payables and revenue
+func (a Account) NormalSide() Side {
+	switch a {
+	case GatewayClearing, Promotions:
+		return Debit
+	default:
+		return Credit
+	}
+}
+
+// Posting is one leg of a journal entry: amount debited or credited to an account
+type Posting struct {
+	Account Account     `json:"account" dynamodbav:"Account"`
+	Side    Side        `json:"side" dynamodbav:"Side"`
+	Amount  types.Money `json:"amount" dynamodbav:"Amount"`
+}
+
+// JournalEntry is a balanced set of postings recorded together. Reference is
+// the payment, transfer or refund the entry records.
+type JournalEntry struct {
+	ID          string    `json:"id" dynamodbav:"EntryID"`
+	Reference   string    `json:"reference" dynamodbav:"Reference"`
+	Description string    `json:"description" dynamodbav:"Description"`
+	Postings    []Posting `json:"postings" dynamodbav:"Postings"`
+	CreatedAt   time.Time `json:"createdAt" dynamodbav:"CreatedAt"`
+}
+
+// NewJournalEntry builds a journal entry and checks that it balances
+func NewJournalEntry(id, reference, description string, createdAt time.Time, postings ...Posting) (*JournalEntry, error) {
+	entry := &JournalEntry{
+		ID:          id,
+		Reference:   reference,
+		Description: description,
+		Postings:    postings,
+		CreatedAt:   createdAt,
+	}
+	if err := entry.Validate(); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// Validate checks the entry has an ID, at least one debit and one credit of
+// positive amounts, and that debits equal credits in every currency
+func (e *JournalEntry) Validate() error {
+	if e.ID == "" {
+		return fmt.Errorf("journal entry ID is required")
+	}
+
+	totals := map[string]int64{}
+	sides := map[Side]bool{}
+	for _, posting := range e.Postings {
+		if posting.Account == "" {
+			return fmt.Errorf("journal entry %s has a posting without an account", e.ID)
+		}
+		if !posting.Amount.IsPositive() {
+			return fmt.Errorf("journal entry %s posts a non-positive amount to %s", e.ID, posting.Account)
+		}
+
+		switch posting.Side {
+		case Debit:
+			totals[posting.Amount.Currency] += posting.Amount.Amount
+		case Credit:
+			totals[posting.Amount.Currency] -= posting.Amount.Amount
+		default:
+			return fmt.Errorf("journal entry %s has a posting with invalid side %q", e.ID, posting.Side)
+		}
+		sides[posting.Side] = true
+	}
+
+	if !sides[Debit] || !sides[Credit] {
+		return fmt.Errorf("%w: entry %s needs a debit and a credit leg", ErrUnbalanced, e.ID)
+	}
+	for currency, total := range totals {
+		if total != 0 {
+			return fmt.Errorf("%w: entry %s is off by %d %s minor units", ErrUnbalanced, e.ID, total, currency)
+		}
+	}
+
+	return nil
+}
+
+// Balance is the balance of account from its postings, positive on the
+// account's normal side. Postings to other accounts are ignored.
+func Balance(account Account, currency string, postings []Posting) (types.Money, error) {
+	balance := types.NewMoney(0, currency)
+	normal := account.NormalSide()
+
+	for _, posting := range postings {
+		if posting.Account != account {
+			continue
+		}
+
+		amount := posting.Amount
+		if posting.Side != normal {
+			amount = amount.Neg()
+		}
+
+		var err error
+		if balance, err = balance.Add(amount); err != nil {
+			return types.Money{}, fmt.Errorf("account %s: %w", account, err)
+		}
+	}
+
+	return balance, nil
+}
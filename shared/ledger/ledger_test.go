@@ -0,0 +1,111 @@
+package ledger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/draftea-coding-challenge/shared/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewJournalEntry_Unbalanced(t *testing.T) {
+	now := time.Now()
+
+	_, err := NewJournalEntry("e1", "pay-1", "", now,
+		Posting{Account: WalletAccount("user123"), Side: Debit, Amount: types.NewMoney(1000, "USD")},
+		Posting{Account: GatewayClearing, Side: Credit, Amount: types.NewMoney(999, "USD")},
+	)
+	assert.ErrorIs(t, err, ErrUnbalanced)
+
+	// Balanced in total but not per currency
+	_, err = NewJournalEntry("e2", "pay-1", "", now,
+		Posting{Account: WalletAccount("user123"), Side: Debit, Amount: types.NewMoney(1000, "USD")},
+		Posting{Account: GatewayClearing, Side: Credit, Amount: types.NewMoney(1000, "EUR")},
+	)
+	assert.ErrorIs(t, err, ErrUnbalanced)
+
+	// A single-sided update is never a valid entry
+	_, err = NewJournalEntry("e3", "pay-1", "", now,
+		Posting{Account: WalletAccount("user123"), Side: Credit, Amount: types.NewMoney(1000, "USD")},
+	)
+	assert.ErrorIs(t, err, ErrUnbalanced)
+
+	_, err = NewJournalEntry("e4", "pay-1", "", now,
+		Posting{Account: WalletAccount("user123"), Side: Debit, Amount: types.NewMoney(0, "USD")},
+		Posting{Account: GatewayClearing, Side: Credit, Amount: types.NewMoney(0, "USD")},
+	)
+	assert.Error(t, err)
+}
+
+func TestNewJournalEntry_SplitPostings(t *testing.T) {
+	entry, err := NewJournalEntry("e1", "pay-1", "", time.Now(),
+		Posting{Account: GatewayClearing, Side: Debit, Amount: types.NewMoney(1000, "USD")},
+		Posting{Account: Revenue, Side: Credit, Amount: types.NewMoney(900, "USD")},
+		Posting{Account: RefundsPayable, Side: Credit, Amount: types.NewMoney(100, "USD")},
+	)
+
+	assert.NoError(t, err)
+	assert.Len(t, entry.Postings, 3)
+}
+
+func TestBalance_PaymentLifecycle(t *testing.T) {
+	now := time.Now()
+	amount := types.NewMoney(2500, "USD")
+
+	var postings []Posting
+	for _, build := range []func() (*JournalEntry, error){
+		func() (*JournalEntry, error) { return WalletGrant("g", "user123", types.NewMoney(10000, "USD"), now) },
+		func() (*JournalEntry, error) { return WalletDebit("d", "user123", "pay-1", amount, now) },
+		func() (*JournalEntry, error) { return GatewayConfirmation("c", "pay-1", amount, now) },
+		func() (*JournalEntry, error) { return RefundApproved("ra", "pay-1", amount, now) },
+		func() (*JournalEntry, error) { return RefundPaid("rp", "user123", "pay-1", amount, now) },
+	} {
+		entry, err := build()
+		assert.NoError(t, err)
+		postings = append(postings, entry.Postings...)
+	}
+
+	balances := map[Account]int64{
+		WalletAccount("user123"): 10000,
+		GatewayClearing:          0,
+		Revenue:                  0,
+		RefundsPayable:           0,
+		Promotions:               10000,
+	}
+	for account, expected := range balances {
+		balance, err := Balance(account, "USD", postings)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, balance.Amount, account)
+	}
+}
+
+func TestAccount_WalletUserID(t *testing.T) {
+	userID, ok := WalletAccount("user123").WalletUserID()
+	assert.True(t, ok)
+	assert.Equal(t, "user123", userID)
+
+	_, ok = Revenue.WalletUserID()
+	assert.False(t, ok)
+}
+
+func TestStore_WriteItems(t *testing.T) {
+	store := NewStore(nil, "Ledger")
+	createdAt := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	entry, err := WalletTransfer("user1#tr-1#TRANSFER_OUT", "user1", "user2", "tr-1", types.NewMoney(500, "USD"), createdAt)
+	assert.NoError(t, err)
+
+	items, err := store.WriteItems(entry)
+	assert.NoError(t, err)
+	assert.Len(t, items, 3)
+
+	assert.Equal(t, "ENTRY#user1#tr-1#TRANSFER_OUT", aws.StringValue(items[0].Put.Item["PK"].S))
+	assert.Equal(t, "attribute_not_exists(PK)", aws.StringValue(items[0].Put.ConditionExpression))
+
+	assert.Equal(t, "ACCOUNT#wallet:user1", aws.StringValue(items[1].Put.Item["PK"].S))
+	assert.Equal(t, "2024-01-15T10:30:00Z#user1#tr-1#TRANSFER_OUT#0", aws.StringValue(items[1].Put.Item["SK"].S))
+	assert.Equal(t, "ACCOUNT#wallet:user2", aws.StringValue(items[2].Put.Item["PK"].S))
+
+	_, err = store.WriteItems(&JournalEntry{ID: "bad"})
+	assert.ErrorIs(t, err, ErrUnbalanced)
+}
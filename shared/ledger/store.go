@@ -0,0 +1,189 @@
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// ErrEntryExists is returned when posting an entry whose ID was already posted
+var ErrEntryExists = errors.New("journal entry already exists")
+
+// Key prefixes of the Ledger table, whose key is PK (hash) and SK (range).
+// An entry is stored once under its ID, and each of its postings under the
+// posting's account, sorted by time.
+const (
+	entryKeyPrefix   = "ENTRY#"
+	accountKeyPrefix = "ACCOUNT#"
+	entrySortKey     = "ENTRY"
+)
+
+// Line is a posting as stored under its account, with the entry it belongs to
+type Line struct {
+	Account     Account     `json:"account" dynamodbav:"Account"`
+	Side        Side        `json:"side" dynamodbav:"Side"`
+	Amount      types.Money `json:"amount" dynamodbav:"Amount"`
+	EntryID     string      `json:"entryId" dynamodbav:"EntryID"`
+	Reference   string      `json:"reference" dynamodbav:"Reference"`
+	Description string      `json:"description" dynamodbav:"Description"`
+	CreatedAt   time.Time   `json:"createdAt" dynamodbav:"CreatedAt"`
+}
+
+// Posting returns the line's posting
+func (l Line) Posting() Posting {
+	return Posting{Account: l.Account, Side: l.Side, Amount: l.Amount}
+}
+
+// Store keeps journal entries in a DynamoDB table
+type Store struct {
+	db    *dynamodb.DynamoDB
+	table string
+}
+
+// NewStore creates a ledger store over the given table
+func NewStore(db *dynamodb.DynamoDB, table string) *Store {
+	return &Store{
+		db:    db,
+		table: table,
+	}
+}
+
+// WriteItems builds the writes that post entry, for callers that record it in
+// the same TransactWriteItems call as the balance change it describes. The
+// first item is the entry itself, which fails its condition if the entry was
+// already posted; one item per posting follows.
+func (s *Store) WriteItems(entry *JournalEntry) ([]*dynamodb.TransactWriteItem, error) {
+	if err := entry.Validate(); err != nil {
+		return nil, err
+	}
+
+	item, err := dynamodbattribute.MarshalMap(entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal journal entry: %w", err)
+	}
+	item["PK"] = &dynamodb.AttributeValue{S: aws.String(entryKeyPrefix + entry.ID)}
+	item["SK"] = &dynamodb.AttributeValue{S: aws.String(entrySortKey)}
+
+	items := []*dynamodb.TransactWriteItem{{
+		Put: &dynamodb.Put{
+			TableName:           aws.String(s.table),
+			Item:                item,
+			ConditionExpression: aws.String("attribute_not_exists(PK)"),
+		},
+	}}
+
+	for i, posting := range entry.Postings {
+		line, err := dynamodbattribute.MarshalMap(Line{
+			Account:     posting.Account,
+			Side:        posting.Side,
+			Amount:      posting.Amount,
+			EntryID:     entry.ID,
+			Reference:   entry.Reference,
+			Description: entry.Description,
+			CreatedAt:   entry.CreatedAt,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal posting: %w", err)
+		}
+		line["PK"] = &dynamodb.AttributeValue{S: aws.String(accountKeyPrefix + string(posting.Account))}
+		line["SK"] = &dynamodb.AttributeValue{S: aws.String(lineSortKey(entry, i))}
+
+		items = append(items, &dynamodb.TransactWriteItem{
+			Put: &dynamodb.Put{
+				TableName: aws.String(s.table),
+				Item:      line,
+			},
+		})
+	}
+
+	return items, nil
+}
+
+// Post writes entry on its own. ErrEntryExists is returned if an entry with
+// the same ID was already posted, which makes retries safe.
+func (s *Store) Post(ctx context.Context, entry *JournalEntry) error {
+	items, err := s.WriteItems(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	if err != nil {
+		var canceled *dynamodb.TransactionCanceledException
+		if errors.As(err, &canceled) && len(canceled.CancellationReasons) > 0 &&
+			aws.StringValue(canceled.CancellationReasons[0].Code) == "ConditionalCheckFailed" {
+			return ErrEntryExists
+		}
+		return fmt.Errorf("failed to post journal entry %s: %w", entry.ID, err)
+	}
+
+	return nil
+}
+
+// Lines returns every posting to account, oldest first
+func (s *Store) Lines(ctx context.Context, account Account) ([]Line, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.table),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pk": {
+				S: aws.String(accountKeyPrefix + string(account)),
+			},
+		},
+		ScanIndexForward: aws.Bool(true),
+	}
+
+	lines := []Line{}
+	for {
+		result, err := s.db.QueryWithContext(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query ledger account %s: %w", account, err)
+		}
+
+		var page []Line
+		if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal ledger lines: %w", err)
+		}
+		lines = append(lines, page...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			return lines, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// AccountBalance rebuilds the balance of account from every posting to it,
+// and returns it together with those postings
+func (s *Store) AccountBalance(ctx context.Context, account Account, currency string) (types.Money, []Line, error) {
+	lines, err := s.Lines(ctx, account)
+	if err != nil {
+		return types.Money{}, nil, err
+	}
+
+	postings := make([]Posting, 0, len(lines))
+	for _, line := range lines {
+		postings = append(postings, line.Posting())
+	}
+
+	balance, err := Balance(account, currency, postings)
+	if err != nil {
+		return types.Money{}, nil, err
+	}
+
+	return balance, lines, nil
+}
+
+// lineSortKey orders an account's postings by time, keeping the postings of
+// one entry unique
+func lineSortKey(entry *JournalEntry, leg int) string {
+	return fmt.Sprintf("%s#%s#%d", entry.CreatedAt.UTC().Format(time.RFC3339Nano), entry.ID, leg)
+}
@@ -104,6 +104,31 @@ func (m *MetricsCollector) RecordCircuitBreakerEvent(ctx context.Context, state
 	m.storeMetric(ctx, metric)
 }
 
+// RecordRetryAttempts records how many times an operation was retried and how
+// it finally ended (success, failed, exhausted)
+func (m *MetricsCollector) RecordRetryAttempts(ctx context.Context, operation string, retries int, outcome string) {
+	m.logger.Info("Retry attempts recorded", map[string]interface{}{
+		"operation":  operation,
+		"retries":    retries,
+		"outcome":    outcome,
+		"metricType": "RESILIENCE_METRIC",
+	})
+
+	metric := Metric{
+		Name:      "RETRY_ATTEMPTS",
+		Value:     float64(retries),
+		Unit:      "Count",
+		Timestamp: time.Now(),
+		Tags: map[string]string{
+			"service":   m.service,
+			"operation": operation,
+			"outcome":   outcome,
+		},
+	}
+
+	m.storeMetric(ctx, metric)
+}
+
 // RecordErrorRate tracks error rates
 func (m *MetricsCollector) RecordErrorRate(ctx context.Context, errorType string) {
 	m.logger.Error("Error occurred", nil, map[string]interface{}{
@@ -5,24 +5,62 @@ import "time"
 type EventType string
 
 const (
-	EventPaymentInitiated   EventType = "payment.initiated"
-	EventInvoiceValidated   EventType = "invoice.validated"
-	EventWalletDebited      EventType = "wallet.debited"
-	EventPaymentProcessed   EventType = "payment.processed"
-	EventPaymentFailed      EventType = "payment.failed"
-	EventRefundInitiated    EventType = "refund.initiated"
-	EventWalletCredited     EventType = "wallet.credited"
-	EventRefundCompleted    EventType = "refund.completed"
+	EventPaymentInitiated     EventType = "payment.initiated"
+	EventInvoiceValidated     EventType = "invoice.validated"
+	EventWalletDebited        EventType = "wallet.debited"
+	EventPaymentProcessed     EventType = "payment.processed"
+	EventPaymentFailed        EventType = "payment.failed"
+	EventRefundInitiated      EventType = "refund.initiated"
+	EventWalletCredited       EventType = "wallet.credited"
+	EventRefundCompleted      EventType = "refund.completed"
+	EventWalletHoldPlaced     EventType = "wallet.hold_placed"
+	EventWalletHoldReleased   EventType = "wallet.hold_released"
+	EventWalletCreated        EventType = "wallet.created"
+	EventWalletDeposited      EventType = "wallet.deposited"
+	EventWalletTransferred    EventType = "wallet.transferred"
+	EventWalletStatusChanged  EventType = "wallet.status_changed"
+	EventWalletCreditLimitSet EventType = "wallet.credit_limit_set"
+
+	// EventWalletBalanceChanged is published from the Wallets table stream,
+	// not stored in PaymentEvents
+	EventWalletBalanceChanged EventType = "wallet.balance_changed"
 )
 
 type PaymentEvent struct {
-	ID            string                 `json:"id" dynamodb:"ID"`
-	PaymentID     string                 `json:"paymentId" dynamodb:"PaymentID"`
-	UserID        string                 `json:"userId" dynamodb:"UserID"`
-	EventType     string                 `json:"eventType" dynamodb:"EventType"`
-	Amount        float64                `json:"amount" dynamodb:"Amount"`
-	Status        string                 `json:"status" dynamodb:"Status"`
-	Metadata      map[string]interface{} `json:"metadata,omitempty" dynamodb:"Metadata,omitempty"`
-	CorrelationID string                 `json:"correlationId" dynamodb:"CorrelationID"`
-	Timestamp     time.Time              `json:"timestamp" dynamodb:"Timestamp"`
-}
\ No newline at end of file
+	ID            string                 `json:"id" dynamodbav:"ID"`
+	PaymentID     string                 `json:"paymentId" dynamodbav:"PaymentID"`
+	UserID        string                 `json:"userId" dynamodbav:"UserID"`
+	EventType     string                 `json:"eventType" dynamodbav:"EventType"`
+	Amount        Money                  `json:"amount" dynamodbav:"Amount"`
+	Status        string                 `json:"status" dynamodbav:"Status"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty" dynamodbav:"Metadata,omitempty"`
+	CorrelationID string                 `json:"correlationId" dynamodbav:"CorrelationID"`
+	Timestamp     time.Time              `json:"timestamp" dynamodbav:"Timestamp"`
+}
+
+// WalletBalanceChanged is published whenever a wallet's balance or held
+// amount changes. It is built from the old and new images of the Wallets
+// table stream, so every change is announced whichever service made it.
+// EventID is the stream record's event ID: a record delivered more than once
+// carries the same EventID, which consumers use to drop duplicates.
+type WalletBalanceChanged struct {
+	EventID         string       `json:"eventId"`
+	EventType       EventType    `json:"eventType"`
+	UserID          string       `json:"userId"`
+	PreviousBalance Money        `json:"previousBalance"`
+	Balance         Money        `json:"balance"`
+	Delta           Money        `json:"delta"`
+	PreviousHeld    Money        `json:"previousHeld"`
+	Held            Money        `json:"held"`
+	Available       Money        `json:"available"`
+	Status          WalletStatus `json:"status"`
+	Version         int          `json:"version"`
+
+	// The transaction behind the change, when the wallet recorded one. Holds
+	// and changes written together with their ledger records carry none.
+	TransactionID   string `json:"transactionId,omitempty"`
+	TransactionType string `json:"transactionType,omitempty"`
+	PaymentID       string `json:"paymentId,omitempty"`
+
+	ChangedAt time.Time `json:"changedAt"`
+}
@@ -0,0 +1,253 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// InvoiceStatus is the lifecycle state of an invoice
+type InvoiceStatus string
+
+const (
+	// InvoiceStatusIssued invoices are waiting to be paid, possibly in part
+	InvoiceStatusIssued InvoiceStatus = "ISSUED"
+
+	// InvoiceStatusPaid invoices were settled in full by one or more payments
+	InvoiceStatusPaid InvoiceStatus = "PAID"
+
+	// InvoiceStatusVoid invoices were cancelled and can no longer be paid.
+	// They keep their number, so a merchant's numbering has no gaps.
+	InvoiceStatusVoid InvoiceStatus = "VOID"
+)
+
+// InvoiceLineItem is one product or service billed on an invoice. Total is
+// Quantity times UnitPrice.
+type InvoiceLineItem struct {
+	Description string `json:"description" dynamodbav:"Description"`
+	Quantity    int64  `json:"quantity" dynamodbav:"Quantity"`
+	UnitPrice   Money  `json:"unitPrice" dynamodbav:"UnitPrice"`
+	Total       Money  `json:"total" dynamodbav:"Total"`
+}
+
+// InvoiceDiscount takes a fixed Amount, or RateBasisPoints of the subtotal
+// (e.g. 1000 is 10%), off an invoice. For a rate, Amount is calculated.
+type InvoiceDiscount struct {
+	Description     string `json:"description" dynamodbav:"Description"`
+	RateBasisPoints int64  `json:"rateBasisPoints,omitempty" dynamodbav:"RateBasisPoints,omitempty"`
+	Amount          Money  `json:"amount" dynamodbav:"Amount"`
+}
+
+// InvoiceTax is charged at RateBasisPoints (e.g. 2100 is 21%) on the
+// subtotal less discounts. Amount is calculated.
+type InvoiceTax struct {
+	Name            string `json:"name" dynamodbav:"Name"`
+	RateBasisPoints int64  `json:"rateBasisPoints" dynamodbav:"RateBasisPoints"`
+	Amount          Money  `json:"amount" dynamodbav:"Amount"`
+}
+
+// InvoicePayment is a completed payment applied to an invoice
+type InvoicePayment struct {
+	PaymentID string    `json:"paymentId" dynamodbav:"PaymentID"`
+	Amount    Money     `json:"amount" dynamodbav:"Amount"`
+	AppliedAt time.Time `json:"appliedAt" dynamodbav:"AppliedAt"`
+}
+
+// InvoiceReservation is part of an invoice taken by a payment still in
+// flight. It is made when the payment is created, before any funds are held,
+// and becomes an InvoicePayment when the payment completes.
+type InvoiceReservation struct {
+	PaymentID  string    `json:"paymentId" dynamodbav:"PaymentID"`
+	Amount     Money     `json:"amount" dynamodbav:"Amount"`
+	ReservedAt time.Time `json:"reservedAt" dynamodbav:"ReservedAt"`
+}
+
+// Invoice bills a user on behalf of a merchant. Number is sequential per
+// merchant, starting at 1. One or more payments settle it: it stays ISSUED
+// until AmountPaid reaches Total, and is PAID from then on. Payments in
+// flight hold Reservations, which AmountReserved sums; together with
+// AmountPaid they never exceed Total.
+type Invoice struct {
+	ID         string            `json:"id" dynamodbav:"ID"`
+	MerchantID string            `json:"merchantId" dynamodbav:"MerchantID"`
+	Number     int64             `json:"number" dynamodbav:"Number"`
+	UserID     string            `json:"userId" dynamodbav:"UserID"`
+	Currency   string            `json:"currency" dynamodbav:"Currency"`
+	LineItems  []InvoiceLineItem `json:"lineItems" dynamodbav:"LineItems"`
+	Discounts  []InvoiceDiscount `json:"discounts,omitempty" dynamodbav:"Discounts,omitempty"`
+	Taxes      []InvoiceTax      `json:"taxes,omitempty" dynamodbav:"Taxes,omitempty"`
+
+	Subtotal      Money `json:"subtotal" dynamodbav:"Subtotal"`
+	DiscountTotal Money `json:"discountTotal" dynamodbav:"DiscountTotal"`
+	TaxTotal      Money `json:"taxTotal" dynamodbav:"TaxTotal"`
+	Total         Money `json:"total" dynamodbav:"Total"`
+
+	AmountPaid Money            `json:"amountPaid" dynamodbav:"AmountPaid"`
+	Payments   []InvoicePayment `json:"payments,omitempty" dynamodbav:"Payments,omitempty"`
+
+	AmountReserved Money                `json:"amountReserved" dynamodbav:"AmountReserved"`
+	Reservations   []InvoiceReservation `json:"reservations,omitempty" dynamodbav:"Reservations,omitempty"`
+
+	Status     InvoiceStatus     `json:"status" dynamodbav:"Status"`
+	DueDate    time.Time         `json:"dueDate" dynamodbav:"DueDate"`
+	IssuedAt   time.Time         `json:"issuedAt" dynamodbav:"IssuedAt"`
+	PaidAt     *time.Time        `json:"paidAt,omitempty" dynamodbav:"PaidAt,omitempty"`
+	VoidedAt   *time.Time        `json:"voidedAt,omitempty" dynamodbav:"VoidedAt,omitempty"`
+	VoidReason string            `json:"voidReason,omitempty" dynamodbav:"VoidReason,omitempty"`
+	Metadata   map[string]string `json:"metadata,omitempty" dynamodbav:"Metadata,omitempty"`
+	Version    int64             `json:"version" dynamodbav:"Version"`
+	CreatedAt  time.Time         `json:"createdAt" dynamodbav:"CreatedAt"`
+	UpdatedAt  time.Time         `json:"updatedAt" dynamodbav:"UpdatedAt"`
+}
+
+// Calculate sets the line item totals, the discount and tax amounts and the
+// invoice totals from the line items, discounts and taxes. Every amount must
+// be in the invoice's currency, and discounts cannot exceed the subtotal.
+func (inv *Invoice) Calculate() error {
+	zero := NewMoney(0, inv.Currency)
+
+	inv.Subtotal = zero
+	for i := range inv.LineItems {
+		item := &inv.LineItems[i]
+		if !item.UnitPrice.SameCurrency(zero) {
+			return fmt.Errorf("line item %d: %w: %s and %s", i+1, ErrCurrencyMismatch, inv.Currency, item.UnitPrice.Currency)
+		}
+		item.Total = NewMoney(item.UnitPrice.Amount*item.Quantity, inv.Currency)
+		inv.Subtotal.Amount += item.Total.Amount
+	}
+
+	inv.DiscountTotal = zero
+	for i := range inv.Discounts {
+		discount := &inv.Discounts[i]
+		if discount.RateBasisPoints > 0 {
+			discount.Amount = inv.Subtotal.Portion(discount.RateBasisPoints)
+		} else if !discount.Amount.SameCurrency(zero) {
+			return fmt.Errorf("discount %d: %w: %s and %s", i+1, ErrCurrencyMismatch, inv.Currency, discount.Amount.Currency)
+		}
+		inv.DiscountTotal.Amount += discount.Amount.Amount
+	}
+	if inv.DiscountTotal.Amount > inv.Subtotal.Amount {
+		return fmt.Errorf("discounts of %s exceed the subtotal of %s", inv.DiscountTotal, inv.Subtotal)
+	}
+
+	taxable := NewMoney(inv.Subtotal.Amount-inv.DiscountTotal.Amount, inv.Currency)
+	inv.TaxTotal = zero
+	for i := range inv.Taxes {
+		tax := &inv.Taxes[i]
+		tax.Amount = taxable.Portion(tax.RateBasisPoints)
+		inv.TaxTotal.Amount += tax.Amount.Amount
+	}
+
+	inv.Total = NewMoney(taxable.Amount+inv.TaxTotal.Amount, inv.Currency)
+	if inv.AmountPaid.Currency == "" {
+		inv.AmountPaid = zero
+	}
+	if inv.AmountReserved.Currency == "" {
+		inv.AmountReserved = zero
+	}
+	return nil
+}
+
+// AmountDue returns the part of the total not paid yet
+func (inv Invoice) AmountDue() Money {
+	due := inv.Total.Amount - inv.AmountPaid.Amount
+	return NewMoney(max(due, 0), inv.Currency)
+}
+
+// AmountPayable returns the part of the amount due that no payment in
+// flight has reserved, which is the most a new payment can take
+func (inv Invoice) AmountPayable() Money {
+	payable := inv.AmountDue().Amount - inv.AmountReserved.Amount
+	return NewMoney(max(payable, 0), inv.Currency)
+}
+
+// HasReservation reports whether paymentID holds a reservation on the invoice
+func (inv Invoice) HasReservation(paymentID string) bool {
+	for _, reservation := range inv.Reservations {
+		if reservation.PaymentID == paymentID {
+			return true
+		}
+	}
+	return false
+}
+
+// Reserve takes amount of an issued invoice for a payment in flight. Once
+// reserved, the amount can only be released or applied by that payment.
+// Reserving for a payment that holds a reservation or was applied is
+// ignored, so reserving again is safe.
+func (inv *Invoice) Reserve(paymentID string, amount Money, at time.Time) error {
+	if inv.HasReservation(paymentID) || inv.HasPayment(paymentID) {
+		return nil
+	}
+	if inv.Status != InvoiceStatusIssued {
+		return fmt.Errorf("invoice %s is %s", inv.ID, inv.Status)
+	}
+	if !amount.IsPositive() || amount.Amount > inv.AmountPayable().Amount {
+		return fmt.Errorf("invoice %s has %s left to reserve, not %s", inv.ID, inv.AmountPayable(), amount)
+	}
+
+	reserved, err := inv.AmountReserved.Add(amount)
+	if err != nil {
+		return err
+	}
+
+	inv.AmountReserved = reserved
+	inv.Reservations = append(inv.Reservations, InvoiceReservation{
+		PaymentID:  paymentID,
+		Amount:     amount,
+		ReservedAt: at,
+	})
+	return nil
+}
+
+// Release drops the reservation of a payment that will not complete, and
+// reports whether it had one
+func (inv *Invoice) Release(paymentID string) bool {
+	for i, reservation := range inv.Reservations {
+		if reservation.PaymentID == paymentID {
+			inv.AmountReserved = NewMoney(inv.AmountReserved.Amount-reservation.Amount.Amount, inv.Currency)
+			inv.Reservations = append(inv.Reservations[:i], inv.Reservations[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// HasPayment reports whether paymentID was already applied to the invoice
+func (inv Invoice) HasPayment(paymentID string) bool {
+	for _, payment := range inv.Payments {
+		if payment.PaymentID == paymentID {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplyPayment applies a completed payment to an issued invoice, in place of
+// its reservation if it has one, marking it PAID once the total is covered.
+// A payment that was already applied is ignored, so applying it again is safe.
+func (inv *Invoice) ApplyPayment(paymentID string, amount Money, at time.Time) error {
+	if inv.HasPayment(paymentID) {
+		return nil
+	}
+	if inv.Status != InvoiceStatusIssued {
+		return fmt.Errorf("invoice %s is %s", inv.ID, inv.Status)
+	}
+	inv.Release(paymentID)
+
+	paid, err := inv.AmountPaid.Add(amount)
+	if err != nil {
+		return err
+	}
+
+	inv.AmountPaid = paid
+	inv.Payments = append(inv.Payments, InvoicePayment{
+		PaymentID: paymentID,
+		Amount:    amount,
+		AppliedAt: at,
+	})
+	if paid.Amount >= inv.Total.Amount {
+		inv.Status = InvoiceStatusPaid
+		inv.PaidAt = &at
+	}
+	return nil
+}
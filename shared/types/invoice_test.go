@@ -0,0 +1,109 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestInvoice() *Invoice {
+	return &Invoice{
+		ID:       "inv-1",
+		Currency: "USD",
+		Status:   InvoiceStatusIssued,
+		LineItems: []InvoiceLineItem{
+			{Description: "Season pass", Quantity: 1, UnitPrice: NewMoney(4999, "USD")},
+			{Description: "Extra lineup", Quantity: 3, UnitPrice: NewMoney(500, "USD")},
+		},
+		Discounts: []InvoiceDiscount{
+			{Description: "Welcome", RateBasisPoints: 1000},
+			{Description: "Coupon", Amount: NewMoney(100, "USD")},
+		},
+		Taxes: []InvoiceTax{
+			{Name: "VAT", RateBasisPoints: 2100},
+		},
+	}
+}
+
+func TestInvoice_Calculate(t *testing.T) {
+	invoice := newTestInvoice()
+	require.NoError(t, invoice.Calculate())
+
+	assert.Equal(t, int64(1500), invoice.LineItems[1].Total.Amount)
+	assert.Equal(t, int64(6499), invoice.Subtotal.Amount)
+
+	// 10% of 64.99 is 6.499, rounded to 6.50
+	assert.Equal(t, int64(650), invoice.Discounts[0].Amount.Amount)
+	assert.Equal(t, int64(750), invoice.DiscountTotal.Amount)
+
+	// 21% of 57.49 is 12.0729
+	assert.Equal(t, int64(1207), invoice.Taxes[0].Amount.Amount)
+	assert.Equal(t, int64(1207), invoice.TaxTotal.Amount)
+	assert.Equal(t, NewMoney(6956, "USD"), invoice.Total)
+	assert.Equal(t, NewMoney(0, "USD"), invoice.AmountPaid)
+	assert.Equal(t, invoice.Total, invoice.AmountDue())
+}
+
+func TestInvoice_CalculateRejectsInvalidAmounts(t *testing.T) {
+	invoice := newTestInvoice()
+	invoice.LineItems[0].UnitPrice = NewMoney(4999, "EUR")
+	assert.ErrorIs(t, invoice.Calculate(), ErrCurrencyMismatch)
+
+	invoice = newTestInvoice()
+	invoice.Discounts = []InvoiceDiscount{{Description: "Too much", Amount: NewMoney(10000, "USD")}}
+	assert.Error(t, invoice.Calculate())
+}
+
+func TestInvoice_ApplyPayment(t *testing.T) {
+	invoice := newTestInvoice()
+	require.NoError(t, invoice.Calculate())
+	now := time.Now().UTC()
+
+	require.NoError(t, invoice.ApplyPayment("pay-1", NewMoney(5000, "USD"), now))
+	assert.Equal(t, InvoiceStatusIssued, invoice.Status)
+	assert.Equal(t, int64(1956), invoice.AmountDue().Amount)
+
+	// Applying the same payment again changes nothing
+	require.NoError(t, invoice.ApplyPayment("pay-1", NewMoney(5000, "USD"), now))
+	assert.Len(t, invoice.Payments, 1)
+
+	require.NoError(t, invoice.ApplyPayment("pay-2", NewMoney(1956, "USD"), now))
+	assert.Equal(t, InvoiceStatusPaid, invoice.Status)
+	assert.NotNil(t, invoice.PaidAt)
+	assert.True(t, invoice.AmountDue().IsZero())
+
+	assert.Error(t, invoice.ApplyPayment("pay-3", NewMoney(100, "USD"), now))
+}
+
+func TestInvoice_Reserve(t *testing.T) {
+	invoice := newTestInvoice()
+	require.NoError(t, invoice.Calculate())
+	now := time.Now().UTC()
+
+	require.NoError(t, invoice.Reserve("pay-1", NewMoney(5000, "USD"), now))
+	assert.Equal(t, int64(6956), invoice.AmountDue().Amount)
+	assert.Equal(t, int64(1956), invoice.AmountPayable().Amount)
+
+	// Reserving again changes nothing; a payment in flight cannot overpay it
+	require.NoError(t, invoice.Reserve("pay-1", NewMoney(5000, "USD"), now))
+	assert.Len(t, invoice.Reservations, 1)
+	assert.Error(t, invoice.Reserve("pay-2", NewMoney(1957, "USD"), now))
+
+	require.NoError(t, invoice.Reserve("pay-2", NewMoney(1956, "USD"), now))
+	assert.True(t, invoice.Release("pay-2"))
+	assert.False(t, invoice.Release("pay-2"))
+	assert.Equal(t, int64(5000), invoice.AmountReserved.Amount)
+
+	// Applying the payment takes the place of its reservation
+	require.NoError(t, invoice.ApplyPayment("pay-1", NewMoney(5000, "USD"), now))
+	assert.Empty(t, invoice.Reservations)
+	assert.True(t, invoice.AmountReserved.IsZero())
+	assert.Equal(t, int64(1956), invoice.AmountPayable().Amount)
+	assert.NoError(t, invoice.Reserve("pay-1", NewMoney(5000, "USD"), now))
+	assert.Empty(t, invoice.Reservations)
+
+	invoice.Status = InvoiceStatusVoid
+	assert.Error(t, invoice.Reserve("pay-3", NewMoney(100, "USD"), now))
+}
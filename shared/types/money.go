@@ -0,0 +1,242 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrCurrencyMismatch is returned when combining amounts in different currencies
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// currencyExponents maps ISO 4217 codes to the number of decimal places of
+// their minor unit. Currencies not listed use two decimal places.
+var currencyExponents = map[string]int{
+	"BHD": 3,
+	"CLP": 0,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"PYG": 0,
+}
+
+// Money is a monetary amount held as an integer number of minor units
+// (cents for USD) together with its ISO 4217 currency code.
+//
+// It marshals to JSON as {"amount":1050,"currency":"USD"} and to DynamoDB as
+// a map with a numeric Amount and a string Currency, so every service reads
+// and writes the exact same value.
+//
+// Converting from a decimal representation (ParseMoney, FromMajor) rounds to
+// the nearest minor unit with ties going to the even neighbour (banker's
+// rounding). Arithmetic between two Money values is exact and never rounds.
+type Money struct {
+	Amount   int64  `json:"amount" dynamodbav:"Amount"`
+	Currency string `json:"currency" dynamodbav:"Currency"`
+}
+
+// NewMoney creates a Money value from an amount in minor units
+func NewMoney(amount int64, currency string) Money {
+	return Money{
+		Amount:   amount,
+		Currency: strings.ToUpper(currency),
+	}
+}
+
+// ParseMoney parses a decimal amount in major units (e.g. "10.505") and
+// rounds it half-to-even to the currency's minor unit.
+func ParseMoney(value, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	exponent := CurrencyExponent(currency)
+
+	s := strings.TrimSpace(value)
+	negative := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		negative = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return Money{}, fmt.Errorf("invalid amount %q", value)
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+	for _, r := range intPart + fracPart {
+		if r < '0' || r > '9' {
+			return Money{}, fmt.Errorf("invalid amount %q", value)
+		}
+	}
+
+	// Split the fraction into the digits we keep and the ones we round away
+	kept := fracPart
+	var dropped string
+	if len(kept) > exponent {
+		kept, dropped = fracPart[:exponent], fracPart[exponent:]
+	}
+	kept += strings.Repeat("0", exponent-len(kept))
+
+	minor, err := strconv.ParseInt(intPart+kept, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("amount %q out of range: %w", value, err)
+	}
+
+	if roundUp(dropped, minor) {
+		if minor == math.MaxInt64 {
+			return Money{}, fmt.Errorf("amount %q out of range", value)
+		}
+		minor++
+	}
+
+	if negative {
+		minor = -minor
+	}
+
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// FromMajor converts a floating point amount in major units to Money using
+// the same half-to-even rule as ParseMoney. It exists for boundaries that
+// still hand us floats; new code should pass minor units instead.
+func FromMajor(value float64, currency string) (Money, error) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return Money{}, fmt.Errorf("invalid amount %v", value)
+	}
+	return ParseMoney(strconv.FormatFloat(value, 'f', -1, 64), currency)
+}
+
+// roundUp reports whether the discarded digits round the kept value up
+func roundUp(dropped string, kept int64) bool {
+	if dropped == "" {
+		return false
+	}
+	switch {
+	case dropped[0] > '5':
+		return true
+	case dropped[0] < '5':
+		return false
+	}
+	// Exactly half only if every remaining digit is zero; then round to even
+	if strings.Trim(dropped[1:], "0") != "" {
+		return true
+	}
+	return kept%2 != 0
+}
+
+// CurrencyExponent returns the number of decimal places of a currency's minor unit
+func CurrencyExponent(currency string) int {
+	if exp, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return exp
+	}
+	return 2
+}
+
+// IsZero reports whether the amount is zero
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsPositive reports whether the amount is greater than zero
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// IsNegative reports whether the amount is less than zero
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// SameCurrency reports whether both amounts are in the same currency
+func (m Money) SameCurrency(other Money) bool {
+	return strings.EqualFold(m.Currency, other.Currency)
+}
+
+// Add returns m + other
+func (m Money) Add(other Money) (Money, error) {
+	if !m.SameCurrency(other) {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns m - other
+func (m Money) Sub(other Money) (Money, error) {
+	if !m.SameCurrency(other) {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}, nil
+}
+
+// Neg returns the amount with its sign flipped
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// Cmp compares two amounts and returns -1, 0 or +1
+func (m Money) Cmp(other Money) (int, error) {
+	if !m.SameCurrency(other) {
+		return 0, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Portion returns basisPoints hundredths of a percent of the amount (e.g.
+// 2100 is 21%), rounded half-to-even to the minor unit like ParseMoney
+func (m Money) Portion(basisPoints int64) Money {
+	product := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(basisPoints))
+	quotient, remainder := new(big.Int).QuoRem(product, big.NewInt(10000), new(big.Int))
+
+	// Compare twice the dropped part with the divisor; on a tie, round to even
+	twice := new(big.Int).Abs(remainder)
+	twice.Lsh(twice, 1)
+	if cmp := twice.Cmp(big.NewInt(10000)); cmp > 0 || (cmp == 0 && quotient.Bit(0) == 1) {
+		quotient.Add(quotient, big.NewInt(int64(product.Sign())))
+	}
+
+	return Money{Amount: quotient.Int64(), Currency: m.Currency}
+}
+
+// Decimal formats the amount in major units, e.g. "10.50"
+func (m Money) Decimal() string {
+	exponent := CurrencyExponent(m.Currency)
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+	}
+
+	digits := strconv.FormatUint(absInt64(amount), 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	split := len(digits) - exponent
+	return sign + digits[:split] + "." + digits[split:]
+}
+
+// String formats the amount for logs and messages, e.g. "10.50 USD"
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+func absInt64(v int64) uint64 {
+	if v < 0 {
+		return uint64(-(v + 1)) + 1
+	}
+	return uint64(v)
+}
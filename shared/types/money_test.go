@@ -0,0 +1,106 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney_RoundsHalfToEven(t *testing.T) {
+	cases := map[string]int64{
+		"10":      1000,
+		"10.5":    1050,
+		"10.50":   1050,
+		"0.285":   28,
+		"0.295":   30,
+		"0.2851":  29,
+		"-0.285":  -28,
+		"1250.50": 125050,
+	}
+
+	for input, expected := range cases {
+		money, err := ParseMoney(input, "usd")
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, money.Amount, input)
+		assert.Equal(t, "USD", money.Currency)
+	}
+}
+
+func TestParseMoney_ZeroDecimalCurrency(t *testing.T) {
+	money, err := ParseMoney("1500.5", "JPY")
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1500), money.Amount)
+	assert.Equal(t, "1500 JPY", money.String())
+}
+
+func TestParseMoney_Invalid(t *testing.T) {
+	for _, input := range []string{"", ".", "abc", "1.2.3", "1e5"} {
+		_, err := ParseMoney(input, "USD")
+		assert.Error(t, err, input)
+	}
+}
+
+func TestFromMajor_AvoidsFloatDrift(t *testing.T) {
+	money, err := FromMajor(0.1+0.2, "USD")
+
+	assert.NoError(t, err)
+	assert.Equal(t, int64(30), money.Amount)
+}
+
+func TestMoney_ArithmeticRequiresSameCurrency(t *testing.T) {
+	usd := NewMoney(1000, "USD")
+	eur := NewMoney(1000, "EUR")
+
+	sum, err := usd.Add(NewMoney(250, "USD"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1250), sum.Amount)
+
+	_, err = usd.Sub(eur)
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	_, err = usd.Cmp(eur)
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+}
+
+func TestMoney_Decimal(t *testing.T) {
+	assert.Equal(t, "0.05", NewMoney(5, "USD").Decimal())
+	assert.Equal(t, "-12.30", NewMoney(-1230, "USD").Decimal())
+	assert.Equal(t, "1.000", NewMoney(1000, "KWD").Decimal())
+}
+
+func TestMoney_Portion(t *testing.T) {
+	cases := []struct {
+		amount      int64
+		basisPoints int64
+		expected    int64
+	}{
+		{10000, 2100, 2100},
+		{1250, 1000, 125},
+		{125, 1000, 12}, // 12.5 rounds to even
+		{135, 1000, 14}, // 13.5 rounds to even
+		{126, 1000, 13}, // 12.6 rounds up
+		{-125, 1000, -12},
+		{999, 0, 0},
+	}
+
+	for _, c := range cases {
+		portion := NewMoney(c.amount, "usd").Portion(c.basisPoints)
+		assert.Equal(t, c.expected, portion.Amount, "%d at %d bp", c.amount, c.basisPoints)
+		assert.Equal(t, "USD", portion.Currency)
+	}
+}
+
+func TestMoney_JSONRoundTrip(t *testing.T) {
+	data, err := json.Marshal(NewMoney(1050, "USD"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"amount":1050,"currency":"USD"}`, string(data))
+
+	var money Money
+	assert.NoError(t, json.Unmarshal(data, &money))
+	assert.Equal(t, NewMoney(1050, "USD"), money)
+
+	// Fractional minor units are rejected rather than silently truncated
+	assert.Error(t, json.Unmarshal([]byte(`{"amount":10.5,"currency":"USD"}`), &money))
+}
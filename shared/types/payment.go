@@ -1,6 +1,7 @@
 package types
 
 import (
+	"fmt"
 	"time"
 )
 
@@ -12,26 +13,32 @@ const (
 	PaymentStatusCompleted  PaymentStatus = "COMPLETED"
 	PaymentStatusFailed     PaymentStatus = "FAILED"
 	PaymentStatusRefunded   PaymentStatus = "REFUNDED"
+
+	// PaymentStatusPartiallyRefunded payments had part of their amount refunded
+	PaymentStatusPartiallyRefunded PaymentStatus = "PARTIALLY_REFUNDED"
+
+	// PaymentStatusCancelled payments were abandoned by the client while
+	// PENDING, before any money moved
+	PaymentStatusCancelled PaymentStatus = "CANCELLED"
 )
 
 type Payment struct {
 	ID            string            `json:"id" dynamodbav:"ID"`
 	UserID        string            `json:"userId" dynamodbav:"UserID"`
-	Amount        float64           `json:"amount" dynamodbav:"Amount"`
-	Currency      string            `json:"currency" dynamodbav:"Currency"`
+	Amount        Money             `json:"amount" dynamodbav:"Amount"`
 	Status        PaymentStatus     `json:"status" dynamodbav:"Status"`
 	ExternalID    string            `json:"externalId,omitempty" dynamodbav:"ExternalID,omitempty"`
 	CorrelationID string            `json:"correlationId" dynamodbav:"CorrelationID"`
 	Metadata      map[string]string `json:"metadata,omitempty" dynamodbav:"Metadata,omitempty"`
 	RefundReason  string            `json:"refundReason,omitempty" dynamodbav:"RefundReason,omitempty"`
+	InvoiceID     string            `json:"invoiceId,omitempty" dynamodbav:"InvoiceID,omitempty"`
 	CreatedAt     time.Time         `json:"createdAt" dynamodbav:"CreatedAt"`
 	UpdatedAt     time.Time         `json:"updatedAt" dynamodbav:"UpdatedAt"`
 }
 
 type PaymentRequest struct {
 	UserID        string            `json:"userId"`
-	Amount        float64           `json:"amount"`
-	Currency      string            `json:"currency"`
+	Amount        Money             `json:"amount"`
 	IdempotencyKey string           `json:"idempotencyKey"`
 	Metadata      map[string]string `json:"metadata,omitempty"`
 }
@@ -40,8 +47,7 @@ type StepFunctionInput struct {
 	Action        string            `json:"action"`
 	PaymentID     string            `json:"paymentId,omitempty"`
 	UserID        string            `json:"userId,omitempty"`
-	Amount        float64           `json:"amount,omitempty"`
-	Currency      string            `json:"currency,omitempty"`
+	Amount        Money             `json:"amount"`
 	Status        string            `json:"status,omitempty"`
 	ExternalID    string            `json:"externalId,omitempty"`
 	CorrelationID string            `json:"correlationId,omitempty"`
@@ -60,22 +66,332 @@ type PaymentResponse struct {
 	Message string        `json:"message,omitempty"`
 }
 
+// Wallet holds a user's funds. Balance is the total owned by the user and
+// Held is the part of it reserved by active holds; see Available.
 type Wallet struct {
 	UserID    string    `json:"userId" dynamodbav:"UserID"`
-	Balance   float64   `json:"balance" dynamodbav:"Balance"`
-	Currency  string    `json:"currency" dynamodbav:"Currency"`
+	Balance   Money     `json:"balance" dynamodbav:"Balance"`
+	Held      Money     `json:"held" dynamodbav:"Held"`
 	Version   int       `json:"version" dynamodbav:"Version"`
 	UpdatedAt time.Time `json:"updatedAt" dynamodbav:"UpdatedAt"`
 	CreatedAt time.Time `json:"createdAt" dynamodbav:"CreatedAt"`
+
+	// Status controls which balance changes the wallet accepts. The reason,
+	// actor and time of the last change are kept for audit.
+	Status          WalletStatus `json:"status" dynamodbav:"Status,omitempty"`
+	StatusReason    string       `json:"statusReason,omitempty" dynamodbav:"StatusReason,omitempty"`
+	StatusChangedBy string       `json:"statusChangedBy,omitempty" dynamodbav:"StatusChangedBy,omitempty"`
+	StatusChangedAt *time.Time   `json:"statusChangedAt,omitempty" dynamodbav:"StatusChangedAt,omitempty"`
+
+	// CreditLimit is how far below zero Balance may go. A negative balance is
+	// an overdraft on this credit line; credits pay it back before anything
+	// else, since they are added to the same balance. Wallets without one have
+	// a zero limit.
+	CreditLimit Money `json:"creditLimit" dynamodbav:"CreditLimit"`
+
+	// LastTransaction names the debit or credit last applied by a single
+	// write, so a reader of the table's stream can tell which payment moved
+	// the balance. Its balances are not recorded.
+	LastTransaction *WalletTransaction `json:"-" dynamodbav:"LastTransaction,omitempty"`
+
+	// SpendingLimits are the user's own limits, overriding the defaults, and
+	// Spending is what the wallet has spent against its limits. Both live on
+	// the wallet so a debit is checked against them in its write's condition.
+	SpendingLimits *SpendingLimits `json:"-" dynamodbav:"SpendingLimits,omitempty"`
+	Spending       *Spending       `json:"-" dynamodbav:"Spending,omitempty"`
+}
+
+// Available returns the part of the balance and credit line not reserved by
+// holds, which is what can still be debited or held
+func (w Wallet) Available() Money {
+	return Money{Amount: w.Balance.Amount - w.Held.Amount + w.CreditLimit.Amount, Currency: w.Balance.Currency}
+}
+
+// Overdraft returns how far the balance is below zero: the part of the
+// credit line in use
+func (w Wallet) Overdraft() Money {
+	return overdraft(w.Balance)
+}
+
+// CurrentStatus returns the wallet's status. Wallets created before statuses
+// existed have none and are ACTIVE.
+func (w Wallet) CurrentStatus() WalletStatus {
+	if w.Status == "" {
+		return WalletStatusActive
+	}
+	return w.Status
+}
+
+// WalletStatus is the lifecycle state of a wallet
+type WalletStatus string
+
+const (
+	// WalletStatusActive accepts debits, holds and credits
+	WalletStatusActive WalletStatus = "ACTIVE"
+	// WalletStatusFrozen accepts credits only, e.g. while fraud is investigated
+	WalletStatusFrozen WalletStatus = "FROZEN"
+	// WalletStatusClosed accepts no balance changes and cannot be reopened
+	WalletStatusClosed WalletStatus = "CLOSED"
+)
+
+// IsValid reports whether s is a known wallet status
+func (s WalletStatus) IsValid() bool {
+	switch s {
+	case WalletStatusActive, WalletStatusFrozen, WalletStatusClosed:
+		return true
+	}
+	return false
 }
 
+// AllowsDebits reports whether funds can leave a wallet in this status
+func (s WalletStatus) AllowsDebits() bool {
+	return s == WalletStatusActive
+}
+
+// AllowsCredits reports whether funds can enter a wallet in this status
+func (s WalletStatus) AllowsCredits() bool {
+	return s == WalletStatusActive || s == WalletStatusFrozen
+}
+
+// HoldStatus is the lifecycle state of a wallet hold
+type HoldStatus string
+
+const (
+	HoldStatusHeld     HoldStatus = "HELD"
+	HoldStatusCaptured HoldStatus = "CAPTURED"
+	HoldStatusReleased HoldStatus = "RELEASED"
+	HoldStatusExpired  HoldStatus = "EXPIRED"
+)
+
+// WalletHold reserves part of a wallet's balance for a payment until it is
+// captured (debited), released, or expires
+type WalletHold struct {
+	ID        string     `json:"id" dynamodbav:"ID"`
+	UserID    string     `json:"userId" dynamodbav:"UserID"`
+	PaymentID string     `json:"paymentId" dynamodbav:"PaymentID"`
+	Amount    Money      `json:"amount" dynamodbav:"Amount"`
+	Status    HoldStatus `json:"status" dynamodbav:"Status"`
+	ExpiresAt time.Time  `json:"expiresAt" dynamodbav:"ExpiresAt"`
+	CreatedAt time.Time  `json:"createdAt" dynamodbav:"CreatedAt"`
+	UpdatedAt time.Time  `json:"updatedAt" dynamodbav:"UpdatedAt"`
+}
+
+// Wallet transaction types
+const (
+	TransactionTypeDebit  = "DEBIT"
+	TransactionTypeCredit = "CREDIT"
+
+	// TransactionTypeGrant is the onboarding grant credited when a wallet is created
+	TransactionTypeGrant = "GRANT"
+
+	// TransactionTypeDeposit is a top-up charged through the payment gateway
+	TransactionTypeDeposit = "DEPOSIT"
+
+	// TransactionTypeTransferOut and TransactionTypeTransferIn are the two
+	// legs of a wallet-to-wallet transfer
+	TransactionTypeTransferOut = "TRANSFER_OUT"
+	TransactionTypeTransferIn  = "TRANSFER_IN"
+)
+
 type WalletTransaction struct {
 	ID            string    `json:"id" dynamodbav:"ID"`
 	UserID        string    `json:"userId" dynamodbav:"UserID"`
 	PaymentID     string    `json:"paymentId" dynamodbav:"PaymentID"`
-	Type          string    `json:"type" dynamodbav:"Type"` // DEBIT, CREDIT
-	Amount        float64   `json:"amount" dynamodbav:"Amount"`
-	BalanceBefore float64   `json:"balanceBefore" dynamodbav:"BalanceBefore"`
-	BalanceAfter  float64   `json:"balanceAfter" dynamodbav:"BalanceAfter"`
+	Type          string    `json:"type" dynamodbav:"Type"` // DEBIT, CREDIT, GRANT, DEPOSIT, TRANSFER_OUT, TRANSFER_IN
+	Amount        Money     `json:"amount" dynamodbav:"Amount"`
+	// BalanceBefore and BalanceAfter are only recorded by writes that read
+	// the wallet; a single-write debit or credit leaves them unset
+	BalanceBefore *Money    `json:"balanceBefore,omitempty" dynamodbav:"BalanceBefore,omitempty"`
+	BalanceAfter  *Money    `json:"balanceAfter,omitempty" dynamodbav:"BalanceAfter,omitempty"`
 	Timestamp     time.Time `json:"timestamp" dynamodbav:"Timestamp"`
-}
\ No newline at end of file
+	// TransferID and CounterpartyID are set on both legs of a transfer
+	TransferID     string `json:"transferId,omitempty" dynamodbav:"TransferID,omitempty"`
+	CounterpartyID string `json:"counterpartyId,omitempty" dynamodbav:"CounterpartyID,omitempty"`
+}
+
+// TimestampKeyLayout formats time-valued sort keys: the Timestamp range key of
+// WalletTransactions and the ExpiresAt key of the WalletHolds expiry index.
+// Unlike time.RFC3339Nano it always writes nine fractional digits, so keys
+// written in UTC sort as strings in time order.
+const TimestampKeyLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// TimestampKey formats t as a time-valued sort key, or as a bound of a query
+// on one
+func TimestampKey(t time.Time) string {
+	return t.UTC().Format(TimestampKeyLayout)
+}
+
+// OverdraftDrawn is the part of the transaction that took the balance further
+// below zero. It is zero when the balances were not recorded.
+func (t WalletTransaction) OverdraftDrawn() Money {
+	if t.BalanceBefore == nil || t.BalanceAfter == nil {
+		return NewMoney(0, t.Amount.Currency)
+	}
+	drawn := overdraft(*t.BalanceAfter).Amount - overdraft(*t.BalanceBefore).Amount
+	return NewMoney(max(drawn, 0), t.Amount.Currency)
+}
+
+// OverdraftRepaid is the part of the transaction that paid back an overdraft.
+// It is zero when the balances were not recorded.
+func (t WalletTransaction) OverdraftRepaid() Money {
+	if t.BalanceBefore == nil || t.BalanceAfter == nil {
+		return NewMoney(0, t.Amount.Currency)
+	}
+	repaid := overdraft(*t.BalanceBefore).Amount - overdraft(*t.BalanceAfter).Amount
+	return NewMoney(max(repaid, 0), t.Amount.Currency)
+}
+
+// Delta is the signed change the transaction made to the wallet's balance:
+// negative for DEBIT and TRANSFER_OUT, positive for every other type
+func (t WalletTransaction) Delta() Money {
+	switch t.Type {
+	case TransactionTypeDebit, TransactionTypeTransferOut:
+		return t.Amount.Neg()
+	}
+	return t.Amount
+}
+
+// WalletDrift is one wallet's entry in a reconciliation report: its stored
+// balance and Version next to the ones replayed from its ledger events.
+// Settled is false when the wallet changed while the report was running, so
+// the difference may only be a write the replay did not see.
+type WalletDrift struct {
+	ReportID        string    `json:"reportId" dynamodbav:"ReportID"`
+	UserID          string    `json:"userId" dynamodbav:"UserID"`
+	StoredBalance   Money     `json:"storedBalance" dynamodbav:"StoredBalance"`
+	ReplayedBalance Money     `json:"replayedBalance" dynamodbav:"ReplayedBalance"`
+	Difference      Money     `json:"difference" dynamodbav:"Difference"`
+	StoredVersion   int       `json:"storedVersion" dynamodbav:"StoredVersion"`
+	ExpectedVersion int       `json:"expectedVersion" dynamodbav:"ExpectedVersion"`
+	Events          int       `json:"events" dynamodbav:"Events"`
+	Reasons         []string  `json:"reasons" dynamodbav:"Reasons"`
+	Settled         bool      `json:"settled" dynamodbav:"Settled"`
+	Frozen          bool      `json:"frozen" dynamodbav:"Frozen"`
+	DetectedAt      time.Time `json:"detectedAt" dynamodbav:"DetectedAt"`
+}
+
+// HasReason reports whether reason is among the drift's reasons
+func (d WalletDrift) HasReason(reason string) bool {
+	for _, r := range d.Reasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// Spending limit periods, each a calendar period in UTC
+const (
+	SpendingPeriodDaily   = "daily"
+	SpendingPeriodWeekly  = "weekly"
+	SpendingPeriodMonthly = "monthly"
+)
+
+// SpendingPeriods orders the periods from shortest to longest
+var SpendingPeriods = []string{SpendingPeriodDaily, SpendingPeriodWeekly, SpendingPeriodMonthly}
+
+// SpendingPeriodKey names the period containing t: its UTC date for daily,
+// its ISO week for weekly and its month for monthly
+func SpendingPeriodKey(period string, t time.Time) string {
+	t = t.UTC()
+	switch period {
+	case SpendingPeriodDaily:
+		return t.Format("2006-01-02")
+	case SpendingPeriodWeekly:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%04d-W%02d", year, week)
+	default:
+		return t.Format("2006-01")
+	}
+}
+
+// SpendingPeriodStart returns when the period containing t began. Weeks
+// start on Monday, like ISO weeks.
+func SpendingPeriodStart(period string, t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case SpendingPeriodDaily:
+		return day
+	case SpendingPeriodWeekly:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	default:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// SpendingLimits caps how much a user can spend in each calendar day, week
+// and month. As a per-user override, a nil limit falls back to the default
+// for that period.
+type SpendingLimits struct {
+	UserID    string    `json:"userId" dynamodbav:"UserID"`
+	Daily     *Money    `json:"daily,omitempty" dynamodbav:"Daily,omitempty"`
+	Weekly    *Money    `json:"weekly,omitempty" dynamodbav:"Weekly,omitempty"`
+	Monthly   *Money    `json:"monthly,omitempty" dynamodbav:"Monthly,omitempty"`
+	UpdatedBy string    `json:"updatedBy,omitempty" dynamodbav:"UpdatedBy,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt" dynamodbav:"UpdatedAt"`
+}
+
+// Resolve returns each period's limit in currency: the override if there is
+// one in that currency, otherwise the default from defaults, which are keyed
+// by period. A period with neither is unlimited and left out.
+func (l *SpendingLimits) Resolve(defaults map[string]Money, currency string) map[string]Money {
+	var overrides map[string]*Money
+	if l != nil {
+		overrides = map[string]*Money{
+			SpendingPeriodDaily:   l.Daily,
+			SpendingPeriodWeekly:  l.Weekly,
+			SpendingPeriodMonthly: l.Monthly,
+		}
+	}
+
+	limits := map[string]Money{}
+	for _, period := range SpendingPeriods {
+		if limit := overrides[period]; limit != nil && limit.SameCurrency(Money{Currency: currency}) {
+			limits[period] = *limit
+			continue
+		}
+		if limit, ok := defaults[period]; ok {
+			limits[period] = limit
+		}
+	}
+	return limits
+}
+
+// SpendingWindow is how much a wallet has spent in one period, in minor units
+// of its currency. Remaining is Limit minus Spent, kept so that a write can
+// compare it with an amount in its condition. A window without a Limit is
+// unlimited and its Remaining is not checked.
+type SpendingWindow struct {
+	Period    string `json:"period" dynamodbav:"Period"`
+	Limit     *int64 `json:"limit,omitempty" dynamodbav:"Limit,omitempty"`
+	Spent     int64  `json:"spent" dynamodbav:"Spent"`
+	Remaining int64  `json:"remaining" dynamodbav:"Remaining"`
+}
+
+// Spending is what a wallet has spent in its current day, week and month.
+// Defaults names the default limits the windows were last set with, so a
+// write that does not read the wallet can tell they are still in force.
+type Spending struct {
+	Defaults string         `json:"defaults" dynamodbav:"Defaults"`
+	Daily    SpendingWindow `json:"daily" dynamodbav:"Daily"`
+	Weekly   SpendingWindow `json:"weekly" dynamodbav:"Weekly"`
+	Monthly  SpendingWindow `json:"monthly" dynamodbav:"Monthly"`
+}
+
+// Window returns the window of period
+func (s *Spending) Window(period string) *SpendingWindow {
+	switch period {
+	case SpendingPeriodDaily:
+		return &s.Daily
+	case SpendingPeriodWeekly:
+		return &s.Weekly
+	default:
+		return &s.Monthly
+	}
+}
+
+// overdraft is how far balance is below zero, or zero
+func overdraft(balance Money) Money {
+	return NewMoney(max(-balance.Amount, 0), balance.Currency)
+}
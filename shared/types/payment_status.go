@@ -0,0 +1,67 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// paymentTransitions lists the statuses each payment status can move to.
+// A payment is PROCESSING once its funds are held; one whose hold fails goes
+// from PENDING straight to FAILED. Only a PENDING payment can be CANCELLED:
+// once PROCESSING the gateway may already be charging it. FAILED, CANCELLED
+// and REFUNDED are final, and so is PARTIALLY_REFUNDED while refunded
+// amounts are not tracked.
+var paymentTransitions = map[PaymentStatus][]PaymentStatus{
+	PaymentStatusPending:    {PaymentStatusProcessing, PaymentStatusFailed, PaymentStatusCancelled},
+	PaymentStatusProcessing: {PaymentStatusCompleted, PaymentStatusFailed},
+	PaymentStatusCompleted:  {PaymentStatusRefunded, PaymentStatusPartiallyRefunded},
+}
+
+// ParsePaymentStatus parses a payment status regardless of case, so the
+// lowercase statuses sent by the payment saga are accepted
+func ParsePaymentStatus(value string) (PaymentStatus, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(value))
+	normalized = strings.NewReplacer("-", "_", " ", "_").Replace(normalized)
+
+	status := PaymentStatus(normalized)
+	if !status.IsValid() {
+		return "", fmt.Errorf("invalid payment status %q", value)
+	}
+	return status, nil
+}
+
+// IsValid reports whether s is a known payment status
+func (s PaymentStatus) IsValid() bool {
+	switch s {
+	case PaymentStatusPending, PaymentStatusProcessing, PaymentStatusCompleted,
+		PaymentStatusFailed, PaymentStatusRefunded, PaymentStatusPartiallyRefunded,
+		PaymentStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// CanTransitionTo reports whether a payment in status s can move to next
+func (s PaymentStatus) CanTransitionTo(next PaymentStatus) bool {
+	for _, allowed := range paymentTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// PaymentStatusesBefore returns the statuses a payment can move to status
+// from, which is what a conditional status update checks the current
+// status against
+func PaymentStatusesBefore(status PaymentStatus) []PaymentStatus {
+	var before []PaymentStatus
+	for _, from := range []PaymentStatus{
+		PaymentStatusPending, PaymentStatusProcessing, PaymentStatusCompleted,
+	} {
+		if from.CanTransitionTo(status) {
+			before = append(before, from)
+		}
+	}
+	return before
+}
@@ -0,0 +1,52 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePaymentStatus(t *testing.T) {
+	cases := map[string]PaymentStatus{
+		"completed":          PaymentStatusCompleted,
+		"FAILED":             PaymentStatusFailed,
+		" Processing ":       PaymentStatusProcessing,
+		"partially_refunded": PaymentStatusPartiallyRefunded,
+		"partially-refunded": PaymentStatusPartiallyRefunded,
+		"cancelled":          PaymentStatusCancelled,
+	}
+
+	for input, expected := range cases {
+		status, err := ParsePaymentStatus(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, expected, status, input)
+	}
+
+	for _, input := range []string{"", "done", "refund"} {
+		_, err := ParsePaymentStatus(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestPaymentStatus_CanTransitionTo(t *testing.T) {
+	assert.True(t, PaymentStatusPending.CanTransitionTo(PaymentStatusProcessing))
+	assert.True(t, PaymentStatusPending.CanTransitionTo(PaymentStatusFailed))
+	assert.True(t, PaymentStatusProcessing.CanTransitionTo(PaymentStatusCompleted))
+	assert.True(t, PaymentStatusCompleted.CanTransitionTo(PaymentStatusPartiallyRefunded))
+	assert.True(t, PaymentStatusPending.CanTransitionTo(PaymentStatusCancelled))
+
+	assert.False(t, PaymentStatusPending.CanTransitionTo(PaymentStatusCompleted))
+	assert.False(t, PaymentStatusCompleted.CanTransitionTo(PaymentStatusPending))
+	assert.False(t, PaymentStatusCompleted.CanTransitionTo(PaymentStatusCompleted))
+	assert.False(t, PaymentStatusFailed.CanTransitionTo(PaymentStatusProcessing))
+	assert.False(t, PaymentStatusRefunded.CanTransitionTo(PaymentStatusCompleted))
+	assert.False(t, PaymentStatusProcessing.CanTransitionTo(PaymentStatusCancelled))
+	assert.False(t, PaymentStatusCancelled.CanTransitionTo(PaymentStatusProcessing))
+}
+
+func TestPaymentStatusesBefore(t *testing.T) {
+	assert.Equal(t, []PaymentStatus{PaymentStatusPending, PaymentStatusProcessing}, PaymentStatusesBefore(PaymentStatusFailed))
+	assert.Equal(t, []PaymentStatus{PaymentStatusCompleted}, PaymentStatusesBefore(PaymentStatusRefunded))
+	assert.Equal(t, []PaymentStatus{PaymentStatusPending}, PaymentStatusesBefore(PaymentStatusCancelled))
+	assert.Empty(t, PaymentStatusesBefore(PaymentStatusPending))
+}
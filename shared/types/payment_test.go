@@ -0,0 +1,73 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpendingPeriodKey(t *testing.T) {
+	// A Sunday, in the last ISO week of 2023
+	at := time.Date(2023, 12, 31, 23, 30, 0, 0, time.UTC)
+
+	cases := map[string]struct {
+		key   string
+		start time.Time
+	}{
+		SpendingPeriodDaily:   {"2023-12-31", time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC)},
+		SpendingPeriodWeekly:  {"2023-W52", time.Date(2023, 12, 25, 0, 0, 0, 0, time.UTC)},
+		SpendingPeriodMonthly: {"2023-12", time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for period, expected := range cases {
+		assert.Equal(t, expected.key, SpendingPeriodKey(period, at), period)
+		assert.Equal(t, expected.start, SpendingPeriodStart(period, at), period)
+	}
+
+	// Periods are taken in UTC
+	local := at.In(time.FixedZone("UTC+3", 3*60*60))
+	assert.Equal(t, "2023-12-31", SpendingPeriodKey(SpendingPeriodDaily, local))
+}
+
+func TestSpendingLimits_Resolve(t *testing.T) {
+	defaults := map[string]Money{
+		SpendingPeriodDaily:   NewMoney(50000, "USD"),
+		SpendingPeriodMonthly: NewMoney(500000, "USD"),
+	}
+	weekly := NewMoney(100000, "USD")
+	daily := NewMoney(20000, "USD")
+	euros := NewMoney(30000, "EUR")
+
+	cases := []struct {
+		name      string
+		overrides *SpendingLimits
+		expected  map[string]Money
+	}{
+		{
+			name:      "defaults only",
+			overrides: nil,
+			expected:  defaults,
+		},
+		{
+			name:      "overrides win",
+			overrides: &SpendingLimits{Daily: &daily, Weekly: &weekly},
+			expected: map[string]Money{
+				SpendingPeriodDaily:   daily,
+				SpendingPeriodWeekly:  weekly,
+				SpendingPeriodMonthly: NewMoney(500000, "USD"),
+			},
+		},
+		{
+			name:      "override in another currency is ignored",
+			overrides: &SpendingLimits{Daily: &euros},
+			expected:  defaults,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.overrides.Resolve(defaults, "USD"))
+		})
+	}
+}
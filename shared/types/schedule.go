@@ -0,0 +1,77 @@
+package types
+
+import "time"
+
+// ScheduleStatus is the lifecycle state of a payment schedule
+type ScheduleStatus string
+
+const (
+	// ScheduleStatusActive schedules are started by the scheduler when due
+	ScheduleStatusActive ScheduleStatus = "ACTIVE"
+
+	// ScheduleStatusPaused schedules are skipped until resumed, either on
+	// request or after too many consecutive failed runs
+	ScheduleStatusPaused ScheduleStatus = "PAUSED"
+
+	// ScheduleStatusCompleted is a one-off schedule whose payment succeeded
+	ScheduleStatusCompleted ScheduleStatus = "COMPLETED"
+
+	// ScheduleStatusCancelled schedules never run again
+	ScheduleStatusCancelled ScheduleStatus = "CANCELLED"
+)
+
+// PaymentSchedule is a payment to run later, once at RunAt, or repeatedly on a
+// cron expression or a fixed interval starting at RunAt. Each occurrence
+// starts the payment saga for Amount.
+type PaymentSchedule struct {
+	ID       string            `json:"id" dynamodbav:"ID"`
+	UserID   string            `json:"userId" dynamodbav:"UserID"`
+	Amount   Money             `json:"amount" dynamodbav:"Amount"`
+	Metadata map[string]string `json:"metadata,omitempty" dynamodbav:"Metadata,omitempty"`
+	RunAt    time.Time         `json:"runAt" dynamodbav:"RunAt"`
+	Cron     string            `json:"cron,omitempty" dynamodbav:"Cron,omitempty"`
+	Interval string            `json:"interval,omitempty" dynamodbav:"Interval,omitempty"`
+	Status   ScheduleStatus    `json:"status" dynamodbav:"Status"`
+
+	// NextRunAt is the next occurrence. It is unset while a one-off
+	// schedule's run is in progress and once it has completed.
+	NextRunAt *time.Time `json:"nextRunAt,omitempty" dynamodbav:"NextRunAt,omitempty"`
+
+	MaxFailures         int               `json:"maxFailures" dynamodbav:"MaxFailures"`
+	ConsecutiveFailures int               `json:"consecutiveFailures" dynamodbav:"ConsecutiveFailures"`
+	LastRunAt           *time.Time        `json:"lastRunAt,omitempty" dynamodbav:"LastRunAt,omitempty"`
+	LastRunStatus       ScheduleRunStatus `json:"lastRunStatus,omitempty" dynamodbav:"LastRunStatus,omitempty"`
+	Version             int64             `json:"version" dynamodbav:"Version"`
+	CreatedAt           time.Time         `json:"createdAt" dynamodbav:"CreatedAt"`
+	UpdatedAt           time.Time         `json:"updatedAt" dynamodbav:"UpdatedAt"`
+}
+
+// Recurring reports whether the schedule has more than one occurrence
+func (s *PaymentSchedule) Recurring() bool {
+	return s.Cron != "" || s.Interval != ""
+}
+
+// ScheduleRunStatus is the outcome of one occurrence of a payment schedule
+type ScheduleRunStatus string
+
+const (
+	ScheduleRunStatusRunning   ScheduleRunStatus = "RUNNING"
+	ScheduleRunStatusSucceeded ScheduleRunStatus = "SUCCEEDED"
+	ScheduleRunStatusFailed    ScheduleRunStatus = "FAILED"
+)
+
+// ScheduleRun records one occurrence of a payment schedule and the saga
+// execution it started. IdempotencyKey is derived from the schedule and the
+// occurrence, and is passed to the saga as the payment's idempotency key.
+type ScheduleRun struct {
+	ScheduleID     string            `json:"scheduleId" dynamodbav:"ScheduleID"`
+	OccurrenceAt   time.Time         `json:"occurrenceAt" dynamodbav:"OccurrenceAt"`
+	UserID         string            `json:"userId" dynamodbav:"UserID"`
+	Amount         Money             `json:"amount" dynamodbav:"Amount"`
+	Status         ScheduleRunStatus `json:"status" dynamodbav:"Status"`
+	IdempotencyKey string            `json:"idempotencyKey" dynamodbav:"IdempotencyKey"`
+	ExecutionArn   string            `json:"executionArn,omitempty" dynamodbav:"ExecutionArn,omitempty"`
+	Error          string            `json:"error,omitempty" dynamodbav:"Error,omitempty"`
+	StartedAt      time.Time         `json:"startedAt" dynamodbav:"StartedAt"`
+	FinishedAt     *time.Time        `json:"finishedAt,omitempty" dynamodbav:"FinishedAt,omitempty"`
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	key := map[string]*dynamodb.AttributeValue{
+		"ID":        {S: aws.String("tx-1")},
+		"UserID":    {S: aws.String("user123")},
+		"Timestamp": {S: aws.String("2024-01-15T10:30:00Z")},
+	}
+
+	cursor, err := EncodeCursor(key)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, cursor)
+
+	decoded, err := DecodeCursor(cursor)
+	assert.NoError(t, err)
+	assert.Equal(t, "tx-1", aws.StringValue(decoded["ID"].S))
+	assert.Equal(t, "user123", aws.StringValue(decoded["UserID"].S))
+	assert.Equal(t, "2024-01-15T10:30:00Z", aws.StringValue(decoded["Timestamp"].S))
+}
+
+func TestCursor_Empty(t *testing.T) {
+	cursor, err := EncodeCursor(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", cursor)
+
+	key, err := DecodeCursor("")
+	assert.NoError(t, err)
+	assert.Nil(t, key)
+}
+
+func TestDecodeCursor_Invalid(t *testing.T) {
+	for _, cursor := range []string{"not base64!", "bm90LWpzb24", "e30"} {
+		_, err := DecodeCursor(cursor)
+		assert.Error(t, err, cursor)
+	}
+}
@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/draftea-coding-challenge/shared/types"
+)
+
+// MoneyFromInput decodes a types.Money from a loosely typed Step Function
+// input value such as input["amount"]. Missing values decode to the zero Money.
+func MoneyFromInput(value interface{}) (types.Money, error) {
+	var money types.Money
+	if value == nil {
+		return money, nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return money, fmt.Errorf("invalid amount: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &money); err != nil {
+		return money, fmt.Errorf("invalid amount: %w", err)
+	}
+
+	return types.NewMoney(money.Amount, money.Currency), nil
+}
@@ -45,6 +45,25 @@ func ErrorResponse(statusCode int, message string) (events.APIGatewayProxyRespon
 	}, nil
 }
 
+// AppErrorResponse creates an error API response from an AppError, with its
+// status code, code and details
+func AppErrorResponse(appErr *errors.AppError) (events.APIGatewayProxyResponse, error) {
+	response := map[string]interface{}{
+		"success": false,
+		"error":   appErr.Message,
+		"code":    appErr.Code,
+	}
+	if len(appErr.Details) > 0 {
+		response["details"] = appErr.Details
+	}
+
+	body, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: appErr.StatusCode,
+		Body:       string(body),
+	}, nil
+}
+
 // SuccessResponse creates a success API response with status code
 func SuccessResponse(statusCode int, data interface{}) (events.APIGatewayProxyResponse, error) {
 	response := map[string]interface{}{
@@ -5,15 +5,19 @@ import (
 	"strings"
 
 	"github.com/draftea-coding-challenge/shared/errors"
+	"github.com/draftea-coding-challenge/shared/types"
 )
 
+// maxPaymentAmount is the largest payment accepted, in major units
+const maxPaymentAmount = 1000000
+
 var (
 	emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
 	uuidRegex  = regexp.MustCompile(`^[a-fA-F0-9]{8}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{4}-[a-fA-F0-9]{12}$`)
 )
 
 // ValidatePaymentRequest validates payment request data
-func ValidatePaymentRequest(paymentID, userID string, amount float64) error {
+func ValidatePaymentRequest(paymentID, userID string, amount types.Money) error {
 	validationErrors := make(map[string]interface{})
 
 	if paymentID == "" {
@@ -24,11 +28,15 @@ func ValidatePaymentRequest(paymentID, userID string, amount float64) error {
 		validationErrors["user_id"] = "User ID is required"
 	}
 
-	if amount <= 0 {
+	if !amount.IsPositive() {
 		validationErrors["amount"] = "Amount must be greater than 0"
 	}
 
-	if amount > 1000000 {
+	if len(amount.Currency) != 3 {
+		validationErrors["currency"] = "Currency must be a 3-letter ISO code"
+	}
+
+	if exceedsMaxPayment(amount) {
 		validationErrors["amount"] = "Amount exceeds maximum limit"
 	}
 
@@ -39,6 +47,15 @@ func ValidatePaymentRequest(paymentID, userID string, amount float64) error {
 	return nil
 }
 
+// exceedsMaxPayment reports whether amount is above maxPaymentAmount in its own currency
+func exceedsMaxPayment(amount types.Money) bool {
+	limit := int64(maxPaymentAmount)
+	for i := 0; i < types.CurrencyExponent(amount.Currency); i++ {
+		limit *= 10
+	}
+	return amount.Amount > limit
+}
+
 // ValidateEmail validates email format
 func ValidateEmail(email string) bool {
 	return emailRegex.MatchString(email)